@@ -2,6 +2,8 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"path"
 	"time"
 
 	"github.com/go-graphite/carbonapi/cache"
@@ -27,6 +29,12 @@ type CacheConfig struct {
 	Size              int      `mapstructure:"size_mb"`
 	MemcachedServers  []string `mapstructure:"memcachedServers"`
 	DefaultTimeoutSec int32    `mapstructure:"defaultTimeoutSec"`
+	// TTL for empty responses, only used by findCache. 0 - empty responses are not cached
+	NegativeTimeoutSec int32 `mapstructure:"negativeTimeoutSec"`
+	// TTL for responses with now-anchored time range (e.x. from=-1h), used by cache and backendCache. 0 - defaultTimeoutSec is used
+	RelativeRangeTimeoutSec int32 `mapstructure:"relativeRangeTimeoutSec"`
+	// TTL for responses with absolute time range that ended in the past, used by cache and backendCache. 0 - defaultTimeoutSec is used
+	AbsoluteRangeTimeoutSec int32 `mapstructure:"absoluteRangeTimeoutSec"`
 }
 
 type GraphiteConfig struct {
@@ -47,41 +55,124 @@ type ExpvarConfig struct {
 	PProfEnabled bool   `mapstructure:"pprofEnabled"`
 }
 
+type HealthCheckConfig struct {
+	// Fraction of backend groups that must be reachable for deep health check to pass. 0 - all of them
+	Quorum float64 `mapstructure:"quorum"`
+}
+
+type FunctionsAccessRule struct {
+	// Functions (names or glob patterns, e.x. "holtWinters*") that are allowed. Empty - all functions are allowed
+	Allow []string `mapstructure:"allow"`
+	// Functions (names or glob patterns) that are forbidden, even if they are allowed by Allow
+	Deny []string `mapstructure:"deny"`
+}
+
+// Forbidden returns first of the functions that is not allowed by the rule, or empty string if all of them are allowed
+func (r FunctionsAccessRule) Forbidden(functions []string) string {
+	for _, f := range functions {
+		if len(r.Allow) > 0 && !matchFunction(r.Allow, f) {
+			return f
+		}
+		if matchFunction(r.Deny, f) {
+			return f
+		}
+	}
+	return ""
+}
+
+// Validate checks that all patterns of the rule are valid
+func (r FunctionsAccessRule) Validate() error {
+	for _, pattern := range append(append([]string{}, r.Allow...), r.Deny...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%s: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchFunction(patterns []string, function string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, function); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type FunctionsAccessConfig struct {
+	Allow []string `mapstructure:"allow"`
+	Deny  []string `mapstructure:"deny"`
+	// Header with API key of the client
+	APIKeyHeader string `mapstructure:"apiKeyHeader"`
+	// Rules for specific API keys, they replace default rule
+	APIKeys map[string]FunctionsAccessRule `mapstructure:"apiKeys"`
+}
+
+// Rule returns access rule for the API key
+func (c FunctionsAccessConfig) Rule(apiKey string) FunctionsAccessRule {
+	if rule, ok := c.APIKeys[apiKey]; ok && apiKey != "" {
+		return rule
+	}
+	return FunctionsAccessRule{Allow: c.Allow, Deny: c.Deny}
+}
+
+// Enabled returns true if any access rule is configured
+func (c FunctionsAccessConfig) Enabled() bool {
+	return len(c.Allow) > 0 || len(c.Deny) > 0 || len(c.APIKeys) > 0
+}
+
+type PushdownConfig struct {
+	// Functions that backends are asked to evaluate by themselves
+	Functions []string `mapstructure:"functions"`
+}
+
 type ConfigType struct {
-	ExtrapolateExperiment      bool               `mapstructure:"extrapolateExperiment"`
-	Logger                     []zapwriter.Config `mapstructure:"logger"`
-	Listen                     string             `mapstructure:"listen"`
-	Buckets                    int                `mapstructure:"buckets"`
-	Concurency                 int                `mapstructure:"concurency"`
-	ResponseCacheConfig        CacheConfig        `mapstructure:"cache"`
-	BackendCacheConfig         CacheConfig        `mapstructure:"backendCache"`
-	Cpus                       int                `mapstructure:"cpus"`
-	TimezoneString             string             `mapstructure:"tz"`
-	UnicodeRangeTables         []string           `mapstructure:"unicodeRangeTables"`
-	Graphite                   GraphiteConfig     `mapstructure:"graphite"`
-	IdleConnections            int                `mapstructure:"idleConnections"`
-	PidFile                    string             `mapstructure:"pidFile"`
-	SendGlobsAsIs              *bool              `mapstructure:"sendGlobsAsIs"`
-	AlwaysSendGlobsAsIs        *bool              `mapstructure:"alwaysSendGlobsAsIs"`
-	MaxBatchSize               int                `mapstructure:"maxBatchSize"`
-	Zipper                     string             `mapstructure:"zipper"`
-	Upstreams                  zipperCfg.Config   `mapstructure:"upstreams"`
-	ExpireDelaySec             int32              `mapstructure:"expireDelaySec"`
-	GraphiteWeb09Compatibility bool               `mapstructure:"graphite09compat"`
-	IgnoreClientTimeout        bool               `mapstructure:"ignoreClientTimeout"`
-	DefaultColors              map[string]string  `mapstructure:"defaultColors"`
-	GraphTemplates             string             `mapstructure:"graphTemplates"`
-	FunctionsConfigs           map[string]string  `mapstructure:"functionsConfig"`
-	HeadersToPass              []string           `mapstructure:"headersToPass"`
-	HeadersToLog               []string           `mapstructure:"headersToLog"`
-	Define                     []Define           `mapstructure:"define"`
-	Prefix                     string             `mapstructure:"prefix"`
-	Expvar                     ExpvarConfig       `mapstructure:"expvar"`
-	NotFoundStatusCode         int                `mapstructure:"notFoundStatusCode"`
-	HTTPResponseStackTrace     bool               `mapstructure:"httpResponseStackTrace"`
+	ExtrapolateExperiment      bool                  `mapstructure:"extrapolateExperiment"`
+	Logger                     []zapwriter.Config    `mapstructure:"logger"`
+	Listen                     string                `mapstructure:"listen"`
+	Buckets                    int                   `mapstructure:"buckets"`
+	Concurency                 int                   `mapstructure:"concurency"`
+	ResponseCacheConfig        CacheConfig           `mapstructure:"cache"`
+	BackendCacheConfig         CacheConfig           `mapstructure:"backendCache"`
+	FindCacheConfig            CacheConfig           `mapstructure:"findCache"`
+	Cpus                       int                   `mapstructure:"cpus"`
+	TimezoneString             string                `mapstructure:"tz"`
+	UnicodeRangeTables         []string              `mapstructure:"unicodeRangeTables"`
+	Graphite                   GraphiteConfig        `mapstructure:"graphite"`
+	IdleConnections            int                   `mapstructure:"idleConnections"`
+	PidFile                    string                `mapstructure:"pidFile"`
+	SendGlobsAsIs              *bool                 `mapstructure:"sendGlobsAsIs"`
+	AlwaysSendGlobsAsIs        *bool                 `mapstructure:"alwaysSendGlobsAsIs"`
+	MaxBatchSize               int                   `mapstructure:"maxBatchSize"`
+	Zipper                     string                `mapstructure:"zipper"`
+	Upstreams                  zipperCfg.Config      `mapstructure:"upstreams"`
+	ExpireDelaySec             int32                 `mapstructure:"expireDelaySec"`
+	GraphiteWeb09Compatibility bool                  `mapstructure:"graphite09compat"`
+	IgnoreClientTimeout        bool                  `mapstructure:"ignoreClientTimeout"`
+	DefaultColors              map[string]string     `mapstructure:"defaultColors"`
+	GraphTemplates             string                `mapstructure:"graphTemplates"`
+	FunctionsConfigs           map[string]string     `mapstructure:"functionsConfig"`
+	HeadersToPass              []string              `mapstructure:"headersToPass"`
+	HeadersToLog               []string              `mapstructure:"headersToLog"`
+	Define                     []Define              `mapstructure:"define"`
+	Prefix                     string                `mapstructure:"prefix"`
+	Expvar                     ExpvarConfig          `mapstructure:"expvar"`
+	NotFoundStatusCode         int                   `mapstructure:"notFoundStatusCode"`
+	HTTPResponseStackTrace     bool                  `mapstructure:"httpResponseStackTrace"`
+	JSONEnvelope               bool                  `mapstructure:"jsonEnvelope"`
+	MaxSeries                  int                   `mapstructure:"maxSeries"`
+	MaxSeriesNameLength        int                   `mapstructure:"maxSeriesNameLength"`
+	HealthCheck                HealthCheckConfig     `mapstructure:"healthCheck"`
+	RollupSelection            bool                  `mapstructure:"rollupSelection"`
+	MaxCost                    int64                 `mapstructure:"maxCost"`
+	FunctionsAccess            FunctionsAccessConfig `mapstructure:"functionsAccess"`
+	MaxNestingDepth            int                   `mapstructure:"maxNestingDepth"`
+	Pushdown                   PushdownConfig        `mapstructure:"pushdown"`
+	IgnoreTagTruncation        bool                  `mapstructure:"ignoreTagTruncation"`
 
 	ResponseCache cache.BytesCache `mapstructure:"-" json:"-"`
 	BackendCache  cache.BytesCache `mapstructure:"-" json:"-"`
+	FindCache     cache.BytesCache `mapstructure:"-" json:"-"`
 
 	DefaultTimeZone *time.Location `mapstructure:"-" json:"-"`
 
@@ -116,6 +207,10 @@ var Config = ConfigType{
 		Type:              "null",
 		DefaultTimeoutSec: 0,
 	},
+	FindCacheConfig: CacheConfig{
+		Type:              "null",
+		DefaultTimeoutSec: 0,
+	},
 	TimezoneString: "",
 	Graphite: GraphiteConfig{
 		Pattern:  "{prefix}.{fqdn}",
@@ -129,6 +224,7 @@ var Config = ConfigType{
 
 	ResponseCache: cache.NullCache{},
 	BackendCache:  cache.NullCache{},
+	FindCache:     cache.NullCache{},
 
 	DefaultTimeZone: time.Local,
 	Logger:          []zapwriter.Config{DefaultLoggerConfig},
@@ -153,4 +249,5 @@ var Config = ConfigType{
 	},
 	NotFoundStatusCode:     200,
 	HTTPResponseStackTrace: true,
+	MaxNestingDepth:        100,
 }
@@ -32,6 +32,7 @@ var graphTemplates map[string]png.PictureParams
 func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 	Config.ResponseCacheConfig.MemcachedServers = viper.GetStringSlice("cache.memcachedServers")
 	Config.BackendCacheConfig.MemcachedServers = viper.GetStringSlice("backendCache.memcachedServers")
+	Config.FindCacheConfig.MemcachedServers = viper.GetStringSlice("findCache.memcachedServers")
 	if n := viper.GetString("logger.logger"); n != "" {
 		Config.Logger[0].Logger = n
 	}
@@ -159,6 +160,7 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 
 	Config.ResponseCache = createCache(logger, "cache", Config.ResponseCacheConfig)
 	Config.BackendCache = createCache(logger, "backendCache", Config.BackendCacheConfig)
+	Config.FindCache = createCache(logger, "findCache", Config.FindCacheConfig)
 
 	if Config.TimezoneString != "" {
 		fields := strings.Split(Config.TimezoneString, ",")
@@ -186,6 +188,8 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 		)
 	}
 
+	parser.MaxDepth = Config.MaxNestingDepth
+
 	if len(Config.UnicodeRangeTables) != 0 {
 		if strings.ToLower(Config.UnicodeRangeTables[0]) == "all" {
 			for _, t := range unicode.Scripts {
@@ -228,12 +232,26 @@ func SetUpConfig(logger *zap.Logger, BuildVersion string) {
 	}
 
 	helper.ExtrapolatePoints = Config.ExtrapolateExperiment
+	helper.DefaultTimeZone = Config.DefaultTimeZone
 	if Config.ExtrapolateExperiment {
 		logger.Warn("extraploation experiment is enabled",
 			zap.String("reason", "this feature is highly experimental and untested"),
 		)
 	}
 
+	if err := Config.FunctionsAccess.Rule("").Validate(); err != nil {
+		logger.Fatal("invalid functionsAccess pattern",
+			zap.Error(err),
+		)
+	}
+	for _, rule := range Config.FunctionsAccess.APIKeys {
+		if err := rule.Validate(); err != nil {
+			logger.Fatal("invalid functionsAccess pattern",
+				zap.Error(err),
+			)
+		}
+	}
+
 	for _, define := range Config.Define {
 		if define.Name == "" {
 			logger.Fatal("empty define name")
@@ -15,7 +15,9 @@ import (
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/date"
 	"github.com/go-graphite/carbonapi/intervalset"
+	"github.com/go-graphite/carbonapi/pkg/parser"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pbv2 "github.com/go-graphite/protocol/carbonapi_v2_pb"
 	pbv3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	pickle "github.com/lomik/og-rek"
@@ -36,6 +38,22 @@ type treejson struct {
 
 var treejsonContext = make(map[string]int)
 
+// findCacheBackendsKey identifies set of backends, so entries of instances with different backends sharing the same
+// find cache are kept apart
+var findCacheBackendsKey string
+
+func computeBackendsKey() string {
+	groups := make([]string, 0, len(config.Config.Upstreams.BackendsV2.Backends))
+	for _, backend := range config.Config.Upstreams.BackendsV2.Backends {
+		servers := make([]string, len(backend.Servers))
+		copy(servers, backend.Servers)
+		sort.Strings(servers)
+		groups = append(groups, backend.GroupName+"="+strings.Join(servers, "|"))
+	}
+	sort.Strings(groups)
+	return strings.Join(groups, ";")
+}
+
 func findTreejson(multiGlobs *pbv3.MultiGlobResponse) ([]byte, error) {
 	var b bytes.Buffer
 
@@ -264,10 +282,23 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	multiGlobs, stats, err := config.Config.ZipperInstance.Find(ctx, pv3Request)
-	if stats != nil {
-		accessLogDetails.ZipperRequests = stats.ZipperRequests
-		accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
+	useCache := !parser.TruthyBool(r.FormValue("noCache"))
+	findCacheKey := findCacheComputeKey(from, until, pv3Request.Metrics)
+	multiGlobs, fromCache := findCacheFetchResults(useCache, findCacheKey)
+	accessLogDetails.UseCache = useCache
+	accessLogDetails.FromCache = fromCache
+
+	var err merry.Error
+	if !fromCache {
+		var stats *zipperTypes.Stats
+		multiGlobs, stats, err = config.Config.ZipperInstance.Find(ctx, pv3Request)
+		if stats != nil {
+			accessLogDetails.ZipperRequests = stats.ZipperRequests
+			accessLogDetails.TotalMetricsCount += stats.TotalMetricsCount
+		}
+		if err == nil {
+			findCacheStoreResults(findCacheKey, multiGlobs)
+		}
 	}
 	if err != nil {
 		returnCode := merry.HTTPCode(err)
@@ -326,7 +357,7 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 		err = merry.Wrap(err2)
 	case pickleFormat:
 		var result []map[string]interface{}
-		now := int32(time.Now().Unix() + 60)
+		now := int32(timeNow().Unix() + 60)
 		for _, globs := range multiGlobs.Metrics {
 			for _, metric := range globs.Matches {
 				if strings.HasPrefix(metric.Path, "_tag") {
@@ -370,3 +401,73 @@ func findHandler(w http.ResponseWriter, r *http.Request) {
 
 	writeResponse(w, http.StatusOK, b, format, jsonp)
 }
+
+func findCacheComputeKey(from, until string, queries []string) string {
+	normalized := make([]string, len(queries))
+	copy(normalized, queries)
+	sort.Strings(normalized)
+
+	var findCacheKey bytes.Buffer
+	findCacheKey.WriteString("backends:")
+	findCacheKey.WriteString(findCacheBackendsKey)
+	findCacheKey.WriteString(" from:")
+	findCacheKey.WriteString(from)
+	findCacheKey.WriteString(" until:")
+	findCacheKey.WriteString(until)
+	findCacheKey.WriteString(" queries:")
+	findCacheKey.WriteString(strings.Join(normalized, ","))
+	return findCacheKey.String()
+}
+
+// findCacheFetchResults returns cached find response. Empty response could be returned from cache as well
+// if negative caching is enabled
+func findCacheFetchResults(useCache bool, findCacheKey string) (*pbv3.MultiGlobResponse, bool) {
+	if !useCache {
+		return nil, false
+	}
+
+	b, err := config.Config.FindCache.Get(findCacheKey)
+	if err != nil {
+		ApiMetrics.FindCacheMisses.Add(1)
+		return nil, false
+	}
+
+	var multiGlobs pbv3.MultiGlobResponse
+	err = multiGlobs.Unmarshal(b)
+	if err != nil {
+		ApiMetrics.FindCacheMisses.Add(1)
+		return nil, false
+	}
+
+	ApiMetrics.FindCacheHits.Add(1)
+	return &multiGlobs, true
+}
+
+func findCacheStoreResults(findCacheKey string, multiGlobs *pbv3.MultiGlobResponse) {
+	empty := true
+	if multiGlobs != nil {
+		for _, globs := range multiGlobs.Metrics {
+			if len(globs.Matches) > 0 {
+				empty = false
+				break
+			}
+		}
+	}
+
+	timeout := config.Config.FindCacheConfig.DefaultTimeoutSec
+	if empty {
+		timeout = config.Config.FindCacheConfig.NegativeTimeoutSec
+	}
+	if timeout <= 0 {
+		return
+	}
+
+	if multiGlobs == nil {
+		multiGlobs = &pbv3.MultiGlobResponse{}
+	}
+	b, err := multiGlobs.Marshal()
+	if err != nil {
+		return
+	}
+	config.Config.FindCache.Set(findCacheKey, b, timeout)
+}
@@ -0,0 +1,100 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/go-graphite/carbonapi/carbonapipb"
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	"github.com/lomik/zapwriter"
+	"go.uber.org/zap"
+)
+
+type backendHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status    string                   `json:"status"`
+	Reachable int                      `json:"reachable,omitempty"`
+	Quorum    int                      `json:"quorum,omitempty"`
+	Backends  map[string]backendHealth `json:"backends,omitempty"`
+}
+
+const (
+	healthOk   = "ok"
+	healthFail = "fail"
+)
+
+// healthHandler answers if carbonapi is alive. With deep=true it also probes all backend groups and answers 200 only if
+// at least healthCheck.quorum of them are reachable
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	t0 := time.Now()
+	accessLogger := zapwriter.Logger("access")
+
+	srcIP, srcPort := splitRemoteAddr(r.RemoteAddr)
+	var accessLogDetails = carbonapipb.AccessLogDetails{
+		Handler:  "health",
+		URL:      r.URL.RequestURI(),
+		PeerIP:   srcIP,
+		PeerPort: srcPort,
+		Host:     r.Host,
+		Referer:  r.Referer(),
+		URI:      r.RequestURI,
+	}
+
+	response := healthResponse{Status: healthOk}
+	if parser.TruthyBool(r.FormValue("deep")) {
+		ctx, cancel := context.WithTimeout(r.Context(), config.Config.Upstreams.Timeouts.Find)
+		probes := config.Config.ZipperInstance.ProbeBackends(ctx)
+		cancel()
+
+		response.Backends = make(map[string]backendHealth, len(probes))
+		for name, err := range probes {
+			if err != nil {
+				response.Backends[name] = backendHealth{Status: healthFail, Error: err.Error()}
+				continue
+			}
+			response.Reachable++
+			response.Backends[name] = backendHealth{Status: healthOk}
+		}
+
+		response.Quorum = healthQuorum(len(probes))
+		if response.Reachable < response.Quorum {
+			response.Status = healthFail
+		}
+	}
+
+	code := http.StatusOK
+	if response.Status != healthOk {
+		code = http.StatusServiceUnavailable
+		accessLogDetails.Reason = "not enough reachable backends"
+	}
+
+	body, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", contentTypeJSON)
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+
+	accessLogDetails.Runtime = time.Since(t0).Seconds()
+	accessLogDetails.HTTPCode = int32(code)
+	if code != http.StatusOK {
+		accessLogger.Error("request failed", zap.Any("data", accessLogDetails))
+	} else {
+		accessLogger.Info("request served", zap.Any("data", accessLogDetails))
+	}
+}
+
+// healthQuorum returns amount of backend groups out of total that must be reachable
+func healthQuorum(total int) int {
+	quorum := config.Config.HealthCheck.Quorum
+	if quorum <= 0 || quorum > 1 {
+		quorum = 1
+	}
+	return int(math.Ceil(quorum * float64(total)))
+}
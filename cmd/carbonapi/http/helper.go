@@ -1,14 +1,18 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"sort"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/go-graphite/carbonapi/carbonapipb"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/metadata"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	"github.com/lomik/zapwriter"
 	"go.uber.org/zap"
@@ -19,6 +23,11 @@ type responseFormat int
 // for testing
 var timeNow = time.Now
 
+// SetTimeNow overrides the source of current time, it's used for default and relative time ranges of requests
+func SetTimeNow(now func() time.Time) {
+	timeNow = now
+}
+
 const (
 	jsonFormat responseFormat = iota
 	treejsonFormat
@@ -30,6 +39,7 @@ const (
 	protoV3Format
 	pickleFormat
 	completerFormat
+	ndjsonFormat
 )
 
 func (r responseFormat) String() string {
@@ -54,6 +64,8 @@ func (r responseFormat) String() string {
 		return "svg"
 	case completerFormat:
 		return "completer"
+	case ndjsonFormat:
+		return "ndjson"
 	default:
 		return "unknown"
 	}
@@ -100,6 +112,8 @@ func (r responseFormat) ValidRenderFormat() bool {
 		return true
 	case rawFormat:
 		return true
+	case ndjsonFormat:
+		return true
 	default:
 		return false
 	}
@@ -118,6 +132,7 @@ var knownFormats = map[string]responseFormat{
 	"raw":             rawFormat,
 	"svg":             svgFormat,
 	"completer":       completerFormat,
+	"ndjson":          ndjsonFormat,
 }
 
 const (
@@ -129,8 +144,18 @@ const (
 	contentTypePNG        = "image/png"
 	contentTypeCSV        = "text/csv"
 	contentTypeSVG        = "image/svg+xml"
+	contentTypeNDJSON     = "application/x-ndjson"
 )
 
+// cacheStatusHeader tells if render response was served from response cache (HIT) or not (MISS)
+const cacheStatusHeader = "X-Cache"
+
+// partialFailureHeader contains amount of failed targets and backends, when render response still has some series
+const partialFailureHeader = "X-Carbonapi-Partial-Failure"
+
+// backendsHeader contains amount of backends that served series of render response, it's set when meta is requested
+const backendsHeader = "X-Carbonapi-Backends"
+
 func getFormat(r *http.Request, defaultFormat responseFormat) (responseFormat, bool, string) {
 	format := r.FormValue("format")
 
@@ -146,6 +171,15 @@ func getFormat(r *http.Request, defaultFormat responseFormat) (responseFormat, b
 	return f, ok, format
 }
 
+// indentJSON returns indented copy of JSON body, or body as is if it's not a valid JSON
+func indentJSON(body []byte) []byte {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, body, "", "  "); err != nil {
+		return body
+	}
+	return buf.Bytes()
+}
+
 func writeResponse(w http.ResponseWriter, returnCode int, b []byte, format responseFormat, jsonp string) {
 	//TODO: Simplify that switch
 	switch format {
@@ -230,10 +264,160 @@ func buildParseErrorString(target, e string, err error) string {
 		msg += fmt.Sprintf("%-20s: %s\n%-20s: %s\n",
 			"Parsed so far", target[0:len(target)-len(e)],
 			"Could not parse", e)
+		msg += fmt.Sprintf("%-20s: %d\n%-20s: %s\n",
+			"Position", len(target)-len(e),
+			"Offending token", offendingToken(e))
+	}
+	return msg
+}
+
+// forbiddenFunction returns first function called in the expression that is forbidden for the client by functionsAccess
+// config, or empty string if all of them are allowed
+func forbiddenFunction(r *http.Request, e parser.Expr) string {
+	access := config.Config.FunctionsAccess
+	if !access.Enabled() {
+		return ""
+	}
+
+	var functions []string
+	var walk func(e parser.Expr)
+	walk = func(e parser.Expr) {
+		if !e.IsFunc() {
+			return
+		}
+		functions = append(functions, e.Target())
+		for _, arg := range e.Args() {
+			walk(arg)
+		}
+		for _, arg := range e.NamedArgs() {
+			walk(arg)
+		}
+	}
+	walk(e)
+
+	var apiKey string
+	if access.APIKeyHeader != "" {
+		apiKey = r.Header.Get(access.APIKeyHeader)
+	}
+	return access.Rule(apiKey).Forbidden(functions)
+}
+
+func buildForbiddenFunctionErrorString(target, name string) string {
+	msg := fmt.Sprintf("%s\n\n%-20s: %s\n%-20s: function %q is not allowed\n",
+		http.StatusText(http.StatusForbidden),
+		"Target", target,
+		"Error", name)
+	if pos := strings.Index(target, name+"("); pos >= 0 {
+		msg += fmt.Sprintf("%-20s: %d\n%-20s: %s\n",
+			"Position", pos,
+			"Offending token", name)
 	}
 	return msg
 }
 
+func buildUnknownFunctionErrorString(target, name string) string {
+	msg := fmt.Sprintf("%s\n\n%-20s: %s\n%-20s: unknown function %q\n",
+		http.StatusText(http.StatusBadRequest),
+		"Target", target,
+		"Error", name)
+	if pos := strings.Index(target, name+"("); pos >= 0 {
+		msg += fmt.Sprintf("%-20s: %d\n%-20s: %s\n",
+			"Position", pos,
+			"Offending token", name)
+	}
+	if suggestions := suggestFunctions(name); len(suggestions) > 0 {
+		msg += fmt.Sprintf("%-20s: %s\n", "Did you mean", strings.Join(suggestions, ", "))
+	}
+	return msg
+}
+
+// offendingToken returns first token of the unparsed part of the target
+func offendingToken(e string) string {
+	e = strings.TrimLeft(e, " ")
+	if e == "" {
+		return ""
+	}
+	end := strings.IndexAny(e, "(),|=' \"")
+	switch end {
+	case -1:
+		return e
+	case 0:
+		return e[:1]
+	}
+	return e[:end]
+}
+
+const maxFunctionSuggestions = 3
+
+// suggestFunctions returns up to maxFunctionSuggestions known functions closest to name by edit distance
+func suggestFunctions(name string) []string {
+	type suggestion struct {
+		name     string
+		distance int
+	}
+
+	// allow roughly one typo per 5 characters, but at least one
+	maxDistance := 1 + len(name)/5
+	nameLower := strings.ToLower(name)
+
+	metadata.FunctionMD.RLock()
+	var suggestions []suggestion
+	for f := range metadata.FunctionMD.Functions {
+		if f == name {
+			continue
+		}
+		d := editDistance(nameLower, strings.ToLower(f))
+		if d <= maxDistance {
+			suggestions = append(suggestions, suggestion{name: f, distance: d})
+		}
+	}
+	metadata.FunctionMD.RUnlock()
+
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].distance != suggestions[j].distance {
+			return suggestions[i].distance < suggestions[j].distance
+		}
+		return suggestions[i].name < suggestions[j].name
+	})
+	if len(suggestions) > maxFunctionSuggestions {
+		suggestions = suggestions[:maxFunctionSuggestions]
+	}
+
+	res := make([]string, 0, len(suggestions))
+	for _, s := range suggestions {
+		res = append(res, s.name)
+	}
+	return res
+}
+
+// editDistance returns Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
 func deferredAccessLogging(accessLogger *zap.Logger, accessLogDetails *carbonapipb.AccessLogDetails, t time.Time, logAsError bool) {
 	accessLogDetails.Runtime = time.Since(t).Seconds()
 	if logAsError {
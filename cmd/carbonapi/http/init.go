@@ -11,6 +11,8 @@ import (
 )
 
 func InitHandlers(headersToPass, headersToLog []string) *http.ServeMux {
+	findCacheBackendsKey = computeBackendsKey()
+
 	r := http.NewServeMux()
 	r.HandleFunc(config.Config.Prefix+"/render/", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(renderHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
 	r.HandleFunc(config.Config.Prefix+"/render", httputil.TrackConnections(httputil.TimeHandler(enrichContextWithHeaders(headersToPass, headersToLog, ctx.ParseCtx(renderHandler, ctx.HeaderUUIDAPI)), bucketRequestTimes)))
@@ -23,6 +25,8 @@ func InitHandlers(headersToPass, headersToLog []string) *http.ServeMux {
 
 	r.HandleFunc(config.Config.Prefix+"/lb_check", lbcheckHandler)
 
+	r.HandleFunc(config.Config.Prefix+"/health", healthHandler)
+
 	r.HandleFunc(config.Config.Prefix+"/version", versionHandler)
 	r.HandleFunc(config.Config.Prefix+"/version/", versionHandler)
 
@@ -1,16 +1,28 @@
 package http
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"math"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/cache"
+	"github.com/go-graphite/carbonapi/date"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	"github.com/go-graphite/carbonapi/expr/types"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	realZipper "github.com/go-graphite/carbonapi/zipper"
+	zipperConfig "github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
 	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"github.com/lomik/zapwriter"
@@ -19,11 +31,18 @@ import (
 
 type mockCarbonZipper struct{}
 
+// mockFindRequests counts Find calls to mockCarbonZipper
+var mockFindRequests int64
+
 func newMockCarbonZipper() *mockCarbonZipper {
 	return new(mockCarbonZipper)
 }
 
 func (z mockCarbonZipper) Find(ctx context.Context, request pb.MultiGlobRequest) (*pb.MultiGlobResponse, *zipperTypes.Stats, merry.Error) {
+	atomic.AddInt64(&mockFindRequests, 1)
+	if request.Metrics[0] == "foo.missing" {
+		return &pb.MultiGlobResponse{Metrics: []pb.GlobResponse{{Name: "foo.missing"}}}, nil, nil
+	}
 	return getGlobResponse(), nil, nil
 }
 
@@ -34,7 +53,25 @@ func (z mockCarbonZipper) Info(ctx context.Context, metrics []string) (*pb.Zippe
 }
 
 func (z mockCarbonZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
-	return z.RenderCompat(ctx, []string{""}, 0, 0)
+	if len(request.Metrics) > 0 && request.Metrics[0].PathExpression == "foo.partial" {
+		multiFetchResponse := getMultiFetchResponse()
+		multiFetchResponse.Metrics[0].PathExpression = "foo.partial"
+		result := []*types.MetricData{{FetchResponse: multiFetchResponse.Metrics[0]}}
+		return result, nil, merry.New("backend2 failed").WithHTTPCode(200)
+	}
+	if len(request.Metrics) > 0 && request.Metrics[0].PathExpression == "seriesByTag('name=truncated')" {
+		multiFetchResponse := getMultiFetchResponse()
+		multiFetchResponse.Metrics[0].PathExpression = request.Metrics[0].PathExpression
+		result := []*types.MetricData{{FetchResponse: multiFetchResponse.Metrics[0]}}
+		return result, &zipperTypes.Stats{TruncatedTargets: []string{request.Metrics[0].PathExpression}}, nil
+	}
+	result, stats, err := z.RenderCompat(ctx, []string{""}, 0, 0)
+	if c := utilctx.GetFetchMetaCollector(ctx); c != nil {
+		for _, m := range result {
+			c.Add(m.PathExpression, m.Name, "http://127.0.0.1:8080", m.StepTime)
+		}
+	}
+	return result, stats, err
 }
 
 func (z mockCarbonZipper) RenderCompat(ctx context.Context, metrics []string, from, until int64) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
@@ -52,6 +89,14 @@ func (z mockCarbonZipper) TagValues(ctx context.Context, query string, limit int
 	return []string{}, nil
 }
 
+func (z mockCarbonZipper) ProbeBackends(ctx context.Context) map[string]merry.Error {
+	return map[string]merry.Error{
+		"group1": nil,
+		"group2": nil,
+		"group3": merry.New("connection refused"),
+	}
+}
+
 func (z mockCarbonZipper) ScaleToCommonStep() bool {
 	return true
 }
@@ -151,6 +196,763 @@ func TestRenderHandler(t *testing.T) {
 	}
 }
 
+func TestRenderHandlerPretty(t *testing.T) {
+	req, rr := setUpRequest(t, "/render/?target=fallbackSeries(foo.bar,foo.baz)&from=-10minutes&format=json")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	compact := rr.Body.String()
+
+	req, rr = setUpRequest(t, "/render/?target=fallbackSeries(foo.bar,foo.baz)&from=-10minutes&format=json&pretty=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	pretty := rr.Body.String()
+
+	expected := `[
+  {
+    "target": "foo.bar",
+    "datapoints": [
+      [
+        null,
+        1510913280
+      ],
+      [
+        1510913759,
+        1510913340
+      ],
+      [
+        1510913818,
+        1510913400
+      ]
+    ],
+    "tags": {}
+  }
+]`
+	assert.Equal(t, expected, pretty)
+
+	var compactParsed, prettyParsed interface{}
+	assert.NoError(t, json.Unmarshal([]byte(compact), &compactParsed))
+	assert.NoError(t, json.Unmarshal([]byte(pretty), &prettyParsed))
+	assert.Equal(t, compactParsed, prettyParsed)
+}
+
+func TestRenderHandlerEnvelope(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{
+			url:      "/render/?target=foo.bar&from=-10minutes&format=json&envelope=1",
+			expected: `{"series":[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}],"errors":[]}`,
+		},
+		{
+			url:      "/render/?target=foo.partial&from=-10minutes&format=json&envelope=1",
+			expected: `{"series":[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}],"errors":[{"error":"backend2 failed"}]}`,
+		},
+		{
+			url:      "/render/?target=foo.partial&from=-10minutes&format=json",
+			expected: `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req, rr := setUpRequest(t, tt.url)
+			renderHandler(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+			assert.Equal(t, tt.expected, rr.Body.String(), "Http response should be same.")
+		})
+	}
+}
+
+func TestRenderHandlerPartialFailure(t *testing.T) {
+	// partial response is not cached, so the header is present every time
+	for i := 0; i < 2; i++ {
+		req, rr := setUpRequest(t, "/render/?target=foo.partial&from=1510913280&until=1510913880&format=json")
+		renderHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+		assert.Equal(t, "1", rr.Header().Get(partialFailureHeader))
+		assert.Equal(t, "MISS", rr.Header().Get(cacheStatusHeader))
+	}
+
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+	assert.Equal(t, "", rr.Header().Get(partialFailureHeader))
+}
+
+func TestRenderHandlerTagTruncation(t *testing.T) {
+	url := "/render/?target=seriesByTag('name=truncated')&from=1510913280&until=1510913880&format=json&noCache=1"
+
+	req, rr := setUpRequest(t, url)
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "seriesByTag('name=truncated') matched more series than backend limit, result is truncated")
+
+	config.Config.IgnoreTagTruncation = true
+	defer func() {
+		config.Config.IgnoreTagTruncation = false
+	}()
+	req, rr = setUpRequest(t, url)
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+	assert.Equal(t, "", rr.Header().Get(partialFailureHeader))
+}
+
+func TestRenderHandlerMeta(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+		backends string
+	}{
+		{
+			url:      "/render/?target=foo.bar&from=-10minutes&format=json&meta=true",
+			expected: `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{},"meta":{"backends":["http://127.0.0.1:8080"],"archive":60,"consolidationFunc":"average","valuesPerPoint":1}}]`,
+			backends: "1",
+		},
+		{
+			url:      "/render/?target=consolidateBy(foo.bar,'max')&from=-10minutes&format=json&meta=true&maxDataPoints=2",
+			expected: `[{"target":"foo.bar","datapoints":[[1510913818,1510913280]],"tags":{},"meta":{"backends":["http://127.0.0.1:8080"],"archive":60,"consolidationFunc":"max","valuesPerPoint":5}}]`,
+			backends: "1",
+		},
+		{
+			url:      "/render/?target=foo.bar&from=-10minutes&format=json",
+			expected: `[{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			req, rr := setUpRequest(t, tt.url)
+			renderHandler(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+			assert.Equal(t, tt.expected, rr.Body.String(), "Http response should be same.")
+			assert.Equal(t, tt.backends, rr.Header().Get(backendsHeader))
+		})
+	}
+}
+
+// blockingZipper hangs in Render until request is cancelled
+type blockingZipper struct {
+	mockCarbonZipper
+	renders   int64
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (z *blockingZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	if atomic.AddInt64(&z.renders, 1) == 1 {
+		close(z.started)
+	}
+	select {
+	case <-ctx.Done():
+		close(z.cancelled)
+		return nil, nil, merry.Wrap(ctx.Err())
+	case <-time.After(10 * time.Second):
+		return z.mockCarbonZipper.Render(ctx, request)
+	}
+}
+
+func TestRenderHandlerClientDisconnect(t *testing.T) {
+	z := &blockingZipper{
+		started:   make(chan struct{}),
+		cancelled: make(chan struct{}),
+	}
+	oldZipper := config.Config.ZipperInstance
+	config.Config.ZipperInstance = z
+	defer func() {
+		config.Config.ZipperInstance = oldZipper
+	}()
+
+	srv := httptest.NewServer(http.HandlerFunc(renderHandler))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"/render/?target=foo.bar&target=foo.baz&format=json&noCache=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		errCh <- err
+	}()
+
+	select {
+	case <-z.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend wasn't called")
+	}
+	cancel()
+
+	select {
+	case <-z.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("backend fetch wasn't cancelled after client disconnected")
+	}
+	assert.Error(t, <-errCh)
+
+	// waits for handler to finish
+	srv.Close()
+	assert.Equal(t, int64(1), atomic.LoadInt64(&z.renders), "evaluation should stop after client disconnected")
+}
+
+// slowZipper holds Render of foo.slow until release is closed
+type slowZipper struct {
+	mockCarbonZipper
+	release chan struct{}
+}
+
+func (z *slowZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	if request.Metrics[0].PathExpression != "foo.slow" {
+		return z.mockCarbonZipper.Render(ctx, request)
+	}
+	<-z.release
+	result, stats, err := z.mockCarbonZipper.Render(ctx, request)
+	for _, r := range result {
+		r.Name = "foo.slow"
+		r.PathExpression = "foo.slow"
+	}
+	return result, stats, err
+}
+
+func TestRenderHandlerNDJSON(t *testing.T) {
+	z := &slowZipper{release: make(chan struct{})}
+	oldZipper := config.Config.ZipperInstance
+	config.Config.ZipperInstance = z
+	srv := httptest.NewServer(http.HandlerFunc(renderHandler))
+	defer func() {
+		srv.Close()
+		config.Config.ZipperInstance = oldZipper
+	}()
+
+	series := `{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}` + "\n"
+
+	resp, err := http.Get(srv.URL + "/render/?target=foo.bar&target=foo.slow&format=ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, contentTypeNDJSON, resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	lines := make(chan string)
+	go func() {
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	// first series must arrive while second target is still being evaluated
+	select {
+	case line := <-lines:
+		assert.Equal(t, series, line)
+	case <-time.After(5 * time.Second):
+		t.Fatal("first series wasn't sent before the rest of the response was ready")
+	}
+
+	close(z.release)
+	assert.Equal(t, strings.Replace(series, "foo.bar", "foo.slow", 1), <-lines)
+	_, ok := <-lines
+	assert.False(t, ok, "response should end after the last series")
+}
+
+func TestRenderHandlerNDJSONAccept(t *testing.T) {
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&target=foo.bar")
+	req.Header.Set("Accept", contentTypeNDJSON)
+	renderHandler(rr, req)
+
+	series := `{"target":"foo.bar","datapoints":[[null,1510913280],[1510913759,1510913340],[1510913818,1510913400]],"tags":{}}` + "\n"
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, contentTypeNDJSON, rr.Header().Get("Content-Type"))
+	assert.Equal(t, series+series, rr.Body.String())
+}
+
+func TestRenderHandlerBadTarget(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		expected string
+	}{
+		{
+			name: "syntax error",
+			url:  "/render/?target=sumSeries(foo.bar%20baz)&format=json",
+			expected: "Bad Request: Bad Request\n\n" +
+				"Target              : sumSeries(foo.bar baz)\n" +
+				"Error               : unexpected character\n" +
+				"Parsed so far       : sumSeries(foo.bar \n" +
+				"Could not parse     : baz)\n" +
+				"Position            : 18\n" +
+				"Offending token     : baz\n\n",
+		},
+		{
+			name: "unknown function",
+			url:  "/render/?target=sumseries(foo.bar)&format=json",
+			expected: "Bad Request: Bad Request\n\n" +
+				"Target              : sumseries(foo.bar)\n" +
+				"Error               : unknown function \"sumseries\"\n" +
+				"Position            : 0\n" +
+				"Offending token     : sumseries\n" +
+				"Did you mean        : sumSeries\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, rr := setUpRequest(t, tt.url)
+			renderHandler(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code, "HttpStatusCode should be 400 Bad Request.")
+			assert.Equal(t, tt.expected, rr.Body.String(), "Http response should be same.")
+		})
+	}
+}
+
+func TestSuggestFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected []string
+	}{
+		{"sumSeies", []string{"sumSeries"}},
+		{"sumseries", []string{"sumSeries"}},
+		{"alis", []string{"alias"}},
+		{"mxSeries", []string{"maxSeries", "mapSeries", "minSeries"}},
+		{"aliasByNod", []string{"aliasByNode"}},
+		{"completelyUnknownFunction", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, suggestFunctions(tt.name))
+		})
+	}
+}
+
+func TestRenderCacheTimeRanges(t *testing.T) {
+	config.Config.ResponseCacheConfig.RelativeRangeTimeoutSec = 1
+	config.Config.ResponseCacheConfig.AbsoluteRangeTimeoutSec = 600
+	defer func() {
+		config.Config.ResponseCacheConfig.RelativeRangeTimeoutSec = 0
+		config.Config.ResponseCacheConfig.AbsoluteRangeTimeoutSec = 0
+	}()
+
+	render := func(url string) {
+		req, rr := setUpRequest(t, url)
+		renderHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+	}
+
+	// historical range is served from cache
+	hits := ApiMetrics.RequestCacheHits.Value()
+	render("/render/?target=foo.bar&from=1510913280&until=1510913880&format=json")
+	render("/render/?target=foo.bar&from=1510913280&until=1510913880&format=json")
+	assert.Equal(t, int64(1), ApiMetrics.RequestCacheHits.Value()-hits)
+
+	req, rr := setUpRequest(t, "/render/?target=foo.bar&from=1510913280&until=1510913880&format=json")
+	renderHandler(rr, req)
+	assert.Equal(t, "HIT", rr.Header().Get(cacheStatusHeader))
+
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=1510913280&until=1510913880&format=json&noCache=1")
+	renderHandler(rr, req)
+	assert.Equal(t, "", rr.Header().Get(cacheStatusHeader))
+
+	// relative range is not served from cache after short TTL
+	hits = ApiMetrics.RequestCacheHits.Value()
+	render("/render/?target=foo.bar&from=-5minutes&format=json")
+	time.Sleep(1100 * time.Millisecond)
+	req, rr = setUpRequest(t, "/render/?target=foo.bar&from=-5minutes&format=json")
+	renderHandler(rr, req)
+	assert.Equal(t, "MISS", rr.Header().Get(cacheStatusHeader))
+	assert.Equal(t, int64(0), ApiMetrics.RequestCacheHits.Value()-hits)
+}
+
+func TestBackendCacheTimeRanges(t *testing.T) {
+	now := time.Unix(1510913880, 0)
+	clock := func() time.Time { return now }
+	SetTimeNow(clock)
+	date.SetTimeNow(clock)
+	oldCache, oldCacheConfig := config.Config.BackendCache, config.Config.BackendCacheConfig
+	config.Config.BackendCache = cache.NewExpireCache(1024 * 1024)
+	config.Config.BackendCacheConfig.DefaultTimeoutSec = 600
+	config.Config.BackendCacheConfig.RelativeRangeTimeoutSec = 60
+	defer func() {
+		SetTimeNow(time.Now)
+		date.SetTimeNow(time.Now)
+		config.Config.BackendCache, config.Config.BackendCacheConfig = oldCache, oldCacheConfig
+	}()
+
+	// every request has a format of its own, so response cache doesn't hide backend cache
+	render := func(format string) int64 {
+		hits := ApiMetrics.BackendCacheHits.Value()
+		req, rr := setUpRequest(t, "/render/?target=foo.bar&from=-5minutes&format="+format)
+		renderHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "HttpStatusCode should be 200 OK.")
+		return ApiMetrics.BackendCacheHits.Value() - hits
+	}
+
+	assert.Equal(t, int64(0), render("json"))
+	now = now.Add(30 * time.Second)
+	assert.Equal(t, int64(1), render("csv"), "same TTL window should be served from backend cache")
+	now = now.Add(60 * time.Second)
+	assert.Equal(t, int64(0), render("raw"), "relative range shouldn't be served from backend cache after time advanced")
+}
+
+func TestResponseCacheComputeKey(t *testing.T) {
+	form := url.Values{"target": []string{"foo.bar"}, "from": []string{"-1h"}}
+
+	key := responseCacheComputeKey(form, []int64{1510909260}, []int64{1510912860}, true, 60)
+	assert.Equal(t, "from=1510909260&target=foo.bar&until=1510912860", key)
+	assert.Equal(t, key, responseCacheComputeKey(form, []int64{1510909319}, []int64{1510912919}, true, 60), "same TTL window should produce same key")
+	assert.NotEqual(t, key, responseCacheComputeKey(form, []int64{1510909320}, []int64{1510912920}, true, 60), "next TTL window should produce new key")
+	assert.Equal(t, "from=-1h&target=foo.bar", responseCacheComputeKey(form, []int64{1510909260}, []int64{1510912860}, false, 60))
+	assert.Equal(t, []string{"-1h"}, form["from"], "form should not be modified")
+
+	form = url.Values{"target": []string{"foo.bar", "foo.baz"}, "from": []string{"-1h", "-1d"}}
+	assert.Equal(t, "from=1510909260&from=1510826460&target=foo.bar&target=foo.baz&until=1510912860",
+		responseCacheComputeKey(form, []int64{1510909260, 1510826460}, []int64{1510912860}, true, 60), "all from values should be in the key")
+}
+
+// recordingZipper remembers time range that was requested for each metric
+type recordingZipper struct {
+	mockCarbonZipper
+	mu     sync.Mutex
+	ranges map[string][2]int64
+}
+
+func (z *recordingZipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	z.mu.Lock()
+	for _, m := range request.Metrics {
+		z.ranges[m.PathExpression] = [2]int64{m.StartTime, m.StopTime}
+	}
+	z.mu.Unlock()
+	return z.mockCarbonZipper.Render(ctx, request)
+}
+
+func TestRenderHandlerPerTargetTimeRange(t *testing.T) {
+	z := &recordingZipper{ranges: make(map[string][2]int64)}
+	oldZipper := config.Config.ZipperInstance
+	config.Config.ZipperInstance = z
+	defer func() {
+		config.Config.ZipperInstance = oldZipper
+	}()
+
+	req, rr := setUpRequest(t, "/render/?format=json&noCache=1"+
+		"&target=foo.bar&from=1510913280&until=1510913880"+
+		"&target=foo.baz&from=1510826880&until=1510827480")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, [2]int64{1510913280, 1510913880}, z.ranges["foo.bar"])
+	assert.Equal(t, [2]int64{1510826880, 1510827480}, z.ranges["foo.baz"])
+
+	// single until applies to all targets
+	z.ranges = make(map[string][2]int64)
+	req, rr = setUpRequest(t, "/render/?format=json&noCache=1&until=1510913880"+
+		"&target=foo.bar&from=1510913280"+
+		"&target=foo.baz&from=1510826880")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, [2]int64{1510913280, 1510913880}, z.ranges["foo.bar"])
+	assert.Equal(t, [2]int64{1510826880, 1510913880}, z.ranges["foo.baz"])
+
+	req, rr = setUpRequest(t, "/render/?format=json&target=foo.bar&target=foo.baz&target=foo.qux&from=-1h&from=-1d")
+	renderHandler(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "got 2 values of from for 3 targets")
+}
+
+func TestRenderHandlerSeriesLimits(t *testing.T) {
+	defer func() {
+		config.Config.MaxSeries = 0
+		config.Config.MaxSeriesNameLength = 0
+	}()
+
+	tests := []struct {
+		name                string
+		url                 string
+		maxSeries           int
+		maxSeriesNameLength int
+		expectedCode        int
+		expected            string
+	}{
+		{
+			name:         "within limits",
+			url:          "/render/?target=foo.bar&target=foo.bar&from=-10minutes&format=json&noCache=1",
+			maxSeries:    2,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "too many series",
+			url:          "/render/?target=foo.bar&target=foo.bar&target=foo.bar&from=-10minutes&format=json&noCache=1",
+			maxSeries:    2,
+			expectedCode: http.StatusBadRequest,
+			expected:     "Bad Request: too many series in response: 3, limit is 2\n",
+		},
+		{
+			name:                "too long name",
+			url:                 "/render/?target=foo.bar&from=-10minutes&format=json&noCache=1",
+			maxSeriesNameLength: 5,
+			expectedCode:        http.StatusBadRequest,
+			expected:            "Bad Request: series name is too long: 7, limit is 5\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.MaxSeries = tt.maxSeries
+			config.Config.MaxSeriesNameLength = tt.maxSeriesNameLength
+
+			req, rr := setUpRequest(t, tt.url)
+			renderHandler(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRenderHandlerMaxCost(t *testing.T) {
+	defer func() {
+		config.Config.MaxCost = 0
+	}()
+
+	tests := []struct {
+		name         string
+		url          string
+		maxCost      int64
+		expectedCode int
+		expected     string
+	}{
+		{
+			name:         "within limit",
+			url:          "/render/?target=sumSeries(foo.*,foo.bar)&from=1510913280&until=1510916880&format=json&noCache=1",
+			maxCost:      120,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "over limit",
+			url:          "/render/?target=sumSeries(foo.*,foo.bar)&target=foo.bar&from=1510913280&until=1510916880&format=json&noCache=1",
+			maxCost:      120,
+			expectedCode: http.StatusBadRequest,
+			expected: "Bad Request: query is too expensive: estimated cost 180 exceeds maxCost 120\n" +
+				"most expensive target: sumSeries(foo.*,foo.bar) (2 metrics * 60 points * 1 complexity = 120)\n" +
+				"use narrower time range or more specific patterns\n",
+		},
+		{
+			name:         "explain",
+			url:          "/render/?target=sumSeries(foo.*,foo.bar)&target=foo.bar&from=1510913280&until=1510916880&format=json&explain=1",
+			maxCost:      120,
+			expectedCode: http.StatusOK,
+			expected: `{"targets":[` +
+				`{"target":"sumSeries(foo.*,foo.bar)","metrics":2,"points":60,"complexity":1,"cost":120,"step":60},` +
+				`{"target":"foo.bar","metrics":1,"points":60,"complexity":1,"cost":60,"step":60}` +
+				`],"cost":180,"maxCost":120}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.MaxCost = tt.maxCost
+
+			req, rr := setUpRequest(t, tt.url)
+			renderHandler(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestRenderHandlerFunctionsAccess(t *testing.T) {
+	defer func() {
+		config.Config.FunctionsAccess = config.FunctionsAccessConfig{}
+	}()
+	config.Config.FunctionsAccess = config.FunctionsAccessConfig{
+		Deny:         []string{"holtWinters*"},
+		APIKeyHeader: "X-Api-Key",
+		APIKeys: map[string]config.FunctionsAccessRule{
+			"trusted":    {},
+			"restricted": {Allow: []string{"sumSeries"}},
+		},
+	}
+
+	tests := []struct {
+		name         string
+		url          string
+		apiKey       string
+		expectedCode int
+		expected     string
+	}{
+		{
+			name:         "allowed",
+			url:          "/render/?target=sumSeries(foo.bar)&from=-10minutes&format=json&noCache=1",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "denied",
+			url:          "/render/?target=foo.bar&target=sumSeries(holtWintersForecast(foo.bar))&from=-10minutes&format=json&noCache=1",
+			expectedCode: http.StatusForbidden,
+			expected: "Forbidden: Forbidden\n\n" +
+				"Target              : sumSeries(holtWintersForecast(foo.bar))\n" +
+				"Error               : function \"holtWintersForecast\" is not allowed\n" +
+				"Position            : 10\n" +
+				"Offending token     : holtWintersForecast\n\n",
+		},
+		{
+			name:         "denied for explain",
+			url:          "/render/?target=holtWintersForecast(foo.bar)&from=-10minutes&format=json&explain=1",
+			expectedCode: http.StatusForbidden,
+		},
+		{
+			name:         "allowed for api key",
+			url:          "/render/?target=holtWintersForecast(foo.bar)&from=-10minutes&format=json&noCache=1",
+			apiKey:       "trusted",
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "not in allow list of api key",
+			url:          "/render/?target=sumSeries(absolute(foo.bar))&from=-10minutes&format=json&noCache=1",
+			apiKey:       "restricted",
+			expectedCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, rr := setUpRequest(t, tt.url)
+			if tt.apiKey != "" {
+				req.Header.Set("X-Api-Key", tt.apiKey)
+			}
+			renderHandler(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			if tt.expected != "" {
+				assert.Equal(t, tt.expected, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	defer func() {
+		config.Config.HealthCheck.Quorum = 0
+	}()
+
+	tests := []struct {
+		name         string
+		url          string
+		quorum       float64
+		expectedCode int
+		expected     string
+	}{
+		{
+			name:         "shallow",
+			url:          "/health",
+			expectedCode: http.StatusOK,
+			expected:     `{"status":"ok"}`,
+		},
+		{
+			name:         "deep, all backends required",
+			url:          "/health?deep=true",
+			expectedCode: http.StatusServiceUnavailable,
+			expected:     `{"status":"fail","reachable":2,"quorum":3,"backends":{"group1":{"status":"ok"},"group2":{"status":"ok"},"group3":{"status":"fail","error":"connection refused"}}}`,
+		},
+		{
+			name:         "deep, quorum is reached",
+			url:          "/health?deep=true",
+			quorum:       0.5,
+			expectedCode: http.StatusOK,
+			expected:     `{"status":"ok","reachable":2,"quorum":2,"backends":{"group1":{"status":"ok"},"group2":{"status":"ok"},"group3":{"status":"fail","error":"connection refused"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.HealthCheck.Quorum = tt.quorum
+
+			req, rr := setUpRequest(t, tt.url)
+			healthHandler(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code)
+			assert.Equal(t, tt.expected, rr.Body.String())
+		})
+	}
+}
+
+// probingZipper probes backends with the real zipper
+type probingZipper struct {
+	mockCarbonZipper
+	z *realZipper.Zipper
+}
+
+func (z *probingZipper) ProbeBackends(ctx context.Context) map[string]merry.Error {
+	return z.z.ProbeBackends(ctx)
+}
+
+func TestHealthHandlerProbesBackends(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := pb.MultiGlobResponse{
+			Metrics: []pb.GlobResponse{{
+				Name:    "*",
+				Matches: []pb.GlobMatch{{Path: "a", IsLeaf: false}},
+			}},
+		}
+		b, _ := response.Marshal()
+		w.Header().Set("Content-Type", httpHeaders.ContentTypeCarbonAPIv3PB)
+		_, _ = w.Write(b)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	maxBatchSize := 100
+	z, err := realZipper.NewZipper(func(*zipperTypes.Stats) {}, &zipperConfig.Config{
+		MaxBatchSize:     &maxBatchSize,
+		TLDCacheDisabled: true,
+		BackendsV2: zipperTypes.BackendsV2{
+			Backends: []zipperTypes.BackendV2{
+				{GroupName: "up", Protocol: "carbonapi_v3_pb", LBMethod: "broadcast", Servers: []string{up.URL}},
+				{GroupName: "down", Protocol: "carbonapi_v3_pb", LBMethod: "broadcast", Servers: []string{down.URL}},
+			},
+		},
+	}, zapwriter.Logger("zipper"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldZipper := config.Config.ZipperInstance
+	config.Config.ZipperInstance = &probingZipper{z: z}
+	defer func() {
+		config.Config.ZipperInstance = oldZipper
+	}()
+
+	req, rr := setUpRequest(t, "/health?deep=true")
+	healthHandler(rr, req)
+
+	var response healthResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, healthFail, response.Status)
+	assert.Equal(t, 1, response.Reachable)
+	assert.Equal(t, healthOk, response.Backends["up"].Status)
+	assert.Equal(t, healthFail, response.Backends["down"].Status)
+	assert.NotEmpty(t, response.Backends["down"].Error)
+}
+
 func TestFindHandler(t *testing.T) {
 	req, rr := setUpRequest(t, "/metrics/find/?query=foo.bar&format=json")
 	findHandler(rr, req)
@@ -188,3 +990,52 @@ func TestInfoHandler(t *testing.T) {
 		t.Error("Http response should be same.")
 	}
 }
+
+func TestFindCache(t *testing.T) {
+	defer func(c cache.BytesCache, cfg config.CacheConfig) {
+		config.Config.FindCache = c
+		config.Config.FindCacheConfig = cfg
+	}(config.Config.FindCache, config.Config.FindCacheConfig)
+
+	config.Config.FindCache = cache.NewExpireCache(0)
+	config.Config.FindCacheConfig.DefaultTimeoutSec = 1
+	config.Config.FindCacheConfig.NegativeTimeoutSec = 0
+
+	expected := `[{"allowChildren":0,"expandable":0,"leaf":1,"id":"foo.bar","text":"bar","context":{}}]` + "\n"
+	before := atomic.LoadInt64(&mockFindRequests)
+	for i := 0; i < 3; i++ {
+		req, rr := setUpRequest(t, "/metrics/find/?query=foo.bar&format=json")
+		findHandler(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, expected, rr.Body.String())
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&mockFindRequests)-before, "find should be served from cache within TTL")
+
+	// noCache must bypass cache
+	req, rr := setUpRequest(t, "/metrics/find/?query=foo.bar&format=json&noCache=1")
+	findHandler(rr, req)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&mockFindRequests)-before)
+
+	// empty results are not cached unless negativeTimeoutSec is set
+	before = atomic.LoadInt64(&mockFindRequests)
+	for i := 0; i < 2; i++ {
+		req, rr := setUpRequest(t, "/metrics/find/?query=foo.missing&format=json")
+		findHandler(rr, req)
+	}
+	assert.Equal(t, int64(2), atomic.LoadInt64(&mockFindRequests)-before)
+
+	config.Config.FindCacheConfig.NegativeTimeoutSec = 1
+	before = atomic.LoadInt64(&mockFindRequests)
+	for i := 0; i < 2; i++ {
+		req, rr := setUpRequest(t, "/metrics/find/?query=foo.missing&format=json")
+		findHandler(rr, req)
+	}
+	assert.Equal(t, int64(1), atomic.LoadInt64(&mockFindRequests)-before)
+
+	// TTL expired
+	time.Sleep(2100 * time.Millisecond)
+	before = atomic.LoadInt64(&mockFindRequests)
+	req, rr = setUpRequest(t, "/metrics/find/?query=foo.bar&format=json")
+	findHandler(rr, req)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&mockFindRequests)-before)
+}
@@ -21,7 +21,9 @@ var ApiMetrics = struct {
 	RenderCacheOverheadNS *expvar.Int
 	RequestBuckets        expvar.Func
 
-	FindRequests *expvar.Int
+	FindRequests    *expvar.Int
+	FindCacheHits   *expvar.Int
+	FindCacheMisses *expvar.Int
 
 	MemcacheTimeouts expvar.Func
 
@@ -37,7 +39,9 @@ var ApiMetrics = struct {
 	BackendCacheMisses:    expvar.NewInt("backend_cache_misses"),
 	RenderCacheOverheadNS: expvar.NewInt("render_cache_overhead_ns"),
 
-	FindRequests: expvar.NewInt("find_requests"),
+	FindRequests:    expvar.NewInt("find_requests"),
+	FindCacheHits:   expvar.NewInt("find_cache_hits"),
+	FindCacheMisses: expvar.NewInt("find_cache_misses"),
 }
 
 var ZipperMetrics = struct {
@@ -2,11 +2,15 @@ package http
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,9 +21,11 @@ import (
 	"github.com/go-graphite/carbonapi/date"
 	"github.com/go-graphite/carbonapi/expr"
 	"github.com/go-graphite/carbonapi/expr/functions/cairo/png"
+	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"github.com/lomik/zapwriter"
 	uuid "github.com/satori/go.uuid"
@@ -45,6 +51,69 @@ func setError(w http.ResponseWriter, accessLogDetails *carbonapipb.AccessLogDeta
 	accessLogDetails.HTTPCode = int32(status)
 }
 
+// streamRender evaluates targets one by one and sends resulting series as newline-delimited JSON as soon as each target
+// is evaluated. Errors are sent as {"target":"...","error":"..."} lines, as response status is already sent.
+func streamRender(ctx context.Context, w http.ResponseWriter, logger *zap.Logger, accessLogDetails *carbonapipb.AccessLogDetails, targets []string, windows []timeWindow, maxDataPoints, timestampMultiplier int64, noNullPoints bool) {
+	w.Header().Set("Content-Type", contentTypeNDJSON)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	var size int64
+	write := func(b []byte) {
+		n, _ := w.Write(b)
+		size += int64(n)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	writeError := func(target, msg string) {
+		b, _ := json.Marshal(types.ResponseError{Target: target, Error: msg})
+		write(append(b, '\n'))
+	}
+
+	values := make(map[parser.MetricRequest][]*types.MetricData)
+	total := 0
+	for i, target := range targets {
+		if expr.Cancelled(ctx) != nil {
+			setClientGone(logger, accessLogDetails)
+			return
+		}
+
+		exp, _, _ := parser.ParseExpr(target)
+		ApiMetrics.RenderRequests.Add(1)
+
+		result, err := expr.FetchAndEvalExp(ctx, exp, windows[i].from, windows[i].until, values)
+		if err != nil && merry.HTTPCode(err) != http.StatusNotFound && !merry.Is(err, parser.ErrSeriesDoesNotExist) {
+			writeError(target, err.Error())
+		}
+
+		total += len(result)
+		if msg := checkSeriesLimits(total, result); msg != "" {
+			writeError(target, msg)
+			break
+		}
+
+		if maxDataPoints != 0 {
+			types.ConsolidateJSON(maxDataPoints, result)
+		}
+		write(types.MarshalNDJSON(result, timestampMultiplier, noNullPoints))
+	}
+
+	accessLogDetails.HTTPCode = http.StatusOK
+	accessLogDetails.MaxDataPoints = maxDataPoints
+	accessLogDetails.CarbonapiResponseSizeBytes = size
+}
+
+// statusClientClosedRequest is a non-standard status (introduced by nginx) for requests that client abandoned
+const statusClientClosedRequest = 499
+
+// setClientGone records that client disconnected before response was ready. Nothing is written as there is no one to read it.
+func setClientGone(logger *zap.Logger, accessLogDetails *carbonapipb.AccessLogDetails) {
+	logger.Debug("client closed request, evaluation cancelled")
+	accessLogDetails.Reason = "client closed request"
+	accessLogDetails.HTTPCode = statusClientClosedRequest
+}
+
 func getCacheTimeout(logger *zap.Logger, r *http.Request, defaultTimeout int32) int32 {
 	if tstr := r.FormValue("cacheTimeout"); tstr != "" {
 		t, err := strconv.Atoi(tstr)
@@ -61,6 +130,107 @@ func getCacheTimeout(logger *zap.Logger, r *http.Request, defaultTimeout int32)
 	return defaultTimeout
 }
 
+// rangeCacheTimeout returns cache TTL depending on requested time range: now-anchored ranges get
+// relativeRangeTimeoutSec, ranges that already ended get absoluteRangeTimeoutSec
+func rangeCacheTimeout(cacheConfig config.CacheConfig, relativeRange bool, until int64, defaultTimeout int32) int32 {
+	if relativeRange {
+		if cacheConfig.RelativeRangeTimeoutSec > 0 {
+			return cacheConfig.RelativeRangeTimeoutSec
+		}
+	} else if until < timeNow().Unix() && cacheConfig.AbsoluteRangeTimeoutSec > 0 {
+		return cacheConfig.AbsoluteRangeTimeoutSec
+	}
+
+	return defaultTimeout
+}
+
+// cacheKeyTimes formats from (or until) values for cache keys. Now-anchored values are truncated to cache TTL,
+// so responses for relative ranges can't be served after "now" moves to the next TTL window
+func cacheKeyTimes(values []int64, relativeRange bool, timeout int32) []string {
+	res := make([]string, len(values))
+	for i, v := range values {
+		if relativeRange && timeout > 0 {
+			v -= v % int64(timeout)
+		}
+		res[i] = strconv.FormatInt(v, 10)
+	}
+	return res
+}
+
+// responseCacheComputeKey replaces now-anchored from and until with their absolute values, truncated to cache TTL
+func responseCacheComputeKey(form url.Values, froms, untils []int64, relativeRange bool, timeout int32) string {
+	if !relativeRange {
+		return form.Encode()
+	}
+
+	key := make(url.Values, len(form))
+	for k, v := range form {
+		key[k] = v
+	}
+	key["from"] = cacheKeyTimes(froms, relativeRange, timeout)
+	key["until"] = cacheKeyTimes(untils, relativeRange, timeout)
+
+	return key.Encode()
+}
+
+// timeWindow is the time range that a target is evaluated for
+type timeWindow struct {
+	from, until int64
+}
+
+// parseTimeParams converts every value of `from` (or `until`) parameter to unix time. Absent parameter is converted to defaultTime
+func parseTimeParams(values []string, qtz string, defaultTime int64) []int64 {
+	if len(values) == 0 {
+		return []int64{defaultTime}
+	}
+	res := make([]int64, len(values))
+	for i, v := range values {
+		res[i] = date.DateParamToEpoch(v, qtz, defaultTime, config.Config.DefaultTimeZone)
+	}
+	return res
+}
+
+// isRelativeRange returns true if any of `from` or `until` values depends on current time
+func isRelativeRange(froms, untils []string) bool {
+	if len(froms) == 0 || len(untils) == 0 {
+		return true
+	}
+	for _, v := range froms {
+		if date.IsRelative(v) {
+			return true
+		}
+	}
+	for _, v := range untils {
+		if date.IsRelative(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetWindows returns time range for each of the targets. Single `from` (or `until`) value applies to all targets,
+// otherwise there must be exactly one value per target, in the same order as targets.
+func targetWindows(targets int, froms, untils []int64) ([]timeWindow, error) {
+	if len(froms) > 1 && len(froms) != targets {
+		return nil, fmt.Errorf("got %d values of from for %d targets, expected one value or one value per target", len(froms), targets)
+	}
+	if len(untils) > 1 && len(untils) != targets {
+		return nil, fmt.Errorf("got %d values of until for %d targets, expected one value or one value per target", len(untils), targets)
+	}
+
+	windows := make([]timeWindow, targets)
+	for i := range windows {
+		windows[i] = timeWindow{from: froms[0], until: untils[0]}
+		if len(froms) > 1 {
+			windows[i].from = froms[i]
+		}
+		if len(untils) > 1 {
+			windows[i].until = untils[i]
+		}
+	}
+	return windows, nil
+}
+
 func renderHandler(w http.ResponseWriter, r *http.Request) {
 	t0 := time.Now()
 	uid := uuid.NewV4()
@@ -115,14 +285,36 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	ctx = utilctx.SetMaxDatapoints(ctx, maxDataPoints)
 	useCache := !parser.TruthyBool(r.FormValue("noCache"))
 	noNullPoints := parser.TruthyBool(r.FormValue("noNullPoints"))
+	jsonEnvelope := config.Config.JSONEnvelope
+	if v := r.FormValue("envelope"); v != "" {
+		jsonEnvelope = parser.TruthyBool(v)
+	}
+	errorCollector := &utilctx.ErrorCollector{}
+	ctx = utilctx.SetErrorCollector(ctx, errorCollector)
+	var fetchMetaCollector *utilctx.FetchMetaCollector
+	if parser.TruthyBool(r.FormValue("meta")) {
+		// cached responses don't know where the data came from
+		useCache = false
+		fetchMetaCollector = &utilctx.FetchMetaCollector{}
+		ctx = utilctx.SetFetchMetaCollector(ctx, fetchMetaCollector)
+	}
 	// status will be checked later after we'll setup everything else
 	format, ok, formatRaw := getFormat(r, pngFormat)
+	if formatRaw == "" && strings.Contains(r.Header.Get("Accept"), contentTypeNDJSON) {
+		format, formatRaw = ndjsonFormat, ndjsonFormat.String()
+	}
+	if format == ndjsonFormat {
+		// streamed responses are never cached
+		useCache = false
+	}
 
 	var jsonp string
+	var pretty bool
 
 	if format == jsonFormat {
 		// TODO(dgryski): check jsonp only has valid characters
 		jsonp = r.FormValue("jsonp")
+		pretty = parser.TruthyBool(r.FormValue("pretty"))
 	}
 
 	timestampFormat := strings.ToLower(r.FormValue("timestampFormat"))
@@ -151,12 +343,24 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 
 	cleanupParams(r)
 
-	responseCacheKey := r.Form.Encode()
-
 	// normalize from and until values
 	qtz := r.FormValue("tz")
-	from32 := date.DateParamToEpoch(from, qtz, timeNow().Add(-24*time.Hour).Unix(), config.Config.DefaultTimeZone)
-	until32 := date.DateParamToEpoch(until, qtz, timeNow().Unix(), config.Config.DefaultTimeZone)
+	froms := parseTimeParams(r.Form["from"], qtz, timeNow().Add(-24*time.Hour).Unix())
+	untils := parseTimeParams(r.Form["until"], qtz, timeNow().Unix())
+	from32, until32 := froms[0], untils[0]
+	lastUntil := until32
+	for _, u := range untils {
+		if u > lastUntil {
+			lastUntil = u
+		}
+	}
+
+	relativeRange := isRelativeRange(r.Form["from"], r.Form["until"])
+	if r.FormValue("cacheTimeout") == "" {
+		responseCacheTimeout = rangeCacheTimeout(config.Config.ResponseCacheConfig, relativeRange, lastUntil, responseCacheTimeout)
+		backendCacheTimeout = rangeCacheTimeout(config.Config.BackendCacheConfig, relativeRange, lastUntil, backendCacheTimeout)
+	}
+	responseCacheKey := responseCacheComputeKey(r.Form, froms, untils, relativeRange, responseCacheTimeout)
 
 	accessLogDetails.UseCache = useCache
 	accessLogDetails.FromRaw = from
@@ -174,6 +378,13 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	windows, err := targetWindows(len(targets), froms, untils)
+	if err != nil {
+		setError(w, accessLogDetails, err.Error(), http.StatusBadRequest)
+		logAsError = true
+		return
+	}
+
 	if format == protoV3Format {
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
@@ -196,8 +407,66 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		from32 = pv3Request.Metrics[0].StartTime
 		until32 = pv3Request.Metrics[0].StopTime
 		targets = make([]string, len(pv3Request.Metrics))
+		windows = make([]timeWindow, len(pv3Request.Metrics))
 		for i, r := range pv3Request.Metrics {
 			targets[i] = r.PathExpression
+			windows[i] = timeWindow{from: r.StartTime, until: r.StopTime}
+		}
+	}
+
+	if config.Config.FunctionsAccess.Enabled() {
+		for _, target := range targets {
+			exp, e, err := parser.ParseExpr(target)
+			if err != nil || e != "" {
+				// parse errors are reported below
+				continue
+			}
+			if name := forbiddenFunction(r, exp); name != "" {
+				setError(w, accessLogDetails, buildForbiddenFunctionErrorString(target, name), http.StatusForbidden)
+				logAsError = true
+				return
+			}
+		}
+	}
+
+	explain := parser.TruthyBool(r.FormValue("explain"))
+	if explain || config.Config.MaxCost > 0 {
+		costs := make([]expr.Cost, 0, len(targets))
+		var totalCost int64
+		for i, target := range targets {
+			exp, e, err := parser.ParseExpr(target)
+			if err != nil || e != "" {
+				msg := buildParseErrorString(target, e, err)
+				setError(w, accessLogDetails, msg, http.StatusBadRequest)
+				logAsError = true
+				return
+			}
+			cost := expr.EstimateCost(ctx, target, exp, windows[i].from, windows[i].until)
+			if explain {
+				cost.Step = expr.EstimateStep(ctx, exp, windows[i].from)
+			}
+			costs = append(costs, cost)
+			totalCost += cost.Cost
+		}
+
+		if explain {
+			body, err := json.Marshal(explainResponse{Targets: costs, Cost: totalCost, MaxCost: config.Config.MaxCost})
+			if err != nil {
+				setError(w, accessLogDetails, err.Error(), http.StatusInternalServerError)
+				logAsError = true
+				return
+			}
+			if pretty {
+				body = indentJSON(body)
+			}
+			writeResponse(w, http.StatusOK, body, jsonFormat, jsonp)
+			return
+		}
+
+		if totalCost > config.Config.MaxCost {
+			setError(w, accessLogDetails, buildCostErrorString(costs, totalCost), http.StatusBadRequest)
+			logAsError = true
+			return
 		}
 	}
 
@@ -212,14 +481,20 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 
 		if err == nil {
 			ApiMetrics.RequestCacheHits.Add(1)
+			w.Header().Set(cacheStatusHeader, "HIT")
 			writeResponse(w, http.StatusOK, response, format, jsonp)
 			accessLogDetails.FromCache = true
 			return
 		}
 		ApiMetrics.RequestCacheMisses.Add(1)
+		w.Header().Set(cacheStatusHeader, "MISS")
 	}
 
-	if from32 == until32 {
+	emptyRange := from32 == until32
+	for _, window := range windows {
+		emptyRange = emptyRange || window.from == window.until
+	}
+	if emptyRange {
 		setError(w, accessLogDetails, "Invalid or empty time range", http.StatusBadRequest)
 		logAsError = true
 		return
@@ -243,8 +518,25 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	if format == ndjsonFormat {
+		// status can't be changed after first series is sent, so check what we can in advance
+		for _, target := range targets {
+			if _, e, err := parser.ParseExpr(target); err != nil || e != "" {
+				setError(w, accessLogDetails, buildParseErrorString(target, e, err), http.StatusBadRequest)
+				logAsError = true
+				return
+			}
+		}
+		streamRender(ctx, w, logger, accessLogDetails, targets, windows, maxDataPoints, timestampMultiplier, noNullPoints)
+		return
+	}
+
 	errors := make(map[string]merry.Error)
-	backendCacheKey := backendCacheComputeKey(from, until, targets)
+	backendCacheKey := backendCacheComputeKey(
+		strings.Join(cacheKeyTimes(froms, relativeRange, backendCacheTimeout), ","),
+		strings.Join(cacheKeyTimes(untils, relativeRange, backendCacheTimeout), ","),
+		targets,
+	)
 	results, err := backendCacheFetchResults(logger, useCache, backendCacheKey, accessLogDetails)
 
 	if err != nil {
@@ -253,7 +545,12 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 		results = make([]*types.MetricData, 0)
 		values := make(map[parser.MetricRequest][]*types.MetricData)
 
-		for _, target := range targets {
+		for i, target := range targets {
+			if expr.Cancelled(ctx) != nil {
+				setClientGone(logger, accessLogDetails)
+				return
+			}
+
 			exp, e, err := parser.ParseExpr(target)
 			if err != nil || e != "" {
 				msg := buildParseErrorString(target, e, err)
@@ -264,12 +561,35 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 
 			ApiMetrics.RenderRequests.Add(1)
 
-			result, err := expr.FetchAndEvalExp(ctx, exp, from32, until32, values)
+			result, err := expr.FetchAndEvalExp(ctx, exp, windows[i].from, windows[i].until, values)
+			if unknownFunction, ok := merry.Unwrap(err).(helper.ErrUnknownFunction); ok {
+				msg := buildUnknownFunctionErrorString(target, string(unknownFunction))
+				setError(w, accessLogDetails, msg, http.StatusBadRequest)
+				logAsError = true
+				return
+			}
+			// truncated series are never returned as a partial response, see ignoreTagTruncation
+			if merry.Is(err, zipperTypes.ErrSeriesTruncated) {
+				setError(w, accessLogDetails, err.Error(), http.StatusBadRequest)
+				logAsError = true
+				return
+			}
 			if err != nil {
 				errors[target] = merry.Wrap(err)
 			}
 
 			results = append(results, result...)
+
+			if msg := checkSeriesLimits(len(results), result); msg != "" {
+				setError(w, accessLogDetails, msg, http.StatusBadRequest)
+				logAsError = true
+				return
+			}
+		}
+
+		if expr.Cancelled(ctx) != nil {
+			setClientGone(logger, accessLogDetails)
+			return
 		}
 
 		for mFetch := range values {
@@ -323,7 +643,19 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 			accessLogDetails.MaxDataPoints = maxDataPoints
 		}
 
-		body = types.MarshalJSON(results, timestampMultiplier, noNullPoints)
+		var seriesMeta map[*types.MetricData]types.SeriesMeta
+		if fetchMetaCollector != nil {
+			seriesMeta = buildSeriesMeta(results, fetchMetaCollector)
+		}
+
+		if jsonEnvelope {
+			body = types.MarshalJSONWithErrors(results, timestampMultiplier, noNullPoints, collectResponseErrors(errors, errorCollector), seriesMeta)
+		} else {
+			body = types.MarshalJSONWithMeta(results, timestampMultiplier, noNullPoints, seriesMeta)
+		}
+		if pretty {
+			body = indentJSON(body)
+		}
 	case protoV2Format:
 		body, err = types.MarshalProtobufV2(results)
 		if err != nil {
@@ -354,9 +686,18 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	accessLogDetails.CarbonzipperResponseSizeBytes = int64(size)
 	accessLogDetails.CarbonapiResponseSizeBytes = int64(len(body))
 
+	partialFailures := countPartialFailures(errors, errorCollector)
+	if len(results) != 0 && partialFailures != 0 {
+		w.Header().Set(partialFailureHeader, strconv.Itoa(partialFailures))
+	}
+	if fetchMetaCollector != nil {
+		w.Header().Set(backendsHeader, strconv.Itoa(len(fetchMetaCollector.Backends())))
+	}
+
 	writeResponse(w, returnCode, body, format, jsonp)
 
-	if len(results) != 0 {
+	// partial responses are not cached, so the failure won't be hidden for the cache TTL
+	if len(results) != 0 && partialFailures == 0 {
 		tc := time.Now()
 		config.Config.ResponseCache.Set(responseCacheKey, body, responseCacheTimeout)
 		td := time.Since(tc).Nanoseconds()
@@ -367,6 +708,102 @@ func renderHandler(w http.ResponseWriter, r *http.Request) {
 	accessLogDetails.HaveNonFatalErrors = gotErrors
 }
 
+// checkSeriesLimits returns non-empty error message if response with total series exceeds configured maxSeries or
+// any of the newly evaluated results exceeds maxSeriesNameLength
+func checkSeriesLimits(total int, results []*types.MetricData) string {
+	if config.Config.MaxSeries > 0 && total > config.Config.MaxSeries {
+		return fmt.Sprintf("too many series in response: %d, limit is %d", total, config.Config.MaxSeries)
+	}
+	if config.Config.MaxSeriesNameLength > 0 {
+		for _, r := range results {
+			if len(r.Name) > config.Config.MaxSeriesNameLength {
+				return fmt.Sprintf("series name is too long: %d, limit is %d", len(r.Name), config.Config.MaxSeriesNameLength)
+			}
+		}
+	}
+	return ""
+}
+
+// buildSeriesMeta returns backends and archive that served each of the results together with consolidation that was applied
+func buildSeriesMeta(results []*types.MetricData, collector *utilctx.FetchMetaCollector) map[*types.MetricData]types.SeriesMeta {
+	res := make(map[*types.MetricData]types.SeriesMeta, len(results))
+	for _, r := range results {
+		fetchMeta, _ := collector.Get(r.PathExpression, r.Name)
+		meta := types.SeriesMeta{
+			Backends:          fetchMeta.Backends,
+			Archive:           fetchMeta.StepTime,
+			ConsolidationFunc: r.ConsolidationFunc,
+			ValuesPerPoint:    r.ValuesPerPoint,
+		}
+		if meta.Backends == nil {
+			meta.Backends = []string{}
+		}
+		if meta.ConsolidationFunc == "" {
+			meta.ConsolidationFunc = "average"
+		}
+		if meta.ValuesPerPoint == 0 {
+			meta.ValuesPerPoint = 1
+		}
+		res[r] = meta
+	}
+	return res
+}
+
+type explainResponse struct {
+	Targets []expr.Cost `json:"targets"`
+	Cost    int64       `json:"cost"`
+	MaxCost int64       `json:"maxCost"`
+}
+
+// buildCostErrorString returns error message for requests that exceed maxCost, pointing to the most expensive target
+func buildCostErrorString(costs []expr.Cost, totalCost int64) string {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "query is too expensive: estimated cost %d exceeds maxCost %d\n", totalCost, config.Config.MaxCost)
+	var worst expr.Cost
+	for _, c := range costs {
+		if c.Cost > worst.Cost {
+			worst = c
+		}
+	}
+	if worst.Target != "" {
+		fmt.Fprintf(&msg, "most expensive target: %s (%d metrics * %d points * %d complexity = %d)\n",
+			worst.Target, worst.Metrics, worst.Points, worst.Complexity, worst.Cost)
+	}
+	msg.WriteString("use narrower time range or more specific patterns")
+	return msg.String()
+}
+
+// countPartialFailures returns amount of failed targets and backends, targets that don't exist are not failures
+func countPartialFailures(errors map[string]merry.Error, errorCollector *utilctx.ErrorCollector) int {
+	n := len(errorCollector.Errors())
+	for _, err := range errors {
+		if merry.HTTPCode(err) == http.StatusNotFound || merry.Is(err, parser.ErrSeriesDoesNotExist) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// collectResponseErrors returns per-target errors (sorted by target) followed by non-fatal backend errors
+func collectResponseErrors(errors map[string]merry.Error, errorCollector *utilctx.ErrorCollector) []types.ResponseError {
+	targets := make([]string, 0, len(errors))
+	for target := range errors {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	res := make([]types.ResponseError, 0, len(errors))
+	for _, target := range targets {
+		res = append(res, types.ResponseError{Target: target, Error: errors[target].Error()})
+	}
+	for _, e := range errorCollector.Errors() {
+		res = append(res, types.ResponseError{Error: e})
+	}
+
+	return res
+}
+
 func backendCacheComputeKey(from, until string, targets []string) string {
 	var backendCacheKey bytes.Buffer
 	backendCacheKey.WriteString("from:")
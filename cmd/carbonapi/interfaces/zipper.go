@@ -20,4 +20,5 @@ type CarbonZipper interface {
 	TagNames(ctx context.Context, query string, limit int64) ([]string, merry.Error)
 	TagValues(ctx context.Context, query string, limit int64) ([]string, merry.Error)
 	ScaleToCommonStep() bool
+	ProbeBackends(ctx context.Context) map[string]merry.Error
 }
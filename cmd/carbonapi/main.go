@@ -8,10 +8,12 @@ import (
 	"net/http/pprof"
 	_ "net/http/pprof"
 	"sync"
+	"time"
 
 	"github.com/facebookgo/grace/gracehttp"
 	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
 	carbonapiHttp "github.com/go-graphite/carbonapi/cmd/carbonapi/http"
+	"github.com/go-graphite/carbonapi/date"
 	"github.com/gorilla/handlers"
 	"github.com/lomik/zapwriter"
 	"go.uber.org/zap"
@@ -35,7 +37,17 @@ func main() {
 	if *envPrefix == "" {
 		logger.Warn("empty prefix is not recommended due to possible collisions with OS environment variables")
 	}
+	now := flag.Int64("now", 0, "Freeze current time at the given unix `timestamp`, relative time ranges are resolved against it. Intended for tests only")
 	flag.Parse()
+	if *now != 0 {
+		frozen := time.Unix(*now, 0)
+		timeNow := func() time.Time { return frozen }
+		date.SetTimeNow(timeNow)
+		carbonapiHttp.SetTimeNow(timeNow)
+		logger.Warn("current time is frozen",
+			zap.Time("now", frozen),
+		)
+	}
 	config.SetUpViper(logger, configPath, *envPrefix)
 	config.SetUpConfigUpstreams(logger)
 	config.SetUpConfig(logger, BuildVersion)
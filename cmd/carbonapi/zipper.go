@@ -85,6 +85,9 @@ func (z zipper) Render(ctx context.Context, request pb.MultiFetchRequest) ([]*ty
 		hdrs := util.GetPassHeaders(ctx)
 		newCtx = util.SetUUID(context.Background(), uuid)
 		newCtx = util.SetPassHeaders(newCtx, hdrs)
+		if collector := util.GetFetchMetaCollector(ctx); collector != nil {
+			newCtx = util.SetFetchMetaCollector(newCtx, collector)
+		}
 	}
 
 	pbresp, stats, err := z.z.FetchProtoV3(newCtx, &request)
@@ -129,3 +132,7 @@ func (z zipper) TagValues(ctx context.Context, query string, limit int64) ([]str
 func (z zipper) ScaleToCommonStep() bool {
 	return z.z.ScaleToCommonStep
 }
+
+func (z zipper) ProbeBackends(ctx context.Context) map[string]merry.Error {
+	return z.z.ProbeBackends(ctx)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// canonicalizers reorder series in bodies of textual formats, where order of series doesn't matter but depends
+// on order of backend responses. sha256 of these formats is computed over the canonical body, so it's stable
+var canonicalizers = map[string]func(b []byte) []byte{
+	contentTypeCSV: canonicalCSV,
+	contentTypeRaw: canonicalRaw,
+}
+
+// canonicalBody returns body with series sorted by target, if it's of the format order of series doesn't matter in
+func canonicalBody(contentType string, b []byte) []byte {
+	if canonicalize, ok := canonicalizers[contentType]; ok {
+		return canonicalize(b)
+	}
+	return b
+}
+
+// seriesLines are lines of the body that belong to the same series
+type seriesLines struct {
+	target string
+	lines  []string
+}
+
+// groupLines splits body into lines, target returns name of the series the line belongs to.
+// Consecutive lines of the same series are kept together
+func groupLines(b []byte, target func(line string) string) []seriesLines {
+	res := make([]seriesLines, 0)
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		name := target(line)
+		if len(res) == 0 || res[len(res)-1].target != name {
+			res = append(res, seriesLines{target: name})
+		}
+		res[len(res)-1].lines = append(res[len(res)-1].lines, line)
+	}
+	return res
+}
+
+// joinSorted sorts series by target (and by their lines if targets are the same) and joins them back
+func joinSorted(series []seriesLines, trailingNewline bool) []byte {
+	sort.SliceStable(series, func(i, j int) bool {
+		if series[i].target != series[j].target {
+			return series[i].target < series[j].target
+		}
+		return strings.Join(series[i].lines, "\n") < strings.Join(series[j].lines, "\n")
+	})
+
+	lines := make([]string, 0, len(series))
+	for _, s := range series {
+		lines = append(lines, s.lines...)
+	}
+	res := strings.Join(lines, "\n")
+	if trailingNewline {
+		res += "\n"
+	}
+	return []byte(res)
+}
+
+// canonicalCSV sorts rows of series by target, rows of the same series keep their order.
+// Row is "target,time,value" and target can contain commas
+func canonicalCSV(b []byte) []byte {
+	series := groupLines(b, func(line string) string {
+		i := strings.LastIndexByte(line, ',')
+		if i < 0 {
+			return line
+		}
+		if j := strings.LastIndexByte(line[:i], ','); j >= 0 {
+			return line[:j]
+		}
+		return line[:i]
+	})
+	return joinSorted(series, strings.HasSuffix(string(b), "\n"))
+}
+
+// canonicalRaw sorts lines of series by target. Line is "target,start,stop,step|values" and target can contain commas
+func canonicalRaw(b []byte) []byte {
+	series := make([]seriesLines, 0)
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		// every line is a separate series, even if targets are the same
+		target := line
+		if i := strings.LastIndexByte(line, '|'); i >= 0 {
+			target = line[:i]
+		}
+		for n := 0; n < 3; n++ {
+			if i := strings.LastIndexByte(target, ','); i >= 0 {
+				target = target[:i]
+			}
+		}
+		series = append(series, seriesLines{target: target, lines: []string{line}})
+	}
+	return joinSorted(series, strings.HasSuffix(string(b), "\n"))
+}
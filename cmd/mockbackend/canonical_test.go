@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{
+			name:        "raw",
+			contentType: contentTypeRaw,
+			body:        "d.e.f,1,4,1|4,5,6\nsum(a,b),1,4,1|None,1,2\na.b.c,1,4,1|1,3,2\n",
+			want:        "a.b.c,1,4,1|1,3,2\nd.e.f,1,4,1|4,5,6\nsum(a,b),1,4,1|None,1,2\n",
+		},
+		{
+			name:        "raw with the same targets",
+			contentType: contentTypeRaw,
+			body:        "x,1,3,1|2,2\nx,1,3,1|1,1",
+			want:        "x,1,3,1|1,1\nx,1,3,1|2,2",
+		},
+		{
+			// points of the series keep their order
+			name:        "csv",
+			contentType: contentTypeCSV,
+			body:        "d.e.f,1970-01-01 00:00:01,4\nd.e.f,1970-01-01 00:00:02,\n\"sum(a,b)\",1970-01-01 00:00:01,1\na.b.c,1970-01-01 00:00:02,3\na.b.c,1970-01-01 00:00:01,1\n",
+			want:        "\"sum(a,b)\",1970-01-01 00:00:01,1\na.b.c,1970-01-01 00:00:02,3\na.b.c,1970-01-01 00:00:01,1\nd.e.f,1970-01-01 00:00:01,4\nd.e.f,1970-01-01 00:00:02,\n",
+		},
+		{
+			// order of series in json is kept
+			name:        "json",
+			contentType: contentTypeJSON,
+			body:        `[{"target":"d.e.f"},{"target":"a.b.c"}]`,
+			want:        `[{"target":"d.e.f"},{"target":"a.b.c"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(canonicalBody(tt.contentType, []byte(tt.body))); got != tt.want {
+				t.Errorf("unexpected body\ngot  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckSHA256Canonical(t *testing.T) {
+	// sha256 of "a.b.c,1,4,1|1,3,2\nd.e.f,1,4,1|4,5,6\n"
+	expected := []string{"23c7a19158457d454a27e831f0c80ae71dbc5b086165c6dac439d8162acf7892"}
+	for _, body := range []string{
+		"a.b.c,1,4,1|1,3,2\nd.e.f,1,4,1|4,5,6\n",
+		"d.e.f,1,4,1|4,5,6\na.b.c,1,4,1|1,3,2\n",
+	} {
+		resp := &testResponse{body: []byte(body)}
+		if failures := (rawDecoder{}).Check(&Query{}, resp, ExpectedResult{SHA256: expected}); len(failures) != 0 {
+			t.Errorf("body %q: unexpected failures %v", body, failures)
+		}
+	}
+}
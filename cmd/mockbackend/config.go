@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StrictConfig makes unknown fields in config an error, so typos (e.x. expectedResult instead of expectedResults)
+// are not silently ignored
+var StrictConfig = true
+
+// loadConfig reads config from the file and merges test apps and queries of all included files into it.
+// stack contains files that are currently being loaded and is used to detect include cycles
+func loadConfig(path string, config *MainConfig, stack []string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, p := range stack {
+		if p == absPath {
+			return fmt.Errorf("include cycle detected: %v -> %v", strings.Join(stack, " -> "), absPath)
+		}
+	}
+	stack = append(stack, absPath)
+
+	d, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return err
+	}
+
+	if StrictConfig {
+		err = yaml.UnmarshalStrict(d, config)
+	} else {
+		err = yaml.Unmarshal(d, config)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+
+	// expected images and golden bodies are next to the config, like included files. Oracle of the test
+	// is set for queries of this file only
+	if config.Test != nil {
+		for i := range config.Test.Queries {
+			if config.Test.Queries[i].OracleEndpoint == "" {
+				config.Test.Queries[i].OracleEndpoint = config.Test.OracleEndpoint
+			}
+			expected := &config.Test.Queries[i].ExpectedResponse
+			if expected.GoldenBodyFile != "" && !filepath.IsAbs(expected.GoldenBodyFile) {
+				expected.GoldenBodyFile = filepath.Join(filepath.Dir(absPath), expected.GoldenBodyFile)
+			}
+			results := expected.ExpectedResults
+			for j := range results {
+				if results[j].SVG != "" && !filepath.IsAbs(results[j].SVG) {
+					results[j].SVG = filepath.Join(filepath.Dir(absPath), results[j].SVG)
+				}
+			}
+		}
+	}
+
+	for _, include := range config.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(absPath), include)
+		}
+
+		var child MainConfig
+		err = loadConfig(include, &child, stack)
+		if err != nil {
+			return err
+		}
+
+		err = mergeTest(config, &child)
+		if err != nil {
+			return fmt.Errorf("%v: %v", include, err)
+		}
+	}
+
+	return nil
+}
+
+// mergeTest adds apps and queries of the child config to the parent one
+func mergeTest(parent, child *MainConfig) error {
+	if child.Test == nil {
+		return nil
+	}
+	if parent.Test == nil {
+		parent.Test = &TestSchema{}
+	}
+
+	for _, app := range child.Test.Apps {
+		duplicate := false
+		for _, a := range parent.Test.Apps {
+			if a.Name != app.Name {
+				continue
+			}
+			if !reflect.DeepEqual(a, app) {
+				return fmt.Errorf("conflicting definitions of app '%v'", app.Name)
+			}
+			duplicate = true
+			break
+		}
+		if !duplicate {
+			parent.Test.Apps = append(parent.Test.Apps, app)
+		}
+	}
+	parent.Test.Queries = append(parent.Test.Queries, child.Test.Queries...)
+
+	return nil
+}
+
+// validateTest checks queries for mistakes that can't be caught by parsing, e.x. missing expected results
+func validateTest(test *TestSchema) error {
+	// responses are compared with each other or not checked at all in these modes
+	if test == nil || len(test.Compare) != 0 || test.Load != nil {
+		return nil
+	}
+
+	for i := range test.Queries {
+		q := &test.Queries[i]
+		expected := &q.ExpectedResponse
+		if expected.HttpCode >= 300 || expected.ExpectEmpty || expected.GoldenBodyFile != "" || len(q.Formats) != 0 || q.OracleEndpoint != "" {
+			continue
+		}
+		if requiresExpectedResults(expected.ContentType) && len(expected.ExpectedResults) == 0 {
+			return fmt.Errorf("query %v '%v' (%v): expectedResults are required for content-type %v", i+1, q.Name, q.URL, expected.ContentType)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigStrict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.yaml")
+	config := `version: "v1"
+test:
+    queries:
+        - endpoint: "http://127.0.0.1:8081"
+          type: "GET"
+          URL: "/render?format=json&target=a.b.c"
+          expectedResponse:
+              httpCode: 200
+              contentType: "application/json"
+              expectedResult:
+                  - metrics: []
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg MainConfig
+	err = loadConfig(path, &cfg, nil)
+	if err == nil || !strings.Contains(err.Error(), "line 10: field expectedResult not found") {
+		t.Fatalf("expected error about unknown field, got %v", err)
+	}
+
+	StrictConfig = false
+	defer func() {
+		StrictConfig = true
+	}()
+	cfg = MainConfig{}
+	if err := loadConfig(path, &cfg, nil); err != nil {
+		t.Fatalf("unexpected error in lenient mode: %v", err)
+	}
+}
+
+func TestLoadConfigSVGPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.yaml")
+	config := `version: "v1"
+test:
+    queries:
+        - endpoint: "http://127.0.0.1:8081"
+          type: "GET"
+          URL: "/render?format=svg&target=a.b.c"
+          expectedResponse:
+              httpCode: 200
+              contentType: "image/svg+xml"
+              expectedResults:
+                  - svg: "images/a.svg"
+                  - svg: "/tmp/b.svg"
+              goldenBodyFile: "golden/render.svg.gz"
+`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg MainConfig
+	if err := loadConfig(path, &cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	results := cfg.Test.Queries[0].ExpectedResponse.ExpectedResults
+	if results[0].SVG != filepath.Join(dir, "images/a.svg") {
+		t.Errorf("relative path must be resolved from the config directory, got %v", results[0].SVG)
+	}
+	if results[1].SVG != "/tmp/b.svg" {
+		t.Errorf("absolute path must be kept, got %v", results[1].SVG)
+	}
+	if golden := cfg.Test.Queries[0].ExpectedResponse.GoldenBodyFile; golden != filepath.Join(dir, "golden/render.svg.gz") {
+		t.Errorf("relative path of golden body must be resolved from the config directory, got %v", golden)
+	}
+}
+
+func TestValidateTest(t *testing.T) {
+	query := func(contentType string, results []ExpectedResult) Query {
+		return Query{
+			URL: "/render?target=a.b.c",
+			ExpectedResponse: ExpectedResponse{
+				HttpCode:        200,
+				ContentType:     contentType,
+				ExpectedResults: results,
+			},
+		}
+	}
+
+	golden := query("text/csv", nil)
+	golden.ExpectedResponse.GoldenBodyFile = "render.csv.gz"
+	oracle := query("application/json", nil)
+	oracle.OracleEndpoint = "${GRAPHITE_WEB_URL}"
+
+	tests := []struct {
+		name   string
+		test   TestSchema
+		failed bool
+	}{
+		{"json with results", TestSchema{Queries: []Query{query("application/json", []ExpectedResult{{}})}}, false},
+		{"json without results", TestSchema{Queries: []Query{query("application/json", nil)}}, true},
+		{"csv without results", TestSchema{Queries: []Query{query("text/csv", nil)}}, true},
+		{"png without results", TestSchema{Queries: []Query{query("image/png", nil)}}, false},
+		{"csv with golden body", TestSchema{Queries: []Query{golden}}, false},
+		{"json with oracle", TestSchema{Queries: []Query{oracle}}, false},
+		{"compare mode", TestSchema{Compare: []string{"a", "b"}, Queries: []Query{query("application/json", nil)}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateTest(&tt.test); (err != nil) != tt.failed {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestTestcasesValid(t *testing.T) {
+	files, err := filepath.Glob("testcases/*/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		// other files in directories of test cases are included ones or configs of apps
+		if filepath.Base(filepath.Dir(f))+".yaml" != filepath.Base(f) {
+			continue
+		}
+		var cfg MainConfig
+		if err := loadConfig(f, &cfg, nil); err != nil {
+			t.Errorf("%v: %v", f, err)
+			continue
+		}
+		if cfg.Test != nil {
+			cfg.Test.Queries = expandQueries(cfg.Test.Queries)
+		}
+		if err := validateTest(cfg.Test); err != nil {
+			t.Errorf("%v: %v", f, err)
+		}
+	}
+}
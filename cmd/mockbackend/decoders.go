@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// ResponseDecoder checks body of responses of the content-type it's registered for, see RegisterResponseDecoder
+type ResponseDecoder interface {
+	// RequiresExpectedResults returns true if response can't be checked without expectedResults of the query
+	RequiresExpectedResults() bool
+	// Check compares response with expected result and returns failures. expected is the first of expectedResults
+	// of the query, it's empty if there are none
+	Check(t *Query, resp *testResponse, expected ExpectedResult) []string
+}
+
+// SeriesDecoder is implemented by decoders of formats that contain series. Series of such responses can be compared
+// with ones in other formats (see Query.Formats) and with responses of oracle
+type SeriesDecoder interface {
+	// DecodeSeries parses body of the response to the query
+	DecodeSeries(t *Query, b []byte) ([]CarbonAPIResponse, error)
+}
+
+// responseDecoders are decoders of response bodies by content-type
+var responseDecoders = map[string]ResponseDecoder{
+	contentTypePNG:      pngDecoder{},
+	contentTypeSVG:      svgDecoder{},
+	contentTypeJSON:     jsonDecoder{},
+	contentTypeCSV:      csvDecoder{},
+	contentTypeRaw:      rawDecoder{},
+	contentTypeProtobuf: protobufDecoder{},
+}
+
+// RegisterResponseDecoder makes responses of the content-type to be checked by the decoder, so formats that
+// are unknown to doTest can be tested. Decoder replaces the one registered before for the same content-type.
+// If it implements SeriesDecoder as well, responses are decoded with it in formats and oracle comparisons
+func RegisterResponseDecoder(contentType string, decoder ResponseDecoder) {
+	responseDecoders[contentType] = decoder
+}
+
+// pngDecoder doesn't check images, they differ between distros, see doc/development/e2e_tests.md
+type pngDecoder struct{}
+
+func (pngDecoder) RequiresExpectedResults() bool { return false }
+
+func (pngDecoder) Check(t *Query, resp *testResponse, expected ExpectedResult) []string {
+	return nil
+}
+
+// svgDecoder compares image with the expected one or checks its sha256
+type svgDecoder struct{}
+
+func (svgDecoder) RequiresExpectedResults() bool { return true }
+
+func (svgDecoder) Check(t *Query, resp *testResponse, expected ExpectedResult) []string {
+	if expected.SVG != "" {
+		return checkSVG(resp.body, expected.SVG)
+	}
+	return checkSHA256(resp.body, expected.SHA256)
+}
+
+// checkSHA256 checks that sha256 of the body is one of the expected ones
+func checkSHA256(b []byte, expected []string) []string {
+	hashStr := fmt.Sprintf("%x", sha256.Sum256(b))
+	for _, sha256sum := range expected {
+		if hashStr == sha256sum {
+			return nil
+		}
+	}
+	encodedBody := base64.StdEncoding.EncodeToString(b)
+	return []string{fmt.Sprintf("sha256 mismatch, got '%v', expected '%v', encodedBodyy: '%v'", hashStr, expected, encodedBody)}
+}
+
+// jsonDecoder checks response of /metrics/find, list of strings or series
+type jsonDecoder struct{}
+
+func (jsonDecoder) RequiresExpectedResults() bool { return true }
+
+func (jsonDecoder) Check(t *Query, resp *testResponse, expected ExpectedResult) []string {
+	if expected.Find != nil {
+		return checkFind(resp.body, expected.Find)
+	}
+	if expected.List != nil {
+		return checkList(resp.body, expected.List)
+	}
+	// big responses are checked while they are read, see doTest
+	if resp.streamed {
+		return resp.streamFailures
+	}
+	return checkMetrics(bytes.NewReader(resp.body), expected)
+}
+
+func (jsonDecoder) DecodeSeries(t *Query, b []byte) ([]CarbonAPIResponse, error) {
+	return parseJSON(b)
+}
+
+// csvDecoder compares series with expected ones or checks sha256 of the body with series sorted by target
+type csvDecoder struct{}
+
+func (csvDecoder) RequiresExpectedResults() bool { return true }
+
+func (csvDecoder) Check(t *Query, resp *testResponse, expected ExpectedResult) []string {
+	if expected.SHA256 != nil {
+		return checkSHA256(canonicalBody(contentTypeCSV, resp.body), expected.SHA256)
+	}
+	return checkCSV(resp.body, expected)
+}
+
+func (csvDecoder) DecodeSeries(t *Query, b []byte) ([]CarbonAPIResponse, error) {
+	return parseCSV(b)
+}
+
+// rawDecoder compares series with expected ones or checks sha256 of the body with series sorted by target
+type rawDecoder struct{}
+
+func (rawDecoder) RequiresExpectedResults() bool { return true }
+
+func (rawDecoder) Check(t *Query, resp *testResponse, expected ExpectedResult) []string {
+	if expected.SHA256 != nil {
+		return checkSHA256(canonicalBody(contentTypeRaw, resp.body), expected.SHA256)
+	}
+	metrics, err := parseRaw(resp.body)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return matchMetrics(metrics, expected)
+}
+
+func (rawDecoder) DecodeSeries(t *Query, b []byte) ([]CarbonAPIResponse, error) {
+	return parseRaw(b)
+}
+
+type protobufDecoder struct{}
+
+func (protobufDecoder) RequiresExpectedResults() bool { return true }
+
+func (protobufDecoder) Check(t *Query, resp *testResponse, expected ExpectedResult) []string {
+	return checkProtobuf(resp.body, requestFormat(t), expected)
+}
+
+func (protobufDecoder) DecodeSeries(t *Query, b []byte) ([]CarbonAPIResponse, error) {
+	return parseProtobuf(b, requestFormat(t))
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// lineDecoder checks responses of made-up format, that has a series name per line, optionally followed by its values
+// at timestamps 1, 2, ...
+type lineDecoder struct{}
+
+func (lineDecoder) RequiresExpectedResults() bool { return true }
+
+func (lineDecoder) Check(t *Query, resp *testResponse, expected ExpectedResult) []string {
+	got := strings.Split(strings.TrimSpace(string(resp.body)), "\n")
+	if !reflect.DeepEqual(got, expected.List) {
+		return []string{fmt.Sprintf("lines are different, got %q, expected %q", got, expected.List)}
+	}
+	return nil
+}
+
+func (lineDecoder) DecodeSeries(t *Query, b []byte) ([]CarbonAPIResponse, error) {
+	metrics := make([]CarbonAPIResponse, 0)
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.Fields(line)
+		series := CarbonAPIResponse{Target: fields[0]}
+		for i, v := range fields[1:] {
+			value, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, err
+			}
+			series.Datapoints = append(series.Datapoints, Datapoint{Timestamp: i + 1, Value: value})
+		}
+		metrics = append(metrics, series)
+	}
+	return metrics, nil
+}
+
+func TestRegisterResponseDecoder(t *testing.T) {
+	const contentType = "application/x-lines"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte("a.b.c\nd.e.f\n"))
+	}))
+	defer srv.Close()
+
+	query := func(results []ExpectedResult) *Query {
+		return &Query{
+			Endpoint: srv.URL,
+			Type:     "GET",
+			URL:      "/render?format=lines&target=*.*.*",
+			ExpectedResponse: ExpectedResponse{
+				HttpCode:        http.StatusOK,
+				ContentType:     contentType,
+				ExpectedResults: results,
+			},
+		}
+	}
+
+	failures := doTest(zap.NewNop(), query([]ExpectedResult{{List: []string{"a.b.c", "d.e.f"}}}))
+	if len(failures) != 1 || !strings.Contains(failures[0], "unsupported content-type") {
+		t.Fatalf("response of unknown content-type must fail, got %v", failures)
+	}
+
+	RegisterResponseDecoder(contentType, lineDecoder{})
+	defer delete(responseDecoders, contentType)
+
+	tests := []struct {
+		name     string
+		results  []ExpectedResult
+		failures []string
+	}{
+		{
+			name:    "same",
+			results: []ExpectedResult{{List: []string{"a.b.c", "d.e.f"}}},
+		},
+		{
+			name:     "different",
+			results:  []ExpectedResult{{List: []string{"a.b.c"}}},
+			failures: []string{`lines are different, got ["a.b.c" "d.e.f"], expected ["a.b.c"]`},
+		},
+		{
+			name:     "no expected results",
+			failures: []string{"no expectedResults to compare response of content-type application/x-lines with"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := doTest(zap.NewNop(), query(tt.results))
+			if len(failures) == 0 {
+				failures = nil
+			}
+			if !reflect.DeepEqual(failures, tt.failures) {
+				t.Errorf("unexpected failures %q, expected %q", failures, tt.failures)
+			}
+		})
+	}
+}
+
+func TestRegisteredSeriesDecoder(t *testing.T) {
+	const contentType = "application/x-lines"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") == "lines" {
+			w.Header().Set("Content-Type", contentType)
+			_, _ = w.Write([]byte("a.b.c 1 3\n"))
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[{"target":"a.b.c","datapoints":[[1,1],[3,2]]}]`))
+	}))
+	defer srv.Close()
+
+	q := &Query{
+		Endpoint: srv.URL,
+		Type:     "GET",
+		URL:      "/render?target=a.b.c",
+		Formats:  []string{"json", "lines"},
+		ExpectedResponse: ExpectedResponse{
+			HttpCode: http.StatusOK,
+		},
+	}
+
+	failures := doFormatsTest(zap.NewNop(), q)
+	if len(failures) != 1 || !strings.Contains(failures[0], "unsupported content-type") {
+		t.Fatalf("response of unknown content-type must fail, got %v", failures)
+	}
+
+	RegisterResponseDecoder(contentType, lineDecoder{})
+	defer delete(responseDecoders, contentType)
+
+	if failures := doFormatsTest(zap.NewNop(), q); len(failures) != 0 {
+		t.Fatalf("series of registered decoder must be compared with other formats, got %v", failures)
+	}
+}
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"crypto/sha256"
-	"encoding/base64"
+	"crypto/tls"
+	"encoding/csv"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,48 +15,286 @@ import (
 	"math"
 	"net/http"
 	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
+	"github.com/go-graphite/protocol/carbonapi_v2_pb"
+	"github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"go.uber.org/zap"
 )
 
 type TestSchema struct {
 	Apps    []App
 	Queries []Query
+	// Compare contains names of two apps (baseline first). If set, every query is sent to both of them
+	// and responses are compared with each other instead of expectedResponse
+	Compare []string `yaml:"compare"`
+	// Load enables load-generation mode, see LoadTest
+	Load *LoadTest `yaml:"load"`
+	// Concurrency is how many queries are run in parallel, 1 by default
+	Concurrency int `yaml:"concurrency"`
+	// Summary is a path of the file the JSON summary of the run is written to, see runSummary
+	Summary string `yaml:"summary"`
+	// MaxSuiteDuration is a time budget of the whole run including start of apps, run fails if it's exceeded
+	// even if all the queries passed. Zero means no limit
+	MaxSuiteDuration time.Duration `yaml:"maxSuiteDuration"`
+	// OracleEndpoint is the default oracleEndpoint of queries in the same file, see Query
+	OracleEndpoint string `yaml:"oracleEndpoint"`
 }
 
 type App struct {
 	Name   string
 	Binary string
 	Args   []string
+	// Endpoint is used to send queries to the app in compare mode
+	Endpoint string `yaml:"endpoint"`
+	// Env contains environment variables of the app, they are set over the ones mockbackend is started with
+	Env map[string]string `yaml:"env"`
+	// DependsOn contains names of apps that must be ready before this one is started
+	DependsOn []string `yaml:"dependsOn"`
+	// Ready is an address app listens on when it's ready to serve. It's required for apps other ones depend on,
+	// defaults to the port allocated for the app, if any
+	Ready string `yaml:"ready"`
+	// Now, if set, is passed to the app as -now flag, so its clock is frozen at this unix timestamp
+	// and relative time ranges (e.x. from=-1h) are the same on every run
+	Now int64 `yaml:"now"`
+	// RestartOnCrash makes the app to be started again if it exits with error, up to MaxRestarts times
+	// (3 by default), so queries after the crash can check how the rest of the system recovers
+	RestartOnCrash bool `yaml:"restartOnCrash"`
+	MaxRestarts    int  `yaml:"maxRestarts"`
 }
 
 type Query struct {
+	// Name is used to select queries with -only flag and in logs
+	Name string `yaml:"name"`
+	// Skip disables the query, unless it's selected with -only
+	Skip bool `yaml:"skip"`
+	// Repeat is how many times query is sent in a row, useful to catch flaky results
+	Repeat int `yaml:"repeat"`
+	// ExpectFailure marks known gaps: query passes only if it fails, with ExpectedError in failures if it's set
+	ExpectFailure    bool             `yaml:"expectFailure"`
+	ExpectedError    string           `yaml:"expectedError"`
 	Endpoint         string           `yaml:"endpoint"`
 	Delay            int              `yaml:"delay"`
 	URL              string           `yaml:"URL"`
 	Type             string           `yaml:"type"`
 	Body             string           `yaml:"body"`
 	ExpectedResponse ExpectedResponse `yaml:"expectedResponse"`
+	// ContentType of the body, defaults to application/x-www-form-urlencoded for POST queries
+	ContentType string `yaml:"contentType"`
+	// Retries is how many times request is resent if it fails on network level (e.x. connection is refused),
+	// responses with unexpected status are not retried. RetryInterval is the pause between them, 200ms by default
+	Retries       int           `yaml:"retries"`
+	RetryInterval time.Duration `yaml:"retryInterval"`
+	// PollUntil makes the query to be resent till its response is as expected or the timeout is elapsed,
+	// e.x. to wait for data written to eventually consistent backend. RetryInterval is the pause between attempts
+	PollUntil time.Duration `yaml:"pollUntil"`
+	// Setup actions are run before the query, if any of them fails query is skipped and reported as failed.
+	// Teardown actions are run after the query regardless of its result
+	Setup    []Action `yaml:"setup"`
+	Teardown []Action `yaml:"teardown"`
+	// ExpectedBackendRequests is amount of requests listeners must receive while the query is run by path, e.x. "/render",
+	// or by listener address and path, e.x. ":9070/render". With concurrency requests of other queries are counted as well
+	ExpectedBackendRequests map[string]int `yaml:"expectedBackendRequests"`
+	// Formats, if set, make the query to be sent once per format (format parameter of URL is replaced) and series of
+	// all the responses are checked to be the same as in the first one. expectedResponse is checked for the first format
+	Formats []string `yaml:"formats"`
+	// ExpectedLogs are substrings (or regular expressions enclosed in slashes) that must appear in output
+	// of the apps while the query is run. With concurrency output of other queries can match as well
+	ExpectedLogs []string `yaml:"expectedLogs"`
+	// Headers are added to the request. Values can reference environment variables as ${NAME},
+	// such values are not shown in logs and recorded HAR
+	Headers map[string]string `yaml:"headers"`
+	// Matrix contains values of variables, query is expanded into one query per combination of them
+	// with ${var} substituted in URL, body and expected response
+	Matrix map[string][]string `yaml:"matrix"`
+	// OracleEndpoint is an address of graphite-web reading the same data, e.x. ${GRAPHITE_WEB_URL}. If set, the query
+	// is sent to both and series are compared with the oracle's ones instead of expectedResponse. Query is skipped
+	// if the variable it references is not set
+	OracleEndpoint string `yaml:"oracleEndpoint"`
+	// HTTP2 makes the client prefer HTTP/2. It's negotiated with TLS servers only, requests to http:// endpoints
+	// are sent over HTTP/1.1 anyway. InsecureSkipVerify allows self-signed certificates, e.x. of tls listeners
+	HTTP2              bool `yaml:"http2"`
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+}
+
+// Action is either a command or HTTP request, e.x. to seed or flush a cache. Command is run without shell,
+// HTTP request must succeed with 2xx status
+type Action struct {
+	Command  []string `yaml:"command"`
+	Endpoint string   `yaml:"endpoint"`
+	Type     string   `yaml:"type"`
+	URL      string   `yaml:"URL"`
+	Body     string   `yaml:"body"`
+}
+
+// run performs the action
+func (a *Action) run() error {
+	if len(a.Command) != 0 {
+		out, err := exec.Command(a.Command[0], a.Command[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("command %q failed: %v, output '%v'", a.Command, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	method := a.Type
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, a.Endpoint+a.URL, strings.NewReader(a.Body))
+	if err != nil {
+		return fmt.Errorf("failed to prepare the request: %v", err)
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request %v %v failed: %v", method, a.URL, err)
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("request %v %v failed with status %v, body '%v'", method, a.URL, resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// runActions performs actions one by one and stops on the first failure
+func runActions(logger *zap.Logger, kind string, actions []Action) error {
+	for i := range actions {
+		logger.Debug("running action",
+			zap.String("kind", kind),
+			zap.Any("action", actions[i]),
+		)
+		if err := actions[i].run(); err != nil {
+			return fmt.Errorf("%v action %v: %v", kind, i+1, err)
+		}
+	}
+	return nil
 }
 
 type ExpectedResponse struct {
 	HttpCode        int              `yaml:"httpCode"`
 	ContentType     string           `yaml:"contentType"`
 	ExpectedResults []ExpectedResult `yaml:"expectedResults"`
+	// ExpectedHeaders are checked on the response. Value matches header exactly unless it's enclosed in slashes,
+	// e.x. "/^(HIT|MISS)$/", then it's treated as regular expression
+	ExpectedHeaders map[string]string `yaml:"expectedHeaders"`
+	// ExpectedHeaderRegex is a shorthand for regular expressions in ExpectedHeaders, values are written without slashes,
+	// e.x. "^[1-9][0-9]*$". It takes precedence if the same header is in both
+	ExpectedHeaderRegex map[string]string `yaml:"expectedHeaderRegex"`
+	// ExpectedTrailers are checked the same way as ExpectedHeaders, but on HTTP trailers of the response
+	ExpectedTrailers map[string]string `yaml:"expectedTrailers"`
+	// ExpectEmpty asserts that response is an empty JSON array, expectedResults are not checked then
+	ExpectEmpty bool `yaml:"expectEmpty"`
+	// MinBytes and MaxBytes limit size of decompressed response body, zero means no limit
+	MinBytes int `yaml:"minBytes"`
+	MaxBytes int `yaml:"maxBytes"`
+	// MinCompressedBytes and MaxCompressedBytes limit size of response body as it was sent over the wire
+	MinCompressedBytes int `yaml:"minCompressedBytes"`
+	MaxCompressedBytes int `yaml:"maxCompressedBytes"`
+	// MaxLatencyMs limits time from sending the request till response headers are received, Delay isn't counted
+	MaxLatencyMs int `yaml:"maxLatencyMs"`
+	// ExpectedProto is protocol the response must be received over, "HTTP/1.1" or "HTTP/2.0"
+	ExpectedProto string `yaml:"expectedProto"`
+	// GoldenBodyFile is a path to gzipped expected body, decompressed response must be the same byte-for-byte.
+	// expectedResults are optional then
+	GoldenBodyFile string `yaml:"goldenBodyFile"`
+}
+
+// expectedHeaders returns ExpectedHeaders together with ExpectedHeaderRegex enclosed in slashes
+func (r *ExpectedResponse) expectedHeaders() map[string]string {
+	if len(r.ExpectedHeaderRegex) == 0 {
+		return r.ExpectedHeaders
+	}
+	res := make(map[string]string, len(r.ExpectedHeaders)+len(r.ExpectedHeaderRegex))
+	for name, value := range r.ExpectedHeaders {
+		res[http.CanonicalHeaderKey(name)] = value
+	}
+	for name, re := range r.ExpectedHeaderRegex {
+		res[http.CanonicalHeaderKey(name)] = "/" + re + "/"
+	}
+	return res
 }
 
 type ExpectedResult struct {
-	SHA256  []string `yaml:"sha256"`
+	SHA256 []string `yaml:"sha256"`
+	// SVG is a path to the expected image, it's compared with the response by shapes and text instead of sha256,
+	// so formatting and version of the renderer don't matter, see svgElements
+	SVG     string `yaml:"svg"`
 	Metrics []CarbonAPIResponse
+	// Find is expected response of /metrics/find in default (treejson) format
+	Find []FindMatch `yaml:"find"`
+	// List is expected response of endpoints returning list of strings, e.x. tag autocomplete
+	List []string `yaml:"list"`
+	// Epsilon is max difference of values that are treated as equal, 0 means exact comparison
+	Epsilon float64 `yaml:"epsilon"`
+	// Ordered requires series to be in the same order as Metrics, otherwise they are matched by target
+	Ordered bool `yaml:"ordered"`
+	// CompareTimestampsOnly checks timestamps of datapoints and ignores values, e.x. to test alignment of synthetic data
+	CompareTimestampsOnly bool `yaml:"compareTimestampsOnly"`
+}
+
+// FindMatch is an entry of /metrics/find response
+type FindMatch struct {
+	ID         string `json:"id" yaml:"id"`
+	Leaf       int    `json:"leaf" yaml:"leaf"`
+	Expandable int    `json:"expandable" yaml:"expandable"`
 }
 
 type CarbonAPIResponse struct {
+	// Target is matched the same way as ExpectedHeaders, so it can be a regular expression enclosed in slashes
 	Target     string            `json:"target" yaml:"target"`
 	Datapoints []Datapoint       `json:"datapoints" yaml:"datapoints"`
 	Tags       map[string]string `json:"tags" yaml:"tags"`
+	// ExpectedPointCount, if set, is checked instead of datapoints, so only amount of points matters
+	ExpectedPointCount int `json:"-" yaml:"expectedPointCount"`
+	// TargetRegex is a shorthand for regular expression in Target, written without slashes. It's used instead of Target if set
+	TargetRegex string `json:"-" yaml:"targetRegex"`
+	// ExpectedConsolidation is checked against consolidation function from meta, query should have meta=true
+	ExpectedConsolidation string        `json:"-" yaml:"expectedConsolidation"`
+	Meta                  *responseMeta `json:"meta" yaml:"-"`
+
+	// targetRe is compiled TargetRegex or Target in slashes, see compileTargetRegexps
+	targetRe *regexp.Regexp
+}
+
+// responseMeta is meta of series, returned by carbonapi for requests with meta=true
+type responseMeta struct {
+	ConsolidationFunc string `json:"consolidationFunc"`
+}
+
+// compileTargetRegexps returns copy of expected metrics with compiled regular expressions for targets,
+// so they are compiled once per query and not on every comparison
+func compileTargetRegexps(metrics []CarbonAPIResponse) ([]CarbonAPIResponse, error) {
+	res := make([]CarbonAPIResponse, len(metrics))
+	copy(res, metrics)
+	for i := range res {
+		m := &res[i]
+		target := m.Target
+		if m.TargetRegex != "" {
+			target = "/" + m.TargetRegex + "/"
+		}
+		re, err := expectedRegexp(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp for target '%v': %v", target, err)
+		}
+		m.targetRe = re
+	}
+	return res, nil
 }
 
 type Datapoint struct {
@@ -118,36 +360,82 @@ func (d *Datapoint) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
-func isMetricsEqual(m1, m2 CarbonAPIResponse) error {
-	if m1.Target != m2.Target {
+// expectedRegexp returns compiled regular expression if expected value is enclosed in slashes, e.x. "/^(HIT|MISS)$/",
+// and nil if value should be matched exactly
+func expectedRegexp(value string) (*regexp.Regexp, error) {
+	if len(value) < 2 || value[0] != '/' || value[len(value)-1] != '/' {
+		return nil, nil
+	}
+	return regexp.Compile(value[1 : len(value)-1])
+}
+
+// isValuesEqual compares values with the tolerance of epsilon, two NaNs are equal
+func isValuesEqual(v1, v2, epsilon float64) bool {
+	if math.IsNaN(v1) || math.IsNaN(v2) {
+		return math.IsNaN(v1) && math.IsNaN(v2)
+	}
+	return v1 == v2 || math.Abs(v1-v2) <= epsilon
+}
+
+// isMetricsEqual checks that m1 is the same as expected m2, values are compared with the tolerance of epsilon
+// or aren't compared at all if timestampsOnly is set
+func isMetricsEqual(m1, m2 CarbonAPIResponse, epsilon float64, timestampsOnly bool) error {
+	// expected target can be a regular expression for series names with volatile parts, e.x. made by legendValue
+	if m2.targetRe != nil {
+		if !m2.targetRe.MatchString(m1.Target) {
+			return fmt.Errorf("target mismatch, got '%v', expected to match '%v'", m1.Target, m2.targetRe)
+		}
+	} else if m1.Target != m2.Target {
 		return fmt.Errorf("target mismatch, got '%v', expected '%v'", m1.Target, m2.Target)
 	}
 
+	// tags are compared by content only if they are expected, so the order they are declared in doesn't matter
+	if m2.Tags != nil && !reflect.DeepEqual(m1.Tags, m2.Tags) {
+		return fmt.Errorf("tags mismatch, got '%v', expected '%v'", m1.Tags, m2.Tags)
+	}
+
+	if m2.ExpectedConsolidation != "" {
+		if m1.Meta == nil {
+			return fmt.Errorf("response has no meta, expected consolidation '%v', query should have meta=true", m2.ExpectedConsolidation)
+		}
+		// backends differ in case of consolidation function names, e.x. "Average" and "average"
+		if !strings.EqualFold(m1.Meta.ConsolidationFunc, m2.ExpectedConsolidation) {
+			return fmt.Errorf("consolidation mismatch, got '%v', expected '%v'", m1.Meta.ConsolidationFunc, m2.ExpectedConsolidation)
+		}
+	}
+
+	if m2.ExpectedPointCount != 0 {
+		if len(m1.Datapoints) != m2.ExpectedPointCount {
+			return fmt.Errorf("response have unexpected amount of points, got %v, expected %v", len(m1.Datapoints), m2.ExpectedPointCount)
+		}
+		return nil
+	}
+
 	if len(m1.Datapoints) != len(m2.Datapoints) {
 		return fmt.Errorf("response have unexpected length, got '%v', expected '%v'", m1.Datapoints, m2.Datapoints)
 	}
 
-	if len(m1.Datapoints) > 1 {
-		step1 := m1.Datapoints[1].Timestamp - m1.Datapoints[2].Timestamp
-		step2 := m2.Datapoints[1].Timestamp - m2.Datapoints[2].Timestamp
+	if len(m1.Datapoints) >= 2 {
+		step1 := m1.Datapoints[1].Timestamp - m1.Datapoints[0].Timestamp
+		step2 := m2.Datapoints[1].Timestamp - m2.Datapoints[0].Timestamp
 		if step1 != step2 {
 			return fmt.Errorf("series has unexpected step, got '%v', expected '%v'", step1, step2)
 		}
 	}
 	datapointsMismatch := false
 	for i := range m1.Datapoints {
-		if math.IsNaN(m1.Datapoints[i].Value) && math.IsNaN(m2.Datapoints[i].Value) {
-			continue
-		}
-		if m1.Datapoints[i].Value != m2.Datapoints[i].Value {
+		if m1.Datapoints[i].Timestamp != m2.Datapoints[i].Timestamp {
 			datapointsMismatch = true
 			break
 		}
-		if m1.Datapoints[i].Timestamp != m2.Datapoints[i].Timestamp {
+		if !timestampsOnly && !isValuesEqual(m1.Datapoints[i].Value, m2.Datapoints[i].Value, epsilon) {
 			datapointsMismatch = true
 			break
 		}
 	}
+	if datapointsMismatch && timestampsOnly {
+		return fmt.Errorf("timestamps in response are different, got '%v', expected '%v'", timestamps(m1.Datapoints), timestamps(m2.Datapoints))
+	}
 	if datapointsMismatch {
 		return fmt.Errorf("data in response is different, got '%v', expected '%v'", m1.Datapoints, m2.Datapoints)
 	}
@@ -155,159 +443,1475 @@ func isMetricsEqual(m1, m2 CarbonAPIResponse) error {
 	return nil
 }
 
-func doTest(logger *zap.Logger, t *Query) []string {
-	client := http.Client{}
-	failures := make([]string, 0)
-	d, err := time.ParseDuration(fmt.Sprintf("%v", t.Delay) + "s")
-	if err != nil {
-		failures = append(failures, fmt.Sprintf("failed parse duration: %v", err))
-		return failures
+func timestamps(datapoints []Datapoint) []int {
+	res := make([]int, len(datapoints))
+	for i := range datapoints {
+		res[i] = datapoints[i].Timestamp
 	}
-	time.Sleep(d)
+	return res
+}
+
+// Verbose enables logging of the request and raw response body on failure, body is truncated to VerboseBodySize bytes
+var (
+	Verbose         bool
+	VerboseBodySize = 4096
+)
+
+type testResponse struct {
+	request     *http.Request
+	code        int
+	proto       string
+	contentType string
+	headers     http.Header
+	trailers    http.Header
+	// body is decompressed, wireSize is the size of body as it was received
+	body     []byte
+	bodySize int
+	wireSize int
+	// streamed is true if body was passed to bodyStreamer instead of being read into memory,
+	// body contains only its beginning for diagnostics then
+	streamed       bool
+	streamFailures []string
+	// requestHeaders are headers of the request that are safe to be shown
+	requestHeaders http.Header
+	// started is when request was sent, wait is time till response headers are received
+	// and receive is time spent reading the body
+	started time.Time
+	wait    time.Duration
+	receive time.Duration
+}
+
+// bodyStreamer checks response body while it's being read and returns failures
+type bodyStreamer func(r io.Reader) []string
+
+// countingReader counts bytes read from the underlying reader
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// prefixBuffer keeps only first limit bytes written to it, negative limit means no limit
+type prefixBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *prefixBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit >= 0 && b.Len()+len(p) > b.limit {
+		p = p[:b.limit-b.Len()]
+	}
+	_, _ = b.Buffer.Write(p)
+	return n, nil
+}
+
+// defaultRetryInterval is the pause between retries of the query if it has no retryInterval
+const defaultRetryInterval = 200 * time.Millisecond
+
+// clientOptions are settings of the query that need a separate http.Client
+type clientOptions struct {
+	http2              bool
+	insecureSkipVerify bool
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = make(map[clientOptions]*http.Client)
+)
+
+// httpClient returns client for the query, clients are shared between queries with the same options to reuse
+// connections. Custom TLS config disables HTTP/2, unless it's forced
+func httpClient(t *Query) *http.Client {
+	opts := clientOptions{http2: t.HTTP2, insecureSkipVerify: t.InsecureSkipVerify}
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+	if client, ok := clients[opts]; ok {
+		return client
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: opts.insecureSkipVerify}
+	transport.ForceAttemptHTTP2 = opts.http2
+	client := &http.Client{Transport: transport}
+	clients[opts] = client
+	return client
+}
+
+// sendRequest sends the query to the endpoint. If stream is set, successful JSON response is passed to it
+// while being read instead of being read into memory
+func sendRequest(logger *zap.Logger, endpoint string, t *Query, stream bodyStreamer) (*testResponse, error) {
+	client := httpClient(t)
 	ctx := context.Background()
 	var body io.Reader
 	if t.Type != "GET" {
 		body = strings.NewReader(t.Body)
 	}
-	var resp *http.Response
-	var contentType string
-	u, err := url.Parse(t.Endpoint + t.URL)
+	u, err := url.Parse(endpoint + t.URL)
 	if err != nil {
-		failures = append(failures, fmt.Sprintf("failed to parse URL: %v", err))
-		return failures
+		return nil, fmt.Errorf("failed to parse URL: %v", err)
 	}
 
 	logger.Info("sending request",
-		zap.String("endpoint", t.Endpoint),
+		zap.String("endpoint", endpoint),
 		zap.String("original_URL", t.URL),
 	)
 
-	req, err := http.NewRequestWithContext(ctx, t.Type, t.Endpoint+u.Path+"/?"+u.Query().Encode(), body)
+	// query is re-encoded, so parameters can be written in config as is, e.x. target=sum(a.b.c,'x y')
+	u.RawQuery = u.Query().Encode()
+	req, err := http.NewRequestWithContext(ctx, t.Type, u.String(), body)
 	if err != nil {
-		failures = append(failures, fmt.Sprintf("failed to prepare the request: %v", err))
-		return failures
+		return nil, fmt.Errorf("failed to prepare the request: %v", err)
+	}
+	if body != nil {
+		contentType := t.ContentType
+		if contentType == "" && t.Type == http.MethodPost {
+			contentType = "application/x-www-form-urlencoded"
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+	}
+	// gzip is requested explicitly, otherwise http.Transport decompresses the body and it's size on the wire is lost
+	req.Header.Set("Accept-Encoding", "gzip")
+	// requestHeaders are the same as headers of the request, but values with secrets are replaced by their templates
+	requestHeaders := req.Header.Clone()
+	for name, value := range t.Headers {
+		expanded, err := expandEnv(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set header '%v': %v", name, err)
+		}
+		req.Header.Set(name, expanded)
+		requestHeaders.Set(name, value)
+	}
+
+	retryInterval := t.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = defaultRetryInterval
+	}
+	var resp *http.Response
+	var started time.Time
+	for attempt := 0; ; attempt++ {
+		started = time.Now()
+		resp, err = client.Do(req)
+		if err == nil || attempt >= t.Retries {
+			break
+		}
+		logger.Debug("request failed, will retry",
+			zap.Int("attempt", attempt+1),
+			zap.Duration("retry_interval", retryInterval),
+			zap.Error(err),
+		)
+		time.Sleep(retryInterval)
+		// body could be partially read by the failed attempt
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("failed to prepare the request: %v", err)
+			}
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform the request: %v", err)
+	}
+	defer resp.Body.Close()
+	wait := time.Since(started)
+
+	var res *testResponse
+	if stream != nil && resp.StatusCode < 300 && resp.Header.Get("Content-Type") == contentTypeJSON {
+		res, err = streamResponse(req, resp, stream)
+	} else {
+		res, err = readResponse(req, resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.proto = resp.Proto
+	res.requestHeaders = requestHeaders
+	res.started = started
+	res.wait = wait
+	res.receive = time.Since(started) - wait
+
+	if HAR != nil {
+		HAR.add(t.Body, res)
+	}
+	return res, nil
+}
+
+// readResponse reads the whole body of the response
+func readResponse(req *http.Request, resp *http.Response) (*testResponse, error) {
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %v", err)
+	}
+	b := raw
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		r, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress body: %v", err)
+		}
+		b, err = ioutil.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress body: %v", err)
+		}
+	}
+
+	return &testResponse{
+		request:     req,
+		code:        resp.StatusCode,
+		contentType: resp.Header.Get("Content-Type"),
+		headers:     resp.Header,
+		trailers:    resp.Trailer,
+		body:        b,
+		bodySize:    len(b),
+		wireSize:    len(raw),
+	}, nil
+}
+
+// streamResponse passes body of the response to stream. Only the beginning of the body is kept
+// for diagnostics in verbose mode
+func streamResponse(req *http.Request, resp *http.Response, stream bodyStreamer) (*testResponse, error) {
+	wire := &countingReader{r: resp.Body}
+	var r io.Reader = wire
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(wire)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress body: %v", err)
+		}
+		r = gz
+	}
+	plain := &countingReader{r: r}
+	r = plain
+	prefix := &prefixBuffer{limit: VerboseBodySize}
+	if Verbose {
+		r = io.TeeReader(r, prefix)
+	}
+
+	failures := stream(r)
+	// the rest of the body is read to get its size and trailers
+	_, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %v", err)
+	}
+
+	return &testResponse{
+		request:        req,
+		code:           resp.StatusCode,
+		contentType:    resp.Header.Get("Content-Type"),
+		headers:        resp.Header,
+		trailers:       resp.Trailer,
+		body:           prefix.Bytes(),
+		bodySize:       plain.n,
+		wireSize:       wire.n,
+		streamed:       true,
+		streamFailures: failures,
+	}, nil
+}
+
+// logsTimeout is how long expected logs are waited for, apps can write them after the response is sent
+var logsTimeout = time.Second
+
+// checkLogs waits for expected lines to appear in output of the apps written after offset
+func checkLogs(offset int, expected []string) []string {
+	if len(expected) == 0 {
+		return nil
+	}
+	res := make([]*regexp.Regexp, len(expected))
+	for i, e := range expected {
+		re, err := expectedRegexp(e)
+		if err != nil {
+			return []string{fmt.Sprintf("invalid expected log '%v': %v", e, err)}
+		}
+		res[i] = re
+	}
+
+	deadline := time.Now().Add(logsTimeout)
+	for {
+		logs := AppLogs.Since(offset)
+		failures := make([]string, 0)
+		for i, e := range expected {
+			var found bool
+			if res[i] != nil {
+				found = res[i].MatchString(logs)
+			} else {
+				found = strings.Contains(logs, e)
+			}
+			if !found {
+				failures = append(failures, fmt.Sprintf("expected log '%v' not found", e))
+			}
+		}
+		if len(failures) == 0 || time.Now().After(deadline) {
+			return failures
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// envPlaceholder is a reference to environment variable, e.x. ${TOKEN}
+var envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces references to environment variables with their values, all of them must be set
+func expandEnv(s string) (string, error) {
+	var err error
+	res := envPlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		name := envPlaceholder.FindStringSubmatch(placeholder)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok && err == nil {
+			err = fmt.Errorf("environment variable '%v' is not set", name)
+		}
+		return value
+	})
+	return res, err
+}
+
+func delay(t *Query) error {
+	d, err := time.ParseDuration(fmt.Sprintf("%v", t.Delay) + "s")
+	if err != nil {
+		return fmt.Errorf("failed parse duration: %v", err)
+	}
+	time.Sleep(d)
+	return nil
+}
+
+// logDiagnostics logs the request and the raw response for failed query
+func logDiagnostics(logger *zap.Logger, t *Query, resp *testResponse) {
+	fields := []zap.Field{
+		zap.String("method", t.Type),
+		zap.String("URL", t.Endpoint+t.URL),
+		zap.String("body", t.Body),
+	}
+	if resp == nil {
+		logger.Error("failed request details", fields...)
+		return
+	}
+
+	body := resp.body
+	truncated := len(body) < resp.bodySize
+	if VerboseBodySize >= 0 && len(body) > VerboseBodySize {
+		body = body[:VerboseBodySize]
+		truncated = true
+	}
+	fields = append(fields,
+		zap.String("request_URL", resp.request.URL.String()),
+		zap.Any("request_headers", resp.requestHeaders),
+		zap.Int("response_code", resp.code),
+		zap.Any("response_headers", resp.headers),
+		zap.ByteString("response_body", body),
+		zap.Bool("response_body_truncated", truncated),
+	)
+	logger.Error("failed request details", fields...)
+}
+
+func doTest(logger *zap.Logger, t *Query) (failures []string) {
+	failures = make([]string, 0)
+	var resp *testResponse
+	if Verbose {
+		defer func() {
+			if len(failures) != 0 {
+				logDiagnostics(logger, t, resp)
+			}
+		}()
+	}
+
+	// series are compared while response is read, so big responses don't need to fit in memory
+	// recorded responses and responses compared with golden body must be complete, so they are not streamed then
+	var stream bodyStreamer
+	if expected, ok := expectedMetrics(&t.ExpectedResponse); ok && HAR == nil && t.ExpectedResponse.GoldenBodyFile == "" {
+		stream = func(r io.Reader) []string {
+			return checkMetrics(r, expected)
+		}
 	}
 
-	resp, err = client.Do(req)
+	logsOffset := AppLogs.Len()
+	backendRequests := BackendRequests.snapshot()
+	resp, err := sendRequest(logger, t.Endpoint, t, stream)
 	if err != nil {
-		failures = append(failures, fmt.Sprintf("failed to perform the request: %v", err))
+		failures = append(failures, err.Error())
 		return failures
 	}
+	failures = append(failures, checkLogs(logsOffset, t.ExpectedLogs)...)
+	failures = append(failures, checkBackendRequests(backendRequests, t.ExpectedBackendRequests)...)
 
-	if resp.StatusCode != t.ExpectedResponse.HttpCode {
-		failures = append(failures,
-			fmt.Sprintf("unexpected status code, got %v, expected %v",
-				resp.StatusCode,
-				t.ExpectedResponse.HttpCode,
-			),
+	if resp.code != t.ExpectedResponse.HttpCode {
+		failure := fmt.Sprintf("unexpected status code, got %v, expected %v",
+			resp.code,
+			t.ExpectedResponse.HttpCode,
 		)
+		// body of error response explains the reason
+		if resp.code >= 400 {
+			failure += fmt.Sprintf(", body '%v'", strings.TrimSpace(string(resp.body)))
+		}
+		failures = append(failures, failure)
 	}
 
-	contentType = resp.Header.Get("Content-Type")
-	if t.ExpectedResponse.ContentType != contentType {
+	contentType := resp.contentType
+	contentTypeMismatch := t.ExpectedResponse.ContentType != contentType
+	if contentTypeMismatch {
+		// response of other type is usually an error page, that explains what went wrong
 		failures = append(failures,
-			fmt.Sprintf("unexpected content-type, got %v, expected %v",
+			fmt.Sprintf("unexpected content-type, got %v, expected %v, %v",
 				contentType,
 				t.ExpectedResponse.ContentType,
+				bodyPreview(resp.body, resp.bodySize),
 			),
 		)
 	}
 
-	b, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		failures = append(failures, fmt.Sprintf("failed to read body: %v", err))
-		return failures
+	failures = append(failures, checkHeaders("header", resp.headers, t.ExpectedResponse.expectedHeaders())...)
+	failures = append(failures, checkHeaders("trailer", resp.trailers, t.ExpectedResponse.ExpectedTrailers)...)
+	failures = append(failures, checkSize("body", resp.bodySize, t.ExpectedResponse.MinBytes, t.ExpectedResponse.MaxBytes)...)
+	failures = append(failures, checkSize("compressed body", resp.wireSize, t.ExpectedResponse.MinCompressedBytes, t.ExpectedResponse.MaxCompressedBytes)...)
+	if max := time.Duration(t.ExpectedResponse.MaxLatencyMs) * time.Millisecond; max != 0 && resp.wait > max {
+		failures = append(failures, fmt.Sprintf("latency is too high, got %v ms, expected at most %v ms", resp.wait.Milliseconds(), t.ExpectedResponse.MaxLatencyMs))
+	}
+	if proto := t.ExpectedResponse.ExpectedProto; proto != "" && resp.proto != proto {
+		failures = append(failures, fmt.Sprintf("protocol mismatch, got %v, expected %v", resp.proto, proto))
 	}
 
+	b := resp.body
+
 	// We don't need to actually check body of response if we expect any sort of error (4xx/5xx)
 	if t.ExpectedResponse.HttpCode >= 300 {
 		return failures
 	}
 
-	switch contentType {
-	case "image/png":
-	case "image/svg+xml":
-		hash := sha256.Sum256(b)
-		hashStr := fmt.Sprintf("%x", hash)
-		sha256matched := false
-		for _, sha256sum := range t.ExpectedResponse.ExpectedResults[0].SHA256 {
-			if hashStr == sha256sum {
-				sha256matched = true
-				break
-			}
-		}
-		if !sha256matched {
-			encodedBody := base64.StdEncoding.EncodeToString(b)
-			failures = append(failures, fmt.Sprintf("sha256 mismatch, got '%v', expected '%v', encodedBodyy: '%v'", hashStr, t.ExpectedResponse.ExpectedResults[0].SHA256, encodedBody))
-			return failures
-		}
-	case "application/json":
-		res := []CarbonAPIResponse{}
-		err := json.Unmarshal(b, &res)
-		if err != nil {
-			failures = append(failures, fmt.Sprintf("failed to parse response '%v'", err))
-			return failures
-		}
+	if t.ExpectedResponse.ExpectEmpty {
+		failures = append(failures, checkEmpty(b)...)
+		return failures
+	}
 
-		if len(res) != len(t.ExpectedResponse.ExpectedResults[0].Metrics) {
-			failures = append(failures, fmt.Sprintf("unexpected amount of results, got %v, expected %v", len(res), len(t.ExpectedResponse.ExpectedResults[0].Metrics)))
+	if t.ExpectedResponse.GoldenBodyFile != "" {
+		failures = append(failures, checkGoldenBody(b, t.ExpectedResponse.GoldenBodyFile)...)
+		if len(t.ExpectedResponse.ExpectedResults) == 0 {
 			return failures
 		}
+	}
 
-		for i := range res {
-			err := isMetricsEqual(res[i], t.ExpectedResponse.ExpectedResults[0].Metrics[i])
-			if err != nil {
-				failures = append(failures, fmt.Sprintf("metrics are not equal: %v", err))
-			}
-		}
+	if requiresExpectedResults(contentType) && len(t.ExpectedResponse.ExpectedResults) == 0 {
+		failures = append(failures, fmt.Sprintf("no expectedResults to compare response of content-type %v with", contentType))
+		return failures
+	}
 
-	default:
-		failures = append(failures, fmt.Sprintf("unsupported content-type: got '%v'", contentType))
+	decoder, ok := responseDecoders[contentType]
+	if !ok {
+		failure := fmt.Sprintf("unsupported content-type: got '%v'", contentType)
+		if !contentTypeMismatch {
+			failure += ", " + bodyPreview(resp.body, resp.bodySize)
+		}
+		failures = append(failures, failure)
+		return failures
+	}
+	var expected ExpectedResult
+	if len(t.ExpectedResponse.ExpectedResults) != 0 {
+		expected = t.ExpectedResponse.ExpectedResults[0]
 	}
+	failures = append(failures, decoder.Check(t, resp, expected)...)
 
 	return failures
 }
 
-func e2eTest(logger *zap.Logger, noapp bool) bool {
-	failed := false
-	logger.Info("will run test",
-		zap.Any("config", cfg.Test),
-	)
-	runningApps := make(map[string]*runner)
-	if !noapp {
-		for i, c := range cfg.Test.Apps {
-			r := NewRunner(&cfg.Test.Apps[i], logger)
-			runningApps[c.Name] = r
-			go r.Run()
+// bodyPreviewSize is the max amount of bytes of the body shown in failures
+const bodyPreviewSize = 512
+
+// bodyPreview returns the beginning of the body to be shown in failure. Body that isn't valid UTF-8
+// is hex-encoded, size is the size of the whole body, that can be bigger than b if body was streamed
+func bodyPreview(b []byte, size int) string {
+	binary := !utf8.Valid(b)
+	limit := bodyPreviewSize
+	if binary {
+		// every byte takes two characters
+		limit /= 2
+	}
+
+	preview := b
+	if len(preview) > limit {
+		preview = preview[:limit]
+		// multibyte character shouldn't be cut
+		for !binary && len(preview) > 0 && !utf8.RuneStart(b[len(preview)]) {
+			preview = preview[:len(preview)-1]
 		}
+	}
 
-		logger.Info("will sleep for 5 seconds to start all required apps")
-		time.Sleep(5 * time.Second)
+	var res string
+	if binary {
+		res = fmt.Sprintf("body (hex) '%v'", hex.EncodeToString(preview))
+	} else {
+		res = fmt.Sprintf("body '%v'", strings.TrimSpace(string(preview)))
 	}
+	if len(preview) < size {
+		res += fmt.Sprintf(" (truncated, %v bytes total)", size)
+	}
+	return res
+}
 
-	for _, t := range cfg.Test.Queries {
-		failures := doTest(logger, &t)
+// requiresExpectedResults returns true if response of the content-type is compared with the first of expectedResults
+func requiresExpectedResults(contentType string) bool {
+	decoder, ok := responseDecoders[contentType]
+	return ok && decoder.RequiresExpectedResults()
+}
 
-		if len(failures) != 0 {
-			failed = true
-			logger.Error("test failed",
-				zap.Strings("failures", failures),
-			)
+// maxReportedSeries limits amount of series listed in failures of big responses
+const maxReportedSeries = 10
+
+// expectedMetrics returns expected result if response is expected to contain series
+func expectedMetrics(expected *ExpectedResponse) (ExpectedResult, bool) {
+	if expected.HttpCode >= 300 || expected.ExpectEmpty || len(expected.ExpectedResults) == 0 {
+		return ExpectedResult{}, false
+	}
+	res := expected.ExpectedResults[0]
+	if res.Find != nil || res.List != nil || res.SHA256 != nil {
+		return ExpectedResult{}, false
+	}
+	return res, true
+}
+
+// seriesMatcher compares series with expected ones as they are added. Series are matched by target and values
+// regardless of the order, unless expected result is ordered
+type seriesMatcher struct {
+	expected   ExpectedResult
+	metrics    []CarbonAPIResponse
+	matched    []bool
+	unexpected []string
+	failures   []string
+	count      int
+}
+
+func newSeriesMatcher(expected ExpectedResult) (*seriesMatcher, error) {
+	metrics, err := compileTargetRegexps(expected.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	return &seriesMatcher{
+		expected:   expected,
+		metrics:    metrics,
+		matched:    make([]bool, len(metrics)),
+		unexpected: make([]string, 0),
+		failures:   make([]string, 0),
+	}, nil
+}
+
+func (m *seriesMatcher) add(series *CarbonAPIResponse) {
+	m.count++
+	i := m.count - 1
+	if !m.expected.Ordered {
+		i = matchSeries(series, m.metrics, m.matched, m.expected.Epsilon, m.expected.CompareTimestampsOnly)
+	}
+	if i < 0 || i >= len(m.metrics) {
+		if len(m.unexpected) < maxReportedSeries {
+			m.unexpected = append(m.unexpected, series.Target)
+		}
+		return
+	}
+	m.matched[i] = true
+
+	err := isMetricsEqual(*series, m.metrics[i], m.expected.Epsilon, m.expected.CompareTimestampsOnly)
+	if err != nil && len(m.failures) < maxReportedSeries {
+		m.failures = append(m.failures, fmt.Sprintf("metrics are not equal: %v", err))
+	}
+}
+
+// result returns failures of added series together with the ones about missing and unexpected series
+func (m *seriesMatcher) result() []string {
+	failures := m.failures
+	if m.count != len(m.metrics) {
+		failures = append(failures, fmt.Sprintf("unexpected amount of results, got %v, expected %v", m.count, len(m.metrics)))
+	}
+	if len(m.unexpected) != 0 {
+		failures = append(failures, fmt.Sprintf("unexpected series %q", m.unexpected))
+	}
+	missing := make([]string, 0)
+	for i := range m.metrics {
+		if m.matched[i] || len(missing) == maxReportedSeries {
+			continue
+		}
+		if m.metrics[i].TargetRegex != "" {
+			missing = append(missing, m.metrics[i].TargetRegex)
 		} else {
-			logger.Info("test OK")
+			missing = append(missing, m.metrics[i].Target)
 		}
 	}
+	if len(missing) != 0 {
+		failures = append(failures, fmt.Sprintf("missing series %q", missing))
+	}
+	return failures
+}
 
-	logger.Info("shutting down running application")
-	for _, v := range runningApps {
-		v.Finish()
+// checkMetrics decodes series from JSON response one by one and compares them with expected ones
+func checkMetrics(r io.Reader, expected ExpectedResult) []string {
+	matcher, err := newSeriesMatcher(expected)
+	if err != nil {
+		return []string{err.Error()}
 	}
 
-	if failed {
-		logger.Error("tests failed")
-	} else {
-		logger.Info("All tests OK")
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return []string{fmt.Sprintf("failed to parse response '%v', expected array, got '%v'", err, tok)}
+	}
+	for dec.More() {
+		var series CarbonAPIResponse
+		if err := dec.Decode(&series); err != nil {
+			return append(matcher.failures, fmt.Sprintf("failed to parse response '%v'", err))
+		}
+		matcher.add(&series)
+	}
+	if _, err := dec.Token(); err != nil {
+		return append(matcher.failures, fmt.Sprintf("failed to parse response '%v'", err))
 	}
 
-	return failed
+	return matcher.result()
+}
+
+// csvTimeFormat is the format of timestamps in CSV responses, they are in UTC
+const csvTimeFormat = "2006-01-02 15:04:05"
+
+// checkCSV compares series in CSV response with expected ones
+func checkCSV(b []byte, expected ExpectedResult) []string {
+	metrics, err := parseCSV(b)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return matchMetrics(metrics, expected)
+}
+
+// matchMetrics compares series of already parsed response with expected ones
+func matchMetrics(metrics []CarbonAPIResponse, expected ExpectedResult) []string {
+	matcher, err := newSeriesMatcher(expected)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	for i := range metrics {
+		matcher.add(&metrics[i])
+	}
+	return matcher.result()
+}
+
+// parseCSV parses CSV response, that has a row with series name, time and value per point. Empty values are absent points
+func parseCSV(b []byte) ([]CarbonAPIResponse, error) {
+	metrics := make([]CarbonAPIResponse, 0)
+	r := csv.NewReader(bytes.NewReader(b))
+	r.FieldsPerRecord = 3
+	// names of series are not escaped
+	r.LazyQuotes = true
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse response '%v'", err)
+		}
+
+		ts, err := time.ParseInLocation(csvTimeFormat, row[1], time.UTC)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse time '%v': %v", row[1], err)
+		}
+		value := math.NaN()
+		if row[2] != "" {
+			value, err = strconv.ParseFloat(row[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse value '%v': %v", row[2], err)
+			}
+		}
+
+		// points of the series go one after another
+		if len(metrics) == 0 || metrics[len(metrics)-1].Target != row[0] {
+			metrics = append(metrics, CarbonAPIResponse{Target: row[0]})
+		}
+		series := &metrics[len(metrics)-1]
+		series.Datapoints = append(series.Datapoints, Datapoint{Timestamp: int(ts.Unix()), Value: value})
+	}
+
+	return metrics, nil
+}
+
+// parseRaw parses response in raw format, that has a line "name,start,stop,step|value,value,..." per series.
+// None values are absent points
+func parseRaw(b []byte) ([]CarbonAPIResponse, error) {
+	metrics := make([]CarbonAPIResponse, 0)
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		sep := strings.LastIndexByte(line, '|')
+		if sep < 0 {
+			return nil, fmt.Errorf("failed to parse line '%v': no values", line)
+		}
+		// name can contain commas, so header is split from the end
+		header := strings.Split(line[:sep], ",")
+		if len(header) < 4 {
+			return nil, fmt.Errorf("failed to parse line '%v': bad header", line)
+		}
+		n := len(header)
+		start, err := strconv.Atoi(header[n-3])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse start time of line '%v': %v", line, err)
+		}
+		step, err := strconv.Atoi(header[n-1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse step of line '%v': %v", line, err)
+		}
+
+		series := CarbonAPIResponse{Target: strings.Join(header[:n-3], ",")}
+		if values := line[sep+1:]; values != "" {
+			for i, v := range strings.Split(values, ",") {
+				value := math.NaN()
+				if v != "None" {
+					value, err = strconv.ParseFloat(v, 64)
+					if err != nil {
+						return nil, fmt.Errorf("failed to parse value '%v': %v", v, err)
+					}
+				}
+				series.Datapoints = append(series.Datapoints, Datapoint{Timestamp: start + i*step, Value: value})
+			}
+		}
+		metrics = append(metrics, series)
+	}
+
+	return metrics, nil
+}
+
+// requestFormat returns format parameter of the query, it can be passed either in URL or in body of POST request
+func requestFormat(t *Query) string {
+	if u, err := url.Parse(t.URL); err == nil && u.Query().Get("format") != "" {
+		return u.Query().Get("format")
+	}
+	values, _ := url.ParseQuery(t.Body)
+	return values.Get("format")
+}
+
+// checkProtobuf compares series in protobuf response with expected ones
+func checkProtobuf(b []byte, format string, expected ExpectedResult) []string {
+	metrics, err := parseProtobuf(b, format)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return matchMetrics(metrics, expected)
+}
+
+// parseProtobuf parses protobuf response. carbonapi_v3_pb format is decoded as carbonapi_v3_pb.MultiFetchResponse,
+// other protobuf formats (protobuf, protobuf3, carbonapi_v2_pb) as carbonapi_v2_pb one
+func parseProtobuf(b []byte, format string) ([]CarbonAPIResponse, error) {
+	if format == "carbonapi_v3_pb" {
+		var resp carbonapi_v3_pb.MultiFetchResponse
+		if err := resp.Unmarshal(b); err != nil {
+			return nil, fmt.Errorf("failed to parse response '%v'", err)
+		}
+		metrics := make([]CarbonAPIResponse, 0, len(resp.Metrics))
+		for _, m := range resp.Metrics {
+			series := CarbonAPIResponse{
+				Target:     m.Name,
+				Datapoints: make([]Datapoint, 0, len(m.Values)),
+			}
+			if m.ConsolidationFunc != "" {
+				series.Meta = &responseMeta{ConsolidationFunc: m.ConsolidationFunc}
+			}
+			for i, v := range m.Values {
+				series.Datapoints = append(series.Datapoints, Datapoint{Timestamp: int(m.StartTime + int64(i)*m.StepTime), Value: v})
+			}
+			metrics = append(metrics, series)
+		}
+		return metrics, nil
+	}
+
+	var resp carbonapi_v2_pb.MultiFetchResponse
+	if err := resp.Unmarshal(b); err != nil {
+		return nil, fmt.Errorf("failed to parse response '%v'", err)
+	}
+	metrics := make([]CarbonAPIResponse, 0, len(resp.Metrics))
+	for _, m := range resp.Metrics {
+		series := CarbonAPIResponse{
+			Target:     m.Name,
+			Datapoints: make([]Datapoint, 0, len(m.Values)),
+		}
+		for i, v := range m.Values {
+			if i < len(m.IsAbsent) && m.IsAbsent[i] {
+				v = math.NaN()
+			}
+			series.Datapoints = append(series.Datapoints, Datapoint{Timestamp: int(m.StartTime) + i*int(m.StepTime), Value: v})
+		}
+		metrics = append(metrics, series)
+	}
+	return metrics, nil
+}
+
+// parseJSON parses render response in JSON format
+func parseJSON(b []byte) ([]CarbonAPIResponse, error) {
+	var metrics []CarbonAPIResponse
+	if err := json.Unmarshal(b, &metrics); err != nil {
+		return nil, fmt.Errorf("failed to parse response '%v'", err)
+	}
+	return metrics, nil
+}
+
+// decodeSeries parses render response to the query with SeriesDecoder registered for its content type
+func decodeSeries(t *Query, b []byte, contentType string) ([]CarbonAPIResponse, error) {
+	decoder, ok := responseDecoders[contentType].(SeriesDecoder)
+	if !ok {
+		return nil, fmt.Errorf("unsupported content-type: got '%v'", contentType)
+	}
+	return decoder.DecodeSeries(t, b)
+}
+
+// matchSeries returns index of not yet matched expected series with the same target, or matching its regexp.
+// Of several such series the one that is equal to the given series is preferred, values are compared the same way
+// as in ordered mode (see isMetricsEqual), so series with the same target can be reordered in the response.
+// If none of them is equal, the first one is returned, so the difference is reported
+func matchSeries(series *CarbonAPIResponse, metrics []CarbonAPIResponse, matched []bool, epsilon float64, timestampsOnly bool) int {
+	candidates := make([]int, 0)
+	for i := range metrics {
+		if !matched[i] && metrics[i].targetRe == nil && metrics[i].Target == series.Target {
+			candidates = append(candidates, i)
+		}
+	}
+	for i := range metrics {
+		if !matched[i] && metrics[i].targetRe != nil && metrics[i].targetRe.MatchString(series.Target) {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	for _, i := range candidates {
+		if isMetricsEqual(*series, metrics[i], epsilon, timestampsOnly) == nil {
+			return i
+		}
+	}
+	return candidates[0]
+}
+
+// checkEmpty checks that response is an empty JSON array
+func checkEmpty(b []byte) []string {
+	var res []json.RawMessage
+	err := json.Unmarshal(b, &res)
+	if err != nil {
+		return []string{fmt.Sprintf("expected empty array, failed to parse response '%v'", err)}
+	}
+	// null is unmarshaled without errors too
+	if res == nil {
+		return []string{fmt.Sprintf("expected empty array, got '%v'", string(b))}
+	}
+	if len(res) != 0 {
+		return []string{fmt.Sprintf("expected empty array, got %v series", len(res))}
+	}
+	return nil
+}
+
+// checkFind checks /metrics/find response in treejson format
+func checkFind(b []byte, expected []FindMatch) []string {
+	failures := make([]string, 0)
+	res := []FindMatch{}
+	err := json.Unmarshal(b, &res)
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("failed to parse response '%v'", err))
+		return failures
+	}
+
+	if !reflect.DeepEqual(res, expected) {
+		failures = append(failures, fmt.Sprintf("find response is different, got '%+v', expected '%+v'", res, expected))
+	}
+	return failures
+}
+
+// checkList checks response that is a list of strings
+func checkList(b []byte, expected []string) []string {
+	failures := make([]string, 0)
+	res := []string{}
+	err := json.Unmarshal(b, &res)
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("failed to parse response '%v'", err))
+		return failures
+	}
+
+	if !reflect.DeepEqual(res, expected) {
+		failures = append(failures, fmt.Sprintf("list is different, got '%v', expected '%v'", res, expected))
+	}
+	return failures
+}
+
+// checkHeaders checks headers (or trailers, kind is used in failure messages) against expected values
+func checkHeaders(kind string, headers http.Header, expected map[string]string) []string {
+	failures := make([]string, 0)
+	for name, value := range expected {
+		got, ok := headers[http.CanonicalHeaderKey(name)]
+		if !ok {
+			failures = append(failures, fmt.Sprintf("%v '%v' is missing, expected '%v'", kind, name, value))
+			continue
+		}
+		gotValue := strings.Join(got, ", ")
+		re, err := expectedRegexp(value)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid regexp for %v '%v': %v", kind, name, err))
+			continue
+		}
+		if re != nil {
+			if !re.MatchString(gotValue) {
+				failures = append(failures, fmt.Sprintf("%v '%v' mismatch, got '%v', expected to match '%v'", kind, name, gotValue, value))
+			}
+			continue
+		}
+		if gotValue != value {
+			failures = append(failures, fmt.Sprintf("%v '%v' mismatch, got '%v', expected '%v'", kind, name, gotValue, value))
+		}
+	}
+	return failures
+}
+
+// checkExpectedFailure turns failures of the query that is expected to fail into success and vice versa
+func checkExpectedFailure(t *Query, failures []string) []string {
+	if len(failures) == 0 {
+		return []string{"query is expected to fail, but succeeded"}
+	}
+	if t.ExpectedError != "" && !strings.Contains(strings.Join(failures, "\n"), t.ExpectedError) {
+		return []string{fmt.Sprintf("query failed without expected error '%v', failures: %v", t.ExpectedError, failures)}
+	}
+	return nil
+}
+
+// checkSize checks that size is within [min, max], zero limits are not checked
+func checkSize(kind string, size, min, max int) []string {
+	failures := make([]string, 0)
+	if min != 0 && size < min {
+		failures = append(failures, fmt.Sprintf("%v is too small, got %v bytes, expected at least %v", kind, size, min))
+	}
+	if max != 0 && size > max {
+		failures = append(failures, fmt.Sprintf("%v is too big, got %v bytes, expected at most %v", kind, size, max))
+	}
+	return failures
+}
+
+// doCompareTest sends the query to both apps and checks that candidate app responds the same way as the baseline one
+func doCompareTest(logger *zap.Logger, t *Query, baseline, candidate *App) []string {
+	failures := make([]string, 0)
+	responses := make([]*testResponse, 0, 2)
+	for _, app := range []*App{baseline, candidate} {
+		resp, err := sendRequest(logger.With(zap.String("app", app.Name)), app.Endpoint, t, nil)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("app '%v': %v", app.Name, err))
+			return failures
+		}
+		responses = append(responses, resp)
+	}
+	expected, got := responses[0], responses[1]
+
+	diverged := func(format string, a ...interface{}) {
+		failures = append(failures, fmt.Sprintf("app '%v' diverged from '%v': ", candidate.Name, baseline.Name)+fmt.Sprintf(format, a...))
+	}
+
+	if got.code != expected.code {
+		diverged("status code mismatch, got %v, expected %v", got.code, expected.code)
+	}
+	if got.contentType != expected.contentType {
+		diverged("content-type mismatch, got %v, expected %v", got.contentType, expected.contentType)
+	}
+	if len(failures) != 0 || expected.code >= 300 {
+		return failures
+	}
+
+	if expected.contentType != "application/json" {
+		if !bytes.Equal(got.body, expected.body) {
+			diverged("body mismatch, got sha256 '%x', expected '%x'", sha256.Sum256(got.body), sha256.Sum256(expected.body))
+		}
+		return failures
+	}
+
+	var expectedRes, gotRes []CarbonAPIResponse
+	if err := json.Unmarshal(expected.body, &expectedRes); err != nil {
+		failures = append(failures, fmt.Sprintf("app '%v': failed to parse response '%v'", baseline.Name, err))
+		return failures
+	}
+	if err := json.Unmarshal(got.body, &gotRes); err != nil {
+		failures = append(failures, fmt.Sprintf("app '%v': failed to parse response '%v'", candidate.Name, err))
+		return failures
+	}
+
+	if len(gotRes) != len(expectedRes) {
+		diverged("unexpected amount of results, got %v, expected %v", len(gotRes), len(expectedRes))
+		return failures
+	}
+
+	// values of different versions can differ in the last digits, it's allowed with epsilon from expected result
+	epsilon := 0.0
+	timestampsOnly := false
+	if len(t.ExpectedResponse.ExpectedResults) != 0 {
+		epsilon = t.ExpectedResponse.ExpectedResults[0].Epsilon
+		timestampsOnly = t.ExpectedResponse.ExpectedResults[0].CompareTimestampsOnly
+	}
+	for i := range gotRes {
+		if err := isMetricsEqual(gotRes[i], expectedRes[i], epsilon, timestampsOnly); err != nil {
+			diverged("metrics are not equal: %v", err)
+		}
+	}
+
+	return failures
+}
+
+// withFormat returns URL with format parameter replaced
+func withFormat(rawURL, format string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL: %v", err)
+	}
+	values := u.Query()
+	values.Set("format", format)
+	u.RawQuery = values.Encode()
+	return u.String(), nil
+}
+
+// doFormatsTest sends the query in every format of t.Formats and checks that series decoded from all the responses
+// are the same as ones of the first format
+func doFormatsTest(logger *zap.Logger, t *Query) []string {
+	failures := make([]string, 0)
+	results := make([][]CarbonAPIResponse, 0, len(t.Formats))
+	for _, format := range t.Formats {
+		q := *t
+		var err error
+		if q.URL, err = withFormat(t.URL, format); err != nil {
+			failures = append(failures, err.Error())
+			return failures
+		}
+		resp, err := sendRequest(logger.With(zap.String("format", format)), t.Endpoint, &q, nil)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("format '%v': %v", format, err))
+			return failures
+		}
+		if resp.code != t.ExpectedResponse.HttpCode {
+			failures = append(failures, fmt.Sprintf("format '%v': unexpected status code, got %v, expected %v", format, resp.code, t.ExpectedResponse.HttpCode))
+			return failures
+		}
+		metrics, err := decodeSeries(&q, resp.body, resp.contentType)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("format '%v': %v", format, err))
+			return failures
+		}
+		results = append(results, metrics)
+	}
+
+	if expected, ok := expectedMetrics(&t.ExpectedResponse); ok {
+		for _, f := range matchMetrics(results[0], expected) {
+			failures = append(failures, fmt.Sprintf("format '%v': %v", t.Formats[0], f))
+		}
+	}
+
+	epsilon := 0.0
+	timestampsOnly := false
+	if len(t.ExpectedResponse.ExpectedResults) != 0 {
+		epsilon = t.ExpectedResponse.ExpectedResults[0].Epsilon
+		timestampsOnly = t.ExpectedResponse.ExpectedResults[0].CompareTimestampsOnly
+	}
+	reference := results[0]
+	for i := 1; i < len(results); i++ {
+		diverged := func(format string, a ...interface{}) {
+			failures = append(failures, fmt.Sprintf("format '%v' diverged from '%v': ", t.Formats[i], t.Formats[0])+fmt.Sprintf(format, a...))
+		}
+		if len(results[i]) != len(reference) {
+			diverged("unexpected amount of results, got %v, expected %v", len(results[i]), len(reference))
+			continue
+		}
+		for j := range results[i] {
+			// not all the formats have tags and meta, only names and points are compared
+			expected := CarbonAPIResponse{Target: reference[j].Target, Datapoints: reference[j].Datapoints}
+			if err := isMetricsEqual(results[i][j], expected, epsilon, timestampsOnly); err != nil {
+				diverged("metrics are not equal: %v", err)
+			}
+		}
+	}
+
+	return failures
+}
+
+// compareApps returns apps referenced by Compare section of the test
+func compareApps(test *TestSchema) (*App, *App, error) {
+	if len(test.Compare) != 2 {
+		return nil, nil, fmt.Errorf("compare mode requires exactly 2 apps, got %v", len(test.Compare))
+	}
+
+	apps := make([]*App, 0, 2)
+	for _, name := range test.Compare {
+		var app *App
+		for i := range test.Apps {
+			if test.Apps[i].Name == name {
+				app = &test.Apps[i]
+				break
+			}
+		}
+		if app == nil {
+			return nil, nil, fmt.Errorf("app '%v' is not defined", name)
+		}
+		if app.Endpoint == "" {
+			return nil, nil, fmt.Errorf("app '%v' have no endpoint", name)
+		}
+		apps = append(apps, app)
+	}
+
+	return apps[0], apps[1], nil
+}
+
+// selectQueries returns queries that should be run, others are logged as skipped. If only pattern is set, queries
+// matching it are selected even if they have skip flag, so a disabled query can be run on its own. Queries
+// compared with oracle that isn't configured can't be run at all
+func selectQueries(logger *zap.Logger, queries []Query, only string) []Query {
+	selected := make([]Query, 0, len(queries))
+	for _, t := range queries {
+		reason := ""
+		if only != "" {
+			if matched, _ := path.Match(only, t.Name); !matched {
+				reason = "doesn't match -only"
+			}
+		} else if t.Skip {
+			reason = "skip is set"
+		}
+		if _, err := expandEnv(t.OracleEndpoint); reason == "" && err != nil {
+			reason = fmt.Sprintf("oracle isn't configured, %v", err)
+		}
+
+		if reason != "" {
+			logger.Warn("test skipped",
+				zap.String("name", t.Name),
+				zap.String("URL", t.URL),
+				zap.String("reason", reason),
+			)
+			continue
+		}
+		selected = append(selected, t)
+	}
+	return selected
+}
+
+// stopOnSignal stops apps and exits if SIGINT or SIGTERM is received. Returned function disables that
+func stopOnSignal(logger *zap.Logger, apps *appsGroup) func() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		s, ok := <-sig
+		if !ok {
+			return
+		}
+		logger.Error("got signal, stopping apps",
+			zap.String("signal", s.String()),
+		)
+		apps.Stop()
+		os.Exit(1)
+	}()
+
+	return func() {
+		signal.Stop(sig)
+		close(sig)
+	}
+}
+
+func e2eTest(logger *zap.Logger, noapp bool, only string, repeat int) bool {
+	failed := false
+	started := time.Now()
+	logger.Info("will run test",
+		zap.Any("config", cfg.Test),
+	)
+	ports, err := allocatePorts(cfg.Test)
+	if err != nil {
+		logger.Error("failed to allocate ports",
+			zap.Error(err),
+		)
+		return true
+	}
+	if len(ports) != 0 {
+		logger.Info("allocated ports",
+			zap.Any("ports", ports),
+		)
+	}
+
+	if !noapp {
+		for i := range cfg.Test.Apps {
+			app := &cfg.Test.Apps[i]
+			if port, ok := ports[app.Name]; ok && app.Ready == "" {
+				app.Ready = fmt.Sprintf("127.0.0.1:%d", port)
+			}
+		}
+		apps, err := startApps(logger, cfg.Test.Apps, 30*time.Second)
+		// apps must be stopped even if test panics or interrupted
+		defer apps.Stop()
+		stop := stopOnSignal(logger, apps)
+		defer stop()
+
+		if err != nil {
+			failed = true
+			logger.Error("apps failed to start",
+				zap.Error(err),
+			)
+		} else if len(ports) != 0 {
+			logger.Info("will wait up to 30 seconds for apps to listen on allocated ports")
+			err = waitForPorts(logger, ports, 30*time.Second)
+			if err != nil {
+				failed = true
+				logger.Error("apps failed to start",
+					zap.Error(err),
+				)
+			}
+		} else {
+			logger.Info("will sleep for 5 seconds to start all required apps")
+			time.Sleep(5 * time.Second)
+		}
+	}
+
+	startup := time.Since(started)
+	queries := selectQueries(logger, cfg.Test.Queries, only)
+	var durations []time.Duration
+	if cfg.Test.Load != nil {
+		failures := doLoadTest(logger, cfg.Test.Load, queries)
+		if len(failures) != 0 {
+			failed = true
+			logger.Error("load test failed",
+				zap.Strings("failures", failures),
+			)
+		} else {
+			logger.Info("load test OK")
+		}
+	} else {
+		var queriesFailed bool
+		queriesFailed, durations = runQueries(logger, queries, repeat)
+		if queriesFailed {
+			failed = true
+		}
+	}
+
+	if max := cfg.Test.MaxSuiteDuration; max != 0 {
+		if duration := time.Since(started); duration > max {
+			failed = true
+			logger.Error("test suite exceeded its duration budget",
+				zap.Duration("duration", duration),
+				zap.Duration("max_suite_duration", max),
+				zap.Duration("startup", startup),
+				zap.Any("queries", queryDurations(queries, durations)),
+			)
+		}
+	}
+
+	skipped := len(cfg.Test.Queries) - len(queries)
+	if failed {
+		logger.Error("tests failed",
+			zap.Int("skipped", skipped),
+		)
+	} else {
+		logger.Info("All tests OK",
+			zap.Int("skipped", skipped),
+		)
+	}
+
+	return failed
+}
+
+// queryDuration is a total time of all runs of the query, it's reported if test suite is too slow
+type queryDuration struct {
+	Name       string  `json:"name"`
+	URL        string  `json:"url"`
+	DurationMs float64 `json:"durationMs"`
+}
+
+// queryDurations returns durations of queries, slowest first. durations are indexed as queries, they are absent
+// in load-generation mode
+func queryDurations(queries []Query, durations []time.Duration) []queryDuration {
+	res := make([]queryDuration, 0, len(durations))
+	for i, d := range durations {
+		res = append(res, queryDuration{Name: queries[i].Name, URL: queries[i].URL, DurationMs: milliseconds(d)})
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].DurationMs > res[j].DurationMs })
+	return res
+}
+
+// queryRuns contains results of all runs of the query
+type queryRuns struct {
+	runs       int
+	failedRuns []int
+}
+
+// queryRun is a single run of the query
+type queryRun struct {
+	query int
+	done  bool
+	// failures are empty if query succeeded, expectedFailures are failures of query with ExpectFailure set
+	failures         []string
+	expectedFailures []string
+	duration         time.Duration
+}
+
+// runQuery waits for the query delay, runs setup actions, sends the query and checks the response, taking
+// ExpectFailure into account, then runs teardown actions
+func runQuery(logger *zap.Logger, t *Query, baseline, candidate *App) (failures, expectedFailures []string) {
+	if err := delay(t); err != nil {
+		return []string{err.Error()}, nil
+	}
+	if err := runActions(logger, "setup", t.Setup); err != nil {
+		// expectFailure doesn't apply, query wasn't run at all
+		return []string{fmt.Sprintf("query is skipped, %v", err)}, nil
+	}
+	failures = poll(logger, t, func() []string {
+		if baseline != nil {
+			return doCompareTest(logger, t, baseline, candidate)
+		} else if t.OracleEndpoint != "" {
+			return doOracleTest(logger, t)
+		} else if len(t.Formats) != 0 {
+			return doFormatsTest(logger, t)
+		}
+		return doTest(logger, t)
+	})
+	if err := runActions(logger, "teardown", t.Teardown); err != nil {
+		failures = append(failures, err.Error())
+	}
+	if t.ExpectFailure {
+		expectedFailures = failures
+		failures = checkExpectedFailure(t, failures)
+	}
+	return failures, expectedFailures
+}
+
+// poll runs the check till it passes or PollUntil of the query is elapsed, failures of the last attempt are returned
+func poll(logger *zap.Logger, t *Query, check func() []string) []string {
+	interval := t.RetryInterval
+	if interval == 0 {
+		interval = defaultRetryInterval
+	}
+	deadline := time.Now().Add(t.PollUntil)
+	for attempt := 1; ; attempt++ {
+		failures := check()
+		if len(failures) == 0 || time.Now().Add(interval).After(deadline) {
+			return failures
+		}
+		logger.Debug("query failed, will poll again",
+			zap.String("name", t.Name),
+			zap.Int("attempt", attempt),
+			zap.Strings("failures", failures),
+		)
+		time.Sleep(interval)
+	}
+}
+
+// runQueries runs the whole set of queries repeat times (each query is also repeated as set in its config)
+// and reports queries that failed in some of the runs. Up to cfg.Test.Concurrency queries are run in parallel,
+// results are still logged in order of queries. Total duration of all runs is returned for every query
+func runQueries(logger *zap.Logger, queries []Query, repeat int) (bool, []time.Duration) {
+	failed := false
+	var baseline, candidate *App
+	if len(cfg.Test.Compare) != 0 {
+		var err error
+		baseline, candidate, err = compareApps(cfg.Test)
+		if err != nil {
+			logger.Error("invalid compare configuration",
+				zap.Error(err),
+			)
+			return true, nil
+		}
+	}
+
+	if repeat < 1 {
+		repeat = 1
+	}
+	runs := make([]queryRun, 0, len(queries)*repeat)
+	for i := 0; i < repeat; i++ {
+		for j := range queries {
+			times := queries[j].Repeat
+			if times < 1 {
+				times = 1
+			}
+			for k := 0; k < times; k++ {
+				runs = append(runs, queryRun{query: j})
+			}
+		}
+	}
+
+	results := make([]queryRuns, len(queries))
+	durations := make([]time.Duration, len(queries))
+	summary := newRunSummary()
+	report := func(r *queryRun) {
+		t := &queries[r.query]
+		durations[r.query] += r.duration
+		results[r.query].runs++
+		run := results[r.query].runs
+		summary.add(t, r, run)
+		if len(r.failures) != 0 {
+			failed = true
+			results[r.query].failedRuns = append(results[r.query].failedRuns, run)
+			logger.Error("test failed",
+				zap.String("name", t.Name),
+				zap.Int("run", run),
+				zap.Strings("failures", r.failures),
+			)
+			return
+		}
+		if t.ExpectFailure {
+			logger.Info("test failed as expected",
+				zap.String("name", t.Name),
+				zap.Strings("failures", r.expectedFailures),
+			)
+		}
+		logger.Info("test OK",
+			zap.String("name", t.Name),
+			zap.Int("run", run),
+		)
+	}
+
+	concurrency := cfg.Test.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	var lock sync.Mutex
+	// runs are reported as soon as all the previous ones are done, so order of logs doesn't depend on scheduling
+	next := 0
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				started := time.Now()
+				failures, expectedFailures := runQuery(logger, &queries[runs[i].query], baseline, candidate)
+				duration := time.Since(started)
+
+				lock.Lock()
+				runs[i].failures = failures
+				runs[i].expectedFailures = expectedFailures
+				runs[i].duration = duration
+				runs[i].done = true
+				for next < len(runs) && runs[next].done {
+					report(&runs[next])
+					next++
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	for i := range runs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for j, r := range results {
+		if r.runs < 2 || len(r.failedRuns) == 0 {
+			continue
+		}
+		msg := "test failed in all runs"
+		if len(r.failedRuns) < r.runs {
+			msg = "test is flaky"
+		}
+		logger.Error(msg,
+			zap.String("name", queries[j].Name),
+			zap.String("URL", queries[j].URL),
+			zap.Int("runs", r.runs),
+			zap.Ints("failed_runs", r.failedRuns),
+		)
+	}
+
+	if cfg.Test.Summary != "" {
+		if err := summary.save(cfg.Test.Summary); err != nil {
+			logger.Error("failed to save summary",
+				zap.String("path", cfg.Test.Summary),
+				zap.Error(err),
+			)
+			failed = true
+		}
+	}
+
+	return failed, durations
 }
@@ -0,0 +1,1458 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/protocol/carbonapi_v2_pb"
+	"github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func bufferLogger(buf *bytes.Buffer) *zap.Logger {
+	return zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(buf),
+		zapcore.DebugLevel,
+	))
+}
+
+func TestDoTestVerbose(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[{"target":"a.b.c","datapoints":[[1,1],[3,2],[2,3]]}]` + strings.Repeat(" ", 100)))
+	}))
+	defer srv.Close()
+
+	Verbose = true
+	VerboseBodySize = 20
+	defer func() {
+		Verbose = false
+		VerboseBodySize = 4096
+	}()
+
+	tests := []struct {
+		name        string
+		target      string
+		diagnostics bool
+	}{
+		{"success", "a.b.c", false},
+		{"failure", "d.e.f", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			q := &Query{
+				Endpoint: srv.URL,
+				Type:     "GET",
+				URL:      "/render?format=json&target=a.b.c",
+				ExpectedResponse: ExpectedResponse{
+					HttpCode:    http.StatusOK,
+					ContentType: contentTypeJSON,
+					ExpectedResults: []ExpectedResult{{
+						Metrics: []CarbonAPIResponse{{
+							Target:     tt.target,
+							Datapoints: []Datapoint{{1, 1}, {2, 3}, {3, 2}},
+						}},
+					}},
+				},
+			}
+
+			failures := doTest(bufferLogger(&buf), q)
+			if (len(failures) != 0) != tt.diagnostics {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+
+			logs := buf.String()
+			if got := strings.Contains(logs, "failed request details"); got != tt.diagnostics {
+				t.Fatalf("diagnostics logged: %v, expected %v, logs: %v", got, tt.diagnostics, logs)
+			}
+			if tt.diagnostics {
+				for _, s := range []string{`"method":"GET"`, `"response_code":200`, `"response_body":"[{\"target\":\"a.b.c\",`, `"response_body_truncated":true`} {
+					if !strings.Contains(logs, s) {
+						t.Errorf("diagnostics doesn't contain %v, logs: %v", s, logs)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDoTestTrailers(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Status")
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+		w.Header().Set("X-Status", "partial")
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		expected string
+		failed   bool
+	}{
+		{"partial", false},
+		{"/^part/", false},
+		{"complete", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			q := &Query{
+				Endpoint: srv.URL,
+				Type:     "GET",
+				URL:      "/render?format=json&target=a.b.c",
+				ExpectedResponse: ExpectedResponse{
+					HttpCode:         http.StatusOK,
+					ContentType:      contentTypeJSON,
+					ExpectedResults:  []ExpectedResult{{}},
+					ExpectedTrailers: map[string]string{"X-Status": tt.expected},
+				},
+			}
+
+			failures := doTest(zap.NewNop(), q)
+			if (len(failures) != 0) != tt.failed {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+}
+
+func TestDoTestExpectedProto(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		http2    bool
+		expected string
+		failed   bool
+	}{
+		{"http2", true, "HTTP/2.0", false},
+		{"http1", false, "HTTP/1.1", false},
+		{"mismatch", false, "HTTP/2.0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Query{
+				Endpoint:           srv.URL,
+				Type:               "GET",
+				URL:                "/render?format=json&target=a.b.c",
+				HTTP2:              tt.http2,
+				InsecureSkipVerify: true,
+				ExpectedResponse: ExpectedResponse{
+					HttpCode:        http.StatusOK,
+					ContentType:     contentTypeJSON,
+					ExpectedResults: []ExpectedResult{{}},
+					ExpectedProto:   tt.expected,
+				},
+			}
+
+			failures := doTest(zap.NewNop(), q)
+			if (len(failures) != 0) != tt.failed {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+}
+
+func TestSelfSignedCertificate(t *testing.T) {
+	cert, err := selfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	resp, err := httpClient(&Query{HTTP2: true, InsecureSkipVerify: true}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Proto != "HTTP/2.0" {
+		t.Fatalf("unexpected protocol %v", resp.Proto)
+	}
+}
+
+func TestDoTestMaxLatency(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		delay      int
+		maxLatency int
+		failed     bool
+	}{
+		{"no limit", 0, 0, false},
+		{"too slow", 0, 50, true},
+		{"fast enough", 0, 1000, false},
+		// delay before the request isn't counted
+		{"delay", 1, 1000, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Query{
+				Endpoint: srv.URL,
+				Delay:    tt.delay,
+				Type:     "GET",
+				URL:      "/render?format=json&target=a.b.c",
+				ExpectedResponse: ExpectedResponse{
+					HttpCode:        http.StatusOK,
+					ContentType:     contentTypeJSON,
+					ExpectedResults: []ExpectedResult{{}},
+					MaxLatencyMs:    tt.maxLatency,
+				},
+			}
+
+			failures, _ := runQuery(zap.NewNop(), q, nil, nil)
+			if (len(failures) != 0) != tt.failed {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+}
+
+func TestSendRequestRetries(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// body of POST request must be resent on retry
+		if r.FormValue("target") != "a.b.c" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+	})
+
+	tests := []struct {
+		name    string
+		retries int
+		failed  bool
+	}{
+		{"no retries", 0, true},
+		{"retries", 20, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			addr := l.Addr().String()
+			l.Close()
+
+			// server is started after the first attempt is refused
+			started := make(chan *httptest.Server, 1)
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				l, err := net.Listen("tcp", addr)
+				if err != nil {
+					started <- nil
+					return
+				}
+				srv := httptest.NewUnstartedServer(handler)
+				srv.Listener = l
+				srv.Start()
+				started <- srv
+			}()
+			defer func() {
+				if srv := <-started; srv != nil {
+					srv.Close()
+				}
+			}()
+
+			q := &Query{
+				Type:          "POST",
+				URL:           "/render",
+				Body:          "target=a.b.c&format=json",
+				Retries:       tt.retries,
+				RetryInterval: 20 * time.Millisecond,
+			}
+			resp, err := sendRequest(zap.NewNop(), "http://"+addr, q, nil)
+			if (err != nil) != tt.failed {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err == nil && resp.code != http.StatusOK {
+				t.Fatalf("unexpected code %v", resp.code)
+			}
+		})
+	}
+}
+
+func TestSendRequestURL(t *testing.T) {
+	var path, rawQuery, target string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, rawQuery, target = r.URL.Path, r.URL.RawQuery, r.URL.Query().Get("target")
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		endpoint string
+		url      string
+		path     string
+		target   string
+		rawQuery string
+	}{
+		{"function", srv.URL, "/render?format=json&target=aliasByNode(foo.bar,0)", "/render", "aliasByNode(foo.bar,0)", "format=json&target=aliasByNode%28foo.bar%2C0%29"},
+		{"endpoint with path", srv.URL + "/prefix", "/render?target=a.b.c", "/prefix/render", "a.b.c", "target=a.b.c"},
+		{"trailing slash", srv.URL, "/render/?target=a.b.c", "/render/", "a.b.c", "target=a.b.c"},
+		{"encoded slash", srv.URL, "/render?target=alias(a.b.c,'a%2Fb')", "/render", "alias(a.b.c,'a/b')", "target=alias%28a.b.c%2C%27a%2Fb%27%29"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Query{Type: "GET", URL: tt.url}
+			if _, err := sendRequest(zap.NewNop(), tt.endpoint, q, nil); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if path != tt.path {
+				t.Errorf("unexpected path, got %v, expected %v", path, tt.path)
+			}
+			if target != tt.target {
+				t.Errorf("unexpected target, got %v, expected %v", target, tt.target)
+			}
+			if rawQuery != tt.rawQuery {
+				t.Errorf("unexpected query, got %v, expected %v", rawQuery, tt.rawQuery)
+			}
+		})
+	}
+}
+
+func TestSendRequestHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Tenant") != "test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	q := &Query{
+		Type: "GET",
+		URL:  "/render?format=json&target=a.b.c",
+		Headers: map[string]string{
+			"Authorization": "Bearer ${MOCKBACKEND_TEST_TOKEN}",
+			"X-Tenant":      "test",
+		},
+	}
+
+	os.Unsetenv("MOCKBACKEND_TEST_TOKEN")
+	_, err := sendRequest(zap.NewNop(), srv.URL, q, nil)
+	if err == nil || !strings.Contains(err.Error(), "MOCKBACKEND_TEST_TOKEN") {
+		t.Fatalf("expected error about unset variable, got %v", err)
+	}
+
+	os.Setenv("MOCKBACKEND_TEST_TOKEN", "secret")
+	defer os.Unsetenv("MOCKBACKEND_TEST_TOKEN")
+	resp, err := sendRequest(zap.NewNop(), srv.URL, q, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.code != http.StatusOK {
+		t.Fatalf("headers were not sent, code %v", resp.code)
+	}
+	if got := resp.requestHeaders.Get("Authorization"); got != "Bearer ${MOCKBACKEND_TEST_TOKEN}" {
+		t.Errorf("secret is not hidden in request headers: %v", got)
+	}
+	if got := resp.requestHeaders.Get("X-Tenant"); got != "test" {
+		t.Errorf("unexpected X-Tenant header: %v", got)
+	}
+}
+
+func TestRunQueriesRepeat(t *testing.T) {
+	// every third response misses the header, like a result depending on goroutine scheduling would do
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1)%3 != 0 {
+			w.Header().Set("X-Status", "ok")
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	cfg.Test = &TestSchema{}
+	defer func() { cfg.Test = nil }()
+
+	tests := []struct {
+		name        string
+		repeat      int
+		queryRepeat int
+		failed      bool
+		failedRuns  string
+	}{
+		{"once", 1, 0, false, ""},
+		{"suite", 4, 0, true, `"failed_runs":[3]`},
+		{"query", 1, 4, true, `"failed_runs":[3]`},
+		{"both", 2, 3, true, `"failed_runs":[3,6]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&requests, 0)
+			var buf bytes.Buffer
+			queries := []Query{{
+				Name:     "flaky",
+				Endpoint: srv.URL,
+				Type:     "GET",
+				URL:      "/render?format=json&target=a.b.c",
+				Repeat:   tt.queryRepeat,
+				ExpectedResponse: ExpectedResponse{
+					HttpCode:        http.StatusOK,
+					ContentType:     contentTypeJSON,
+					ExpectedResults: []ExpectedResult{{}},
+					ExpectedHeaders: map[string]string{"X-Status": "ok"},
+				},
+			}}
+
+			if failed, _ := runQueries(bufferLogger(&buf), queries, tt.repeat); failed != tt.failed {
+				t.Fatalf("failed: %v, expected %v, logs: %v", failed, tt.failed, buf.String())
+			}
+			logs := buf.String()
+			if tt.failed && !(strings.Contains(logs, "test is flaky") && strings.Contains(logs, tt.failedRuns)) {
+				t.Errorf("flaky test isn't reported, logs: %v", logs)
+			}
+		})
+	}
+}
+
+func TestCheckExpectedFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		expectedError string
+		failures      []string
+		failed        bool
+	}{
+		{"succeeded", "", []string{}, true},
+		{"failed", "", []string{"unexpected status code, got 400, expected 200"}, false},
+		{"failed with expected error", "unknown function", []string{"a", `body 'Error : unknown function "foo"'`}, false},
+		{"failed with other error", "unknown function", []string{"unexpected status code, got 500, expected 200"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := &Query{ExpectFailure: true, ExpectedError: tt.expectedError}
+			failures := checkExpectedFailure(q, tt.failures)
+			if (len(failures) != 0) != tt.failed {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+}
+
+func TestCheckHeadersRegex(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("X-Carbonapi-Backends", "3")
+
+	tests := []struct {
+		name     string
+		expected map[string]string
+		failures []string
+	}{
+		{"matched", map[string]string{"x-carbonapi-backends": "^[1-9][0-9]*$"}, nil},
+		{"partial match", map[string]string{"X-Carbonapi-Backends": "3"}, nil},
+		{"mismatch", map[string]string{"X-Carbonapi-Backends": "^[12]$"}, []string{
+			"header 'X-Carbonapi-Backends' mismatch, got '3', expected to match '/^[12]$/'",
+		}},
+		{"missing", map[string]string{"X-Carbonapi-Partial-Failure": "^0$"}, []string{
+			"header 'X-Carbonapi-Partial-Failure' is missing, expected '/^0$/'",
+		}},
+		{"invalid", map[string]string{"X-Carbonapi-Backends": "(3"}, []string{
+			"invalid regexp for header 'X-Carbonapi-Backends': error parsing regexp: missing closing ): `(3`",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ExpectedResponse{ExpectedHeaderRegex: tt.expected}
+			failures := checkHeaders("header", headers, r.expectedHeaders())
+			if strings.Join(failures, "\n") != strings.Join(tt.failures, "\n") {
+				t.Fatalf("got failures %q, expected %q", failures, tt.failures)
+			}
+		})
+	}
+}
+
+func TestExpectedHeaders(t *testing.T) {
+	r := ExpectedResponse{
+		ExpectedHeaders:     map[string]string{"X-Cache": "HIT", "x-carbonapi-backends": "2"},
+		ExpectedHeaderRegex: map[string]string{"X-Carbonapi-Backends": "^[1-9]$"},
+	}
+	expected := map[string]string{"X-Cache": "HIT", "X-Carbonapi-Backends": "/^[1-9]$/"}
+	if got := r.expectedHeaders(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestIsMetricsEqualTargetRegex(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected CarbonAPIResponse
+		target   string
+		err      string
+	}{
+		{"exact", CarbonAPIResponse{Target: "a.b.c"}, "a.b.c", ""},
+		{"exact mismatch", CarbonAPIResponse{Target: "a.b.*"}, "a.b.c", "target mismatch"},
+		{"regex", CarbonAPIResponse{TargetRegex: `^a\.b \(avg: [0-9.]+\)$`}, "a.b (avg: 1.5)", ""},
+		{"regex mismatch", CarbonAPIResponse{TargetRegex: `^a\.b \(avg: [0-9.]+\)$`}, "a.b (max: 1.5)", "expected to match"},
+		{"regex in slashes", CarbonAPIResponse{Target: `/^a\.b/`}, "a.b (avg: 1.5)", ""},
+		{"invalid regex", CarbonAPIResponse{TargetRegex: `a.b(`}, "a.b", "invalid regexp for target '/a.b(/'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := compileTargetRegexps([]CarbonAPIResponse{tt.expected})
+			if err == nil {
+				err = isMetricsEqual(CarbonAPIResponse{Target: tt.target}, expected[0], 0, false)
+			}
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("unexpected error '%v', expected '%v'", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestIsMetricsEqualEpsilon(t *testing.T) {
+	nan := math.NaN()
+	// computed at runtime, constant expression would be exact
+	sum := 0.1
+	sum += 0.2
+	tests := []struct {
+		name     string
+		got      []Datapoint
+		expected []Datapoint
+		epsilon  float64
+		equal    bool
+	}{
+		{"exact", []Datapoint{{1, 0.1}, {2, 0.3}, {3, 0}}, []Datapoint{{1, 0.1}, {2, 0.3}, {3, 0}}, 0, true},
+		{"last ULP differs", []Datapoint{{1, sum}}, []Datapoint{{1, 0.3}}, 0, false},
+		{"last ULP within epsilon", []Datapoint{{1, sum}}, []Datapoint{{1, 0.3}}, 1e-9, true},
+		{"out of epsilon", []Datapoint{{1, 0.31}}, []Datapoint{{1, 0.3}}, 1e-9, false},
+		{"NaNs", []Datapoint{{1, nan}, {2, 1}, {3, nan}}, []Datapoint{{1, nan}, {2, 1}, {3, nan}}, 0, true},
+		{"NaN and value", []Datapoint{{1, nan}}, []Datapoint{{1, 0}}, 1, false},
+		{"NaNs at different timestamps", []Datapoint{{1, nan}}, []Datapoint{{2, nan}}, 0, false},
+		{"infinities", []Datapoint{{1, math.Inf(1)}}, []Datapoint{{1, math.Inf(1)}}, 1e-9, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := isMetricsEqual(
+				CarbonAPIResponse{Target: "a", Datapoints: tt.got},
+				CarbonAPIResponse{Target: "a", Datapoints: tt.expected},
+				tt.epsilon,
+				false,
+			)
+			if (err == nil) != tt.equal {
+				t.Fatalf("unexpected result: %v", err)
+			}
+		})
+	}
+}
+
+func TestIsMetricsEqualStep(t *testing.T) {
+	tests := []struct {
+		name     string
+		got      []Datapoint
+		expected []Datapoint
+		err      string
+	}{
+		{"two points", []Datapoint{{60, 1}, {120, 2}}, []Datapoint{{60, 1}, {120, 2}}, ""},
+		{"two points with other step", []Datapoint{{60, 1}, {120, 2}}, []Datapoint{{60, 1}, {90, 2}}, "unexpected step, got '60', expected '30'"},
+		{"one point", []Datapoint{{60, 1}}, []Datapoint{{60, 1}}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := isMetricsEqual(
+				CarbonAPIResponse{Target: "a", Datapoints: tt.got},
+				CarbonAPIResponse{Target: "a", Datapoints: tt.expected},
+				0,
+				false,
+			)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("unexpected error '%v', expected '%v'", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestIsMetricsEqualTimestampsOnly(t *testing.T) {
+	tests := []struct {
+		name     string
+		got      []Datapoint
+		expected []Datapoint
+		err      string
+	}{
+		{"values differ", []Datapoint{{60, 1}, {120, 2}}, []Datapoint{{60, 3}, {120, math.NaN()}}, ""},
+		{"shifted timestamps", []Datapoint{{60, 1}, {120, 2}}, []Datapoint{{0, 1}, {60, 2}}, "timestamps in response are different, got '[60 120]', expected '[0 60]'"},
+		{"other step", []Datapoint{{60, 1}, {120, 2}}, []Datapoint{{60, 1}, {90, 2}}, "unexpected step"},
+		{"other length", []Datapoint{{60, 1}}, []Datapoint{{60, 1}, {120, 2}}, "unexpected length"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := isMetricsEqual(
+				CarbonAPIResponse{Target: "a", Datapoints: tt.got},
+				CarbonAPIResponse{Target: "a", Datapoints: tt.expected},
+				0,
+				true,
+			)
+			if tt.err == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Fatalf("unexpected error '%v', expected '%v'", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckEmpty(t *testing.T) {
+	tests := []struct {
+		body  string
+		empty bool
+	}{
+		{`[]`, true},
+		{" [ ]\n", true},
+		{`[{"target":"a.b.c","datapoints":[]}]`, false},
+		{`null`, false},
+		{`{}`, false},
+		{`[`, false},
+		{``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			failures := checkEmpty([]byte(tt.body))
+			if (len(failures) == 0) != tt.empty {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+}
+
+func TestRunQueriesConcurrency(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", contentTypeJSON)
+		// responses of queries that should fail don't have the header
+		if !strings.Contains(r.URL.RawQuery, "fail") {
+			w.Header().Set("X-Status", "ok")
+		}
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	cfg.Test = &TestSchema{Concurrency: 4}
+	defer func() { cfg.Test = nil }()
+
+	queries := make([]Query, 0)
+	for i := 0; i < 8; i++ {
+		target := fmt.Sprintf("q%d", i)
+		if i%3 == 0 {
+			target += ".fail"
+		}
+		queries = append(queries, Query{
+			Name:     target,
+			Endpoint: srv.URL,
+			Type:     "GET",
+			URL:      "/render?format=json&target=" + target,
+			ExpectedResponse: ExpectedResponse{
+				HttpCode:        http.StatusOK,
+				ContentType:     contentTypeJSON,
+				ExpectedResults: []ExpectedResult{{}},
+				ExpectedHeaders: map[string]string{"X-Status": "ok"},
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	start := time.Now()
+	if failed, _ := runQueries(bufferLogger(&buf), queries, 1); !failed {
+		t.Fatal("failures weren't reported")
+	}
+	if elapsed := time.Since(start); elapsed >= 800*time.Millisecond {
+		t.Errorf("queries weren't run in parallel, took %v", elapsed)
+	}
+
+	// results are logged in order of queries, regardless of which of them finished first
+	results := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var entry struct {
+			Msg  string `json:"msg"`
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		if entry.Msg == "test OK" || entry.Msg == "test failed" {
+			results = append(results, entry.Name+" "+entry.Msg)
+		}
+	}
+	expected := []string{
+		"q0.fail test failed", "q1 test OK", "q2 test OK", "q3.fail test failed",
+		"q4 test OK", "q5 test OK", "q6.fail test failed", "q7 test OK",
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("unexpected results %v, expected %v", results, expected)
+	}
+}
+
+func TestE2ETestMaxSuiteDuration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("target") == "slow" {
+			time.Sleep(200 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	query := func(name string) Query {
+		return Query{
+			Name:     name,
+			Endpoint: srv.URL,
+			Type:     "GET",
+			URL:      "/render?format=json&target=" + name,
+			ExpectedResponse: ExpectedResponse{
+				HttpCode:    http.StatusOK,
+				ContentType: contentTypeJSON,
+				ExpectEmpty: true,
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		max    time.Duration
+		failed bool
+	}{
+		{"no budget", 0, false},
+		{"within budget", 10 * time.Second, false},
+		{"exceeded", 100 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.Test = &TestSchema{
+				Queries:          []Query{query("fast"), query("slow")},
+				MaxSuiteDuration: tt.max,
+			}
+			defer func() { cfg.Test = nil }()
+
+			var buf bytes.Buffer
+			if failed := e2eTest(bufferLogger(&buf), true, "", 1); failed != tt.failed {
+				t.Fatalf("failed: %v, expected %v, logs: %v", failed, tt.failed, buf.String())
+			}
+
+			logs := buf.String()
+			exceeded := strings.Contains(logs, "test suite exceeded its duration budget")
+			if exceeded != tt.failed {
+				t.Fatalf("unexpected report of duration budget, logs: %v", logs)
+			}
+			// queries are reported slowest first
+			if tt.failed && !strings.Contains(logs, `"queries":[{"name":"slow"`) {
+				t.Errorf("breakdown by query isn't reported, logs: %v", logs)
+			}
+		})
+	}
+}
+
+func TestCheckMetricsOrder(t *testing.T) {
+	body := `[{"target":"b","datapoints":[[1,1]]},{"target":"a (avg: 1)","datapoints":[[2,1]]},{"target":"a","datapoints":[[3,1]]}]`
+	tests := []struct {
+		name     string
+		expected ExpectedResult
+		failures []string
+	}{
+		{
+			name: "any order",
+			expected: ExpectedResult{Metrics: []CarbonAPIResponse{
+				{Target: "a", Datapoints: []Datapoint{{1, 3}}},
+				{TargetRegex: `^a \(avg`, Datapoints: []Datapoint{{1, 2}}},
+				{Target: "b", Datapoints: []Datapoint{{1, 1}}},
+			}},
+		},
+		{
+			name: "ordered",
+			expected: ExpectedResult{Ordered: true, Metrics: []CarbonAPIResponse{
+				{Target: "a", Datapoints: []Datapoint{{1, 3}}},
+				{TargetRegex: `^a \(avg`, Datapoints: []Datapoint{{1, 2}}},
+				{Target: "b", Datapoints: []Datapoint{{1, 1}}},
+			}},
+			failures: []string{"target mismatch, got 'b', expected 'a'", "target mismatch, got 'a', expected 'b'"},
+		},
+		{
+			name: "missing and unexpected",
+			expected: ExpectedResult{Metrics: []CarbonAPIResponse{
+				{Target: "a", Datapoints: []Datapoint{{1, 3}}},
+				{Target: "b", Datapoints: []Datapoint{{1, 1}}},
+				{Target: "c", Datapoints: []Datapoint{{1, 1}}},
+			}},
+			failures: []string{`unexpected series ["a (avg: 1)"]`, `missing series ["c"]`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := checkMetrics(strings.NewReader(body), tt.expected)
+			if len(failures) != len(tt.failures) {
+				t.Fatalf("unexpected failures %v, expected %v", failures, tt.failures)
+			}
+			for i := range failures {
+				if !strings.Contains(failures[i], tt.failures[i]) {
+					t.Errorf("unexpected failure '%v', expected '%v'", failures[i], tt.failures[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCheckMetricsReorderedWithEpsilon(t *testing.T) {
+	body := `[{"target":"x","datapoints":[[2.0004,1],[null,2]]},{"target":"x","datapoints":[[1.0003,1],[3.0001,2]]},{"target":"y (avg: 1)","datapoints":[[5,1],[6,2]]},{"target":"y (avg: 2)","datapoints":[[7,1],[8,2]]}]`
+	expected := []CarbonAPIResponse{
+		{Target: "x", Datapoints: []Datapoint{{1, 1}, {2, 3}}},
+		{Target: "x", Datapoints: []Datapoint{{1, 2}, {2, math.NaN()}}},
+		{TargetRegex: `^y \(avg`, Datapoints: []Datapoint{{1, 7}, {2, 8}}},
+		{TargetRegex: `^y \(avg`, Datapoints: []Datapoint{{1, 5}, {2, 6}}},
+	}
+
+	tests := []struct {
+		name     string
+		expected ExpectedResult
+		failures []string
+	}{
+		{
+			name:     "within epsilon",
+			expected: ExpectedResult{Epsilon: 0.001, Metrics: expected},
+		},
+		{
+			name:     "exceeds epsilon",
+			expected: ExpectedResult{Epsilon: 0.0001, Metrics: expected},
+			failures: []string{"data in response is different", "data in response is different"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := checkMetrics(strings.NewReader(body), tt.expected)
+			if len(failures) != len(tt.failures) {
+				t.Fatalf("unexpected failures %v, expected %v", failures, tt.failures)
+			}
+			for i := range failures {
+				if !strings.Contains(failures[i], tt.failures[i]) {
+					t.Errorf("unexpected failure '%v', expected '%v'", failures[i], tt.failures[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDoTestLargeResponse(t *testing.T) {
+	const (
+		seriesCount = 1000
+		pointsCount = 1000
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		bw := bufio.NewWriter(w)
+		_, _ = bw.WriteString("[")
+		for i := 0; i < seriesCount; i++ {
+			if i > 0 {
+				_, _ = bw.WriteString(",")
+			}
+			_, _ = fmt.Fprintf(bw, `{"target":"series.%d","datapoints":[`, i)
+			for j := 0; j < pointsCount; j++ {
+				if j > 0 {
+					_, _ = bw.WriteString(",")
+				}
+				_, _ = fmt.Fprintf(bw, "[%d,%d]", 1000000+j, 1000000000+j*60)
+			}
+			_, _ = bw.WriteString("]}")
+		}
+		_, _ = bw.WriteString("]")
+		_ = bw.Flush()
+	}))
+	defer srv.Close()
+
+	metrics := make([]CarbonAPIResponse, 0, seriesCount)
+	// series are matched regardless of the order
+	for i := seriesCount - 1; i >= 0; i-- {
+		metrics = append(metrics, CarbonAPIResponse{Target: fmt.Sprintf("series.%d", i), ExpectedPointCount: pointsCount})
+	}
+	q := &Query{
+		Endpoint: srv.URL,
+		Type:     "GET",
+		URL:      "/render?format=json&target=series.*",
+		ExpectedResponse: ExpectedResponse{
+			HttpCode:        http.StatusOK,
+			ContentType:     contentTypeJSON,
+			ExpectedResults: []ExpectedResult{{Metrics: metrics}},
+			MinBytes:        seriesCount * pointsCount * 20,
+		},
+	}
+
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	base := stats.HeapAlloc
+	var peak uint64
+	done := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		var stats runtime.MemStats
+		for {
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > peak {
+				peak = stats.HeapAlloc
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}()
+
+	failures := doTest(zap.NewNop(), q)
+	close(done)
+	<-sampled
+	if len(failures) != 0 {
+		t.Fatalf("unexpected failures: %v", failures)
+	}
+
+	// response is ~20MB, only a series at a time should be kept in memory, garbage is allowed
+	if growth := int64(peak) - int64(base); growth > 8<<20 {
+		t.Errorf("heap grew by %v bytes while reading the response", growth)
+	}
+}
+
+func TestCheckCSV(t *testing.T) {
+	body := "\"a.b.c\",2001-09-09 01:46:40,1\n" +
+		"\"a.b.c\",2001-09-09 01:47:40,\n" +
+		"\"sumSeries(a.b.c,a.b.c)\",2001-09-09 01:46:40,2.5\n"
+	nan := math.NaN()
+
+	tests := []struct {
+		name     string
+		expected []CarbonAPIResponse
+		failed   bool
+	}{
+		{
+			name: "equal",
+			expected: []CarbonAPIResponse{
+				{Target: "a.b.c", Datapoints: []Datapoint{{1000000000, 1}, {1000000060, nan}}},
+				{Target: "sumSeries(a.b.c,a.b.c)", Datapoints: []Datapoint{{1000000000, 2.5}}},
+			},
+		},
+		{
+			name: "different value",
+			expected: []CarbonAPIResponse{
+				{Target: "a.b.c", Datapoints: []Datapoint{{1000000000, 1}, {1000000060, 2}}},
+				{Target: "sumSeries(a.b.c,a.b.c)", Datapoints: []Datapoint{{1000000000, 2.5}}},
+			},
+			failed: true,
+		},
+		{
+			name: "different time",
+			expected: []CarbonAPIResponse{
+				{Target: "a.b.c", Datapoints: []Datapoint{{1000000000, 1}, {1000000060, nan}}},
+				{Target: "sumSeries(a.b.c,a.b.c)", Datapoints: []Datapoint{{1000000001, 2.5}}},
+			},
+			failed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := checkCSV([]byte(body), ExpectedResult{Metrics: tt.expected})
+			if (len(failures) != 0) != tt.failed {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+}
+
+func TestCheckProtobuf(t *testing.T) {
+	nan := math.NaN()
+	v3, err := (&carbonapi_v3_pb.MultiFetchResponse{
+		Metrics: []carbonapi_v3_pb.FetchResponse{
+			{Name: "a.b.c", StartTime: 1000000000, StopTime: 1000000120, StepTime: 60, Values: []float64{1, nan}},
+			{Name: "sumSeries(a.b.c,a.b.c)", StartTime: 1000000000, StopTime: 1000000060, StepTime: 60, Values: []float64{2.5}},
+		},
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := (&carbonapi_v2_pb.MultiFetchResponse{
+		Metrics: []carbonapi_v2_pb.FetchResponse{
+			{Name: "a.b.c", StartTime: 1000000000, StopTime: 1000000120, StepTime: 60, Values: []float64{1, 0}, IsAbsent: []bool{false, true}},
+			{Name: "sumSeries(a.b.c,a.b.c)", StartTime: 1000000000, StopTime: 1000000060, StepTime: 60, Values: []float64{2.5}},
+		},
+	}).Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		expected []CarbonAPIResponse
+		failed   bool
+	}{
+		{
+			name: "equal",
+			expected: []CarbonAPIResponse{
+				{Target: "a.b.c", Datapoints: []Datapoint{{1000000000, 1}, {1000000060, nan}}},
+				{Target: "sumSeries(a.b.c,a.b.c)", Datapoints: []Datapoint{{1000000000, 2.5}}},
+			},
+		},
+		{
+			name: "different value",
+			expected: []CarbonAPIResponse{
+				{Target: "a.b.c", Datapoints: []Datapoint{{1000000000, 1}, {1000000060, 2}}},
+				{Target: "sumSeries(a.b.c,a.b.c)", Datapoints: []Datapoint{{1000000000, 2.5}}},
+			},
+			failed: true,
+		},
+		{
+			name: "different time",
+			expected: []CarbonAPIResponse{
+				{Target: "a.b.c", Datapoints: []Datapoint{{1000000000, 1}, {1000000060, nan}}},
+				{Target: "sumSeries(a.b.c,a.b.c)", Datapoints: []Datapoint{{1000000001, 2.5}}},
+			},
+			failed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		for format, body := range map[string][]byte{"carbonapi_v3_pb": v3, "protobuf": v2} {
+			t.Run(tt.name+" "+format, func(t *testing.T) {
+				failures := checkProtobuf(body, format, ExpectedResult{Metrics: tt.expected})
+				if (len(failures) != 0) != tt.failed {
+					t.Fatalf("unexpected failures: %v", failures)
+				}
+			})
+		}
+	}
+
+	if failures := checkProtobuf(v2, "carbonapi_v3_pb", ExpectedResult{}); len(failures) == 0 {
+		t.Errorf("carbonapi_v2_pb response is decoded as carbonapi_v3_pb")
+	}
+}
+
+func TestRequestFormat(t *testing.T) {
+	tests := []struct {
+		q        Query
+		expected string
+	}{
+		{Query{URL: "/render?format=carbonapi_v3_pb&target=a"}, "carbonapi_v3_pb"},
+		{Query{URL: "/render", Body: "target=a&format=protobuf"}, "protobuf"},
+		{Query{URL: "/render?target=a"}, ""},
+	}
+	for _, tt := range tests {
+		if got := requestFormat(&tt.q); got != tt.expected {
+			t.Errorf("unexpected format for %v %v: got %v, expected %v", tt.q.URL, tt.q.Body, got, tt.expected)
+		}
+	}
+}
+
+func TestCheckLogs(t *testing.T) {
+	logsTimeout = 200 * time.Millisecond
+	defer func() {
+		logsTimeout = time.Second
+	}()
+
+	_, _ = AppLogs.Write([]byte("INFO\taccess\t{\"url\": \"/render\", \"from_cache\": false}\n"))
+	offset := AppLogs.Len()
+	_, _ = AppLogs.Write([]byte("INFO\taccess\t{\"url\": \"/metrics/find\", \"from_cache\": true}\n"))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = AppLogs.Write([]byte("DEBUG\tzipper\tbackend fallback\n"))
+	}()
+
+	tests := []struct {
+		name     string
+		expected []string
+		failed   bool
+	}{
+		{"substring", []string{`"from_cache": true`}, false},
+		{"regexp", []string{`/"url": "/metrics/.*"from_cache": true/`}, false},
+		{"written later", []string{"backend fallback"}, false},
+		{"before offset", []string{`"from_cache": false`}, true},
+		{"invalid regexp", []string{`/(/`}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := checkLogs(offset, tt.expected)
+			if (len(failures) != 0) != tt.failed {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+}
+
+func TestParseRaw(t *testing.T) {
+	body := "a.b.c,1000000000,1000000180,60|1,None,2.5\n" +
+		"sumSeries(a.b.c,a.b.c),1000000000,1000000060,60|2\n" +
+		"empty,1000000000,1000000000,60|\n"
+	nan := math.NaN()
+	expected := []CarbonAPIResponse{
+		{Target: "a.b.c", Datapoints: []Datapoint{{1000000000, 1}, {1000000060, nan}, {1000000120, 2.5}}},
+		{Target: "sumSeries(a.b.c,a.b.c)", Datapoints: []Datapoint{{1000000000, 2}}},
+		{Target: "empty"},
+	}
+
+	got, err := parseRaw([]byte(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("unexpected amount of series, got %v, expected %v", len(got), len(expected))
+	}
+	for i := range got {
+		if err := isMetricsEqual(got[i], expected[i], 0, false); err != nil {
+			t.Errorf("series %v: %v", i, err)
+		}
+	}
+
+	for _, b := range []string{"a.b.c,1,2,1", "a.b.c,1|1", "a.b.c,1,2,1|x"} {
+		if _, err := parseRaw([]byte(b)); err == nil {
+			t.Errorf("expected error for '%v'", b)
+		}
+	}
+}
+
+func TestDoFormatsTest(t *testing.T) {
+	rawValue := "3"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("format") {
+		case "json":
+			w.Header().Set("Content-Type", contentTypeJSON)
+			_, _ = w.Write([]byte(`[{"target":"a.b.c","datapoints":[[1,1000000000],[3,1000000060]],"tags":{"name":"a.b.c"}}]`))
+		case "raw":
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte("a.b.c,1000000000,1000000120,60|1," + rawValue + "\n"))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		formats  []string
+		rawValue string
+		failure  string
+	}{
+		{"same", []string{"json", "raw"}, "3", ""},
+		{"diverged", []string{"json", "raw"}, "4", "format 'raw' diverged from 'json'"},
+		{"bad format", []string{"json", "png"}, "3", "format 'png': unexpected status code"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rawValue = tt.rawValue
+			q := &Query{
+				Endpoint: srv.URL,
+				Type:     "GET",
+				URL:      "/render?format=json&target=a.b.c",
+				Formats:  tt.formats,
+				ExpectedResponse: ExpectedResponse{
+					HttpCode: http.StatusOK,
+				},
+			}
+
+			failures := doFormatsTest(zap.NewNop(), q)
+			if tt.failure == "" {
+				if len(failures) != 0 {
+					t.Fatalf("unexpected failures: %v", failures)
+				}
+				return
+			}
+			if len(failures) != 1 || !strings.Contains(failures[0], tt.failure) {
+				t.Fatalf("expected failure '%v', got %v", tt.failure, failures)
+			}
+		})
+	}
+}
+
+func TestRunQuerySetupTeardown(t *testing.T) {
+	var flushes, renders int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flush":
+			atomic.AddInt32(&flushes, 1)
+		case "/missing":
+			http.Error(w, "not found", http.StatusNotFound)
+		default:
+			atomic.AddInt32(&renders, 1)
+			w.Header().Set("Content-Type", contentTypeJSON)
+			_, _ = w.Write([]byte(`[]`))
+		}
+	}))
+	defer srv.Close()
+
+	flush := Action{Endpoint: srv.URL, Type: "POST", URL: "/flush"}
+	tests := []struct {
+		name     string
+		setup    []Action
+		teardown []Action
+		failure  string
+		flushes  int32
+		renders  int32
+	}{
+		{"success", []Action{flush}, []Action{flush, {Command: []string{"true"}}}, "", 2, 1},
+		{"setup command failed", []Action{{Command: []string{"false"}}, flush}, []Action{flush}, "query is skipped, setup action 1: command", 0, 0},
+		{"setup request failed", []Action{{Endpoint: srv.URL, URL: "/missing"}}, nil, "query is skipped, setup action 1: request GET /missing failed with status 404", 0, 0},
+		{"teardown failed", nil, []Action{{Command: []string{"false"}}}, "teardown action 1: command", 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&flushes, 0)
+			atomic.StoreInt32(&renders, 0)
+			q := &Query{
+				Endpoint: srv.URL,
+				Type:     "GET",
+				URL:      "/render?format=json&target=a.b.c",
+				Setup:    tt.setup,
+				Teardown: tt.teardown,
+				ExpectedResponse: ExpectedResponse{
+					HttpCode:        http.StatusOK,
+					ContentType:     contentTypeJSON,
+					ExpectedResults: []ExpectedResult{{}},
+				},
+			}
+
+			failures, _ := runQuery(zap.NewNop(), q, nil, nil)
+			if tt.failure == "" && len(failures) != 0 {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+			if tt.failure != "" && (len(failures) != 1 || !strings.Contains(failures[0], tt.failure)) {
+				t.Fatalf("expected failure '%v', got %v", tt.failure, failures)
+			}
+			if got := atomic.LoadInt32(&flushes); got != tt.flushes {
+				t.Errorf("unexpected amount of flushes, got %v, expected %v", got, tt.flushes)
+			}
+			if got := atomic.LoadInt32(&renders); got != tt.renders {
+				t.Errorf("unexpected amount of queries, got %v, expected %v", got, tt.renders)
+			}
+		})
+	}
+}
+
+func TestDoTestNoExpectedResults(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("contentType"))
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	for _, contentType := range []string{contentTypeJSON, "text/csv", "application/x-protobuf", "image/svg+xml"} {
+		t.Run(contentType, func(t *testing.T) {
+			q := &Query{
+				Endpoint: srv.URL,
+				Type:     "GET",
+				URL:      "/render?target=a.b.c&contentType=" + url.QueryEscape(contentType),
+				ExpectedResponse: ExpectedResponse{
+					HttpCode:    http.StatusOK,
+					ContentType: contentType,
+				},
+			}
+
+			failures := doTest(zap.NewNop(), q)
+			if len(failures) != 1 || !strings.Contains(failures[0], "no expectedResults") {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+}
+
+func TestDoTestHTMLErrorPage(t *testing.T) {
+	page := "<html><body><h1>Internal error</h1><pre>panic: runtime error: index out of range</pre></body></html>\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	q := &Query{
+		Endpoint: srv.URL,
+		Type:     "GET",
+		URL:      "/render?target=a.b.c&format=json",
+		ExpectedResponse: ExpectedResponse{
+			HttpCode:    http.StatusOK,
+			ContentType: contentTypeJSON,
+			ExpectedResults: []ExpectedResult{{
+				Metrics: []CarbonAPIResponse{{Target: "a.b.c", Datapoints: []Datapoint{{1, 1}}}},
+			}},
+		},
+	}
+
+	failures := doTest(zap.NewNop(), q)
+	expected := "unexpected content-type, got text/html, expected application/json, body '" + strings.TrimSpace(page) + "'"
+	if len(failures) == 0 || failures[0] != expected {
+		t.Fatalf("unexpected failures '%v', expected '%v'", failures, expected)
+	}
+	for _, f := range failures[1:] {
+		if strings.Contains(f, "<html>") {
+			t.Fatalf("body is shown more than once: %v", failures)
+		}
+	}
+}
+
+func TestBodyPreview(t *testing.T) {
+	long := strings.Repeat("a", bodyPreviewSize-1) + "ю" + "tail"
+	tests := []struct {
+		name     string
+		body     []byte
+		size     int
+		expected string
+	}{
+		{"text", []byte(" Error: unknown function\n"), 25, "body 'Error: unknown function'"},
+		{"truncated", []byte(long), len(long), "body '" + strings.Repeat("a", bodyPreviewSize-1) + "' (truncated, " + strconv.Itoa(len(long)) + " bytes total)"},
+		{"streamed", []byte("[{"), 100, "body '[{' (truncated, 100 bytes total)"},
+		{"binary", []byte{0x0a, 0xff, 0xfe}, 3, "body (hex) '0afffe'"},
+		{"binary truncated", bytes.Repeat([]byte{0xff}, bodyPreviewSize), bodyPreviewSize, "body (hex) '" + strings.Repeat("ff", bodyPreviewSize/2) + "' (truncated, " + strconv.Itoa(bodyPreviewSize) + " bytes total)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bodyPreview(tt.body, tt.size); got != tt.expected {
+				t.Fatalf("unexpected preview '%v', expected '%v'", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRunQueryPollUntil(t *testing.T) {
+	var renders int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		// data appears on the third request
+		if atomic.AddInt32(&renders, 1) < 3 {
+			_, _ = w.Write([]byte(`[]`))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"target":"a.b.c","datapoints":[[1,1]]}]`))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		pollUntil time.Duration
+		failed    bool
+		renders   int32
+	}{
+		{"without polling", 0, true, 1},
+		{"data appeared", time.Second, false, 3},
+		{"timeout", 15 * time.Millisecond, true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			atomic.StoreInt32(&renders, 0)
+			q := &Query{
+				Endpoint:      srv.URL,
+				Type:          "GET",
+				URL:           "/render?format=json&target=a.b.c",
+				PollUntil:     tt.pollUntil,
+				RetryInterval: 10 * time.Millisecond,
+				ExpectedResponse: ExpectedResponse{
+					HttpCode:    http.StatusOK,
+					ContentType: contentTypeJSON,
+					ExpectedResults: []ExpectedResult{{
+						Metrics: []CarbonAPIResponse{{Target: "a.b.c", Datapoints: []Datapoint{{1, 1}}}},
+					}},
+				},
+			}
+
+			failures, _ := runQuery(zap.NewNop(), q, nil, nil)
+			if (len(failures) != 0) != tt.failed {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+			if got := atomic.LoadInt32(&renders); got != tt.renders {
+				t.Fatalf("unexpected amount of requests, got %v, expected %v", got, tt.renders)
+			}
+		})
+	}
+}
+
+func TestSelectQueries(t *testing.T) {
+	queries := []Query{
+		{Name: "sum"},
+		{Name: "skipped", Skip: true},
+		{Name: "sum-skipped", Skip: true},
+		{Name: "max"},
+	}
+
+	tests := []struct {
+		only     string
+		selected []string
+	}{
+		{"", []string{"sum", "max"}},
+		{"max", []string{"max"}},
+		{"sum*", []string{"sum", "sum-skipped"}},
+		// only wins over skip flag
+		{"skipped", []string{"skipped"}},
+		{"none", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.only, func(t *testing.T) {
+			names := make([]string, 0)
+			for _, q := range selectQueries(zap.NewNop(), queries, tt.only) {
+				names = append(names, q.Name)
+			}
+			if !reflect.DeepEqual(names, tt.selected) {
+				t.Fatalf("unexpected queries %v, expected %v", names, tt.selected)
+			}
+		})
+	}
+}
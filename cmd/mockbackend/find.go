@@ -10,6 +10,7 @@ import (
 
 	"github.com/ansel1/merry"
 	"github.com/go-graphite/carbonapi/intervalset"
+	"github.com/go-graphite/carbonapi/zipper/protocols/graphite/msgpack"
 	"github.com/go-graphite/protocol/carbonapi_v2_pb"
 	"github.com/go-graphite/protocol/carbonapi_v3_pb"
 	ogórek "github.com/lomik/og-rek"
@@ -71,7 +72,15 @@ func (cfg *listener) findHandler(wr http.ResponseWriter, req *http.Request) {
 		Metrics: []carbonapi_v3_pb.GlobResponse{},
 	}
 
-	if query[0] != "*" {
+	if len(cfg.Listener.Tree) != 0 {
+		for _, q := range query {
+			multiGlobs.Metrics = append(multiGlobs.Metrics,
+				carbonapi_v3_pb.GlobResponse{
+					Name:    q,
+					Matches: findInTree(cfg.Listener.Tree, q),
+				})
+		}
+	} else if query[0] != "*" {
 		for m := range cfg.Listener.Expressions {
 			globMatches := []carbonapi_v3_pb.GlobMatch{}
 
@@ -142,6 +151,17 @@ func (cfg *listener) findHandler(wr http.ResponseWriter, req *http.Request) {
 	case protoV3Format:
 		b, err = multiGlobs.Marshal()
 		format = protoV3Format
+	case msgpackFormat:
+		var response msgpack.MultiGraphiteGlobResponse
+		for _, globs := range multiGlobs.Metrics {
+			for _, m := range globs.Matches {
+				response = append(response, msgpack.GraphiteGlobResponse{
+					Path:   m.Path,
+					IsLeaf: m.IsLeaf,
+				})
+			}
+		}
+		b, err = response.MarshalMsg(nil)
 	case pickleFormat:
 		var result []map[string]interface{}
 		now := int32(time.Now().Unix() + 60)
@@ -182,6 +202,8 @@ func (cfg *listener) findHandler(wr http.ResponseWriter, req *http.Request) {
 		wr.Header().Set("Content-Type", contentTypeProtobuf)
 	case pickleFormat:
 		wr.Header().Set("Content-Type", contentTypePickle)
+	case msgpackFormat:
+		wr.Header().Set("Content-Type", contentTypeMsgPack)
 	}
 	_, _ = wr.Write(b)
 }
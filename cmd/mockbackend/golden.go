@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+)
+
+// goldenSnippet is the amount of bytes shown around the first difference from golden body
+const goldenSnippet = 32
+
+// gunzip decompresses the data, it fails if data isn't gzipped
+func gunzip(b []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// isGzip reports if data starts with gzip magic bytes
+func isGzip(b []byte) bool {
+	return len(b) >= 2 && b[0] == 0x1f && b[1] == 0x8b
+}
+
+// firstDifference returns offset of the first byte that differs, -1 if data is the same.
+// If one of them is the prefix of another, length of the shorter one is returned
+func firstDifference(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+	return -1
+}
+
+func snippet(b []byte, offset int) []byte {
+	end := offset + goldenSnippet
+	if end > len(b) {
+		end = len(b)
+	}
+	return b[offset:end]
+}
+
+// compareGolden checks that body is the same as golden one byte-for-byte
+func compareGolden(b, golden []byte) []string {
+	offset := firstDifference(b, golden)
+	if offset < 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("body differs from golden at offset %v, got %v bytes, expected %v bytes, got %q, expected %q",
+		offset, len(b), len(golden), snippet(b, offset), snippet(golden, offset),
+	)}
+}
+
+// checkGoldenBody compares body with the gzipped golden one in file. Body is decompressed too if it's still gzipped,
+// e.x. if it was sent without Content-Encoding
+func checkGoldenBody(b []byte, path string) []string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read golden body: %v", err)}
+	}
+	golden, err := gunzip(data)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to decompress golden body %v: %v", path, err)}
+	}
+	if isGzip(b) {
+		b, err = gunzip(b)
+		if err != nil {
+			return []string{fmt.Sprintf("failed to decompress body: %v", err)}
+		}
+	}
+	return compareGolden(b, golden)
+}
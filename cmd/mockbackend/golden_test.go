@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCheckGoldenBody(t *testing.T) {
+	data, err := ioutil.ReadFile("testcases/goldenBody/render.csv.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := gunzip(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := bytes.Replace(golden, []byte(",6\n"), []byte(",7\n"), 1)
+
+	tests := []struct {
+		name     string
+		body     []byte
+		failures []string
+	}{
+		{
+			name: "same",
+			body: golden,
+		},
+		{
+			name: "gzipped response",
+			body: gzipped(t, golden),
+		},
+		{
+			name: "different byte",
+			body: changed,
+			failures: []string{
+				`body differs from golden at offset 178, got 180 bytes, expected 180 bytes, got "7\n", expected "6\n"`,
+			},
+		},
+		{
+			name: "truncated",
+			body: golden[:170],
+			failures: []string{
+				`body differs from golden at offset 170, got 170 bytes, expected 180 bytes, got "", expected "0:00:03,6\n"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := checkGoldenBody(tt.body, "testcases/goldenBody/render.csv.gz")
+			if !reflect.DeepEqual(failures, tt.failures) {
+				t.Errorf("unexpected failures, got %q, expected %q", failures, tt.failures)
+			}
+		})
+	}
+}
+
+func TestCheckGoldenBodyNotGzipped(t *testing.T) {
+	failures := checkGoldenBody([]byte("a"), "testcases/goldenBody/goldenBody.yaml")
+	if len(failures) != 1 {
+		t.Fatalf("golden body that isn't gzipped must fail, got %v", failures)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HAR records requests and responses of the queries if set, see -har flag
+var HAR *harRecorder
+
+// harTimeFormat is ISO 8601 with milliseconds, as HAR requires
+const harTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Types below are the subset of HTTP Archive 1.2 format (http://www.softwareishard.com/blog/har-12-spec/),
+// that is enough to import requests into browser devtools or replay them
+type harLog struct {
+	Log harContent `json:"log"`
+}
+
+type harContent struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+
+	started time.Time
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harBody        `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harBody struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harRecorder collects entries of the archive, it's safe for concurrent use
+type harRecorder struct {
+	lock    sync.Mutex
+	entries []harEntry
+}
+
+func newHARRecorder() *harRecorder {
+	return &harRecorder{
+		entries: make([]harEntry, 0),
+	}
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	res := make([]harNameValue, 0, len(h))
+	for name, values := range h {
+		for _, v := range values {
+			res = append(res, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// add records the request with its body and the response
+func (h *harRecorder) add(body string, resp *testResponse) {
+	req := resp.request
+	query := make([]harNameValue, 0)
+	for name, values := range req.URL.Query() {
+		for _, v := range values {
+			query = append(query, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.Slice(query, func(i, j int) bool {
+		return query[i].Name < query[j].Name
+	})
+
+	// client sends requests over the protocol the response is received over
+	version := resp.proto
+	if version == "" {
+		version = "HTTP/1.1"
+	}
+	entry := harEntry{
+		StartedDateTime: resp.started.Format(harTimeFormat),
+		Time:            milliseconds(resp.wait + resp.receive),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: version,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(resp.requestHeaders),
+			QueryString: query,
+			HeadersSize: -1,
+			BodySize:    0,
+		},
+		Response: harResponse{
+			Status:      resp.code,
+			StatusText:  http.StatusText(resp.code),
+			HTTPVersion: version,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(resp.headers),
+			Content: harBody{
+				Size:     resp.bodySize,
+				MimeType: resp.contentType,
+				Text:     string(resp.body),
+			},
+			HeadersSize: -1,
+			BodySize:    resp.wireSize,
+		},
+		Timings: harTimings{
+			Send:    0,
+			Wait:    milliseconds(resp.wait),
+			Receive: milliseconds(resp.receive),
+		},
+		started: resp.started,
+	}
+	if req.Method != http.MethodGet {
+		entry.Request.PostData = &harPostData{
+			MimeType: req.Header.Get("Content-Type"),
+			Text:     body,
+		}
+		entry.Request.BodySize = len(body)
+	}
+
+	h.lock.Lock()
+	h.entries = append(h.entries, entry)
+	h.lock.Unlock()
+}
+
+// save writes the archive to the file, entries are sorted by the time they were started
+func (h *harRecorder) save(path string) error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	sort.SliceStable(h.entries, func(i, j int) bool {
+		return h.entries[i].started.Before(h.entries[j].started)
+	})
+	b, err := json.MarshalIndent(harLog{
+		Log: harContent{
+			Version: "1.2",
+			Creator: harCreator{Name: "mockbackend", Version: "1.0"},
+			Entries: h.entries,
+		},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestHARRecording(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[{"target":"a.b.c","datapoints":[[1,1],[3,2],[2,3]]}]`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "mockbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	HAR = newHARRecorder()
+	defer func() { HAR = nil }()
+
+	expected := ExpectedResponse{
+		HttpCode:    http.StatusOK,
+		ContentType: contentTypeJSON,
+		ExpectedResults: []ExpectedResult{{
+			Metrics: []CarbonAPIResponse{{
+				Target:     "a.b.c",
+				Datapoints: []Datapoint{{1, 1}, {2, 3}, {3, 2}},
+			}},
+		}},
+	}
+	queries := []*Query{
+		{Endpoint: srv.URL, Type: "GET", URL: "/render?format=json&target=a.b.c", ExpectedResponse: expected},
+		{Endpoint: srv.URL, Type: "POST", URL: "/render", Body: "format=json&target=a.b.c", ExpectedResponse: expected},
+	}
+	for _, q := range queries {
+		if failures := doTest(zap.NewNop(), q); len(failures) != 0 {
+			t.Fatalf("unexpected failures: %v", failures)
+		}
+	}
+
+	path := filepath.Join(dir, "test.har")
+	if err := HAR.save(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var har harLog
+	if err := json.Unmarshal(b, &har); err != nil {
+		t.Fatalf("HAR is not valid JSON: %v", err)
+	}
+	if har.Log.Version != "1.2" || har.Log.Creator.Name == "" {
+		t.Errorf("unexpected version or creator: %+v", har.Log)
+	}
+	if len(har.Log.Entries) != len(queries) {
+		t.Fatalf("got %v entries, expected %v", len(har.Log.Entries), len(queries))
+	}
+
+	for i, e := range har.Log.Entries {
+		if _, err := time.Parse(harTimeFormat, e.StartedDateTime); err != nil {
+			t.Errorf("entry %v: invalid startedDateTime: %v", i, err)
+		}
+		if e.Time < 0 || e.Timings.Wait < 0 || e.Timings.Receive < 0 {
+			t.Errorf("entry %v: invalid timings %+v", i, e.Timings)
+		}
+		if e.Request.Method != queries[i].Type {
+			t.Errorf("entry %v: got method %v, expected %v", i, e.Request.Method, queries[i].Type)
+		}
+		if e.Request.Cookies == nil || e.Request.Headers == nil || e.Request.QueryString == nil {
+			t.Errorf("entry %v: request lists must not be null: %+v", i, e.Request)
+		}
+		if e.Response.Status != http.StatusOK || e.Response.Content.MimeType != contentTypeJSON {
+			t.Errorf("entry %v: unexpected response %+v", i, e.Response)
+		}
+		if e.Response.Content.Text == "" || e.Response.Content.Size != len(e.Response.Content.Text) {
+			t.Errorf("entry %v: response body isn't recorded completely: %+v", i, e.Response.Content)
+		}
+	}
+
+	if har.Log.Entries[0].Request.PostData != nil {
+		t.Errorf("GET request has postData")
+	}
+	post := har.Log.Entries[1].Request.PostData
+	if post == nil || post.Text != queries[1].Body || post.MimeType != "application/x-www-form-urlencoded" {
+		t.Errorf("unexpected postData of POST request: %+v", post)
+	}
+}
@@ -3,19 +3,84 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"sort"
+	"strings"
+	"time"
 )
 
+// startedAt is the time mockbackend was started, it's a reference for Metric.AppearAfter
+var startedAt = time.Now()
+
 type Response struct {
-	PathExpression string   `yaml:"pathExpression"`
-	Data           []Metric `yaml:"data"`
+	PathExpression string `yaml:"pathExpression"`
+	// Code makes render requests for this target fail with given http code
+	Code int      `yaml:"httpCode"`
+	Data []Metric `yaml:"data"`
 }
 
 type Metric struct {
-	MetricName string    `yaml:"metricName"`
-	Step       int       `yaml:"step"`
-	StartTime  int       `yaml:"startTime"`
-	Values     []float64 `yaml:"values"`
+	MetricName string `yaml:"metricName"`
+	// Tags are appended to the MetricName in render responses, sorted by tag name
+	Tags      map[string]string `yaml:"tags"`
+	Step      int               `yaml:"step"`
+	StartTime int               `yaml:"startTime"`
+	Values    []float64         `yaml:"values"`
+	// Generator makes values span requested time range instead of using Values, see generate
+	Generator string `yaml:"generator"`
+	// AppearAfter hides the metric from render responses for the duration after mockbackend is started,
+	// e.x. to simulate a backend that is eventually consistent
+	AppearAfter time.Duration `yaml:"appearAfter"`
+}
+
+// visible returns false if the metric isn't shown yet, see AppearAfter
+func (m *Metric) visible() bool {
+	return m.AppearAfter == 0 || time.Since(startedAt) >= m.AppearAfter
+}
+
+// generate returns start time and values for the requested time range. First point is aligned to the step,
+// all points are in [from, until). Generator can be "time" (value is a timestamp of the point), "sin" (value is
+// a sin of the timestamp) or "repeat" (Values are repeated to fill the time range)
+func (m *Metric) generate(step int, from, until int64) (int, []float64, error) {
+	if from <= 0 || until <= from {
+		return 0, nil, fmt.Errorf("invalid time range [%v, %v) for generated metric %v", from, until, m.MetricName)
+	}
+
+	start := (from + int64(step) - 1) / int64(step) * int64(step)
+	values := make([]float64, 0, (until-start)/int64(step)+1)
+	for ts := start; ts < until; ts += int64(step) {
+		switch m.Generator {
+		case "time":
+			values = append(values, float64(ts))
+		case "sin":
+			values = append(values, math.Sin(float64(ts)))
+		case "repeat":
+			if len(m.Values) == 0 {
+				return 0, nil, fmt.Errorf("no values to repeat for metric %v", m.MetricName)
+			}
+			values = append(values, m.Values[len(values)%len(m.Values)])
+		default:
+			return 0, nil, fmt.Errorf("unknown generator '%v' for metric %v", m.Generator, m.MetricName)
+		}
+	}
+
+	return int(start), values, nil
+}
+
+// name returns name of the metric with tags, e.x. "name;tag1=value1;tag2=value2"
+func (m *Metric) name() string {
+	if len(m.Tags) == 0 {
+		return m.MetricName
+	}
+
+	tags := make([]string, 0, len(m.Tags))
+	for k, v := range m.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+
+	return m.MetricName + ";" + strings.Join(tags, ";")
 }
 
 type metricForJson struct {
@@ -43,6 +108,7 @@ const (
 	pickleFormat
 	protoV2Format
 	protoV3Format
+	msgpackFormat
 )
 
 func getFormat(req *http.Request) (responseFormat, error) {
@@ -66,6 +132,7 @@ var knownFormats = map[string]responseFormat{
 	"protobuf3":       protoV2Format,
 	"carbonapi_v2_pb": protoV2Format,
 	"carbonapi_v3_pb": protoV3Format,
+	"msgpack":         msgpackFormat,
 }
 
 func (r responseFormat) String() string {
@@ -76,6 +143,10 @@ func (r responseFormat) String() string {
 		return "pickle"
 	case protoV2Format:
 		return "carbonapi_v2_pb"
+	case protoV3Format:
+		return "carbonapi_v3_pb"
+	case msgpackFormat:
+		return "msgpack"
 	default:
 		return "unknown"
 	}
@@ -84,15 +155,19 @@ func (r responseFormat) String() string {
 func copyResponse(src Response) Response {
 	dst := Response{
 		PathExpression: src.PathExpression,
+		Code:           src.Code,
 		Data:           make([]Metric, len(src.Data)),
 	}
 
 	for i := range src.Data {
 		dst.Data[i] = Metric{
-			MetricName: src.Data[i].MetricName,
-			Values:     make([]float64, len(src.Data[i].Values)),
-			StartTime:  src.Data[i].StartTime,
-			Step:       src.Data[i].Step,
+			MetricName:  src.Data[i].MetricName,
+			Tags:        src.Data[i].Tags,
+			Generator:   src.Data[i].Generator,
+			Values:      make([]float64, len(src.Data[i].Values)),
+			StartTime:   src.Data[i].StartTime,
+			Step:        src.Data[i].Step,
+			AppearAfter: src.Data[i].AppearAfter,
 		}
 
 		for j := range src.Data[i].Values {
@@ -119,6 +194,7 @@ const (
 	contentTypeJavaScript = "text/javascript"
 	contentTypeRaw        = "text/plain"
 	contentTypePickle     = "application/pickle"
+	contentTypeMsgPack    = "application/x-msgpack"
 	contentTypePNG        = "image/png"
 	contentTypeCSV        = "text/csv"
 	contentTypeSVG        = "image/svg+xml"
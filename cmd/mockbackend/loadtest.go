@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LoadTest describes load-generation mode. Queries are replayed in round-robin fashion for the whole Duration
+// and latency percentiles are checked against thresholds instead of exact-match assertions
+type LoadTest struct {
+	// Rate is amount of requests per second for all workers, 0 means no limit
+	Rate int `yaml:"rate"`
+	// Concurrency is amount of workers sending requests, 1 by default
+	Concurrency int           `yaml:"concurrency"`
+	Duration    time.Duration `yaml:"duration"`
+
+	Thresholds LoadThresholds `yaml:"thresholds"`
+}
+
+// LoadThresholds are upper limits for the load test, zero value disables the check
+type LoadThresholds struct {
+	P50          time.Duration `yaml:"p50"`
+	P90          time.Duration `yaml:"p90"`
+	P99          time.Duration `yaml:"p99"`
+	MaxErrorRate float64       `yaml:"maxErrorRate"`
+}
+
+type loadResult struct {
+	latency time.Duration
+	failed  bool
+}
+
+func percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	idx := int(float64(len(latencies))*p/100+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(latencies) {
+		idx = len(latencies) - 1
+	}
+	return latencies[idx]
+}
+
+// doLoadTest replays queries according to the load test configuration and returns list of failed thresholds
+func doLoadTest(logger *zap.Logger, cfg *LoadTest, queries []Query) []string {
+	failures := make([]string, 0)
+	if len(queries) == 0 {
+		failures = append(failures, "no queries to replay")
+		return failures
+	}
+	if cfg.Duration <= 0 {
+		failures = append(failures, "duration of the load test must be positive")
+		return failures
+	}
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	// requests are not logged one by one, it would be too noisy
+	reqLogger := zap.NewNop()
+
+	jobs := make(chan *Query)
+	results := make(chan loadResult, concurrency)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				start := time.Now()
+				resp, err := sendRequest(reqLogger, t.Endpoint, t, nil)
+				failed := err != nil
+				if resp != nil && t.ExpectedResponse.HttpCode != 0 && resp.code != t.ExpectedResponse.HttpCode {
+					failed = true
+				}
+				results <- loadResult{latency: time.Since(start), failed: failed}
+			}
+		}()
+	}
+
+	go func() {
+		var ticker *time.Ticker
+		if cfg.Rate > 0 {
+			ticker = time.NewTicker(time.Second / time.Duration(cfg.Rate))
+			defer ticker.Stop()
+		}
+		deadline := time.Now().Add(cfg.Duration)
+		for i := 0; time.Now().Before(deadline); i++ {
+			if ticker != nil {
+				<-ticker.C
+			}
+			jobs <- &queries[i%len(queries)]
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	start := time.Now()
+	latencies := make([]time.Duration, 0)
+	errors := 0
+	for r := range results {
+		latencies = append(latencies, r.latency)
+		if r.failed {
+			errors++
+		}
+	}
+	elapsed := time.Since(start)
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	p50 := percentile(latencies, 50)
+	p90 := percentile(latencies, 90)
+	p99 := percentile(latencies, 99)
+	errorRate := 0.0
+	if len(latencies) > 0 {
+		errorRate = float64(errors) / float64(len(latencies))
+	}
+
+	logger.Info("load test finished",
+		zap.Int("requests", len(latencies)),
+		zap.Int("errors", errors),
+		zap.Float64("error_rate", errorRate),
+		zap.Float64("rps", float64(len(latencies))/elapsed.Seconds()),
+		zap.Duration("p50", p50),
+		zap.Duration("p90", p90),
+		zap.Duration("p99", p99),
+	)
+
+	checks := []struct {
+		name      string
+		got       time.Duration
+		threshold time.Duration
+	}{
+		{"p50", p50, cfg.Thresholds.P50},
+		{"p90", p90, cfg.Thresholds.P90},
+		{"p99", p99, cfg.Thresholds.P99},
+	}
+	for _, c := range checks {
+		if c.threshold > 0 && c.got > c.threshold {
+			failures = append(failures, fmt.Sprintf("%v latency is too high, got %v, threshold %v", c.name, c.got, c.threshold))
+		}
+	}
+	if errorRate > cfg.Thresholds.MaxErrorRate {
+		failures = append(failures, fmt.Sprintf("error rate is too high, got %v, threshold %v", errorRate, cfg.Thresholds.MaxErrorRate))
+	}
+
+	return failures
+}
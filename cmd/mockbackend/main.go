@@ -2,8 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
@@ -11,11 +11,12 @@ import (
 	"time"
 
 	"go.uber.org/zap"
-	"gopkg.in/yaml.v2"
 )
 
 type MainConfig struct {
-	Version   string      `yaml:"version"`
+	Version string `yaml:"version"`
+	// Include is a list of files (relative to the current one) which test apps and queries are merged into this config
+	Include   []string    `yaml:"include"`
 	Test      *TestSchema `yaml:"test"`
 	Listeners []Listener  `yaml:"listeners"`
 }
@@ -26,6 +27,12 @@ type Listener struct {
 	ShuffleResults bool                `yaml:"shuffleResults"`
 	EmptyBody      bool                `yaml:"emptyBody"`
 	Expressions    map[string]Response `yaml:"expressions"`
+	// Tree is used to answer /metrics/find requests, if it's not set expressions are used instead
+	Tree []FindNode `yaml:"tree"`
+	// TagIndex is a list of tagged series, used for seriesByTag render requests and tag endpoints
+	TagIndex []Metric `yaml:"tagIndex"`
+	// TLS makes listener serve HTTPS with self-signed certificate, HTTP/2 is negotiated with clients supporting it
+	TLS bool `yaml:"tls"`
 }
 
 var cfg = MainConfig{}
@@ -40,6 +47,12 @@ func main() {
 	testonly := flag.Bool("testonly", false, "run only unit test")
 	noapp := flag.Bool("noapp", false, "do not run application")
 	test := flag.Bool("test", false, "run unit test if present")
+	only := flag.String("only", "", "run only queries with name matching the pattern")
+	repeat := flag.Int("repeat", 1, "run queries N times and report ones that failed in any of the runs")
+	har := flag.String("har", "", "record requests and responses of queries to HTTP Archive (HAR) file")
+	flag.BoolVar(&StrictConfig, "strict", StrictConfig, "fail on unknown fields in config, -strict=false allows them in old configs")
+	flag.BoolVar(&Verbose, "verbose", false, "log request and raw response of failed queries")
+	flag.IntVar(&VerboseBodySize, "verbose-body-size", VerboseBodySize, "max size of response body logged in verbose mode, negative value disables truncation")
 	flag.Parse()
 	logger, err := zap.NewProduction()
 	if err != nil {
@@ -50,16 +63,17 @@ func main() {
 		logger.Fatal("failed to get config, it should be non-null")
 	}
 
-	d, err := ioutil.ReadFile(*config)
-	if err != nil {
-		logger.Fatal("failed to read config", zap.Error(err))
-	}
-
-	err = yaml.Unmarshal(d, &cfg)
+	err = loadConfig(*config, &cfg, nil)
 	if err != nil {
 		logger.Fatal("failed to read config", zap.Error(err))
 		return
 	}
+	if cfg.Test != nil {
+		cfg.Test.Queries = expandQueries(cfg.Test.Queries)
+	}
+	if err := validateTest(cfg.Test); err != nil {
+		logger.Fatal("invalid test config", zap.Error(err))
+	}
 
 	logger.Info("starting mockbackend",
 		zap.Any("config", cfg),
@@ -93,14 +107,28 @@ func main() {
 			mux.HandleFunc("/render/", listener.renderHandler)
 			mux.HandleFunc("/metrics/find", listener.findHandler)
 			mux.HandleFunc("/metrics/find/", listener.findHandler)
+			mux.HandleFunc("/tags/", listener.tagsHandler)
 
 			wg.Add(1)
 			server := &http.Server{
 				Addr:    listener.Address,
-				Handler: mux,
+				Handler: BackendRequests.count(listener.Address, mux),
+			}
+			if listener.TLS {
+				cert, err := selfSignedCertificate()
+				if err != nil {
+					logger.Fatal("failed to generate certificate",
+						zap.Error(err),
+					)
+				}
+				server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
 			}
 			go func(h *http.Server) {
-				err = h.ListenAndServe()
+				if h.TLSConfig != nil {
+					err = h.ListenAndServeTLS("", "")
+				} else {
+					err = h.ListenAndServe()
+				}
 				if err != nil {
 					logger.Error("failed to start server",
 						zap.Error(err),
@@ -116,7 +144,19 @@ func main() {
 
 	failed := false
 	if cfg.Test != nil && (*test || *testonly) {
-		failed = e2eTest(logger, *noapp)
+		if *har != "" {
+			HAR = newHARRecorder()
+		}
+		failed = e2eTest(logger, *noapp, *only, *repeat)
+		if HAR != nil {
+			err = HAR.save(*har)
+			if err != nil {
+				logger.Error("failed to save HAR",
+					zap.String("file", *har),
+					zap.Error(err),
+				)
+			}
+		}
 	}
 
 	if !*testonly {
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// mediaType returns content-type without parameters, graphite-web and carbonapi can differ in them
+func mediaType(contentType string) string {
+	return strings.TrimSpace(strings.Split(contentType, ";")[0])
+}
+
+// doOracleTest sends the query both to carbonapi and to the oracle (a graphite-web reading the same data) and
+// reports every series that is absent in one of the responses or differs from the oracle's one
+func doOracleTest(logger *zap.Logger, t *Query) []string {
+	oracle, err := expandEnv(t.OracleEndpoint)
+	if err != nil {
+		return []string{fmt.Sprintf("oracle endpoint: %v", err)}
+	}
+
+	got, err := sendRequest(logger, t.Endpoint, t, nil)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	expected, err := sendRequest(logger.With(zap.String("app", "oracle")), oracle, t, nil)
+	if err != nil {
+		return []string{fmt.Sprintf("oracle: %v", err)}
+	}
+
+	failures := make([]string, 0)
+	diverged := func(format string, a ...interface{}) {
+		failures = append(failures, "diverged from oracle: "+fmt.Sprintf(format, a...))
+	}
+
+	if got.code != expected.code {
+		diverged("status code mismatch, got %v, expected %v", got.code, expected.code)
+	}
+	if mediaType(got.contentType) != mediaType(expected.contentType) {
+		diverged("content-type mismatch, got %v, expected %v", got.contentType, expected.contentType)
+	}
+	if len(failures) != 0 || expected.code >= 300 {
+		return failures
+	}
+
+	gotRes, err := decodeSeries(t, got.body, mediaType(got.contentType))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	expectedRes, err := decodeSeries(t, expected.body, mediaType(expected.contentType))
+	if err != nil {
+		return []string{fmt.Sprintf("oracle: %v", err)}
+	}
+
+	// graphite-web computes in python, values can differ in the last digits, it's allowed with epsilon from expected result
+	epsilon := 0.0
+	timestampsOnly := false
+	if len(t.ExpectedResponse.ExpectedResults) != 0 {
+		epsilon = t.ExpectedResponse.ExpectedResults[0].Epsilon
+		timestampsOnly = t.ExpectedResponse.ExpectedResults[0].CompareTimestampsOnly
+	}
+	matched := make([]bool, len(expectedRes))
+	for i := range gotRes {
+		j := matchSeries(&gotRes[i], expectedRes, matched, epsilon, timestampsOnly)
+		if j < 0 {
+			diverged("series '%v' is absent in oracle response", gotRes[i].Target)
+			continue
+		}
+		matched[j] = true
+		if err := isMetricsEqual(gotRes[i], expectedRes[j], epsilon, timestampsOnly); err != nil {
+			diverged("series '%v': %v", gotRes[i].Target, err)
+		}
+	}
+	for j := range expectedRes {
+		if !matched[j] {
+			diverged("series '%v' is missing", expectedRes[j].Target)
+		}
+	}
+
+	return failures
+}
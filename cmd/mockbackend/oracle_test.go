@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestDoOracleTest(t *testing.T) {
+	jsonServer := func(code int, body string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			_, _ = w.Write([]byte(body))
+		}))
+	}
+
+	tests := []struct {
+		name     string
+		got      string
+		oracle   string
+		code     int
+		epsilon  float64
+		failures []string
+	}{
+		{
+			name:   "same",
+			got:    `[{"target":"a.b.c","datapoints":[[1,1],[null,2]]},{"target":"d.e.f","datapoints":[[4,1],[5,2]]}]`,
+			oracle: `[{"target":"d.e.f","datapoints":[[4,1],[5,2]]},{"target":"a.b.c","datapoints":[[1,1],[null,2]]}]`,
+		},
+		{
+			name:    "within epsilon",
+			got:     `[{"target":"a.b.c","datapoints":[[1.0000001,1],[2,2]]}]`,
+			oracle:  `[{"target":"a.b.c","datapoints":[[1,1],[2,2]]}]`,
+			epsilon: 0.000001,
+		},
+		{
+			name:   "diverged",
+			got:    `[{"target":"a.b.c","datapoints":[[1,1],[3,2]]},{"target":"x.y.z","datapoints":[[1,1]]}]`,
+			oracle: `[{"target":"a.b.c","datapoints":[[1,1],[2,2]]},{"target":"d.e.f","datapoints":[[4,1]]}]`,
+			failures: []string{
+				"diverged from oracle: series 'a.b.c': " + isMetricsEqual(
+					CarbonAPIResponse{Target: "a.b.c", Datapoints: []Datapoint{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 3}}},
+					CarbonAPIResponse{Target: "a.b.c", Datapoints: []Datapoint{{Timestamp: 1, Value: 1}, {Timestamp: 2, Value: 2}}},
+					0, false,
+				).Error(),
+				"diverged from oracle: series 'x.y.z' is absent in oracle response",
+				"diverged from oracle: series 'd.e.f' is missing",
+			},
+		},
+		{
+			name:     "status code",
+			got:      `[]`,
+			oracle:   `{"error":"bad target"}`,
+			code:     http.StatusBadRequest,
+			failures: []string{"diverged from oracle: status code mismatch, got 200, expected 400"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carbonapi := jsonServer(http.StatusOK, tt.got)
+			defer carbonapi.Close()
+			code := tt.code
+			if code == 0 {
+				code = http.StatusOK
+			}
+			oracle := jsonServer(code, tt.oracle)
+			defer oracle.Close()
+
+			q := &Query{
+				Endpoint:       carbonapi.URL,
+				OracleEndpoint: oracle.URL,
+				Type:           "GET",
+				URL:            "/render?format=json&target=*.*.*",
+				ExpectedResponse: ExpectedResponse{
+					ExpectedResults: []ExpectedResult{{Epsilon: tt.epsilon}},
+				},
+			}
+			failures := doOracleTest(zap.NewNop(), q)
+			if len(failures) == 0 {
+				failures = nil
+			}
+			if !reflect.DeepEqual(failures, tt.failures) {
+				t.Errorf("unexpected failures %q, expected %q", failures, tt.failures)
+			}
+		})
+	}
+}
+
+func TestSelectQueriesWithoutOracle(t *testing.T) {
+	const name = "MOCKBACKEND_TEST_ORACLE"
+	queries := []Query{
+		{Name: "plain"},
+		{Name: "oracle", OracleEndpoint: "${" + name + "}"},
+	}
+
+	os.Unsetenv(name)
+	selected := selectQueries(zap.NewNop(), queries, "")
+	if len(selected) != 1 || selected[0].Name != "plain" {
+		t.Fatalf("query must be skipped if oracle isn't configured, selected %v", selected)
+	}
+
+	os.Setenv(name, "http://127.0.0.1:8080")
+	defer os.Unsetenv(name)
+	selected = selectQueries(zap.NewNop(), queries, "")
+	if len(selected) != 2 {
+		t.Fatalf("query must be run if oracle is configured, selected %v", selected)
+	}
+}
+
+func TestLoadConfigOracleEndpoint(t *testing.T) {
+	var cfg MainConfig
+	if err := loadConfig("testcases/oracle/oracle.yaml", &cfg, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range cfg.Test.Queries {
+		if q.OracleEndpoint != "${GRAPHITE_WEB_URL}" {
+			t.Errorf("query '%v' must inherit oracle endpoint of the test, got '%v'", q.URL, q.OracleEndpoint)
+		}
+	}
+}
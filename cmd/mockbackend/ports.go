@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// portPlaceholder is replaced with a free port allocated for the app, e.x. ${PORT:carbonapi}
+var portPlaceholder = regexp.MustCompile(`\$\{PORT:([^}]+)\}`)
+
+// allocatePorts finds free ports for all port placeholders used in the test, substitutes them
+// into app args, env and endpoints and into query endpoints, URLs and bodies.
+// Returns allocated ports by app name
+func allocatePorts(test *TestSchema) (map[string]int, error) {
+	ports := make(map[string]int)
+	listeners := make([]net.Listener, 0)
+	// all listeners are kept open till the end, so the same port can't be allocated twice
+	defer func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}()
+
+	var allocErr error
+	replace := func(s string) string {
+		return portPlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+			name := portPlaceholder.FindStringSubmatch(placeholder)[1]
+			if port, ok := ports[name]; ok {
+				return fmt.Sprintf("%d", port)
+			}
+
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				allocErr = fmt.Errorf("failed to allocate port for '%v': %v", name, err)
+				return placeholder
+			}
+			listeners = append(listeners, l)
+			ports[name] = l.Addr().(*net.TCPAddr).Port
+			return fmt.Sprintf("%d", ports[name])
+		})
+	}
+
+	for i := range test.Apps {
+		app := &test.Apps[i]
+		app.Endpoint = replace(app.Endpoint)
+		app.Ready = replace(app.Ready)
+		for j := range app.Args {
+			app.Args[j] = replace(app.Args[j])
+		}
+		for name, value := range app.Env {
+			app.Env[name] = replace(value)
+		}
+	}
+
+	for i := range test.Queries {
+		q := &test.Queries[i]
+		q.Endpoint = replace(q.Endpoint)
+		q.OracleEndpoint = replace(q.OracleEndpoint)
+		q.URL = replace(q.URL)
+		q.Body = replace(q.Body)
+		for name, value := range q.Headers {
+			q.Headers[name] = replace(value)
+		}
+		for _, actions := range [][]Action{q.Setup, q.Teardown} {
+			for j := range actions {
+				a := &actions[j]
+				a.Endpoint = replace(a.Endpoint)
+				a.URL = replace(a.URL)
+				a.Body = replace(a.Body)
+				for k := range a.Command {
+					a.Command[k] = replace(a.Command[k])
+				}
+			}
+		}
+	}
+
+	return ports, allocErr
+}
+
+// waitForPorts waits till something listens on all the ports or timeout is reached
+func waitForPorts(logger *zap.Logger, ports map[string]int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for name, port := range ports {
+		addr := fmt.Sprintf("127.0.0.1:%d", port)
+		err := waitListening(addr, deadline, nil)
+		if err != nil {
+			return fmt.Errorf("'%v' %v", name, err)
+		}
+		logger.Info("app is listening",
+			zap.String("name", name),
+			zap.Int("port", port),
+		)
+	}
+	return nil
+}
+
+// waitListening waits till something listens on the address. It gives up at deadline or when exited is closed
+func waitListening(addr string, deadline time.Time, exited <-chan struct{}) error {
+	for {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		if err == nil {
+			_ = conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("is not listening on %v in time", addr)
+		}
+		select {
+		case <-exited:
+			return fmt.Errorf("exited before started listening on %v", addr)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestAllocatePorts(t *testing.T) {
+	test := &TestSchema{
+		Apps: []App{
+			{
+				Name: "carbonapi",
+				Args: []string{"-listen", "127.0.0.1:${PORT:carbonapi}"},
+			},
+			{
+				Name:     "carbonapi2",
+				Args:     []string{"-listen", "127.0.0.1:${PORT:carbonapi2}"},
+				Env:      map[string]string{"BACKEND": "http://127.0.0.1:${PORT:carbonapi}"},
+				Endpoint: "http://127.0.0.1:${PORT:carbonapi2}",
+			},
+		},
+		Queries: []Query{
+			{
+				Endpoint: "http://127.0.0.1:${PORT:carbonapi}",
+				URL:      "/render?target=a.b.c",
+			},
+		},
+	}
+
+	ports, err := allocatePorts(test)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ports) != 2 {
+		t.Fatalf("ports must be allocated for 2 apps, got %v", ports)
+	}
+	first, second := ports["carbonapi"], ports["carbonapi2"]
+	if first == 0 || second == 0 || first == second {
+		t.Fatalf("apps must get distinct ports, got %v", ports)
+	}
+
+	// ports are released, so apps can listen on them
+	for name, port := range ports {
+		l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			t.Fatalf("port of '%v' is not free: %v", name, err)
+		}
+		_ = l.Close()
+	}
+
+	// the same placeholder gets the same port everywhere
+	checks := []struct {
+		name     string
+		got      string
+		expected string
+	}{
+		{"args", test.Apps[0].Args[1], fmt.Sprintf("127.0.0.1:%d", first)},
+		{"args of the second app", test.Apps[1].Args[1], fmt.Sprintf("127.0.0.1:%d", second)},
+		{"env", test.Apps[1].Env["BACKEND"], fmt.Sprintf("http://127.0.0.1:%d", first)},
+		{"app endpoint", test.Apps[1].Endpoint, fmt.Sprintf("http://127.0.0.1:%d", second)},
+		{"query endpoint", test.Queries[0].Endpoint, fmt.Sprintf("http://127.0.0.1:%d", first)},
+	}
+	for _, c := range checks {
+		if c.got != c.expected {
+			t.Errorf("%v: got '%v', expected '%v'", c.name, c.got, c.expected)
+		}
+	}
+}
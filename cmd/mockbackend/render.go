@@ -8,6 +8,7 @@ import (
 	"math"
 	"math/rand"
 	"net/http"
+	"strconv"
 
 	"github.com/go-graphite/protocol/carbonapi_v2_pb"
 	"github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -15,6 +16,7 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
+	"github.com/go-graphite/carbonapi/zipper/protocols/graphite/msgpack"
 )
 
 func (cfg *listener) renderHandler(wr http.ResponseWriter, req *http.Request) {
@@ -47,6 +49,14 @@ func (cfg *listener) renderHandler(wr http.ResponseWriter, req *http.Request) {
 
 	targets := req.Form["target"]
 	maxDataPoints := int64(0)
+	// requested time range for each target, used by generated metrics
+	from, _ := strconv.ParseInt(req.Form.Get("from"), 10, 64)
+	until, _ := strconv.ParseInt(req.Form.Get("until"), 10, 64)
+	froms := make([]int64, len(targets))
+	untils := make([]int64, len(targets))
+	for i := range targets {
+		froms[i], untils[i] = from, until
+	}
 
 	if format == protoV3Format {
 		body, err := ioutil.ReadAll(req.Body)
@@ -70,8 +80,11 @@ func (cfg *listener) renderHandler(wr http.ResponseWriter, req *http.Request) {
 		}
 
 		targets = make([]string, len(pv3Request.Metrics))
+		froms = make([]int64, len(pv3Request.Metrics))
+		untils = make([]int64, len(pv3Request.Metrics))
 		for i, r := range pv3Request.Metrics {
 			targets[i] = r.PathExpression
+			froms[i], untils[i] = r.StartTime, r.StopTime
 		}
 		maxDataPoints = pv3Request.Metrics[0].MaxDataPoints
 	}
@@ -96,14 +109,34 @@ func (cfg *listener) renderHandler(wr http.ResponseWriter, req *http.Request) {
 		Expressions: copyMap(cfg.Expressions),
 	}
 
-	for _, target := range targets {
+	for targetIdx, target := range targets {
 		response, ok := newCfg.Expressions[target]
+		if exprs, isTagged := seriesByTagExpressions(target); !ok && isTagged {
+			data, err := findTagged(cfg.TagIndex, exprs)
+			if err != nil {
+				http.Error(wr, err.Error(), http.StatusBadRequest)
+				return
+			}
+			response, ok = Response{PathExpression: target, Data: data}, true
+		}
 		if !ok {
 			wr.WriteHeader(http.StatusNotFound)
 			_, _ = wr.Write([]byte("Not found"))
 			return
 		}
+		if response.Code != 0 && response.Code != http.StatusOK {
+			logger.Info("target is configured to fail",
+				zap.String("target", target),
+				zap.Int("code", response.Code),
+			)
+			wr.WriteHeader(response.Code)
+			_, _ = wr.Write([]byte(http.StatusText(response.Code)))
+			return
+		}
 		for _, m := range response.Data {
+			if !m.visible() {
+				continue
+			}
 			startTime := m.StartTime
 			if startTime == 0 {
 				startTime = 1
@@ -112,38 +145,50 @@ func (cfg *listener) renderHandler(wr http.ResponseWriter, req *http.Request) {
 			if step == 0 {
 				step = 1
 			}
-			isAbsent := make([]bool, 0, len(m.Values))
-			protov2Values := make([]float64, 0, len(m.Values))
-			for i := range m.Values {
-				if math.IsNaN(m.Values[i]) {
+			values := m.Values
+			if m.Generator != "" {
+				startTime, values, err = m.generate(step, froms[targetIdx], untils[targetIdx])
+				if err != nil {
+					logger.Error("failed to generate values",
+						zap.String("target", target),
+						zap.Error(err),
+					)
+					http.Error(wr, err.Error(), http.StatusBadRequest)
+					return
+				}
+			}
+			isAbsent := make([]bool, 0, len(values))
+			protov2Values := make([]float64, 0, len(values))
+			for i := range values {
+				if math.IsNaN(values[i]) {
 					isAbsent = append(isAbsent, true)
 					protov2Values = append(protov2Values, 0.0)
 				} else {
 					isAbsent = append(isAbsent, false)
-					protov2Values = append(protov2Values, m.Values[i])
+					protov2Values = append(protov2Values, values[i])
 				}
 			}
 			fr2 := carbonapi_v2_pb.FetchResponse{
-				Name:      m.MetricName,
+				Name:      m.name(),
 				StartTime: int32(startTime),
-				StopTime:  int32(step * (startTime + len(protov2Values) - 1)),
+				StopTime:  int32(startTime + step*(len(protov2Values)-1)),
 				StepTime:  int32(step),
 				Values:    protov2Values,
 				IsAbsent:  isAbsent,
 			}
 
 			fr3 := carbonapi_v3_pb.FetchResponse{
-				Name:                    m.MetricName,
+				Name:                    m.name(),
 				PathExpression:          target,
 				ConsolidationFunc:       "avg",
 				StartTime:               int64(startTime),
-				StopTime:                int64(step * (startTime + len(m.Values) - 1)),
+				StopTime:                int64(startTime + step*(len(values)-1)),
 				StepTime:                int64(step),
 				XFilesFactor:            0,
 				HighPrecisionTimestamps: false,
-				Values:                  m.Values,
+				Values:                  values,
 				RequestStartTime:        1,
-				RequestStopTime:         int64(step * (startTime + len(m.Values) - 1)),
+				RequestStopTime:         int64(startTime + step*(len(values)-1)),
 			}
 
 			multiv2.Metrics = append(multiv2.Metrics, fr2)
@@ -247,6 +292,38 @@ func (cfg *listener) marshalResponse(wr http.ResponseWriter, logger *zap.Logger,
 			_, _ = wr.Write([]byte(err.Error()))
 			return "", nil
 		}
+	case msgpackFormat:
+		contentType = httpHeaders.ContentTypeMsgPack
+		if cfg.EmptyBody {
+			break
+		}
+		response := make(msgpack.MultiGraphiteFetchResponse, 0, len(multiv3.Metrics))
+		for _, metric := range multiv3.GetMetrics() {
+			values := make([]interface{}, len(metric.Values))
+			for i, v := range metric.Values {
+				if !math.IsNaN(v) {
+					values[i] = v
+				}
+			}
+			response = append(response, msgpack.GraphiteFetchResponse{
+				Start:          uint32(metric.StartTime),
+				End:            uint32(metric.StopTime),
+				Step:           uint32(metric.StepTime),
+				Name:           metric.Name,
+				PathExpression: metric.PathExpression,
+				Values:         values,
+			})
+		}
+		logger.Info("request will be served",
+			zap.String("format", "msgpack"),
+			zap.Any("content", response),
+		)
+		d, err = response.MarshalMsg(nil)
+		if err != nil {
+			wr.WriteHeader(http.StatusBadGateway)
+			_, _ = wr.Write([]byte(err.Error()))
+			return "", nil
+		}
 	case jsonFormat:
 		contentType = "application/json"
 		if cfg.EmptyBody {
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// requestsPath is the path listeners serve counts of received requests on
+const requestsPath = "/_requests"
+
+// BackendRequests counts requests received by listeners, queries check their expectedBackendRequests against it
+var BackendRequests = newRequestCounter()
+
+// requestCounter counts requests by listener address and path, it's safe for concurrent use
+type requestCounter struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+func newRequestCounter() *requestCounter {
+	return &requestCounter{
+		counts: make(map[string]int),
+	}
+}
+
+// count wraps the handler of the listener, so requests to it are counted. Trailing slash of the path is ignored
+func (c *requestCounter) count(address string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == requestsPath {
+			c.ServeHTTP(w, r)
+			return
+		}
+		key := address + strings.TrimSuffix(r.URL.Path, "/")
+		c.lock.Lock()
+		c.counts[key]++
+		c.lock.Unlock()
+		h.ServeHTTP(w, r)
+	})
+}
+
+// snapshot returns copy of the current counts
+func (c *requestCounter) snapshot() map[string]int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	res := make(map[string]int, len(c.counts))
+	for k, v := range c.counts {
+		res[k] = v
+	}
+	return res
+}
+
+// ServeHTTP responds with counts of requests received by all the listeners, e.x. {":9070/render": 2}
+func (c *requestCounter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, err := json.Marshal(c.snapshot())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentTypeJSON)
+	_, _ = w.Write(b)
+}
+
+// checkBackendRequests checks amount of requests received since before snapshot was taken. Key of expected is either
+// listener address with path (":9070/render") or only path ("/render"), then requests to all the listeners are summed
+func checkBackendRequests(before map[string]int, expected map[string]int) []string {
+	if len(expected) == 0 {
+		return nil
+	}
+	after := BackendRequests.snapshot()
+
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	failures := make([]string, 0)
+	for _, key := range keys {
+		want := strings.TrimSuffix(key, "/")
+		got := 0
+		for k, v := range after {
+			// addresses don't contain slashes, so path starts at the first one
+			if k == want || (strings.HasPrefix(want, "/") && k[strings.Index(k, "/"):] == want) {
+				got += v - before[k]
+			}
+		}
+		if got != expected[key] {
+			failures = append(failures, fmt.Sprintf("unexpected amount of backend requests to '%v', got %v, expected %v", key, got, expected[key]))
+		}
+	}
+	return failures
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRequestCounter(t *testing.T) {
+	saved := BackendRequests
+	BackendRequests = newRequestCounter()
+	defer func() { BackendRequests = saved }()
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	backend1 := httptest.NewServer(BackendRequests.count(":9070", ok))
+	defer backend1.Close()
+	backend2 := httptest.NewServer(BackendRequests.count(":9071", ok))
+	defer backend2.Close()
+
+	get := func(url string) {
+		resp, err := http.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	get(backend1.URL + "/render")
+	before := BackendRequests.snapshot()
+	get(backend1.URL + "/render/")
+	get(backend1.URL + "/metrics/find")
+	get(backend2.URL + "/render")
+
+	tests := []struct {
+		name     string
+		expected map[string]int
+		failed   bool
+	}{
+		{"all listeners", map[string]int{"/render": 2, "/metrics/find": 1}, false},
+		{"listener", map[string]int{":9070/render": 1, ":9071/render/": 1, ":9071/metrics/find": 0}, false},
+		{"not requested", map[string]int{"/tags/autoComplete/tags": 0}, false},
+		{"mismatch", map[string]int{"/render": 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := checkBackendRequests(before, tt.expected)
+			if (len(failures) != 0) != tt.failed {
+				t.Fatalf("unexpected failures: %v", failures)
+			}
+		})
+	}
+
+	resp, err := http.Get(backend2.URL + requestsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var counts map[string]int
+	if err := json.NewDecoder(resp.Body).Decode(&counts); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int{":9070/render": 2, ":9070/metrics/find": 1, ":9071/render": 1}
+	if !reflect.DeepEqual(counts, expected) {
+		t.Errorf("unexpected counts, got %v, expected %v", counts, expected)
+	}
+}
@@ -1,24 +1,92 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+// finishTimeout is how long Finish waits for the application to exit
+const finishTimeout = 10 * time.Second
+
+// defaultMaxRestarts limits restarts of crashed app with RestartOnCrash, if MaxRestarts isn't set
+const defaultMaxRestarts = 3
+
+// restartDelay is a pause before crashed app is started again
+const restartDelay = 100 * time.Millisecond
+
+// secretEnvName matches names of environment variables, values of which are not logged
+var secretEnvName = regexp.MustCompile(`(?i)secret|password|passwd|token|key|credential|auth`)
+
+const redactedValue = "<redacted>"
+
+// AppLogs is combined output of all the applications, queries check their expectedLogs against it
+var AppLogs = &logBuffer{}
+
+// logBuffer is a buffer that is safe for concurrent use
+type logBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+// Len returns amount of bytes written so far, it can be used as offset for Since
+func (b *logBuffer) Len() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Len()
+}
+
+// Since returns everything written after offset
+func (b *logBuffer) Since(offset int) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if offset > b.buf.Len() {
+		return ""
+	}
+	return string(b.buf.Bytes()[offset:])
+}
+
+func (b *logBuffer) String() string {
+	return b.Since(0)
+}
+
 type runner struct {
 	App
 
-	isRunning bool
-	ctx       context.Context
-	cancel    context.CancelFunc
-	logger    *zap.Logger
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	logger *zap.Logger
+
+	lock sync.Mutex
+	// pid of the running process, 0 if it's not running
+	pid      int
+	restarts int
 }
 
 func NewRunner(config *App, logger *zap.Logger) *runner {
+	ctx, cancel := context.WithCancel(context.Background())
 	r := &runner{
-		App: *config,
+		App:    *config,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
 		logger: logger.With(
 			zap.String("name", config.Name),
 		),
@@ -27,30 +95,269 @@ func NewRunner(config *App, logger *zap.Logger) *runner {
 	return r
 }
 
+// Run starts the application and waits for it to exit. Crashed application is started again if it has RestartOnCrash
 func (r *runner) Run() {
-	if r.isRunning {
-		r.logger.Fatal("app is already running")
-	}
+	defer close(r.done)
 	r.logger.Debug("will start application",
-		zap.Any("config", r.App),
+		zap.Any("config", r.redacted()),
 	)
-	r.ctx, r.cancel = context.WithCancel(context.Background())
 
-	cmd := exec.CommandContext(r.ctx, r.Binary, r.Args...)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		r.logger.Error("error running program",
-			zap.Any("config", r.App),
-			zap.String("output", string(out)),
+	maxRestarts := r.MaxRestarts
+	if maxRestarts == 0 {
+		maxRestarts = defaultMaxRestarts
+	}
+	for {
+		out, err := r.run()
+		if err == nil || r.ctx.Err() != nil {
+			return
+		}
+		if !r.RestartOnCrash || r.Restarts() >= maxRestarts {
+			r.logger.Error("error running program",
+				zap.Any("config", r.redacted()),
+				zap.String("output", out),
+				zap.Int("restarts", r.Restarts()),
+				zap.Error(err),
+			)
+			return
+		}
+
+		r.lock.Lock()
+		r.restarts++
+		restarts := r.restarts
+		r.lock.Unlock()
+		r.logger.Warn("application crashed, restarting",
+			zap.Int("restart", restarts),
+			zap.Int("max_restarts", maxRestarts),
+			zap.String("output", out),
 			zap.Error(err),
 		)
+
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(restartDelay):
+		}
+	}
+}
+
+// run starts the process once and waits for it to exit, output of the process is returned
+func (r *runner) run() (string, error) {
+	args := r.Args
+	if r.Now != 0 {
+		args = append(append([]string{}, r.Args...), "-now", strconv.FormatInt(r.Now, 10))
+	}
+	cmd := exec.CommandContext(r.ctx, r.Binary, args...)
+	if len(r.Env) != 0 {
+		cmd.Env = r.environ()
 	}
+	var out logBuffer
+	cmd.Stdout = io.MultiWriter(&out, AppLogs)
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+
+	r.lock.Lock()
+	r.pid = cmd.Process.Pid
+	r.lock.Unlock()
+	err := cmd.Wait()
+	r.lock.Lock()
+	r.pid = 0
+	r.lock.Unlock()
+
+	return out.String(), err
+}
+
+// Pid returns process id of the running application or 0 if it isn't running
+func (r *runner) Pid() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.pid
+}
 
-	r.isRunning = true
+// Restarts returns how many times the application was restarted after crash
+func (r *runner) Restarts() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.restarts
 }
 
+// environ returns environment of mockbackend with Env of the app set over it
+func (r *runner) environ() []string {
+	names := make([]string, 0, len(r.Env))
+	for name := range r.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// if variable is set twice, the last value is used by exec
+	env := os.Environ()
+	for _, name := range names {
+		env = append(env, name+"="+r.Env[name])
+	}
+	return env
+}
+
+// redacted returns config of the app, that is safe to log: values of environment variables
+// that look like secrets are hidden
+func (r *runner) redacted() App {
+	app := r.App
+	if len(app.Env) == 0 {
+		return app
+	}
+	app.Env = make(map[string]string, len(r.Env))
+	for name, value := range r.Env {
+		if secretEnvName.MatchString(name) {
+			value = redactedValue
+		}
+		app.Env[name] = value
+	}
+	return app
+}
+
+// Finish kills the application and waits for it to exit
 func (r *runner) Finish() {
 	r.cancel()
 
-	r.isRunning = false
+	select {
+	case <-r.done:
+	case <-time.After(finishTimeout):
+		r.logger.Error("application didn't exit in time")
+	}
+}
+
+// appsGroup is a set of running applications, that can be stopped only once
+type appsGroup struct {
+	runners []*runner
+	once    sync.Once
+	logger  *zap.Logger
+}
+
+// startApps starts the applications in order of their dependencies. Apps of the same level are started
+// in parallel, then ones that are dependencies of others are waited for to be ready before the next level is started.
+// Returned group contains apps that were started even if error happened, so it always has to be stopped
+func startApps(logger *zap.Logger, apps []App, timeout time.Duration) (*appsGroup, error) {
+	g := &appsGroup{
+		runners: make([]*runner, 0, len(apps)),
+		logger:  logger,
+	}
+	levels, err := dependencyLevels(apps)
+	if err != nil {
+		return g, err
+	}
+
+	dependencies := make(map[string]bool)
+	for i := range apps {
+		for _, name := range apps[i].DependsOn {
+			dependencies[name] = true
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for _, level := range levels {
+		started := make([]*runner, 0, len(level))
+		for _, i := range level {
+			r := NewRunner(&apps[i], logger)
+			g.runners = append(g.runners, r)
+			started = append(started, r)
+			go r.Run()
+		}
+
+		errs := make(chan error, len(started))
+		for _, r := range started {
+			if !dependencies[r.Name] {
+				errs <- nil
+				continue
+			}
+			go func(r *runner) {
+				err := waitListening(r.Ready, deadline, r.done)
+				if err != nil {
+					errs <- fmt.Errorf("app '%v' %v", r.Name, err)
+					return
+				}
+				r.logger.Info("app is ready",
+					zap.String("address", r.Ready),
+				)
+				errs <- nil
+			}(r)
+		}
+		for range started {
+			if e := <-errs; e != nil && err == nil {
+				err = e
+			}
+		}
+		if err != nil {
+			return g, err
+		}
+	}
+
+	return g, nil
+}
+
+// dependencyLevels groups indexes of apps by levels: apps of the first level have no dependencies,
+// apps of any other level depend only on apps of previous ones
+func dependencyLevels(apps []App) ([][]int, error) {
+	index := make(map[string]int, len(apps))
+	for i := range apps {
+		if _, ok := index[apps[i].Name]; ok {
+			return nil, fmt.Errorf("duplicate app name '%v'", apps[i].Name)
+		}
+		index[apps[i].Name] = i
+	}
+	for i := range apps {
+		for _, name := range apps[i].DependsOn {
+			j, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("app '%v' depends on unknown app '%v'", apps[i].Name, name)
+			}
+			if apps[j].Ready == "" {
+				return nil, fmt.Errorf("app '%v' is a dependency of '%v', but has no ready address", name, apps[i].Name)
+			}
+		}
+	}
+
+	levels := make([][]int, 0)
+	placed := make(map[string]bool, len(apps))
+	for len(placed) < len(apps) {
+		level := make([]int, 0)
+		for i := range apps {
+			if placed[apps[i].Name] {
+				continue
+			}
+			ready := true
+			for _, name := range apps[i].DependsOn {
+				if !placed[name] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				level = append(level, i)
+			}
+		}
+		if len(level) == 0 {
+			return nil, fmt.Errorf("apps have circular dependencies")
+		}
+		for _, i := range level {
+			placed[apps[i].Name] = true
+		}
+		levels = append(levels, level)
+	}
+
+	return levels, nil
+}
+
+// Stop finishes all the applications. It's safe to call it multiple times and from multiple goroutines
+func (g *appsGroup) Stop() {
+	g.once.Do(func() {
+		g.logger.Info("shutting down running application")
+		for _, r := range g.runners {
+			r.Finish()
+			if n := r.Restarts(); n != 0 {
+				r.logger.Warn("application was restarted after crashes",
+					zap.Int("restarts", n),
+				)
+			}
+		}
+	})
 }
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestAppsStoppedOnPanic(t *testing.T) {
+	var apps *appsGroup
+	func() {
+		defer func() {
+			if r := recover(); r == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+
+		var err error
+		apps, err = startApps(zap.NewNop(), []App{
+			{Name: "sleep1", Binary: "sleep", Args: []string{"60"}},
+			{Name: "sleep2", Binary: "sleep", Args: []string{"60"}},
+		}, time.Second)
+		defer apps.Stop()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// give apps some time to start
+		time.Sleep(100 * time.Millisecond)
+		for _, r := range apps.runners {
+			select {
+			case <-r.done:
+				t.Fatalf("app %v exited before panic", r.Name)
+			default:
+			}
+		}
+
+		panic("test panic in the middle of suite")
+	}()
+
+	for _, r := range apps.runners {
+		select {
+		case <-r.done:
+		default:
+			t.Errorf("app %v is still running", r.Name)
+		}
+	}
+
+	// stopping apps again is safe
+	apps.Stop()
+}
+
+func TestStartAppsDependsOn(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	startedFile := filepath.Join(dir, "started")
+
+	// address the dependency becomes ready on, it's listened by test itself after a delay
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	startedEarly := make(chan bool, 1)
+	ready := make(chan net.Listener, 1)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		_, err := os.Stat(startedFile)
+		startedEarly <- err == nil
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Error(err)
+		}
+		ready <- l
+	}()
+
+	// dependent app is listed first, but must be started last
+	apps, err := startApps(zap.NewNop(), []App{
+		{Name: "dependent", Binary: "touch", Args: []string{startedFile}, DependsOn: []string{"backend"}},
+		{Name: "backend", Binary: "sleep", Args: []string{"60"}, Ready: addr},
+	}, 5*time.Second)
+	defer apps.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := <-ready; l != nil {
+		defer l.Close()
+	}
+
+	if <-startedEarly {
+		t.Fatal("dependent app was started before its dependency is ready")
+	}
+	for i := 0; ; i++ {
+		if _, err := os.Stat(startedFile); err == nil {
+			break
+		}
+		if i == 50 {
+			t.Fatal("dependent app wasn't started")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestStartAppsDependencyErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		apps []App
+		err  string
+	}{
+		{
+			name: "unknown",
+			apps: []App{{Name: "a", Binary: "true", DependsOn: []string{"b"}}},
+			err:  "depends on unknown app",
+		},
+		{
+			name: "no ready address",
+			apps: []App{
+				{Name: "a", Binary: "true", DependsOn: []string{"b"}},
+				{Name: "b", Binary: "true"},
+			},
+			err: "has no ready address",
+		},
+		{
+			name: "cycle",
+			apps: []App{
+				{Name: "a", Binary: "true", DependsOn: []string{"b"}, Ready: "127.0.0.1:1"},
+				{Name: "b", Binary: "true", DependsOn: []string{"a"}, Ready: "127.0.0.1:1"},
+			},
+			err: "circular dependencies",
+		},
+		{
+			name: "dependency exited",
+			apps: []App{
+				{Name: "a", Binary: "true", DependsOn: []string{"b"}},
+				{Name: "b", Binary: "true", Ready: "127.0.0.1:1"},
+			},
+			err: "app 'b' exited before started listening",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apps, err := startApps(zap.NewNop(), tt.apps, 5*time.Second)
+			defer apps.Stop()
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("unexpected error '%v', expected '%v'", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestRunnerEnv(t *testing.T) {
+	if err := os.Setenv("MOCKBACKEND_TEST_PARENT", "parent"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("MOCKBACKEND_TEST_PARENT")
+	if err := os.Setenv("MOCKBACKEND_TEST_OVERRIDDEN", "parent"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("MOCKBACKEND_TEST_OVERRIDDEN")
+
+	r := NewRunner(&App{
+		Name:   "env",
+		Binary: "sh",
+		Args:   []string{"-c", `echo "child=$MOCKBACKEND_TEST_CHILD parent=$MOCKBACKEND_TEST_PARENT overridden=$MOCKBACKEND_TEST_OVERRIDDEN"`},
+		Env: map[string]string{
+			"MOCKBACKEND_TEST_CHILD":      "child",
+			"MOCKBACKEND_TEST_OVERRIDDEN": "child",
+		},
+	}, zap.NewNop())
+
+	offset := AppLogs.Len()
+	r.Run()
+
+	expected := "child=child parent=parent overridden=child"
+	if out := AppLogs.Since(offset); !strings.Contains(out, expected) {
+		t.Fatalf("unexpected output of the app '%v', expected '%v'", out, expected)
+	}
+}
+
+func TestRunnerRedacted(t *testing.T) {
+	r := NewRunner(&App{
+		Name:   "env",
+		Binary: "true",
+		Env: map[string]string{
+			"CARBONAPI_LISTEN": "127.0.0.1:8081",
+			"API_TOKEN":        "token",
+			"DB_Password":      "password",
+		},
+	}, zap.NewNop())
+
+	app := r.redacted()
+	expected := map[string]string{
+		"CARBONAPI_LISTEN": "127.0.0.1:8081",
+		"API_TOKEN":        redactedValue,
+		"DB_Password":      redactedValue,
+	}
+	if !reflect.DeepEqual(app.Env, expected) {
+		t.Fatalf("unexpected env '%v', expected '%v'", app.Env, expected)
+	}
+	if r.Env["API_TOKEN"] != "token" {
+		t.Fatalf("env of the app is changed: %v", r.Env)
+	}
+}
+
+// TestHelperServer isn't a real test, it's an app for runner tests that serves HTTP on MOCKBACKEND_TEST_LISTEN
+func TestHelperServer(t *testing.T) {
+	addr := os.Getenv("MOCKBACKEND_TEST_LISTEN")
+	if addr == "" {
+		return
+	}
+	_ = http.ListenAndServe(addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte("[]"))
+	}))
+	os.Exit(1)
+}
+
+func TestRunnerRestartOnCrash(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+
+	apps, err := startApps(zap.NewNop(), []App{{
+		Name:           "server",
+		Binary:         os.Args[0],
+		Args:           []string{"-test.run=^TestHelperServer$"},
+		Env:            map[string]string{"MOCKBACKEND_TEST_LISTEN": addr},
+		RestartOnCrash: true,
+		MaxRestarts:    1,
+	}}, time.Second)
+	defer apps.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := apps.runners[0]
+
+	kill := func() {
+		if err := waitListening(addr, time.Now().Add(5*time.Second), r.done); err != nil {
+			t.Fatal(err)
+		}
+		p, err := os.FindProcess(r.Pid())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Kill(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kill()
+	// app is started again, so the next query succeeds once it's listening
+	q := &Query{
+		Endpoint:      "http://" + addr,
+		URL:           "/",
+		Type:          "GET",
+		Retries:       50,
+		RetryInterval: 100 * time.Millisecond,
+		ExpectedResponse: ExpectedResponse{
+			HttpCode:    200,
+			ContentType: contentTypeJSON,
+			ExpectEmpty: true,
+		},
+	}
+	if failures, _ := runQuery(zap.NewNop(), q, nil, nil); len(failures) != 0 {
+		t.Fatalf("query after restart failed: %v", failures)
+	}
+	if n := r.Restarts(); n != 1 {
+		t.Fatalf("unexpected amount of restarts: %v", n)
+	}
+
+	// there are no restarts left
+	kill()
+	select {
+	case <-r.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("app was restarted over the limit")
+	}
+	if n := r.Restarts(); n != 1 {
+		t.Fatalf("unexpected amount of restarts: %v", n)
+	}
+}
+
+func TestRunnerRestartOnCrashExit(t *testing.T) {
+	tests := []struct {
+		name     string
+		app      App
+		restarts int
+	}{
+		{
+			name:     "crash without restartOnCrash",
+			app:      App{Binary: "sh", Args: []string{"-c", "exit 1"}},
+			restarts: 0,
+		},
+		{
+			name:     "clean exit",
+			app:      App{Binary: "true", RestartOnCrash: true},
+			restarts: 0,
+		},
+		{
+			name:     "crash loop",
+			app:      App{Binary: "sh", Args: []string{"-c", "exit 1"}, RestartOnCrash: true, MaxRestarts: 2},
+			restarts: 2,
+		},
+		{
+			name:     "default limit",
+			app:      App{Binary: "sh", Args: []string{"-c", "exit 1"}, RestartOnCrash: true},
+			restarts: defaultMaxRestarts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.app.Name = tt.name
+			r := NewRunner(&tt.app, zap.NewNop())
+			r.Run()
+			if n := r.Restarts(); n != tt.restarts {
+				t.Fatalf("unexpected amount of restarts: got %v, expected %v", n, tt.restarts)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// runSummary is a short report of the test run, written to TestSchema.Summary file. It's meant to be parsed
+// by tools, e.x. deployment gates, while logs are for humans
+type runSummary struct {
+	Total      int           `json:"total"`
+	Passed     int           `json:"passed"`
+	Failed     int           `json:"failed"`
+	DurationMs float64       `json:"durationMs"`
+	Results    []queryResult `json:"results"`
+
+	started time.Time
+}
+
+// queryResult is a result of a single run of the query
+type queryResult struct {
+	Name       string   `json:"name"`
+	URL        string   `json:"url"`
+	Run        int      `json:"run"`
+	Passed     bool     `json:"passed"`
+	DurationMs float64  `json:"durationMs"`
+	Failures   []string `json:"failures,omitempty"`
+	// ExpectedFailures are failures of the query with expectFailure, that passed because of them
+	ExpectedFailures []string `json:"expectedFailures,omitempty"`
+}
+
+func newRunSummary() *runSummary {
+	return &runSummary{
+		Results: make([]queryResult, 0),
+		started: time.Now(),
+	}
+}
+
+// add records the run of the query, it's not safe for concurrent use
+func (s *runSummary) add(t *Query, r *queryRun, run int) {
+	passed := len(r.failures) == 0
+	s.Total++
+	if passed {
+		s.Passed++
+	} else {
+		s.Failed++
+	}
+	s.Results = append(s.Results, queryResult{
+		Name:             t.Name,
+		URL:              t.URL,
+		Run:              run,
+		Passed:           passed,
+		DurationMs:       milliseconds(r.duration),
+		Failures:         r.failures,
+		ExpectedFailures: r.expectedFailures,
+	})
+}
+
+// save writes the summary to the file
+func (s *runSummary) save(path string) error {
+	s.DurationMs = milliseconds(time.Since(s.started))
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRunQueriesSummary(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentTypeJSON)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "mockbackend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "summary.json")
+	cfg.Test = &TestSchema{Summary: path}
+	defer func() { cfg.Test = nil }()
+
+	query := func(name string, code int, expectFailure bool) Query {
+		return Query{
+			Name:          name,
+			Endpoint:      srv.URL,
+			Type:          "GET",
+			URL:           "/render?format=json&target=" + name,
+			ExpectFailure: expectFailure,
+			ExpectedResponse: ExpectedResponse{
+				HttpCode:        code,
+				ContentType:     contentTypeJSON,
+				ExpectedResults: []ExpectedResult{{}},
+			},
+		}
+	}
+	queries := []Query{
+		query("passed", http.StatusOK, false),
+		query("failed", http.StatusNotFound, false),
+		query("known", http.StatusNotFound, true),
+	}
+
+	if failed, _ := runQueries(zap.NewNop(), queries, 1); !failed {
+		t.Fatalf("run is expected to fail")
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary map[string]interface{}
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatalf("failed to parse summary: %v", err)
+	}
+
+	for key, expected := range map[string]float64{"total": 3, "passed": 2, "failed": 1} {
+		if summary[key] != expected {
+			t.Errorf("unexpected %v, got %v, expected %v", key, summary[key], expected)
+		}
+	}
+	if _, ok := summary["durationMs"].(float64); !ok {
+		t.Errorf("summary has no durationMs: %s", b)
+	}
+
+	results, ok := summary["results"].([]interface{})
+	if !ok || len(results) != len(queries) {
+		t.Fatalf("unexpected results: %s", b)
+	}
+	keys := map[string][]string{
+		"passed": {"durationMs", "name", "passed", "run", "url"},
+		"failed": {"durationMs", "failures", "name", "passed", "run", "url"},
+		"known":  {"durationMs", "expectedFailures", "name", "passed", "run", "url"},
+	}
+	for i, r := range results {
+		result := r.(map[string]interface{})
+		name := queries[i].Name
+		if result["name"] != name || result["passed"] != (name != "failed") || result["url"] != queries[i].URL || result["run"] != 1.0 {
+			t.Errorf("unexpected result %v: %v", i, result)
+		}
+		got := make([]string, 0, len(result))
+		for k := range result {
+			got = append(got, k)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, keys[name]) {
+			t.Errorf("unexpected fields of result '%v', got %v, expected %v", name, got, keys[name])
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pathToken is a command or a number of path data
+var pathToken = regexp.MustCompile(`[A-Za-z]|[-+]?(?:\d+\.?\d*|\.\d+)(?:[eE][-+]?\d+)?`)
+
+// svgNumber formats the number rounded to 2 decimal places, so renderers of different precision give the same result
+func svgNumber(s string) string {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return s
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// svgPath returns path data with the same separators and number formatting
+func svgPath(d string) string {
+	tokens := pathToken.FindAllString(d, -1)
+	for i, t := range tokens {
+		if len(t) != 1 || t[0] < 'A' || t[0] > 'z' {
+			tokens[i] = svgNumber(t)
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+func svgAttr(e xml.StartElement, name string) string {
+	for _, a := range e.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// svgElements returns structurally significant elements of SVG image in document order: shapes of paths and
+// rectangles, text and glyphs placed by use elements. Glyphs are resolved to their shapes, so ids don't matter.
+// Formatting, styles and metadata (e.x. version of the renderer) are ignored
+func svgElements(b []byte) ([]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	// shapes of glyphs by their ids, cairo defines them as symbols before they are used
+	symbols := make(map[string]string)
+	var symbol string
+	defs := 0
+	text := 0
+	res := make([]string, 0)
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			switch token.Name.Local {
+			case "defs":
+				defs++
+			case "symbol":
+				symbol = svgAttr(token, "id")
+			case "text":
+				text++
+			case "path":
+				d := svgPath(svgAttr(token, "d"))
+				if symbol != "" {
+					symbols[symbol] = strings.TrimSpace(symbols[symbol] + " " + d)
+				} else if defs == 0 {
+					res = append(res, "path "+d)
+				}
+			case "rect":
+				if defs == 0 {
+					res = append(res, fmt.Sprintf("rect %v %v %v %v",
+						svgNumber(svgAttr(token, "x")), svgNumber(svgAttr(token, "y")),
+						svgNumber(svgAttr(token, "width")), svgNumber(svgAttr(token, "height")),
+					))
+				}
+			case "use":
+				if defs == 0 {
+					id := strings.TrimPrefix(svgAttr(token, "href"), "#")
+					shape, ok := symbols[id]
+					if !ok {
+						shape = "#" + id
+					}
+					res = append(res, fmt.Sprintf("use %v %v %v", svgNumber(svgAttr(token, "x")), svgNumber(svgAttr(token, "y")), shape))
+				}
+			}
+		case xml.EndElement:
+			switch token.Name.Local {
+			case "defs":
+				defs--
+			case "symbol":
+				symbol = ""
+			case "text":
+				text--
+			}
+		case xml.CharData:
+			if s := strings.Join(strings.Fields(string(token)), " "); text > 0 && s != "" {
+				res = append(res, "text "+s)
+			}
+		}
+	}
+	return res, nil
+}
+
+// compareSVG checks that SVG image has the same significant elements as the expected one, see svgElements
+func compareSVG(b, expected []byte) []string {
+	got, err := svgElements(b)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to parse SVG: %v", err)}
+	}
+	want, err := svgElements(expected)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to parse expected SVG: %v", err)}
+	}
+
+	failures := make([]string, 0)
+	if len(got) != len(want) {
+		failures = append(failures, fmt.Sprintf("SVG has unexpected amount of elements, got %v, expected %v", len(got), len(want)))
+	}
+	for i := 0; i < len(got) && i < len(want); i++ {
+		if got[i] != want[i] {
+			failures = append(failures, fmt.Sprintf("SVG element %v is different, got '%v', expected '%v'", i, got[i], want[i]))
+			break
+		}
+	}
+	return failures
+}
+
+// checkSVG compares SVG image with the one in file
+func checkSVG(b []byte, path string) []string {
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		return []string{fmt.Sprintf("failed to read expected SVG: %v", err)}
+	}
+	return compareSVG(b, expected)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestCompareSVGWhitespace(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/expected_reformatted.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if failures := checkSVG(b, "testdata/expected.svg"); len(failures) != 0 {
+		t.Errorf("SVGs that differ only in whitespace must be equal, got failures %v", failures)
+	}
+}
+
+func TestCompareSVG(t *testing.T) {
+	expected := `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.1">
+<defs><g><symbol overflow="visible" id="glyph0-0"><path d="M 0.5 0 L 0.5 -7 Z "/></symbol></g></defs>
+<g id="surface1">
+<path style="stroke:rgb(0%,0%,0%);" d="M 50.5 250.5 L 100.5 200.5 "/>
+<use xlink:href="#glyph0-0" x="55" y="290"/>
+<text x="300" y="20">No Data</text>
+</g>
+</svg>`
+
+	tests := []struct {
+		name     string
+		svg      string
+		failures []string
+	}{
+		{
+			name: "same",
+			svg:  expected,
+		},
+		{
+			name: "glyph ids, styles and number formatting",
+			svg: `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" version="1.2">
+<defs><g><symbol overflow="visible" id="glyph1-7"><path d="M0.500,0L.5-7.001Z"/></symbol></g></defs>
+<g id="surface5">
+<path style="stroke:rgb(100%,0%,0%);" d="M 50.50 250.5 L 100.5 200.5"/>
+<use xlink:href="#glyph1-7" x="55.0" y="290"/>
+<text x="300" y="20"> No  Data </text>
+</g>
+</svg>`,
+		},
+		{
+			name: "different path",
+			svg:  strings.Replace(expected, "L 100.5 200.5", "L 100.5 210.5", 1),
+			failures: []string{
+				"SVG element 0 is different, got 'path M 50.5 250.5 L 100.5 210.5', expected 'path M 50.5 250.5 L 100.5 200.5'",
+			},
+		},
+		{
+			name: "different glyph",
+			svg:  strings.Replace(expected, `d="M 0.5 0 L 0.5 -7 Z "`, `d="M 0.5 0 L 1.5 -7 Z "`, 1),
+			failures: []string{
+				"SVG element 1 is different, got 'use 55 290 M 0.5 0 L 1.5 -7 Z', expected 'use 55 290 M 0.5 0 L 0.5 -7 Z'",
+			},
+		},
+		{
+			name: "missing text",
+			svg:  strings.Replace(expected, `<text x="300" y="20">No Data</text>`, "", 1),
+			failures: []string{
+				"SVG has unexpected amount of elements, got 2, expected 3",
+			},
+		},
+		{
+			name: "invalid",
+			svg:  `<svg><g></svg>`,
+			failures: []string{
+				"failed to parse SVG: XML syntax error on line 1: element <g> closed by </svg>",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failures := compareSVG([]byte(tt.svg), []byte(expected))
+			if strings.Join(failures, "\n") != strings.Join(tt.failures, "\n") {
+				t.Errorf("got failures %q, expected %q", failures, tt.failures)
+			}
+		})
+	}
+}
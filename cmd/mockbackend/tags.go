@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+// tagMatcher is a single tag expression of seriesByTag, e.x. 'dc=~east.*'
+type tagMatcher struct {
+	tag    string
+	negate bool
+	re     *regexp.Regexp
+	value  string
+}
+
+func parseTagExpression(expr string) (*tagMatcher, error) {
+	ops := []string{"!=~", "=~", "!=", "="}
+	for _, op := range ops {
+		idx := strings.Index(expr, op)
+		if idx <= 0 {
+			continue
+		}
+
+		m := &tagMatcher{
+			tag:    expr[:idx],
+			negate: strings.HasPrefix(op, "!"),
+			value:  expr[idx+len(op):],
+		}
+		if strings.HasSuffix(op, "~") {
+			re, err := regexp.Compile("^(?:" + m.value + ")")
+			if err != nil {
+				return nil, err
+			}
+			m.re = re
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("invalid tag expression '%v'", expr)
+}
+
+func (m *tagMatcher) match(tags map[string]string) bool {
+	v := tags[m.tag]
+	var ok bool
+	if m.re != nil {
+		ok = m.re.MatchString(v)
+	} else {
+		ok = v == m.value
+	}
+	return ok != m.negate
+}
+
+// seriesTags returns tags of the metric including name
+func seriesTags(m *Metric) map[string]string {
+	tags := make(map[string]string, len(m.Tags)+1)
+	for k, v := range m.Tags {
+		tags[k] = v
+	}
+	tags["name"] = m.MetricName
+	return tags
+}
+
+// findTagged returns series from the tag index matching all tag expressions
+func findTagged(index []Metric, exprs []string) ([]Metric, error) {
+	matchers := make([]*tagMatcher, 0, len(exprs))
+	for _, e := range exprs {
+		m, err := parseTagExpression(e)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+
+	res := make([]Metric, 0)
+	for i := range index {
+		tags := seriesTags(&index[i])
+		matched := true
+		for _, m := range matchers {
+			if !m.match(tags) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			res = append(res, index[i])
+		}
+	}
+	return res, nil
+}
+
+// seriesByTagExpressions returns tag expressions of seriesByTag target or false if target is not a seriesByTag call
+func seriesByTagExpressions(target string) ([]string, bool) {
+	if !strings.HasPrefix(target, "seriesByTag(") {
+		return nil, false
+	}
+	// parser keeps seriesByTag as a metric name, so its arguments are parsed as arguments of a regular function
+	exp, _, err := parser.ParseExpr("tags" + strings.TrimPrefix(target, "seriesByTag"))
+	if err != nil {
+		return nil, false
+	}
+
+	exprs := make([]string, 0, len(exp.Args()))
+	for _, arg := range exp.Args() {
+		exprs = append(exprs, arg.StringValue())
+	}
+	return exprs, true
+}
+
+// tagsHandler serves /tags/autoComplete/tags, /tags/autoComplete/values and /tags/findSeries using the tag index
+func (cfg *listener) tagsHandler(wr http.ResponseWriter, req *http.Request) {
+	_ = req.ParseForm()
+	logger := cfg.logger.With(
+		zap.String("function", "tagsHandler"),
+		zap.String("path", req.URL.Path),
+		zap.Any("form", req.Form),
+	)
+	logger.Info("got request")
+
+	if cfg.Code != http.StatusOK {
+		wr.WriteHeader(cfg.Code)
+		return
+	}
+
+	exprs := req.Form["expr"]
+	series, err := findTagged(cfg.TagIndex, exprs)
+	if err != nil {
+		http.Error(wr, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	path := strings.TrimSuffix(req.URL.Path, "/")
+	var res []string
+	switch {
+	case strings.HasSuffix(path, "/autoComplete/tags"):
+		// tags that are already used in expressions are not suggested
+		used := make(map[string]bool)
+		for _, e := range exprs {
+			if m, err := parseTagExpression(e); err == nil {
+				used[m.tag] = true
+			}
+		}
+		res = uniqueSorted(series, req.Form.Get("tagPrefix"), func(tags map[string]string) []string {
+			names := make([]string, 0, len(tags))
+			for k := range tags {
+				if !used[k] {
+					names = append(names, k)
+				}
+			}
+			return names
+		})
+	case strings.HasSuffix(path, "/autoComplete/values"):
+		tag := req.Form.Get("tag")
+		res = uniqueSorted(series, req.Form.Get("valuePrefix"), func(tags map[string]string) []string {
+			if v, ok := tags[tag]; ok {
+				return []string{v}
+			}
+			return nil
+		})
+	case strings.HasSuffix(path, "/findSeries"):
+		res = make([]string, 0, len(series))
+		for i := range series {
+			res = append(res, series[i].name())
+		}
+		sort.Strings(res)
+	default:
+		http.Error(wr, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	if limit, err := strconv.Atoi(req.Form.Get("limit")); err == nil && limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(wr, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Info("will return", zap.Strings("response", res))
+	wr.Header().Set("Content-Type", contentTypeJSON)
+	_, _ = wr.Write(b)
+}
+
+func uniqueSorted(series []Metric, prefix string, values func(tags map[string]string) []string) []string {
+	seen := make(map[string]struct{})
+	res := make([]string, 0)
+	for i := range series {
+		for _, v := range values(seriesTags(&series[i])) {
+			if _, ok := seen[v]; ok || !strings.HasPrefix(v, prefix) {
+				continue
+			}
+			seen[v] = struct{}{}
+			res = append(res, v)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindTagged(t *testing.T) {
+	index := []Metric{
+		{MetricName: "cpu", Tags: map[string]string{"dc": "east", "host": "a"}},
+		{MetricName: "cpu", Tags: map[string]string{"dc": "west", "host": "b"}},
+		{MetricName: "mem", Tags: map[string]string{"dc": "east"}},
+	}
+
+	tests := []struct {
+		target   string
+		expected []string
+	}{
+		{"seriesByTag('name=cpu')", []string{"cpu;dc=east;host=a", "cpu;dc=west;host=b"}},
+		{"seriesByTag('name=cpu', 'dc!=east')", []string{"cpu;dc=west;host=b"}},
+		{"seriesByTag('dc=~ea')", []string{"cpu;dc=east;host=a", "mem;dc=east"}},
+		{"seriesByTag('name!=~c.*', 'host!=a')", []string{"mem;dc=east"}},
+		{"seriesByTag('host=')", []string{"mem;dc=east"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exprs, ok := seriesByTagExpressions(tt.target)
+			if !ok {
+				t.Fatalf("failed to parse %v", tt.target)
+			}
+			series, err := findTagged(index, exprs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make([]string, 0, len(series))
+			for i := range series {
+				got = append(got, series[i].name())
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
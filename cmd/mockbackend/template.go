@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// expandQueries replaces every query that have matrix with one query per combination of variable values
+func expandQueries(queries []Query) []Query {
+	res := make([]Query, 0, len(queries))
+	for _, q := range queries {
+		if len(q.Matrix) == 0 {
+			res = append(res, q)
+			continue
+		}
+
+		names := make([]string, 0, len(q.Matrix))
+		for name := range q.Matrix {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		combinations := [][]string{{}}
+		for _, name := range names {
+			next := make([][]string, 0, len(combinations)*len(q.Matrix[name]))
+			for _, c := range combinations {
+				for _, v := range q.Matrix[name] {
+					next = append(next, append(append([]string{}, c...), "${"+name+"}", v))
+				}
+			}
+			combinations = next
+		}
+
+		for _, c := range combinations {
+			res = append(res, applyTemplate(q, strings.NewReplacer(c...)))
+		}
+	}
+
+	return res
+}
+
+func applyTemplate(q Query, r *strings.Replacer) Query {
+	q.Matrix = nil
+	q.Name = r.Replace(q.Name)
+	q.Endpoint = r.Replace(q.Endpoint)
+	q.OracleEndpoint = r.Replace(q.OracleEndpoint)
+	q.URL = r.Replace(q.URL)
+	q.Body = r.Replace(q.Body)
+	q.Headers = replaceMap(q.Headers, r)
+	q.Setup = replaceActions(q.Setup, r)
+	q.Teardown = replaceActions(q.Teardown, r)
+
+	expected := q.ExpectedResponse
+	expected.ContentType = r.Replace(expected.ContentType)
+	expected.ExpectedHeaders = replaceMap(expected.ExpectedHeaders, r)
+	expected.ExpectedHeaderRegex = replaceMap(expected.ExpectedHeaderRegex, r)
+	expected.ExpectedTrailers = replaceMap(expected.ExpectedTrailers, r)
+	expected.GoldenBodyFile = r.Replace(expected.GoldenBodyFile)
+	results := make([]ExpectedResult, 0, len(expected.ExpectedResults))
+	for _, er := range expected.ExpectedResults {
+		result := er
+		result.SHA256 = make([]string, 0, len(er.SHA256))
+		result.Metrics = make([]CarbonAPIResponse, 0, len(er.Metrics))
+		for _, sum := range er.SHA256 {
+			result.SHA256 = append(result.SHA256, r.Replace(sum))
+		}
+		for _, m := range er.Metrics {
+			m.Target = r.Replace(m.Target)
+			m.TargetRegex = r.Replace(m.TargetRegex)
+			m.Tags = replaceMap(m.Tags, r)
+			result.Metrics = append(result.Metrics, m)
+		}
+		results = append(results, result)
+	}
+	expected.ExpectedResults = results
+	q.ExpectedResponse = expected
+
+	return q
+}
+
+func replaceMap(m map[string]string, r *strings.Replacer) map[string]string {
+	if m == nil {
+		return nil
+	}
+	res := make(map[string]string, len(m))
+	for k, v := range m {
+		res[r.Replace(k)] = r.Replace(v)
+	}
+	return res
+}
+
+// replaceActions returns copy of actions with placeholders replaced
+func replaceActions(actions []Action, r *strings.Replacer) []Action {
+	if actions == nil {
+		return nil
+	}
+	res := make([]Action, 0, len(actions))
+	for _, a := range actions {
+		a.Endpoint = r.Replace(a.Endpoint)
+		a.URL = r.Replace(a.URL)
+		a.Body = r.Replace(a.Body)
+		command := make([]string, 0, len(a.Command))
+		for _, arg := range a.Command {
+			command = append(command, r.Replace(arg))
+		}
+		a.Command = command
+		res = append(res, a)
+	}
+	return res
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpandQueries(t *testing.T) {
+	queries := []Query{
+		{
+			Name: "${function} of ${metric}",
+			URL:  "/render?format=json&target=${function}(${metric})",
+			Matrix: map[string][]string{
+				"function": {"sumSeries", "maxSeries"},
+				"metric":   {"a.b.c", "d.e.f"},
+			},
+			ExpectedResponse: ExpectedResponse{
+				ExpectedResults: []ExpectedResult{{
+					Metrics: []CarbonAPIResponse{{Target: "${function}(${metric})"}},
+				}},
+			},
+		},
+		{
+			Name: "plain",
+			URL:  "/render?format=json&target=a.b.c",
+		},
+	}
+
+	expanded := expandQueries(queries)
+
+	type query struct {
+		name   string
+		url    string
+		target string
+	}
+	got := make([]query, 0, len(expanded))
+	for _, q := range expanded {
+		if q.Matrix != nil {
+			t.Errorf("query '%v' must not have matrix after expansion", q.Name)
+		}
+		target := ""
+		if results := q.ExpectedResponse.ExpectedResults; len(results) != 0 {
+			target = results[0].Metrics[0].Target
+		}
+		got = append(got, query{q.Name, q.URL, target})
+	}
+
+	// variables are expanded in order of their names, values in order they are listed
+	expected := []query{
+		{"sumSeries of a.b.c", "/render?format=json&target=sumSeries(a.b.c)", "sumSeries(a.b.c)"},
+		{"sumSeries of d.e.f", "/render?format=json&target=sumSeries(d.e.f)", "sumSeries(d.e.f)"},
+		{"maxSeries of a.b.c", "/render?format=json&target=maxSeries(a.b.c)", "maxSeries(a.b.c)"},
+		{"maxSeries of d.e.f", "/render?format=json&target=maxSeries(d.e.f)", "maxSeries(d.e.f)"},
+		{"plain", "/render?format=json&target=a.b.c", ""},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("unexpected queries\ngot      %v\nexpected %v", got, expected)
+	}
+
+	// expected results of the template are not modified
+	if target := queries[0].ExpectedResponse.ExpectedResults[0].Metrics[0].Target; target != "${function}(${metric})" {
+		t.Errorf("template is modified, target is '%v'", target)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// FindNode is a node of the metric tree served by /metrics/find. Node is expandable if it has children
+type FindNode struct {
+	Name     string     `yaml:"name"`
+	Leaf     bool       `yaml:"leaf"`
+	Children []FindNode `yaml:"children"`
+}
+
+// findInTree returns nodes of the tree matching the graphite glob query
+func findInTree(tree []FindNode, query string) []carbonapi_v3_pb.GlobMatch {
+	matches := make([]carbonapi_v3_pb.GlobMatch, 0)
+	findNodes(tree, strings.Split(query, "."), "", &matches)
+	return matches
+}
+
+func findNodes(nodes []FindNode, parts []string, prefix string, matches *[]carbonapi_v3_pb.GlobMatch) {
+	for _, node := range nodes {
+		if !matchGlob(parts[0], node.Name) {
+			continue
+		}
+
+		nodePath := prefix + node.Name
+		if len(parts) == 1 {
+			*matches = append(*matches, carbonapi_v3_pb.GlobMatch{
+				Path:   nodePath,
+				IsLeaf: node.Leaf,
+			})
+			continue
+		}
+		findNodes(node.Children, parts[1:], nodePath+".", matches)
+	}
+}
+
+// matchGlob matches name against glob pattern, with support of graphite's {a,b} alternatives
+func matchGlob(pattern, name string) bool {
+	for _, p := range expandBraces(pattern) {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// expandBraces expands all {a,b} alternatives in the pattern
+func expandBraces(pattern string) []string {
+	start := strings.IndexByte(pattern, '{')
+	if start == -1 {
+		return []string{pattern}
+	}
+	end := strings.IndexByte(pattern[start:], '}')
+	if end == -1 {
+		return []string{pattern}
+	}
+	end += start
+
+	res := make([]string, 0)
+	for _, alt := range strings.Split(pattern[start+1:end], ",") {
+		res = append(res, expandBraces(pattern[:start]+alt+pattern[end+1:])...)
+	}
+	return res
+}
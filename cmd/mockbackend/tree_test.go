@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+func TestFindInTree(t *testing.T) {
+	tree := []FindNode{
+		{Name: "a", Children: []FindNode{
+			{Name: "b", Leaf: true},
+			{Name: "c", Children: []FindNode{
+				{Name: "d", Leaf: true},
+				{Name: "e", Leaf: true},
+			}},
+		}},
+		{Name: "x", Leaf: true},
+	}
+
+	tests := []struct {
+		query    string
+		expected []carbonapi_v3_pb.GlobMatch
+	}{
+		{"*", []carbonapi_v3_pb.GlobMatch{{Path: "a"}, {Path: "x", IsLeaf: true}}},
+		{"a.*", []carbonapi_v3_pb.GlobMatch{{Path: "a.b", IsLeaf: true}, {Path: "a.c"}}},
+		{"a.c.{d,e}", []carbonapi_v3_pb.GlobMatch{{Path: "a.c.d", IsLeaf: true}, {Path: "a.c.e", IsLeaf: true}}},
+		{"*.[bc].d", []carbonapi_v3_pb.GlobMatch{{Path: "a.c.d", IsLeaf: true}}},
+		{"a.b.c", []carbonapi_v3_pb.GlobMatch{}},
+		{"missing", []carbonapi_v3_pb.GlobMatch{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := findInTree(tree, tt.query)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("got %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
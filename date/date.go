@@ -10,8 +10,16 @@ import (
 )
 
 var errBadTime = errors.New("bad time")
+
+const millisecondsTimestampLen = 13
+
 var timeNow = time.Now
 
+// SetTimeNow overrides the source of current time, relative dates are resolved against it
+func SetTimeNow(now func() time.Time) {
+	timeNow = now
+}
+
 // parseTime parses a time and returns hours and minutes
 func parseTime(s string) (hour, minute int, err error) {
 
@@ -45,6 +53,30 @@ func parseTime(s string) (hour, minute int, err error) {
 
 var TimeFormats = []string{"20060102", "01/02/06"}
 
+// IsRelative returns true if passed from/until parameter is anchored to the current time (e.x. "-1h", "now",
+// "midnight", "noon yesterday") and its value changes over time
+func IsRelative(s string) bool {
+	if s == "" || s[0] == '-' {
+		return true
+	}
+
+	split := strings.Fields(strings.Replace(s, "_", " ", 1))
+	switch len(split) {
+	case 1:
+		switch split[0] {
+		case "now", "midnight", "noon", "teatime", "today", "yesterday", "tomorrow":
+			return true
+		}
+	case 2:
+		switch split[1] {
+		case "today", "yesterday", "tomorrow":
+			return true
+		}
+	}
+
+	return false
+}
+
 // DateParamToEpoch turns a passed string parameter into a unix epoch
 func DateParamToEpoch(s, qtz string, d int64, defaultTimeZone *time.Location) int64 {
 
@@ -76,6 +108,11 @@ func DateParamToEpoch(s, qtz string, d int64, defaultTimeZone *time.Location) in
 	sint, err := strconv.Atoi(s)
 	// need to check that len(s) > 8 to avoid turning 20060102 into seconds
 	if err == nil && len(s) > 8 {
+		// 13 digits can only be a timestamp in milliseconds: seconds will have 10 digits till Nov 2286,
+		// milliseconds have 13 digits since Sep 2001
+		if len(s) == millisecondsTimestampLen {
+			return int64(sint) / 1000
+		}
 		return int64(sint) // We got a timestamp so returning it
 	}
 
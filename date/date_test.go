@@ -47,3 +47,49 @@ func TestDateParamToEpoch(t *testing.T) {
 		}
 	}
 }
+
+func TestDateParamToEpochMilliseconds(t *testing.T) {
+	var tests = []struct {
+		seconds      string
+		milliseconds string
+	}{
+		{"1510913280", "1510913280000"},
+		{"1510913880", "1510913880999"},
+		{"1000000000", "1000000000000"},
+	}
+
+	for _, tt := range tests {
+		want := DateParamToEpoch(tt.seconds, "Local", 0, time.Local)
+		got := DateParamToEpoch(tt.milliseconds, "Local", 0, time.Local)
+		if got != want {
+			t.Errorf("dateParamToEpoch(%q, 0)=%v, want %v (same as for %q)", tt.milliseconds, got, want, tt.seconds)
+		}
+	}
+}
+
+func TestIsRelative(t *testing.T) {
+	var tests = []struct {
+		input    string
+		relative bool
+	}{
+		{"", true},
+		{"-1h", true},
+		{"now", true},
+		{"midnight", true},
+		{"today", true},
+		{"noon yesterday", true},
+		{"noon_tomorrow", true},
+
+		{"1510913280", false},
+		{"1510913280000", false},
+		{"19940812", false},
+		{"noon 08/12/94", false},
+		{"17:04 19940812", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRelative(tt.input); got != tt.relative {
+			t.Errorf("IsRelative(%q)=%v, want %v", tt.input, got, tt.relative)
+		}
+	}
+}
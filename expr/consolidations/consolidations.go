@@ -289,17 +289,14 @@ func AggSum(v []float64) float64 {
 	return sum
 }
 
-// AggFirst returns first point
+// AggFirst returns first non-NaN point
 func AggFirst(v []float64) float64 {
-	var m = math.Inf(-1)
-	var abs = true
-	if len(v) > 0 {
-		return v[0]
-	}
-	if abs {
-		return math.NaN()
+	for _, vv := range v {
+		if !math.IsNaN(vv) {
+			return vv
+		}
 	}
-	return m
+	return math.NaN()
 }
 
 // AggLast returns last point
@@ -109,3 +109,30 @@ func TestSummarizeValues(t *testing.T) {
 	}
 
 }
+
+func TestConsolidationToFunc(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		name     string
+		function string
+		values   []float64
+		expected float64
+	}{
+		{"first", "first", []float64{1, nan, 3}, 1},
+		{"first skips nulls", "first", []float64{nan, nan, 2, nan, 3}, 2},
+		{"first of nulls", "first", []float64{nan, nan}, nan},
+		{"last skips nulls", "last", []float64{1, 2, nan}, 2},
+		{"count", "count", []float64{1, 2, 3}, 3},
+		{"count skips nulls", "count", []float64{nan, 1, nan, 2, nan}, 2},
+		{"count of nulls", "count", []float64{nan, nan}, nan},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := ConsolidationToFunc[tt.function](tt.values)
+			if actual != tt.expected && !(math.IsNaN(actual) && math.IsNaN(tt.expected)) {
+				t.Errorf("actual %v, expected %v", actual, tt.expected)
+			}
+		})
+	}
+}
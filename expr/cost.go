@@ -0,0 +1,133 @@
+package expr
+
+import (
+	"context"
+	"strings"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// CostStep is the resolution (in seconds) that is assumed for metrics while estimating amount of points to fetch
+const CostStep = 60
+
+// Cost is an estimate of how expensive it is to evaluate the target
+type Cost struct {
+	Target string `json:"target"`
+	// Metrics is amount of leaf metrics that target fetches
+	Metrics int64 `json:"metrics"`
+	// Points is amount of points per metric
+	Points int64 `json:"points"`
+	// Complexity is amount of function calls in the target
+	Complexity int64 `json:"complexity"`
+	Cost       int64 `json:"cost"`
+	// Step is the step that series of the target are resampled to before they are aggregated together, 0 if unknown
+	Step int64 `json:"step,omitempty"`
+}
+
+func isGlob(metric string) bool {
+	return strings.ContainsAny(metric, "*?[{")
+}
+
+// complexity returns amount of function calls in the expression, but at least 1
+func complexity(e parser.Expr) int64 {
+	var c int64
+	var walk func(e parser.Expr)
+	walk = func(e parser.Expr) {
+		if !e.IsFunc() {
+			return
+		}
+		c++
+		for _, arg := range e.Args() {
+			walk(arg)
+		}
+		for _, arg := range e.NamedArgs() {
+			walk(arg)
+		}
+	}
+	walk(e)
+
+	if c == 0 {
+		return 1
+	}
+	return c
+}
+
+// EstimateCost scores the expression as amount of leaf metrics × points × function complexity.
+// Globs are expanded with find requests to backends.
+func EstimateCost(ctx context.Context, target string, e parser.Expr, from, until int64) Cost {
+	cost := Cost{
+		Target:     target,
+		Points:     (until - from) / CostStep,
+		Complexity: complexity(e),
+	}
+	if cost.Points < 1 {
+		cost.Points = 1
+	}
+
+	request := pb.MultiGlobRequest{
+		StartTime: from,
+		StopTime:  until,
+	}
+	for _, m := range e.Metrics() {
+		if isGlob(m.Metric) {
+			request.Metrics = append(request.Metrics, m.Metric)
+		} else {
+			cost.Metrics++
+		}
+	}
+
+	if len(request.Metrics) > 0 {
+		resp, _, err := config.Config.ZipperInstance.Find(ctx, request)
+		if err != nil && !merry.Is(err, zipperTypes.ErrNonFatalErrors) {
+			if !merry.Is(err, zipperTypes.ErrNotFound) {
+				// can't expand globs, so assume that each of them matches at least one metric
+				cost.Metrics += int64(len(request.Metrics))
+			}
+		} else if resp != nil {
+			for _, g := range resp.Metrics {
+				for _, match := range g.Matches {
+					if match.IsLeaf {
+						cost.Metrics++
+					}
+				}
+			}
+		}
+	}
+
+	cost.Cost = cost.Metrics * cost.Points * cost.Complexity
+	return cost
+}
+
+// EstimateStep asks backends for retentions of the metrics and returns the common step (LCM of steps of archives
+// that would be used) that aggregating functions resample series with different steps to. 0 is returned if retentions are unknown.
+func EstimateStep(ctx context.Context, e parser.Expr, from int64) int64 {
+	var metrics []string
+	for _, m := range e.Metrics() {
+		metrics = append(metrics, m.Metric)
+	}
+	if len(metrics) == 0 {
+		return 0
+	}
+
+	info, _, err := config.Config.ZipperInstance.Info(ctx, metrics)
+	if err != nil || info == nil {
+		return 0
+	}
+
+	now := timeNow().Unix()
+	var steps []int64
+	for _, resp := range info.Info {
+		for _, m := range resp.Metrics {
+			if step := archiveStep(m.Retentions, from, now); step > 0 {
+				steps = append(steps, step)
+			}
+		}
+	}
+	return helper.LCM(steps...)
+}
@@ -0,0 +1,131 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+func TestEstimateCost(t *testing.T) {
+	oldConfig := config.Config
+	defer func() {
+		config.Config = oldConfig
+	}()
+
+	config.Config.ZipperInstance = &mockZipper{
+		globs: map[string][]string{
+			"few.*":  {"few.a", "few.b"},
+			"many.*": {"many.a", "many.b", "many.c", "many.d", "many.e", "many.f"},
+		},
+	}
+
+	tests := []struct {
+		target   string
+		from     int64
+		until    int64
+		expected Cost
+	}{
+		{
+			target:   "foo.bar",
+			from:     0,
+			until:    3600,
+			expected: Cost{Metrics: 1, Points: 60, Complexity: 1, Cost: 60},
+		},
+		{
+			target:   "few.*",
+			from:     0,
+			until:    3600,
+			expected: Cost{Metrics: 2, Points: 60, Complexity: 1, Cost: 120},
+		},
+		{
+			target:   "many.*",
+			from:     0,
+			until:    3600,
+			expected: Cost{Metrics: 6, Points: 60, Complexity: 1, Cost: 360},
+		},
+		{
+			target:   "many.*",
+			from:     0,
+			until:    7200,
+			expected: Cost{Metrics: 6, Points: 120, Complexity: 1, Cost: 720},
+		},
+		{
+			target:   "sumSeries(movingAverage(many.*, '5min'))",
+			from:     0,
+			until:    3600,
+			expected: Cost{Metrics: 6, Points: 60, Complexity: 2, Cost: 720},
+		},
+		{
+			target:   "divideSeries(sumSeries(few.*), foo.bar)",
+			from:     0,
+			until:    3600,
+			expected: Cost{Metrics: 3, Points: 60, Complexity: 2, Cost: 360},
+		},
+		{
+			target:   "missing.*",
+			from:     0,
+			until:    30,
+			expected: Cost{Metrics: 0, Points: 1, Complexity: 1, Cost: 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.expected.Target = tt.target
+			got := EstimateCost(context.Background(), tt.target, exp, tt.from, tt.until)
+			if got != tt.expected {
+				t.Errorf("unexpected cost: got %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEstimateStep(t *testing.T) {
+	now := time.Unix(100000000, 0)
+	timeNow = func() time.Time { return now }
+	oldConfig := config.Config
+	defer func() {
+		timeNow = time.Now
+		config.Config = oldConfig
+	}()
+
+	config.Config.ZipperInstance = &mockZipper{
+		retentions: testRetentions,
+		metricRetentions: map[string][]pb.Retention{
+			// 60s:30d
+			"coarse.metric": {{SecondsPerPoint: 60, NumberOfPoints: 43200}},
+		},
+	}
+
+	tests := []struct {
+		target   string
+		from     int64
+		expected int64
+	}{
+		{"sumSeries(foo.bar,foo.baz)", now.Unix() - 3600, 10},
+		{"sumSeries(foo.bar,coarse.metric)", now.Unix() - 3600, 60},
+		{"sumSeries(foo.bar,coarse.metric)", now.Unix() - 14*24*3600, 60},
+		{"sumSeries(foo.bar,coarse.metric)", now.Unix() - 60*24*3600, 600},
+		{"constantLine(1)", now.Unix() - 3600, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := EstimateStep(context.Background(), exp, tt.from); got != tt.expected {
+				t.Errorf("unexpected step: got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package expr
 
 import (
 	"context"
+	"sort"
+	"strings"
 
 	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 
@@ -12,6 +14,7 @@ import (
 	"github.com/go-graphite/carbonapi/expr/metadata"
 	"github.com/go-graphite/carbonapi/expr/types"
 	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
 	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
 )
 
@@ -19,9 +22,19 @@ type evaluator struct{}
 
 // FetchAndEvalExp fetch data and evalualtes expressions
 func (eval evaluator) FetchAndEvalExp(ctx context.Context, exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
-	config.Config.Limiter.Enter()
+	if config.Config.IgnoreClientTimeout {
+		config.Config.Limiter.Enter()
+	} else if err := config.Config.Limiter.EnterWithContext(ctx); err != nil {
+		return nil, err
+	}
 	defer config.Config.Limiter.Leave()
 
+	if len(config.Config.Pushdown.Functions) > 0 {
+		if results, ok := pushdown(ctx, exp, from, until, values); ok {
+			return results, nil
+		}
+	}
+
 	multiFetchRequest := pb.MultiFetchRequest{}
 	metricRequestCache := make(map[string]parser.MetricRequest)
 	maxDataPoints := utilctx.GetMaxDatapoints(ctx)
@@ -60,17 +73,34 @@ func (eval evaluator) FetchAndEvalExp(ctx context.Context, exp parser.Expr, from
 			continue
 		}
 
+		if config.Config.RollupSelection {
+			applyRollup(ctx, &fetchRequest)
+		}
+
 		metricRequestCache[m.Metric] = metricRequest
 		targetValues[metricRequest] = nil
 		multiFetchRequest.Metrics = append(multiFetchRequest.Metrics, fetchRequest)
 	}
 
+	if err := Cancelled(ctx); err != nil {
+		return nil, err
+	}
+
 	if len(multiFetchRequest.Metrics) > 0 {
-		metrics, _, err := config.Config.ZipperInstance.Render(ctx, multiFetchRequest)
+		metrics, stats, err := config.Config.ZipperInstance.Render(ctx, multiFetchRequest)
+		// truncated response would under-count series, so it's an error unless user prefers partial data
+		if stats != nil && len(stats.TruncatedTargets) != 0 && !config.Config.IgnoreTagTruncation {
+			return nil, truncatedError(stats.TruncatedTargets)
+		}
 		// If we had only partial result, we want to do our best to actually do our job
 		if err != nil && merry.HTTPCode(err) >= 400 && exp.Target() != "fallbackSeries" {
 			return nil, err
 		}
+		if err != nil {
+			if c := utilctx.GetErrorCollector(ctx); c != nil {
+				c.Add(err.Error())
+			}
+		}
 		for _, metric := range metrics {
 			metricRequest := metricRequestCache[metric.PathExpression]
 			if metric.RequestStartTime != 0 && metric.RequestStopTime != 0 {
@@ -93,9 +123,28 @@ func (eval evaluator) FetchAndEvalExp(ctx context.Context, exp parser.Expr, from
 		targetValues = helper.ScaleValuesToCommonStep(targetValues)
 	}
 
+	// client might have gone while we were waiting for backends
+	if err := Cancelled(ctx); err != nil {
+		return nil, err
+	}
+
 	return eval.Eval(ctx, exp, from, until, targetValues)
 }
 
+// truncatedError returns error about seriesByTag expressions that matched more series than backends returned
+func truncatedError(targets []string) merry.Error {
+	seen := make(map[string]bool, len(targets))
+	unique := make([]string, 0, len(targets))
+	for _, t := range targets {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	sort.Strings(unique)
+	return zipperTypes.ErrSeriesTruncated.Here().WithMessagef("%s matched more series than backend limit, result is truncated", strings.Join(unique, ", "))
+}
+
 // Eval evalualtes expressions
 func (eval evaluator) Eval(ctx context.Context, exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) (results []*types.MetricData, err error) {
 	rewritten, targets, err := RewriteExpr(ctx, exp, from, until, values)
@@ -126,6 +175,14 @@ func init() {
 	metadata.SetEvaluator(_evaluator)
 }
 
+// Cancelled returns error if request was cancelled (e.x. client disconnected), unless client timeouts should be ignored
+func Cancelled(ctx context.Context) error {
+	if config.Config.IgnoreClientTimeout {
+		return nil
+	}
+	return ctx.Err()
+}
+
 // FetchAndEvalExp fetch data and evalualtes expressions
 func FetchAndEvalExp(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	return _evaluator.FetchAndEvalExp(ctx, e, from, until, values)
@@ -146,6 +203,10 @@ func EvalExpr(ctx context.Context, e parser.Expr, from, until int64, values map[
 		return nil, parser.ErrMissingArgument
 	}
 
+	if err := Cancelled(ctx); err != nil {
+		return nil, err
+	}
+
 	metadata.FunctionMD.RLock()
 	f, ok := metadata.FunctionMD.Functions[e.Target()]
 	metadata.FunctionMD.RUnlock()
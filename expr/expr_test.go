@@ -502,3 +502,45 @@ func TestEvalCustomFromUntil(t *testing.T) {
 		})
 	}
 }
+
+func TestEvalConsolidateBy(t *testing.T) {
+	nan := math.NaN()
+	tests := []struct {
+		target         string
+		valuesPerPoint int
+		want           []float64
+	}{
+		{"consolidateBy(metric1,'first')", 3, []float64{1, 3, nan, 4}},
+		{"consolidateBy(metric1,'count')", 3, []float64{2, 1, nan, 1}},
+		{"consolidateBy(metric1,'last')", 3, []float64{2, 3, nan, 4}},
+		{"consolidateBy(metric1,'First')", 3, []float64{1, 3, nan, 4}},
+		// consolidator is kept by functions applied after consolidateBy
+		{"alias(consolidateBy(metric1,'count'),'a')", 3, []float64{2, 1, nan, 1}},
+		{"consolidateBy(summarize(metric1,'2s','sum'),'count')", 2, []float64{2, nan, 1}},
+		{"consolidateBy(summarize(metric1,'2s','sum'),'first')", 2, []float64{1, nan, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			m := map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{nan, 1, 2, 3, nan, nan, nan, nan, nan, 4}, 1, 0)},
+			}
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g, err := EvalExpr(context.Background(), exp, 0, 1, m)
+			if err != nil {
+				t.Fatalf("failed to eval %v: %s", tt.target, err)
+			}
+			if len(g) != 1 {
+				t.Fatalf("unexpected amount of results, got %v, want 1", len(g))
+			}
+
+			g[0].SetValuesPerPoint(tt.valuesPerPoint)
+			if got := g[0].AggregatedValues(); !th.NearlyEqual(got, tt.want) {
+				t.Errorf("unexpected consolidated values, got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
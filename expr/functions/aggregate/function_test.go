@@ -22,6 +22,11 @@ func init() {
 	}
 }
 
+func withConsolidation(m *types.MetricData, consolidationFunc string) *types.MetricData {
+	m.ConsolidationFunc = consolidationFunc
+	return m
+}
+
 func TestAverageSeries(t *testing.T) {
 	now32 := int64(time.Now().Unix())
 
@@ -233,6 +238,22 @@ func TestAverageSeries(t *testing.T) {
 			},
 			[]*types.MetricData{types.MakeMetricData("sumSeries(metric1,metric2,metric3)", []float64{6, 9, 8, 15, 11, math.NaN()}, 1, now32)},
 		},
+		{
+			"sumSeries(metric1,metric2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 10, 1800)},
+				{"metric2", 0, 1}: {types.MakeMetricData("metric2", []float64{100, 200}, 60, 1800)},
+			},
+			[]*types.MetricData{types.MakeMetricData("sumSeries(metric1,metric2)", []float64{103.5, 209.5}, 60, 1800)},
+		},
+		{
+			"sumSeries(metric1,metric2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {withConsolidation(types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}, 10, 1800), "sum")},
+				{"metric2", 0, 1}: {types.MakeMetricData("metric2", []float64{100, 200}, 60, 1800)},
+			},
+			[]*types.MetricData{types.MakeMetricData("sumSeries(metric1,metric2)", []float64{121, 257}, 60, 1800)},
+		},
 
 		// minMax
 		{
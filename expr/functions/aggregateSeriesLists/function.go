@@ -0,0 +1,127 @@
+package aggregateSeriesLists
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/go-graphite/carbonapi/expr/consolidations"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type aggregateSeriesLists struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &aggregateSeriesLists{}
+	functions := []string{"aggregateSeriesLists"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// divide is CarbonAPI-specific aggregation, it divides first value by the second one, like divideSeriesLists
+func divide(v []float64) float64 {
+	if math.IsNaN(v[0]) || math.IsNaN(v[1]) || v[1] == 0 {
+		return math.NaN()
+	}
+	return v[0] / v[1]
+}
+
+func aggregationFuncs() []string {
+	return append([]string{"divide"}, consolidations.AvailableConsolidationFuncs()...)
+}
+
+// aggregateSeriesLists(seriesListFirstPos, seriesListSecondPos, func)
+func (f *aggregateSeriesLists) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	if len(e.Args()) < 3 {
+		return nil, parser.ErrMissingArgument
+	}
+
+	first, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+	second, err := helper.GetSeriesArg(e.Args()[1], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+	callback, err := e.GetStringArg(2)
+	if err != nil {
+		return nil, err
+	}
+
+	aggFunc := divide
+	if callback != "divide" {
+		var ok bool
+		aggFunc, ok = consolidations.ConsolidationToFunc[callback]
+		if !ok {
+			return nil, fmt.Errorf("unsupported aggregation function %s", callback)
+		}
+	}
+
+	if len(first) != len(second) {
+		return nil, fmt.Errorf("seriesListFirstPos and seriesListSecondPos must have equal length, got %d and %d", len(first), len(second))
+	}
+
+	// like in graphite-web, series are paired by their position in the lists
+	results := make([]*types.MetricData, 0, len(first))
+	for i := range first {
+		args := []*types.MetricData{first[i], second[i]}
+		if !helper.ExtrapolatePoints {
+			args = helper.ScaleToCommonStep(args, 0)
+		}
+		args = helper.AlignSeries(args)
+
+		r := *args[0]
+		r.Name = fmt.Sprintf("%sSeries(%s,%s)", callback, first[i].Name, second[i].Name)
+		r.Values = make([]float64, len(args[0].Values))
+		for j := range r.Values {
+			r.Values[j] = aggFunc([]float64{args[0].Values[j], args[1].Values[j]})
+		}
+		results = append(results, &r)
+	}
+
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *aggregateSeriesLists) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"aggregateSeriesLists": {
+			Description: "Iterates over a two lists and aggregates using specified function\nlist1[0] to list2[0], list1[1] to list2[1] and so on.\nThe lists will need to be the same length\n\nPosition of seriesList matters. For example using \"diff\" function with\nlist1[0] and list2[0] results in `diffSeries(list1[0], list2[0])`\n\nExample:\n\n.. code-block:: none\n\n  &target=aggregateSeriesLists(mining.{carbon,graphite,diamond}.extracted,mining.{carbon,graphite,diamond}.shipped, 'diff')\n\nAn example above would be the same as running :py:func:`aggregate <aggregate>` for each member of the list:\n\n.. code-block:: none\n\n  ?target=aggregate([mining.carbon.extracted,mining.carbon.shipped], 'diff')\n  &target=aggregate([mining.graphite.extracted,mining.graphite.shipped], 'diff')\n  &target=aggregate([mining.diamond.extracted,mining.diamond.shipped], 'diff')\n\nThis function can be used with aggregation functions ``average``, ``median``, ``sum``, ``min``,\n``max``, ``diff``, ``stddev``, ``count``, ``range``, ``multiply`` & ``last``.\nCarbonAPI-specific extension allows to use ``divide`` function, that divides list1[0] by list2[0] and so on.",
+			Function:    "aggregateSeriesLists(seriesListFirstPos, seriesListSecondPos, func)",
+			Group:       "Combine",
+			Module:      "graphite.render.functions",
+			Name:        "aggregateSeriesLists",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesListFirstPos",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "seriesListSecondPos",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "func",
+					Required: true,
+					Type:     types.AggFunc,
+					Options:  aggregationFuncs(),
+				},
+			},
+		},
+	}
+}
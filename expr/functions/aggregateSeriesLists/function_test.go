@@ -0,0 +1,138 @@
+package aggregateSeriesLists
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestFunction(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	series := map[parser.MetricRequest][]*types.MetricData{
+		{"requests.*.errors", 0, 1}: {
+			types.MakeMetricData("requests.host1.errors", []float64{1, 2, 3, math.NaN(), 5}, 1, now32),
+			types.MakeMetricData("requests.host2.errors", []float64{1, 3, 0, 4, math.NaN()}, 1, now32),
+		},
+		{"requests.*.total", 0, 1}: {
+			types.MakeMetricData("requests.host1.total", []float64{2, 4, 6, 8, 10}, 1, now32),
+			types.MakeMetricData("requests.host2.total", []float64{4, 6, 0, 8, 10}, 1, now32),
+		},
+	}
+
+	tests := []th.EvalTestItem{
+		{
+			"aggregateSeriesLists(requests.*.errors,requests.*.total,\"divide\")",
+			series,
+			[]*types.MetricData{
+				types.MakeMetricData("divideSeries(requests.host1.errors,requests.host1.total)", []float64{0.5, 0.5, 0.5, math.NaN(), 0.5}, 1, now32),
+				types.MakeMetricData("divideSeries(requests.host2.errors,requests.host2.total)", []float64{0.25, 0.5, math.NaN(), 0.5, math.NaN()}, 1, now32),
+			},
+		},
+		{
+			"aggregateSeriesLists(requests.*.errors,requests.*.total,\"sum\")",
+			series,
+			[]*types.MetricData{
+				types.MakeMetricData("sumSeries(requests.host1.errors,requests.host1.total)", []float64{3, 6, 9, 8, 15}, 1, now32),
+				types.MakeMetricData("sumSeries(requests.host2.errors,requests.host2.total)", []float64{5, 9, 0, 12, 10}, 1, now32),
+			},
+		},
+		{
+			"aggregateSeriesLists(requests.*.total,requests.*.errors,\"diff\")",
+			series,
+			[]*types.MetricData{
+				types.MakeMetricData("diffSeries(requests.host1.total,requests.host1.errors)", []float64{1, 2, 3, 8, 5}, 1, now32),
+				types.MakeMetricData("diffSeries(requests.host2.total,requests.host2.errors)", []float64{3, 3, 0, 4, 10}, 1, now32),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
+
+// series are paired by position in the lists, even if their names sort in a different order
+func TestFunctionPairsByPosition(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tt := th.EvalTestItem{
+		"aggregateSeriesLists(first.*,second.*,\"diff\")",
+		map[parser.MetricRequest][]*types.MetricData{
+			{"first.*", 0, 1}: {
+				types.MakeMetricData("first.b", []float64{10, 20}, 1, now32),
+				types.MakeMetricData("first.a", []float64{5, 6}, 1, now32),
+			},
+			{"second.*", 0, 1}: {
+				types.MakeMetricData("second.c", []float64{1, 2}, 1, now32),
+				types.MakeMetricData("second.d", []float64{3, 4}, 1, now32),
+			},
+		},
+		[]*types.MetricData{
+			types.MakeMetricData("diffSeries(first.b,second.c)", []float64{9, 18}, 1, now32),
+			types.MakeMetricData("diffSeries(first.a,second.d)", []float64{2, 2}, 1, now32),
+		},
+	}
+	th.TestEvalExpr(t, &tt)
+}
+
+func TestFunctionErrors(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	series := map[parser.MetricRequest][]*types.MetricData{
+		{"requests.*.errors", 0, 1}: {
+			types.MakeMetricData("requests.host1.errors", []float64{1, 2}, 1, now32),
+		},
+		{"requests.*.total", 0, 1}: {
+			types.MakeMetricData("requests.host1.total", []float64{2, 4}, 1, now32),
+			types.MakeMetricData("requests.host2.total", []float64{4, 6}, 1, now32),
+		},
+	}
+
+	tests := []struct {
+		target string
+		err    string
+	}{
+		{
+			"aggregateSeriesLists(requests.*.errors,requests.*.total,\"divide\")",
+			"seriesListFirstPos and seriesListSecondPos must have equal length, got 1 and 2",
+		},
+		{
+			"aggregateSeriesLists(requests.*.errors,requests.*.errors,\"unknown\")",
+			"unsupported aggregation function unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = metadata.GetEvaluator().Eval(context.Background(), exp, 0, 1, series)
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("unexpected error, got %v, expected %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,304 @@
+package aliasByExternal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+
+	"github.com/dgryski/go-expirecache"
+	"github.com/lomik/zapwriter"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type cacheEntry struct {
+	name  string
+	found bool
+}
+
+type aliasByExternal struct {
+	interfaces.FunctionBase
+
+	url         string
+	aliases     map[string]string
+	ttl         int32
+	concurrency int
+	client      *http.Client
+	logger      *zap.Logger
+	cache       *expirecache.Cache
+}
+
+type aliasByExternalConfig struct {
+	Enabled bool
+	// URL of lookup service. Key is passed as `key` query parameter, response body is used as a display name, 404 means that there is no display name for the key
+	URL string
+	// File with JSON object that maps keys to display names. Used before lookup service is queried
+	File    string
+	TTL     time.Duration
+	Timeout time.Duration
+	// Max amount of cached lookup results, random ones are evicted when it's exceeded
+	CacheSize uint64
+	// Max amount of concurrent requests to lookup service per call of the function
+	Concurrency int
+}
+
+// GetOrder - standard function
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+// New - function for parsing config
+func New(configFile string) []interfaces.FunctionMetadata {
+	logger := zapwriter.Logger("functionInit").With(zap.String("function", "aliasByExternal"))
+	if configFile == "" {
+		logger.Debug("no config file specified",
+			zap.String("message", "this function requrires config file to work properly"),
+		)
+		return nil
+	}
+	v := viper.New()
+	v.SetConfigFile(configFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		logger.Error("failed to read config file",
+			zap.Error(err),
+		)
+		return nil
+	}
+
+	cfg := aliasByExternalConfig{
+		Enabled:     false,
+		TTL:         5 * time.Minute,
+		Timeout:     1 * time.Second,
+		CacheSize:   100000,
+		Concurrency: 10,
+	}
+	err = v.Unmarshal(&cfg)
+	if err != nil {
+		logger.Error("failed to parse config",
+			zap.Error(err),
+		)
+		return nil
+	}
+	if !cfg.Enabled {
+		logger.Warn("aliasByExternal config found but aliasByExternal is disabled")
+		return nil
+	}
+	if cfg.URL == "" && cfg.File == "" {
+		logger.Error("neither url nor file is specified, aliasByExternal is disabled")
+		return nil
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+
+	aliases := make(map[string]string)
+	if cfg.File != "" {
+		data, err := ioutil.ReadFile(cfg.File)
+		if err != nil {
+			logger.Error("failed to read aliases file",
+				zap.String("file", cfg.File),
+				zap.Error(err),
+			)
+			return nil
+		}
+		err = json.Unmarshal(data, &aliases)
+		if err != nil {
+			logger.Error("failed to parse aliases file",
+				zap.String("file", cfg.File),
+				zap.Error(err),
+			)
+			return nil
+		}
+	}
+
+	f := &aliasByExternal{
+		url:         cfg.URL,
+		aliases:     aliases,
+		ttl:         int32(cfg.TTL.Seconds()),
+		concurrency: cfg.Concurrency,
+		client:      &http.Client{Timeout: cfg.Timeout},
+		logger:      zapwriter.Logger("aliasByExternal"),
+		cache:       expirecache.New(cfg.CacheSize),
+	}
+	go f.cache.ApproximateCleaner(10 * time.Second)
+	res := make([]interfaces.FunctionMetadata, 0)
+	for _, n := range []string{"aliasByExternal"} {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// fetch asks lookup service for display name of the key
+func (f *aliasByExternal) fetch(ctx context.Context, key string) (string, bool, error) {
+	req, err := http.NewRequest("GET", f.url+"?key="+url.QueryEscape(key), nil)
+	if err != nil {
+		return "", false, err
+	}
+	resp, err := f.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", false, fmt.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", false, err
+	}
+	name := strings.TrimSpace(string(body))
+	return name, name != "", nil
+}
+
+// lookup returns display name for the key. Results of lookup service requests (including misses) are cached for ttl, errors are not cached
+func (f *aliasByExternal) lookup(ctx context.Context, key string) (string, bool) {
+	if name, ok := f.aliases[key]; ok {
+		return name, true
+	}
+	if f.url == "" {
+		return "", false
+	}
+
+	if v, ok := f.cache.Get(key); ok {
+		entry := v.(cacheEntry)
+		return entry.name, entry.found
+	}
+
+	name, found, err := f.fetch(ctx, key)
+	if err != nil {
+		f.logger.Warn("failed to lookup display name",
+			zap.String("key", key),
+			zap.Error(err),
+		)
+		return "", false
+	}
+
+	f.cache.Set(key, cacheEntry{name: name, found: found}, 1, f.ttl)
+	return name, found
+}
+
+// lookupAll returns display names of the keys that have them. Keys are looked up concurrently, at most concurrency
+// requests at a time
+func (f *aliasByExternal) lookupAll(ctx context.Context, keys map[string]struct{}) map[string]string {
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		names = make(map[string]string, len(keys))
+		sem   = make(chan struct{}, f.concurrency)
+	)
+	for key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if name, ok := f.lookup(ctx, key); ok {
+				mu.Lock()
+				names[key] = name
+				mu.Unlock()
+			}
+		}(key)
+	}
+	wg.Wait()
+	return names
+}
+
+// keyNodeIndex returns index of the key node in the nodes, ok is false if there is no such node
+func keyNodeIndex(nodes []string, keyNode int) (int, bool) {
+	n := keyNode
+	if n < 0 {
+		n += len(nodes)
+	}
+	return n, n >= 0 && n < len(nodes)
+}
+
+// aliasByExternal(seriesList, keyNode)
+func (f *aliasByExternal) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	args, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	keyNode, err := e.GetIntArg(1)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]struct{})
+	for _, a := range args {
+		metric := helper.ExtractMetric(a.Name)
+		nodes := strings.Split(metric, ".")
+		if n, ok := keyNodeIndex(nodes, keyNode); metric != "" && ok {
+			keys[nodes[n]] = struct{}{}
+		}
+	}
+	names := f.lookupAll(ctx, keys)
+
+	results := make([]*types.MetricData, 0, len(args))
+	for _, a := range args {
+		metric := helper.ExtractMetric(a.Name)
+		nodes := strings.Split(metric, ".")
+		n, ok := keyNodeIndex(nodes, keyNode)
+		if metric == "" || !ok {
+			results = append(results, a)
+			continue
+		}
+
+		name, ok := names[nodes[n]]
+		if !ok {
+			results = append(results, a)
+			continue
+		}
+		nodes[n] = name
+
+		r := a.Copy(true)
+		r.Name = strings.Join(nodes, ".")
+		r.Tags["name"] = r.Name
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// Description for aliasByExternal function
+func (f *aliasByExternal) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"aliasByExternal": {
+			Description: "Takes a seriesList and replaces the \"node\" portion of the target name with a display name\nlooked up in external key-value service (or aliases file). Node indices are 0 indexed.\nSeries without display name for the node are returned as-is.\n\n.. code-block:: none\n\n  &target=aliasByExternal(servers.*.cpu.load5,1)\n\n  # will produce output series like\n  # servers.frontend-1.cpu.load5, servers.frontend-2.cpu.load5",
+			Function:    "aliasByExternal(seriesList, keyNode)",
+			Group:       "Alias",
+			Module:      "graphite.render.functions",
+			Name:        "aliasByExternal",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "keyNode",
+					Required: true,
+					Type:     types.Node,
+				},
+			},
+		},
+	}
+}
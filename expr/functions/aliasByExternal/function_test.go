@@ -0,0 +1,189 @@
+package aliasByExternal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgryski/go-expirecache"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+var lookups int64
+
+// mock lookup endpoint
+var displayNames = map[string]string{
+	"host1": "frontend-1",
+	"host2": "frontend-2",
+}
+
+func TestMain(m *testing.M) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&lookups, 1)
+		name, ok := displayNames[r.URL.Query().Get("key")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(name))
+	}))
+
+	dir, err := ioutil.TempDir("", "aliasByExternal")
+	if err != nil {
+		panic(err)
+	}
+	aliasesFile := filepath.Join(dir, "aliases.json")
+	err = ioutil.WriteFile(aliasesFile, []byte(`{"db1": "database-1"}`), 0644)
+	if err != nil {
+		panic(err)
+	}
+	configFile := filepath.Join(dir, "aliasByExternal.yaml")
+	config := fmt.Sprintf("enabled: true\nurl: %q\nfile: %q\nttl: \"1m\"\ntimeout: \"1s\"\n", srv.URL+"/lookup", aliasesFile)
+	err = ioutil.WriteFile(configFile, []byte(config), 0644)
+	if err != nil {
+		panic(err)
+	}
+
+	md := New(configFile)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+	evaluator := th.EvaluatorFromFuncWithMetadata(metadata.FunctionMD.Functions)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+
+	code := m.Run()
+
+	srv.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestAliasByExternal(t *testing.T) {
+	now32 := time.Now().Unix()
+
+	tests := []th.EvalTestItem{
+		{
+			"aliasByExternal(servers.*.cpu,1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"servers.*.cpu", 0, 1}: {
+					types.MakeMetricData("servers.host1.cpu", []float64{1, 2, 3}, 1, now32),
+					types.MakeMetricData("servers.host2.cpu", []float64{4, 5, 6}, 1, now32),
+					types.MakeMetricData("servers.host3.cpu", []float64{7, 8, 9}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("servers.frontend-1.cpu", []float64{1, 2, 3}, 1, now32),
+				types.MakeMetricData("servers.frontend-2.cpu", []float64{4, 5, 6}, 1, now32),
+				types.MakeMetricData("servers.host3.cpu", []float64{7, 8, 9}, 1, now32),
+			},
+		},
+		{
+			"aliasByExternal(servers.*.cpu,-2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"servers.*.cpu", 0, 1}: {
+					types.MakeMetricData("servers.db1.cpu", []float64{1, 2, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("servers.database-1.cpu", []float64{1, 2, 3}, 1, now32),
+			},
+		},
+		{
+			"aliasByExternal(servers.*.cpu,5)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"servers.*.cpu", 0, 1}: {
+					types.MakeMetricData("servers.host1.cpu", []float64{1, 2, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("servers.host1.cpu", []float64{1, 2, 3}, 1, now32),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
+
+func TestAliasByExternalCache(t *testing.T) {
+	now32 := time.Now().Unix()
+
+	tt := th.EvalTestItem{
+		"aliasByExternal(servers.*.mem,1)",
+		map[parser.MetricRequest][]*types.MetricData{
+			{"servers.*.mem", 0, 1}: {
+				types.MakeMetricData("servers.host1.mem", []float64{1, 2, 3}, 1, now32),
+				types.MakeMetricData("servers.host4.mem", []float64{4, 5, 6}, 1, now32),
+			},
+		},
+		[]*types.MetricData{
+			types.MakeMetricData("servers.frontend-1.mem", []float64{1, 2, 3}, 1, now32),
+			types.MakeMetricData("servers.host4.mem", []float64{4, 5, 6}, 1, now32),
+		},
+	}
+
+	th.TestEvalExpr(t, &tt)
+	before := atomic.LoadInt64(&lookups)
+	th.TestEvalExpr(t, &tt)
+	if after := atomic.LoadInt64(&lookups); after != before {
+		t.Errorf("cached display names (and misses) should not be looked up again, got %v extra lookups", after-before)
+	}
+}
+
+func TestAliasByExternalLookupAll(t *testing.T) {
+	var inflight, maxInflight int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&inflight, 1)
+		defer atomic.AddInt64(&inflight, -1)
+		for {
+			m := atomic.LoadInt64(&maxInflight)
+			if n <= m || atomic.CompareAndSwapInt64(&maxInflight, m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("name-" + r.URL.Query().Get("key")))
+	}))
+	defer srv.Close()
+
+	f := &aliasByExternal{
+		url:         srv.URL,
+		ttl:         60,
+		concurrency: 2,
+		client:      &http.Client{Timeout: time.Second},
+		logger:      zap.NewNop(),
+		cache:       expirecache.New(2),
+	}
+
+	keys := map[string]struct{}{"a": {}, "b": {}, "c": {}, "d": {}}
+	names := f.lookupAll(context.Background(), keys)
+	for key := range keys {
+		if names[key] != "name-"+key {
+			t.Errorf("unexpected display name of '%v': '%v'", key, names[key])
+		}
+	}
+	if m := atomic.LoadInt64(&maxInflight); m != 2 {
+		t.Errorf("keys should be looked up concurrently, at most 2 at a time, got %v", m)
+	}
+	if n := f.cache.Items(); n > 2 {
+		t.Errorf("cache should be bounded by 2 entries, got %v", n)
+	}
+}
@@ -45,7 +45,6 @@ func (f *averageSeriesWithWildcards) Do(ctx context.Context, e parser.Expr, from
 
 	var results []*types.MetricData
 
-	nodeList := []string{}
 	groups := make(map[string][]*types.MetricData)
 
 	for _, a := range args {
@@ -63,14 +62,10 @@ func (f *averageSeriesWithWildcards) Do(ctx context.Context, e parser.Expr, from
 
 		node := strings.Join(s, ".")
 
-		if len(groups[node]) == 0 {
-			nodeList = append(nodeList, node)
-		}
-
 		groups[node] = append(groups[node], a)
 	}
 
-	for _, series := range nodeList {
+	for _, series := range helper.SortedGroupNames(groups) {
 		args := groups[series]
 		r := *args[0]
 		r.Name = fmt.Sprintf("averageSeriesWithWildcards(%s)", series)
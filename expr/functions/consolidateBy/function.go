@@ -2,6 +2,7 @@ package consolidateBy
 
 import (
 	"context"
+	"strings"
 
 	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/helper"
@@ -44,7 +45,8 @@ func (f *consolidateBy) Do(ctx context.Context, e parser.Expr, from, until int64
 	for _, a := range arg {
 		r := *a
 
-		r.AggregateFunction = consolidations.ConsolidationToFunc[name]
+		r.AggregateFunction = consolidations.ConsolidationToFunc[strings.ToLower(name)]
+		r.ConsolidationFunc = name
 
 		results = append(results, &r)
 	}
@@ -28,7 +28,7 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-// exclude(seriesList, pattern)
+// exclude(seriesList, pattern, ignoreCase=False)
 func (f *exclude) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
@@ -40,6 +40,14 @@ func (f *exclude) Do(ctx context.Context, e parser.Expr, from, until int64, valu
 		return nil, err
 	}
 
+	ignoreCase, err := e.GetBoolNamedOrPosArgDefault("ignoreCase", 2, false)
+	if err != nil {
+		return nil, err
+	}
+	if ignoreCase {
+		pat = "(?i)" + pat
+	}
+
 	patre, err := regexp.Compile(pat)
 	if err != nil {
 		return nil, err
@@ -60,8 +68,8 @@ func (f *exclude) Do(ctx context.Context, e parser.Expr, from, until int64, valu
 func (f *exclude) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"exclude": {
-			Description: "Takes a metric or a wildcard seriesList, followed by a regular expression\nin double quotes.  Excludes metrics that match the regular expression.\n\nExample:\n\n.. code-block:: none\n\n  &target=exclude(servers*.instance*.threads.busy,\"server02\")",
-			Function:    "exclude(seriesList, pattern)",
+			Description: "Takes a metric or a wildcard seriesList, followed by a regular expression\nin double quotes.  Excludes metrics that match the regular expression.\nIf ignoreCase is true, pattern is matched case-insensitively.\n\nExample:\n\n.. code-block:: none\n\n  &target=exclude(servers*.instance*.threads.busy,\"server02\")\n  &target=exclude(servers*.instance*.threads.busy,\"SERVER02\",true)",
+			Function:    "exclude(seriesList, pattern, ignoreCase=False)",
 			Group:       "Filter Series",
 			Module:      "graphite.render.functions",
 			Name:        "exclude",
@@ -76,6 +84,11 @@ func (f *exclude) Description() map[string]types.FunctionDescription {
 					Required: true,
 					Type:     types.String,
 				},
+				{
+					Default: types.NewSuggestion(false),
+					Name:    "ignoreCase",
+					Type:    types.Boolean,
+				},
 			},
 		},
 	}
@@ -37,6 +37,47 @@ func TestExclude(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("metricBar", // NOTE(dgryski): not sure if this matches graphite
 				[]float64{2, 2, 2, 2, 2}, 1, now32)},
 		},
+		{
+			"exclude(metric1,\"(foo|baz)\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metricFoo", []float64{1, 1, 1, 1, 1}, 1, now32),
+					types.MakeMetricData("metricBar", []float64{2, 2, 2, 2, 2}, 1, now32),
+					types.MakeMetricData("metricBaz", []float64{3, 3, 3, 3, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metricFoo", []float64{1, 1, 1, 1, 1}, 1, now32),
+				types.MakeMetricData("metricBar", []float64{2, 2, 2, 2, 2}, 1, now32),
+				types.MakeMetricData("metricBaz", []float64{3, 3, 3, 3, 3}, 1, now32),
+			},
+		},
+		{
+			"exclude(metric1,\"(foo|baz)\",true)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metricFoo", []float64{1, 1, 1, 1, 1}, 1, now32),
+					types.MakeMetricData("metricBar", []float64{2, 2, 2, 2, 2}, 1, now32),
+					types.MakeMetricData("metricBaz", []float64{3, 3, 3, 3, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metricBar", []float64{2, 2, 2, 2, 2}, 1, now32),
+			},
+		},
+		{
+			"exclude(metric1,\"(foo|baz)\",ignoreCase=true)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {
+					types.MakeMetricData("metricFoo", []float64{1, 1, 1, 1, 1}, 1, now32),
+					types.MakeMetricData("metricBar", []float64{2, 2, 2, 2, 2}, 1, now32),
+					types.MakeMetricData("metricBaz", []float64{3, 3, 3, 3, 3}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metricBar", []float64{2, 2, 2, 2, 2}, 1, now32),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,161 @@
+package exponentialMovingAverage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type exponentialMovingAverage struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &exponentialMovingAverage{}
+	functions := []string{"exponentialMovingAverage"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// exponentialMovingAverage(seriesList, windowSize)
+func (f *exponentialMovingAverage) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	var n int
+	var err error
+
+	var seconds int64
+	var argstr string
+
+	if len(e.Args()) < 2 {
+		return nil, parser.ErrMissingArgument
+	}
+
+	switch e.Args()[1].Type() {
+	case parser.EtConst:
+		// zipper does not request additional retrospective points, so the window is taken from the requested range
+		// and leading values are NaN
+		n, err = e.GetIntArg(1)
+		argstr = strconv.Itoa(n)
+	case parser.EtString:
+		var n32 int32
+		n32, err = e.GetIntervalArg(1, 1)
+		argstr = fmt.Sprintf("%q", e.Args()[1].StringValue())
+		// like in graphite-web, sign of the interval doesn't matter
+		seconds = int64(n32)
+		if seconds < 0 {
+			seconds = -seconds
+		}
+	default:
+		err = parser.ErrBadType
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	arg, err := helper.GetSeriesArg(e.Args()[0], from-seconds, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*types.MetricData
+	for _, a := range arg {
+		// window of the interval is converted to points by step of each series, as steps can be different
+		windowPoints, offset := n, 0
+		if seconds != 0 {
+			windowPoints = int(seconds / a.StepTime)
+			offset = windowPoints
+		}
+		if offset > len(a.Values) {
+			offset = len(a.Values)
+		}
+
+		r := *a
+		r.Name = fmt.Sprintf("exponentialMovingAverage(%s,%s)", a.Name, argstr)
+		r.Values = make([]float64, len(a.Values)-offset)
+		r.StartTime = (from + r.StepTime - 1) / r.StepTime * r.StepTime // align StartTime to closest >= StepTime
+		r.StopTime = r.StartTime + int64(len(r.Values))*r.StepTime
+
+		for i := range r.Values {
+			r.Values[i] = math.NaN()
+		}
+		if windowPoints <= 0 || windowPoints > len(a.Values) {
+			result = append(result, &r)
+			continue
+		}
+
+		// the first window is seeded with simple average, NaNs are skipped and window without values counts as 0
+		ema := 0.0
+		count := 0
+		for _, v := range a.Values[:windowPoints] {
+			if !math.IsNaN(v) {
+				ema += v
+				count++
+			}
+		}
+		if count > 0 {
+			ema /= float64(count)
+		}
+		if ridx := windowPoints - 1 - offset; ridx >= 0 {
+			r.Values[ridx] = ema
+		}
+
+		alpha := 2 / (float64(windowPoints) + 1)
+		for i := windowPoints; i < len(a.Values); i++ {
+			v := a.Values[i]
+			if math.IsNaN(v) {
+				continue
+			}
+			ema = alpha*v + (1-alpha)*ema
+			r.Values[i-offset] = ema
+		}
+		result = append(result, &r)
+	}
+	return result, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *exponentialMovingAverage) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"exponentialMovingAverage": {
+			Description: "Takes a series of values and a window size and produces an exponential moving\naverage utilizing the following formula:\n\n.. code-block:: none\n\n  ema(current) = constant * (Current Value) + (1 - constant) * ema(previous)\n\nThe Constant is calculated as:\n\n.. code-block:: none\n\n  constant = 2 / (windowSize + 1)\n\nThe first period EMA uses a simple moving average for its value.\n\nExample:\n\n.. code-block:: none\n\n  &target=exponentialMovingAverage(*.transactions.count, 10)\n  &target=exponentialMovingAverage(*.transactions.count, '-10s')",
+			Function:    "exponentialMovingAverage(seriesList, windowSize)",
+			Group:       "Calculate",
+			Module:      "graphite.render.functions",
+			Name:        "exponentialMovingAverage",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "windowSize",
+					Required: true,
+					Suggestions: types.NewSuggestions(
+						5,
+						7,
+						10,
+						"1min",
+						"5min",
+						"10min",
+						"30min",
+						"1hour",
+					),
+					Type: types.IntOrInterval,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,112 @@
+package exponentialMovingAverage
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestExponentialMovingAverage(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	tests := []th.EvalTestItem{
+		{
+			// constant is 2/(3+1), first window is seeded with its average
+			"exponentialMovingAverage(metric1,3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6, math.NaN(), 8}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("exponentialMovingAverage(metric1,3)", []float64{math.NaN(), math.NaN(), 2, 3, 4, 5, math.NaN(), 6.5}, 1, 0)}, // StartTime = from
+		},
+		{
+			"exponentialMovingAverage(metric1,2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{math.NaN(), 4, 7}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("exponentialMovingAverage(metric1,2)", []float64{math.NaN(), 4, 6}, 1, 0)}, // StartTime = from
+		},
+		{
+			// window before from is fetched, so the whole requested range has values
+			"exponentialMovingAverage(metric1,'3s')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -3, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData(`exponentialMovingAverage(metric1,"3s")`, []float64{3, 4, 5}, 1, 0)}, // StartTime = from
+		},
+		{
+			"exponentialMovingAverage(metric1,'-3s')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -3, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5, 6}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData(`exponentialMovingAverage(metric1,"-3s")`, []float64{3, 4, 5}, 1, 0)}, // StartTime = from
+		},
+		{
+			// window of 4 seconds is 2 points of 2 seconds
+			"exponentialMovingAverage(metric1,'4s')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -4, 1}: {types.MakeMetricData("metric1", []float64{2, 4, 6, 8, 10}, 2, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData(`exponentialMovingAverage(metric1,"4s")`, []float64{5, 7, 9}, 2, 0)}, // StartTime = from
+		},
+		{
+			// window is longer than the series
+			"exponentialMovingAverage(metric1,10)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("exponentialMovingAverage(metric1,10)", []float64{math.NaN(), math.NaN(), math.NaN()}, 1, 0)}, // StartTime = from
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
+
+func TestExponentialMovingAverageDifferentSteps(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	// the same interval is 3 points for the first series and 2 points for the second one
+	tests := []th.MultiReturnEvalTestItem{
+		{
+			"exponentialMovingAverage(metric*,'6s')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", -6, 1}: {
+					types.MakeMetricData("metric1", []float64{2, 2, 2, 6, 10}, 2, now32),
+					types.MakeMetricData("metric2", []float64{2, 4, 6}, 3, now32),
+				},
+			},
+			"exponentialMovingAverage",
+			map[string][]*types.MetricData{
+				`exponentialMovingAverage(metric1,"6s")`: {types.MakeMetricData(`exponentialMovingAverage(metric1,"6s")`, []float64{4, 7}, 2, 0)},
+				`exponentialMovingAverage(metric2,"6s")`: {types.MakeMetricData(`exponentialMovingAverage(metric2,"6s")`, []float64{5}, 3, 0)},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestMultiReturnEvalExpr(t, &tt)
+		})
+	}
+}
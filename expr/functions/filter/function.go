@@ -70,6 +70,7 @@ func (f *filterSeries) Do(ctx context.Context, e parser.Expr, from, until int64,
 
 	var results []*types.MetricData
 	for _, a := range args {
+		// aggregate of series without points is NaN, so it's kept only by '!='
 		val := aggFunc(a.Values)
 		keepSeries := false
 		switch operator {
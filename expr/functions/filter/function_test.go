@@ -117,3 +117,49 @@ func TestConstantLine(t *testing.T) {
 	}
 
 }
+
+func TestFilterSeriesNaN(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+	nan := math.NaN()
+
+	series := map[string]*types.MetricData{
+		"metricNaN": types.MakeMetricData("metricNaN", []float64{nan, nan, nan}, 1, now32),
+		"metric0":   types.MakeMetricData("metric0", []float64{nan, 0, nan}, 1, now32),
+		"metric1":   types.MakeMetricData("metric1", []float64{nan, 1, nan}, 1, now32),
+		"metric2":   types.MakeMetricData("metric2", []float64{nan, 2, nan}, 1, now32),
+	}
+	order := []string{"metricNaN", "metric0", "metric1", "metric2"}
+
+	expected := map[string][]string{
+		"=":  {"metric1"},
+		"!=": {"metricNaN", "metric0", "metric2"},
+		">":  {"metric2"},
+		">=": {"metric1", "metric2"},
+		"<":  {"metric0"},
+		"<=": {"metric0", "metric1"},
+	}
+
+	for _, aggregation := range []string{"max", "min", "sum", "average", "last", "median"} {
+		for operator, names := range expected {
+			input := make([]*types.MetricData, 0, len(order))
+			for _, name := range order {
+				input = append(input, series[name])
+			}
+			want := make([]*types.MetricData, 0, len(names))
+			for _, name := range names {
+				want = append(want, series[name])
+			}
+
+			tt := th.EvalTestItem{
+				Target: "filterSeries(metric*, '" + aggregation + "', '" + operator + "', 1)",
+				M: map[parser.MetricRequest][]*types.MetricData{
+					{"metric*", 0, 1}: input,
+				},
+				Want: want,
+			}
+			t.Run(tt.Target, func(t *testing.T) {
+				th.TestEvalExpr(t, &tt)
+			})
+		}
+	}
+}
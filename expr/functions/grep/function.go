@@ -28,7 +28,7 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-// grep(seriesList, pattern)
+// grep(seriesList, pattern, ignoreCase=False)
 func (f *grep) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
@@ -40,6 +40,14 @@ func (f *grep) Do(ctx context.Context, e parser.Expr, from, until int64, values
 		return nil, err
 	}
 
+	ignoreCase, err := e.GetBoolNamedOrPosArgDefault("ignoreCase", 2, false)
+	if err != nil {
+		return nil, err
+	}
+	if ignoreCase {
+		pat = "(?i)" + pat
+	}
+
 	patre, err := regexp.Compile(pat)
 	if err != nil {
 		return nil, err
@@ -60,8 +68,8 @@ func (f *grep) Do(ctx context.Context, e parser.Expr, from, until int64, values
 func (f *grep) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"grep": {
-			Description: "Takes a metric or a wildcard seriesList, followed by a regular expression\nin double quotes.  Excludes metrics that don't match the regular expression.\n\nExample:\n\n.. code-block:: none\n\n  &target=grep(servers*.instance*.threads.busy,\"server02\")",
-			Function:    "grep(seriesList, pattern)",
+			Description: "Takes a metric or a wildcard seriesList, followed by a regular expression\nin double quotes.  Excludes metrics that don't match the regular expression.\nIf ignoreCase is true, pattern is matched case-insensitively.\n\nExample:\n\n.. code-block:: none\n\n  &target=grep(servers*.instance*.threads.busy,\"server02\")\n  &target=grep(servers*.instance*.threads.busy,\"SERVER02\",true)",
+			Function:    "grep(seriesList, pattern, ignoreCase=False)",
 			Group:       "Filter Series",
 			Module:      "graphite.render.functions",
 			Name:        "grep",
@@ -76,6 +84,11 @@ func (f *grep) Description() map[string]types.FunctionDescription {
 					Required: true,
 					Type:     types.String,
 				},
+				{
+					Default: types.NewSuggestion(false),
+					Name:    "ignoreCase",
+					Type:    types.Boolean,
+				},
 			},
 		},
 	}
@@ -66,7 +66,6 @@ func (f *groupByNode) Do(ctx context.Context, e parser.Expr, from, until int64,
 	var results []*types.MetricData
 
 	groups := make(map[string][]*types.MetricData)
-	nodeList := []string{}
 
 	for _, a := range args {
 
@@ -77,14 +76,11 @@ func (f *groupByNode) Do(ctx context.Context, e parser.Expr, from, until int64,
 			nodeKey = append(nodeKey, nodes[f])
 		}
 		node := strings.Join(nodeKey, ".")
-		if len(groups[node]) == 0 {
-			nodeList = append(nodeList, node)
-		}
 
 		groups[node] = append(groups[node], a)
 	}
 
-	for _, k := range nodeList {
+	for _, k := range helper.SortedGroupNames(groups) {
 		k := k // k's reference is used later, so it's important to make it unique per loop
 		v := groups[k]
 
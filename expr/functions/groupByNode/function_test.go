@@ -1,6 +1,8 @@
 package groupByNode
 
 import (
+	"context"
+	"reflect"
 	"testing"
 	"time"
 
@@ -105,3 +107,38 @@ func TestGroupByNode(t *testing.T) {
 	}
 
 }
+
+func TestGroupByNodeOrder(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+	series := []*types.MetricData{
+		types.MakeMetricData("metric1.foo.bar1.qux", []float64{1, 2, 3}, 1, now32),
+		types.MakeMetricData("metric1.foo.bar2.baz", []float64{4, 5, 6}, 1, now32),
+		types.MakeMetricData("metric1.foo.bar3.quux", []float64{7, 8, 9}, 1, now32),
+		types.MakeMetricData("metric1.foo.bar4.bar", []float64{10, 11, 12}, 1, now32),
+	}
+	expected := []string{"bar", "baz", "quux", "qux"}
+
+	exp, _, err := parser.ParseExpr(`groupByNode(metric1.foo.*.*,3,"sum")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluator := metadata.GetEvaluator()
+	// output order must not depend on order of fetched series
+	for i := 0; i < len(series); i++ {
+		rotated := append(append([]*types.MetricData{}, series[i:]...), series[:i]...)
+		values := map[parser.MetricRequest][]*types.MetricData{
+			{"metric1.foo.*.*", 0, 1}: rotated,
+		}
+		res, err := evaluator.Eval(context.Background(), exp, 0, 1, values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range res {
+			names = append(names, r.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("unexpected order of series: got %v, expected %v", names, expected)
+		}
+	}
+}
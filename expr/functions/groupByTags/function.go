@@ -77,9 +77,9 @@ func (f *groupByTags) Do(ctx context.Context, e parser.Expr, from, until int64,
 		}
 	}
 
-	for k, v := range groups {
+	for _, k := range helper.SortedGroupNames(groups) {
 		k := k // k's reference is used later, so it's important to make it unique per loop
-		v := v
+		v := groups[k]
 
 		var expr string
 		_, ok := consolidations.ConsolidationToFunc[callback]
@@ -1,6 +1,8 @@
 package groupByTags
 
 import (
+	"context"
+	"reflect"
 	"testing"
 	"time"
 
@@ -87,3 +89,36 @@ func TestGroupByNode(t *testing.T) {
 	}
 
 }
+
+func TestGroupByTagsOrder(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+	values := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1.foo.*", 0, 1}: {
+			types.MakeMetricData("metric1.foo;cpu=cpu1;dc=dc3", []float64{1, 2, 3}, 1, now32),
+			types.MakeMetricData("metric1.foo;cpu=cpu2;dc=dc1", []float64{4, 5, 6}, 1, now32),
+			types.MakeMetricData("metric1.foo;cpu=cpu3;dc=dc4", []float64{7, 8, 9}, 1, now32),
+			types.MakeMetricData("metric1.foo;cpu=cpu4;dc=dc2", []float64{10, 11, 12}, 1, now32),
+		},
+	}
+	expected := []string{"metric1.foo;dc=dc1", "metric1.foo;dc=dc2", "metric1.foo;dc=dc3", "metric1.foo;dc=dc4"}
+
+	exp, _, err := parser.ParseExpr(`groupByTags(metric1.foo.*, "sum", "dc")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluator := metadata.GetEvaluator()
+	// groups are kept in a map, so repeated evaluations would catch random order
+	for i := 0; i < 20; i++ {
+		res, err := evaluator.Eval(context.Background(), exp, 0, 1, th.DeepClone(values))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, r := range res {
+			names = append(names, r.Name)
+		}
+		if !reflect.DeepEqual(names, expected) {
+			t.Fatalf("unexpected order of series: got %v, expected %v", names, expected)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package holtWintersForecast
+
+import (
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func TestHoltWintersForecast(t *testing.T) {
+	// four points per day with a clear daily pattern
+	daily := []float64{1, 5, 9, 5, 1, 5, 9, 5, 1, 5, 9, 5}
+
+	tests := []th.EvalTestItem{
+		{
+			"holtWintersForecast(metric1,\"2d\",\"1d\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -172800, 1}: {types.MakeMetricData("metric1", daily, 21600, 0)},
+			},
+			[]*types.MetricData{types.MakeMetricData("holtWintersForecast(metric1)",
+				[]float64{3.1730247078385916, 3.6631758880503806, 4.437804308073623, 4.100552090012371}, 21600, 172800)},
+		},
+		{
+			"holtWintersForecast(metric1,bootstrapInterval=\"2d\",seasonality=\"12h\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", -172800, 1}: {types.MakeMetricData("metric1", daily, 21600, 0)},
+			},
+			[]*types.MetricData{types.MakeMetricData("holtWintersForecast(metric1)",
+				[]float64{4.216256585119146, 3.7464541705144807, 3.7436987874801804, 4.525712816418533}, 21600, 172800)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
@@ -50,6 +50,24 @@ func TestFunction(t *testing.T) {
 				types.MakeMetricData("servers.server4.cpu.total", []float64{12, 13, 14}, 1, now32),
 			},
 		},
+		{
+			// groups are returned in order of their first appearance, like in graphite-web
+			"mapSeries(servers.*.cpu.*, 1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"servers.*.cpu.*", 0, 1}: {
+					types.MakeMetricData("servers.server2.cpu.valid", []float64{6, 7, 8}, 1, now32),
+					types.MakeMetricData("servers.server1.cpu.valid", []float64{1, 2, 3}, 1, now32),
+					types.MakeMetricData("servers.server2.cpu.total", []float64{5, 7, 8}, 1, now32),
+					types.MakeMetricData("servers.server1.cpu.total", []float64{1, 2, 4}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("servers.server2.cpu.valid", []float64{6, 7, 8}, 1, now32),
+				types.MakeMetricData("servers.server2.cpu.total", []float64{5, 7, 8}, 1, now32),
+				types.MakeMetricData("servers.server1.cpu.valid", []float64{1, 2, 3}, 1, now32),
+				types.MakeMetricData("servers.server1.cpu.total", []float64{1, 2, 4}, 1, now32),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -46,7 +46,6 @@ func (f *multiplySeriesWithWildcards) Do(ctx context.Context, e parser.Expr, fro
 
 	var results []*types.MetricData
 
-	nodeList := []string{}
 	groups := make(map[string][]*types.MetricData)
 
 	for _, a := range args {
@@ -64,14 +63,10 @@ func (f *multiplySeriesWithWildcards) Do(ctx context.Context, e parser.Expr, fro
 
 		node := strings.Join(s, ".")
 
-		if len(groups[node]) == 0 {
-			nodeList = append(nodeList, node)
-		}
-
 		groups[node] = append(groups[node], a)
 	}
 
-	for _, series := range nodeList {
+	for _, series := range helper.SortedGroupNames(groups) {
 		args := groups[series]
 		r := *args[0]
 		r.Name = fmt.Sprintf("multiplySeriesWithWildcards(%s)", series)
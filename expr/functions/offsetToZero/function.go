@@ -2,8 +2,8 @@ package offsetToZero
 
 import (
 	"context"
-	"math"
 
+	"github.com/go-graphite/carbonapi/expr/consolidations"
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
@@ -31,13 +31,8 @@ func New(configFile string) []interfaces.FunctionMetadata {
 // offsetToZero(seriesList)
 func (f *offsetToZero) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	return helper.ForEachSeriesDo(e, from, until, values, func(a *types.MetricData, r *types.MetricData) *types.MetricData {
-		minimum := math.Inf(1)
-		for _, v := range a.Values {
-			// NaN < val is always false
-			if v < minimum {
-				minimum = v
-			}
-		}
+		// absent points are skipped, so leading or trailing gaps don't affect the offset, like in graphite-web
+		minimum := consolidations.MinValue(a.Values)
 		for i, v := range a.Values {
 			r.Values[i] = v - minimum
 		}
@@ -34,6 +34,23 @@ func TestFunction(t *testing.T) {
 			[]*types.MetricData{types.MakeMetricData("offsetToZero(metric1)",
 				[]float64{0, 1, 2, math.NaN(), 4, 5, 6, 7, 8}, 1, now32)},
 		},
+		{
+			// absent points must not be taken as the minimum, neither in a leading gap nor in the middle
+			"offsetToZero(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{math.NaN(), math.NaN(), math.NaN(), 12, math.NaN(), 10, 15, math.NaN()}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("offsetToZero(metric1)",
+				[]float64{math.NaN(), math.NaN(), math.NaN(), 2, math.NaN(), 0, 5, math.NaN()}, 1, now32)},
+		},
+		{
+			"offsetToZero(metric1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{math.NaN(), math.NaN(), math.NaN()}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("offsetToZero(metric1)",
+				[]float64{math.NaN(), math.NaN(), math.NaN()}, 1, now32)},
+		},
 	}
 
 	for _, tt := range tests {
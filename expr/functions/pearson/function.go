@@ -23,15 +23,23 @@ func GetOrder() interfaces.Order {
 func New(configFile string) []interfaces.FunctionMetadata {
 	res := make([]interfaces.FunctionMetadata, 0)
 	f := &pearson{}
-	functions := []string{"pearson"}
+	functions := []string{"pearson", "correlate"}
 	for _, n := range functions {
 		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
 	}
 	return res
 }
 
+// minCorrelatePairs is the least amount of non-null pairs in the window correlate computes coefficient for
+const minCorrelatePairs = 2
+
 // pearson(series, series, windowSize)
+// correlate(series, seriesList, windowSize)
 func (f *pearson) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	if e.Target() == "correlate" {
+		return correlate(e, from, until, values)
+	}
+
 	arg1, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
 		return nil, err
@@ -78,6 +86,70 @@ func (f *pearson) Do(ctx context.Context, e parser.Expr, from, until int64, valu
 	return []*types.MetricData{&r}, nil
 }
 
+// correlate computes rolling Pearson coefficient of the first series and each series of the second argument,
+// over the last windowSize points. Points with less than minCorrelatePairs non-null pairs in the window are absent
+func correlate(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	if len(e.Args()) < 3 {
+		return nil, parser.ErrMissingArgument
+	}
+
+	arg1, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+	if len(arg1) != 1 {
+		return nil, types.ErrWildcardNotAllowed
+	}
+	arg2, err := helper.GetSeriesArg(e.Args()[1], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+
+	windowSize, err := e.GetIntArg(2)
+	if err != nil {
+		return nil, err
+	}
+	if windowSize < minCorrelatePairs {
+		return nil, fmt.Errorf("windowSize must be at least %d, got %d", minCorrelatePairs, windowSize)
+	}
+
+	results := make([]*types.MetricData, 0, len(arg2))
+	for _, a2 := range arg2 {
+		args := []*types.MetricData{arg1[0], a2}
+		if !helper.ExtrapolatePoints {
+			args = helper.ScaleToCommonStep(args, 0)
+		}
+		args = helper.AlignSeries(args)
+
+		r := *args[0]
+		r.Name = fmt.Sprintf("correlate(%s,%s)", arg1[0].Name, a2.Name)
+		r.Values = make([]float64, len(args[0].Values))
+		for i := range r.Values {
+			start := i - windowSize + 1
+			if start < 0 {
+				start = 0
+			}
+			w1, w2 := args[0].Values[start:i+1], args[1].Values[start:i+1]
+
+			pairs := 0
+			for j := range w1 {
+				if !math.IsNaN(w1[j]) && !math.IsNaN(w2[j]) {
+					pairs++
+				}
+			}
+			if pairs < minCorrelatePairs {
+				r.Values[i] = math.NaN()
+				continue
+			}
+			// coefficient of constant series is undefined, it's NaN as well
+			r.Values[i] = onlinestats.Pearson(w1, w2)
+		}
+		results = append(results, &r)
+	}
+
+	return results, nil
+}
+
 func (f *pearson) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"pearson": {
@@ -118,5 +190,29 @@ and will manifest as if the entire window/series had missing values.`,
 				},
 			},
 		},
+		"correlate": {
+			Description: "Calculates rolling Pearson correlation coefficient of seriesA and each series of seriesList over the last\nwindowSize points. Points are absent if there are less than 2 pairs of non-null values in the window.\n\nExample:\n\n.. code-block:: none\n\n  &target=correlate(Server.instance01.requests,Server.instance*.cpu,10)",
+			Function:    "correlate(seriesA, seriesList, windowSize)",
+			Group:       "Combine",
+			Module:      "graphite.render.functions.custom",
+			Name:        "correlate",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesA",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "windowSize",
+					Required: true,
+					Type:     types.Integer,
+				},
+			},
+		},
 	}
 }
@@ -34,6 +34,39 @@ func TestFunction(t *testing.T) {
 			},
 			[]*types.MetricData{types.MakeMetricData("pearson(metric1,metric2,6)", []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), 0.5298089018901744}, 1, 0)}, // StartTime = from
 		},
+		{
+			// perfectly correlated and anti-correlated series, the first window has a single pair
+			"correlate(metric1,metric[23],3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4, 5}, 1, now32)},
+				{"metric[23]", 0, 1}: {
+					types.MakeMetricData("metric2", []float64{2, 4, 6, 8, 10}, 1, now32),
+					types.MakeMetricData("metric3", []float64{10, 8, 6, 4, 2}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("correlate(metric1,metric2)", []float64{math.NaN(), 1, 1, 1, 1}, 1, now32),
+				types.MakeMetricData("correlate(metric1,metric3)", []float64{math.NaN(), -1, -1, -1, -1}, 1, now32),
+			},
+		},
+		{
+			// uncorrelated in the whole window of the last point
+			"correlate(metric1,metric2,4)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, 3, 4}, 1, now32)},
+				{"metric2", 0, 1}: {types.MakeMetricData("metric2", []float64{1, -1, -1, 1}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("correlate(metric1,metric2)", []float64{math.NaN(), -1, -math.Sqrt(3) / 2, 0}, 1, now32)},
+		},
+		{
+			// windows with less than 2 non-null pairs
+			"correlate(metric1,metric2,2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2, math.NaN(), 4, 5, 6}, 1, now32)},
+				{"metric2", 0, 1}: {types.MakeMetricData("metric2", []float64{1, 2, 3, 4, math.NaN(), 3}, 1, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("correlate(metric1,metric2)", []float64{math.NaN(), 1, math.NaN(), math.NaN(), math.NaN(), math.NaN()}, 1, now32)},
+		},
 	}
 
 	for _, tt := range tests {
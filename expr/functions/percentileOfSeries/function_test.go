@@ -80,3 +80,62 @@ func TestPercentileOfSeriesSeries(t *testing.T) {
 	}
 
 }
+
+func TestPercentileOfSeriesInterpolation(t *testing.T) {
+	now32 := int64(time.Now().Unix())
+
+	// values at every timestamp sorted are [15 20 35 40 50] and [1 1 3 4 5], rank of percentile is 4*n/100,
+	// interpolated value is the same as of numpy.percentile with default (linear) interpolation
+	series := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1.*", 0, 1}: {
+			types.MakeMetricData("metric1.a", []float64{15, 3}, 1, now32),
+			types.MakeMetricData("metric1.b", []float64{20, 1}, 1, now32),
+			types.MakeMetricData("metric1.c", []float64{35, 4}, 1, now32),
+			types.MakeMetricData("metric1.d", []float64{40, 1}, 1, now32),
+			types.MakeMetricData("metric1.e", []float64{50, 5}, 1, now32),
+		},
+	}
+
+	tests := []th.EvalTestItem{
+		// rank is 2, there is nothing to interpolate
+		{
+			`percentileOfSeries(metric1.*,50)`,
+			series,
+			[]*types.MetricData{types.MakeMetricData("percentileOfSeries(metric1.*,50)", []float64{35, 3}, 1, now32)},
+		},
+		{
+			`percentileOfSeries(metric1.*,50,true)`,
+			series,
+			[]*types.MetricData{types.MakeMetricData("percentileOfSeries(metric1.*,50,true)", []float64{35, 3}, 1, now32)},
+		},
+		// rank is 3.6
+		{
+			`percentileOfSeries(metric1.*,90)`,
+			series,
+			[]*types.MetricData{types.MakeMetricData("percentileOfSeries(metric1.*,90)", []float64{50, 5}, 1, now32)},
+		},
+		{
+			`percentileOfSeries(metric1.*,90,true)`,
+			series,
+			[]*types.MetricData{types.MakeMetricData("percentileOfSeries(metric1.*,90,true)", []float64{46, 4.6}, 1, now32)},
+		},
+		// rank is 3.96
+		{
+			`percentileOfSeries(metric1.*,99,false)`,
+			series,
+			[]*types.MetricData{types.MakeMetricData("percentileOfSeries(metric1.*,99,false)", []float64{50, 5}, 1, now32)},
+		},
+		{
+			`percentileOfSeries(metric1.*,99,interpolate=true)`,
+			series,
+			[]*types.MetricData{types.MakeMetricData("percentileOfSeries(metric1.*,99,interpolate=true)", []float64{49.6, 4.96}, 1, now32)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
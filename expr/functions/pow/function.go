@@ -22,15 +22,46 @@ func GetOrder() interfaces.Order {
 func New(configFile string) []interfaces.FunctionMetadata {
 	res := make([]interfaces.FunctionMetadata, 0)
 	f := &pow{}
-	functions := []string{"pow"}
+	functions := []string{"pow", "powSeries"}
 	for _, n := range functions {
 		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
 	}
 	return res
 }
 
+// safePow returns x**y, result is absent if any of the arguments is, if it's not a real number
+// (e.x. negative base with fractional exponent) or if it's infinite, like in graphite-web
+func safePow(x, y float64) float64 {
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return math.NaN()
+	}
+	v := math.Pow(x, y)
+	if math.IsInf(v, 0) {
+		return math.NaN()
+	}
+	return v
+}
+
+// powChain raises the first value to the power of the second one, the result to the power of the third one and so on
+func powChain(values []float64) float64 {
+	v := values[0]
+	for _, exp := range values[1:] {
+		v = safePow(v, exp)
+	}
+	return v
+}
+
 // pow(seriesList,factor)
+// powSeries(*seriesLists)
 func (f *pow) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	if e.Target() == "powSeries" {
+		args, err := helper.GetSeriesArgsAndRemoveNonExisting(e, from, until, values)
+		if err != nil {
+			return nil, err
+		}
+		return helper.AggregateSeries(e, args, powChain)
+	}
+
 	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
 	if err != nil {
 		return nil, err
@@ -47,11 +78,7 @@ func (f *pow) Do(ctx context.Context, e parser.Expr, from, until int64, values m
 		r.Values = make([]float64, len(a.Values))
 
 		for i, v := range a.Values {
-			if math.IsNaN(v) {
-				r.Values[i] = math.NaN()
-			} else {
-				r.Values[i] = math.Pow(v, factor)
-			}
+			r.Values[i] = safePow(v, factor)
 		}
 		results = append(results, &r)
 	}
@@ -80,5 +107,20 @@ func (f *pow) Description() map[string]types.FunctionDescription {
 				},
 			},
 		},
+		"powSeries": {
+			Description: "Takes two or more series and pows their points. A constant line may be\nused.\n\nExample:\n\n.. code-block:: none\n\n  &target=powSeries(Server.instance01.app.requests, Server.instance01.app.replies)",
+			Function:    "powSeries(*seriesLists)",
+			Group:       "Combine",
+			Module:      "graphite.render.functions",
+			Name:        "powSeries",
+			Params: []types.FunctionParam{
+				{
+					Multiple: true,
+					Name:     "seriesLists",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+			},
+		},
 	}
 }
@@ -40,6 +40,50 @@ func TestFunction(t *testing.T) {
 			},
 			[]*types.MetricData{types.MakeMetricData("pow(metric1,0)", []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN()}, 60, now32)},
 		},
+		{
+			// square root of negative value isn't a real number, it's absent like in graphite-web
+			"pow(metric1,0.5)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{4, -4, math.NaN(), 0, 2.25}, 60, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("pow(metric1,0.5)", []float64{2, math.NaN(), math.NaN(), 0, 1.5}, 60, now32)},
+		},
+		{
+			"pow(metric1,-1)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{-4, 0, 0.5}, 60, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("pow(metric1,-1)", []float64{-0.25, math.NaN(), 2}, 60, now32)},
+		},
+		{
+			"powSeries(metric1,metric2)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{2, -8, 4, math.NaN(), 1e200}, 60, now32)},
+				{"metric2", 0, 1}: {types.MakeMetricData("metric2", []float64{3, 1.0 / 3, 0.5, 2, 2}, 60, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("powSeries(metric1,metric2)", []float64{8, math.NaN(), 2, math.NaN(), math.NaN()}, 60, now32)},
+		},
+		{
+			// series are chained in order of arguments: (metric1^metric2)^metric3
+			"powSeries(metric1,metric2,metric3)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{2, 3, 2, 2}, 60, now32)},
+				{"metric2", 0, 1}: {types.MakeMetricData("metric2", []float64{3, 2, math.NaN(), 0.5}, 60, now32)},
+				{"metric3", 0, 1}: {types.MakeMetricData("metric3", []float64{2, 0.5, 1, 4}, 60, now32)},
+			},
+			[]*types.MetricData{types.MakeMetricData("powSeries(metric1,metric2,metric3)", []float64{64, 3, math.NaN(), 4}, 60, now32)},
+		},
+		{
+			"powSeries(metric*)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					types.MakeMetricData("metric1", []float64{2, 10}, 60, now32),
+					types.MakeMetricData("metric2", []float64{2, 2}, 60, now32),
+					types.MakeMetricData("metric3", []float64{3, 0.5}, 60, now32),
+				},
+			},
+			[]*types.MetricData{types.MakeMetricData("powSeries(metric*)", []float64{64, 10}, 60, now32)},
+		},
 	}
 
 	for _, tt := range tests {
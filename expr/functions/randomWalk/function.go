@@ -3,6 +3,7 @@ package randomWalk
 import (
 	"context"
 	"math/rand"
+	"time"
 
 	"github.com/go-graphite/carbonapi/expr/interfaces"
 	"github.com/go-graphite/carbonapi/expr/types"
@@ -28,26 +29,46 @@ func New(configFile string) []interfaces.FunctionMetadata {
 	return res
 }
 
-// squareRoot(seriesList)
+// randomWalk(name, step=60, seed=None)
 func (f *randomWalk) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
 	name, err := e.GetStringArg(0)
 	if err != nil {
 		name = "randomWalk"
 	}
 
-	size := until - from
+	step, err := e.GetIntNamedOrPosArgDefault("step", 1, 60)
+	if err != nil {
+		return nil, err
+	}
+	if step <= 0 {
+		return nil, parser.ErrBadType
+	}
+
+	seed := time.Now().UnixNano()
+	if e.GetNamedArg("seed") != nil || len(e.Args()) > 2 {
+		s, err := e.GetIntNamedOrPosArgDefault("seed", 2, 0)
+		if err != nil {
+			return nil, err
+		}
+		seed = int64(s)
+	}
+	rnd := rand.New(rand.NewSource(seed))
+
+	size := (until - from) / int64(step)
 
 	r := types.MetricData{FetchResponse: pb.FetchResponse{
 		Name:              name,
 		Values:            make([]float64, size),
-		StepTime:          1,
+		StepTime:          int64(step),
 		StartTime:         from,
-		StopTime:          until,
+		StopTime:          from + size*int64(step),
 		ConsolidationFunc: "average",
-	}}
+	},
+		Tags: map[string]string{"name": name},
+	}
 
-	for i := 1; i < len(r.Values)-1; i++ {
-		r.Values[i+1] = r.Values[i] + (rand.Float64() - 0.5)
+	for i := 1; i < len(r.Values); i++ {
+		r.Values[i] = r.Values[i-1] + (rnd.Float64() - 0.5)
 	}
 	return []*types.MetricData{&r}, nil
 }
@@ -56,8 +77,8 @@ func (f *randomWalk) Do(ctx context.Context, e parser.Expr, from, until int64, v
 func (f *randomWalk) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"randomWalk": {
-			Description: "Short Alias: randomWalk()\n\nReturns a random walk starting at 0. This is great for testing when there is\nno real data in whisper.\n\nExample:\n\n.. code-block:: none\n\n  &target=randomWalk(\"The.time.series\")\n\nThis would create a series named \"The.time.series\" that contains points where\nx(t) == x(t-1)+random()-0.5, and x(0) == 0.\nAccepts optional second argument as 'step' parameter (default step is 60 sec)",
-			Function:    "randomWalk(name, step=60)",
+			Description: "Short Alias: randomWalk()\n\nReturns a random walk starting at 0. This is great for testing when there is\nno real data in whisper.\n\nExample:\n\n.. code-block:: none\n\n  &target=randomWalk(\"The.time.series\")\n\nThis would create a series named \"The.time.series\" that contains points where\nx(t) == x(t-1)+random()-0.5, and x(0) == 0.\nAccepts optional second argument as 'step' parameter (default step is 60 sec)\nand optional third argument as 'seed' parameter to get the same series every time (by default series is different for every request)",
+			Function:    "randomWalk(name, step=60, seed=None)",
 			Group:       "Special",
 			Module:      "graphite.render.functions",
 			Name:        "randomWalk",
@@ -72,11 +93,15 @@ func (f *randomWalk) Description() map[string]types.FunctionDescription {
 					Name:    "step",
 					Type:    types.Integer,
 				},
+				{
+					Name: "seed",
+					Type: types.Integer,
+				},
 			},
 		},
 		"randomWalkFunction": {
-			Description: "Short Alias: randomWalk()\n\nReturns a random walk starting at 0. This is great for testing when there is\nno real data in whisper.\n\nExample:\n\n.. code-block:: none\n\n  &target=randomWalk(\"The.time.series\")\n\nThis would create a series named \"The.time.series\" that contains points where\nx(t) == x(t-1)+random()-0.5, and x(0) == 0.\nAccepts optional second argument as 'step' parameter (default step is 60 sec)",
-			Function:    "randomWalkFunction(name, step=60)",
+			Description: "Short Alias: randomWalk()\n\nReturns a random walk starting at 0. This is great for testing when there is\nno real data in whisper.\n\nExample:\n\n.. code-block:: none\n\n  &target=randomWalk(\"The.time.series\")\n\nThis would create a series named \"The.time.series\" that contains points where\nx(t) == x(t-1)+random()-0.5, and x(0) == 0.\nAccepts optional second argument as 'step' parameter (default step is 60 sec)\nand optional third argument as 'seed' parameter to get the same series every time (by default series is different for every request)",
+			Function:    "randomWalkFunction(name, step=60, seed=None)",
 			Group:       "Special",
 			Module:      "graphite.render.functions",
 			Name:        "randomWalkFunction",
@@ -91,6 +116,10 @@ func (f *randomWalk) Description() map[string]types.FunctionDescription {
 					Name:    "step",
 					Type:    types.Integer,
 				},
+				{
+					Name: "seed",
+					Type: types.Integer,
+				},
 			},
 		},
 	}
@@ -0,0 +1,76 @@
+package randomWalk
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+}
+
+func eval(t *testing.T, target string, from, until int64) *types.MetricData {
+	exp, _, err := parser.ParseExpr(target)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", target, err)
+	}
+	g, err := metadata.GetEvaluator().Eval(context.Background(), exp, from, until, nil)
+	if err != nil {
+		t.Fatalf("failed to eval %s: %v", target, err)
+	}
+	if len(g) != 1 {
+		t.Fatalf("%s returned %d series, expected 1", target, len(g))
+	}
+	return g[0]
+}
+
+func TestRandomWalkSeed(t *testing.T) {
+	tests := []struct {
+		target string
+		want   *types.MetricData
+	}{
+		{
+			`randomWalk("foo",60,42)`,
+			types.MakeMetricData("foo", []float64{0, -0.12697163895336738, -0.5609711421598494, -0.4568772906012074, -0.7480585875465483}, 60, 0),
+		},
+		{
+			`randomWalkFunction("foo",seed=42)`,
+			types.MakeMetricData("foo", []float64{0, -0.12697163895336738, -0.5609711421598494, -0.4568772906012074, -0.7480585875465483}, 60, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			// the same seed gives the same series every time
+			for i := 0; i < 2; i++ {
+				got := eval(t, tt.target, 0, 300)
+				if got.Name != tt.want.Name || got.StepTime != tt.want.StepTime ||
+					got.StartTime != tt.want.StartTime || got.StopTime != tt.want.StopTime {
+					t.Errorf("unexpected series: got %v, want %v", got, tt.want)
+				}
+				if !th.NearlyEqual(got.Values, tt.want.Values) {
+					t.Errorf("unexpected values: got %v, want %v", got.Values, tt.want.Values)
+				}
+			}
+		})
+	}
+}
+
+func TestRandomWalkStep(t *testing.T) {
+	got := eval(t, `randomWalk("foo",10)`, 0, 300)
+	if got.StepTime != 10 || len(got.Values) != 30 || got.Values[0] != 0 {
+		t.Errorf("unexpected series: got %v", got)
+	}
+}
@@ -57,7 +57,13 @@ func (f *smartSummarize) Do(ctx context.Context, e parser.Expr, from, until int6
 
 	start := args[0].StartTime
 	stop := args[0].StopTime
-	if alignToInterval != "" {
+	// months and years don't have fixed length, so their buckets start on the first day of calendar months.
+	// Series still has fixed step, timestamps of such buckets are approximate then
+	var bounds []int64
+	if months, ok := parser.CalendarMonths(e.Args()[1].StringValue()); ok {
+		bounds = helper.CalendarBuckets(start, stop, months)
+		start = bounds[0]
+	} else if alignToInterval != "" {
 		interval, err := parser.IntervalString(alignToInterval, 1)
 		if err != nil {
 			return nil, err
@@ -66,6 +72,9 @@ func (f *smartSummarize) Do(ctx context.Context, e parser.Expr, from, until int6
 	}
 
 	buckets := helper.GetBuckets(start, stop, bucketSize)
+	if bounds != nil {
+		buckets = int64(len(bounds) - 1)
+	}
 	results := make([]*types.MetricData, 0, len(args))
 	for _, arg := range args {
 
@@ -90,6 +99,9 @@ func (f *smartSummarize) Do(ctx context.Context, e parser.Expr, from, until int6
 
 		t := arg.StartTime // unadjusted
 		bucketEnd := start + bucketSize
+		if bounds != nil {
+			bucketEnd = bounds[1]
+		}
 		values := make([]float64, 0, bucketSize/arg.StepTime)
 		ridx := 0
 		bucketItems := 0
@@ -110,7 +122,11 @@ func (f *smartSummarize) Do(ctx context.Context, e parser.Expr, from, until int6
 
 				r.Values[ridx] = rv
 				ridx++
-				bucketEnd += bucketSize
+				if bounds != nil {
+					bucketEnd = bounds[ridx+1]
+				} else {
+					bucketEnd += bucketSize
+				}
 				bucketItems = 0
 				values = values[:0]
 			}
@@ -2,6 +2,7 @@ package smartSummarize
 
 import (
 	"testing"
+	"time"
 
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/metadata"
@@ -111,6 +112,120 @@ func TestFunctionUseNameWithWildcards(t *testing.T) {
 	}
 }
 
+func TestEvalSmartSummarizeCalendar(t *testing.T) {
+	defer func(tz *time.Location) { helper.DefaultTimeZone = tz }(helper.DefaultTimeZone)
+
+	day := int64(24 * 60 * 60)
+	jan2020 := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	jan2021 := time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC).Unix()
+	// a point per day, so sums of buckets are lengths of the months
+	daily := func(days int) []float64 {
+		values := make([]float64, days)
+		for i := range values {
+			values[i] = 1
+		}
+		return values
+	}
+
+	tests := []struct {
+		tz *time.Location
+		tt th.SummarizeEvalTestItem
+	}{
+		{
+			time.UTC,
+			th.SummarizeEvalTestItem{
+				"smartSummarize(metric1,'1month','sum')",
+				map[parser.MetricRequest][]*types.MetricData{
+					{"metric1", 0, 1}: {types.MakeMetricData("metric1", daily(31+28+31), day, jan2021)},
+				},
+				[]float64{31, 28, 31},
+				"smartSummarize(metric1,'1month','sum')",
+				30 * day,
+				jan2021,
+				jan2021 + (31+28+31)*day,
+			},
+		},
+		{
+			time.UTC,
+			th.SummarizeEvalTestItem{
+				"smartSummarize(metric1,'1mon','sum')",
+				map[parser.MetricRequest][]*types.MetricData{
+					{"metric1", 0, 1}: {types.MakeMetricData("metric1", daily(31+29+31), day, jan2020)},
+				},
+				[]float64{31, 29, 31},
+				"smartSummarize(metric1,'1mon','sum')",
+				30 * day,
+				jan2020,
+				jan2020 + (31+29+31)*day,
+			},
+		},
+		// months crossing the year boundary
+		{
+			time.UTC,
+			th.SummarizeEvalTestItem{
+				"smartSummarize(metric1,'1month','sum')",
+				map[parser.MetricRequest][]*types.MetricData{
+					{"metric1", 0, 1}: {types.MakeMetricData("metric1", daily(30+31+31+28), day, jan2021-(30+31)*day)},
+				},
+				[]float64{30, 31, 31, 28},
+				"smartSummarize(metric1,'1month','sum')",
+				30 * day,
+				jan2021 - (30+31)*day,
+				jan2021 + (31+28)*day,
+			},
+		},
+		// series starts in the middle of January, the first bucket still starts on the first of it
+		{
+			time.UTC,
+			th.SummarizeEvalTestItem{
+				"smartSummarize(metric1,'2months','sum')",
+				map[parser.MetricRequest][]*types.MetricData{
+					{"metric1", 0, 1}: {types.MakeMetricData("metric1", daily(17+28+31+30), day, jan2021+14*day)},
+				},
+				[]float64{17 + 28, 31 + 30},
+				"smartSummarize(metric1,'2months','sum')",
+				60 * day,
+				jan2021,
+				jan2021 + (31+28+31+30)*day,
+			},
+		},
+		{
+			time.UTC,
+			th.SummarizeEvalTestItem{
+				"smartSummarize(metric1,'1y','sum')",
+				map[parser.MetricRequest][]*types.MetricData{
+					{"metric1", 0, 1}: {types.MakeMetricData("metric1", daily(366+365), day, jan2020)},
+				},
+				[]float64{366, 365},
+				"smartSummarize(metric1,'1y','sum')",
+				365 * day,
+				jan2020,
+				jan2020 + (366+365)*day,
+			},
+		},
+		// months start an hour later than in UTC, so the first point of every month belongs to the previous one
+		{
+			time.FixedZone("UTC-1", -60*60),
+			th.SummarizeEvalTestItem{
+				"smartSummarize(metric1,'1month','sum')",
+				map[parser.MetricRequest][]*types.MetricData{
+					{"metric1", 0, 1}: {types.MakeMetricData("metric1", daily(31+28+31), day, jan2021)},
+				},
+				[]float64{1, 31, 28, 30},
+				"smartSummarize(metric1,'1month','sum')",
+				30 * day,
+				time.Date(2020, time.December, 1, 1, 0, 0, 0, time.UTC).Unix(),
+				jan2021 + (31+28+31)*day,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		helper.DefaultTimeZone = tt.tz
+		th.TestSummarizeEvalExpr(t, &tt.tt)
+	}
+}
+
 func generateValues(start, stop, step int64) (values []float64) {
 	for i := start; i < stop; i += step {
 		values = append(values, float64(i))
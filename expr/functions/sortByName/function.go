@@ -2,7 +2,11 @@ package sortByName
 
 import (
 	"context"
+	"fmt"
+	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-graphite/carbonapi/expr/helper"
 	"github.com/go-graphite/carbonapi/expr/interfaces"
@@ -40,22 +44,80 @@ func (f *sortByName) Do(ctx context.Context, e parser.Expr, from, until int64, v
 		return nil, err
 	}
 
-	arg := make([]*types.MetricData, len(original))
-	copy(arg, original)
+	transform := identity
 	if natSort {
-		sort.Sort(helper.ByNameNatural(arg))
-	} else {
-		sort.Sort(helper.ByName(arg))
+		transform = pad
 	}
+	arg := make([]*types.MetricData, len(original))
+	copy(arg, original)
+	sort.Sort(newByName(arg, transform))
 
 	return arg, nil
 }
 
+func identity(s string) string { return s }
+
+var dre = regexp.MustCompile(`\d+`)
+
+// pad pads numbers in the string with zeroes, so they are compared naturally
+func pad(str string) string {
+	return dre.ReplaceAllStringFunc(str, func(match string) string {
+		n, _ := strconv.ParseInt(match, 10, 64)
+		return fmt.Sprintf("%010d", n)
+	})
+}
+
+// sortKey splits series name into metric name followed by tags sorted by tag name. Tag name and value are
+// separated with \x00, so tags are ordered by name first and then by value. transform is applied to every part
+func sortKey(name string, transform func(string) string) []string {
+	parts := strings.Split(name, ";")
+	tags := parts[1:]
+	for i := range tags {
+		tags[i] = strings.Replace(tags[i], "=", "\x00", 1)
+	}
+	sort.Strings(tags)
+	for i := range parts {
+		parts[i] = transform(parts[i])
+	}
+	return parts
+}
+
+// byName sorts series by metric name and then by tags. Keys are computed once, before sorting
+type byName struct {
+	keys   [][]string
+	series []*types.MetricData
+}
+
+func newByName(series []*types.MetricData, transform func(string) string) byName {
+	keys := make([][]string, len(series))
+	for i := range series {
+		keys[i] = sortKey(series[i].Name, transform)
+	}
+	return byName{keys: keys, series: series}
+}
+
+func (s byName) Len() int { return len(s.series) }
+
+func (s byName) Swap(i, j int) {
+	s.series[i], s.series[j] = s.series[j], s.series[i]
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+}
+
+func (s byName) Less(i, j int) bool {
+	a, b := s.keys[i], s.keys[j]
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
 // Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
 func (f *sortByName) Description() map[string]types.FunctionDescription {
 	return map[string]types.FunctionDescription{
 		"sortByName": {
-			Description: "Takes one metric or a wildcard seriesList.\nSorts the list of metrics by the metric name using either alphabetical order or natural sorting.\nNatural sorting allows names containing numbers to be sorted more naturally, e.g:\n- Alphabetical sorting: server1, server11, server12, server2\n- Natural sorting: server1, server2, server11, server12",
+			Description: "Takes one metric or a wildcard seriesList.\nSorts the list of metrics by the metric name using either alphabetical order or natural sorting.\nNatural sorting allows names containing numbers to be sorted more naturally, e.g:\n- Alphabetical sorting: server1, server11, server12, server2\n- Natural sorting: server1, server2, server11, server12\n\nTagged series are sorted by metric name first and then by tags, in order of tag names.",
 			Function:    "sortByName(seriesList, natural=False, reverse=False)",
 			Group:       "Sorting",
 			Module:      "graphite.render.functions",
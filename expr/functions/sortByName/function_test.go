@@ -63,6 +63,42 @@ func TestFunction(t *testing.T) {
 				types.MakeMetricData("metric1234567890", []float64{0, 0, 0, 5, 0, 0}, 1, now32),
 			},
 		},
+		{
+			"sortByName(metric*)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					types.MakeMetricData("metric.b", []float64{0, 0, 0, 0, 0, 0}, 1, now32),
+					types.MakeMetricData("metric;dc=dc2;host=a", []float64{0, 1, 0, 0, 0, 0}, 1, now32),
+					types.MakeMetricData("metric", []float64{0, 0, 2, 0, 0, 0}, 1, now32),
+					types.MakeMetricData("metric;host=b;dc=dc1", []float64{0, 0, 0, 3, 0, 0}, 1, now32),
+					types.MakeMetricData("metric;dc=dc1;host=a", []float64{0, 0, 0, 0, 4, 0}, 1, now32),
+					types.MakeMetricData("metric.a;dc=dc1", []float64{0, 0, 0, 0, 0, 5}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metric", []float64{0, 0, 2, 0, 0, 0}, 1, now32),
+				types.MakeMetricData("metric;dc=dc1;host=a", []float64{0, 0, 0, 0, 4, 0}, 1, now32),
+				types.MakeMetricData("metric;host=b;dc=dc1", []float64{0, 0, 0, 3, 0, 0}, 1, now32),
+				types.MakeMetricData("metric;dc=dc2;host=a", []float64{0, 1, 0, 0, 0, 0}, 1, now32),
+				types.MakeMetricData("metric.a;dc=dc1", []float64{0, 0, 0, 0, 0, 5}, 1, now32),
+				types.MakeMetricData("metric.b", []float64{0, 0, 0, 0, 0, 0}, 1, now32),
+			},
+		},
+		{
+			"sortByName(metric*,natural=true)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					types.MakeMetricData("metric;host=host10", []float64{0, 0, 0, 0, 0, 0}, 1, now32),
+					types.MakeMetricData("metric2", []float64{0, 1, 0, 0, 0, 0}, 1, now32),
+					types.MakeMetricData("metric;host=host9", []float64{0, 0, 2, 0, 0, 0}, 1, now32),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metric;host=host9", []float64{0, 0, 2, 0, 0, 0}, 1, now32),
+				types.MakeMetricData("metric;host=host10", []float64{0, 0, 0, 0, 0, 0}, 1, now32),
+				types.MakeMetricData("metric2", []float64{0, 1, 0, 0, 0, 0}, 1, now32),
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -205,3 +205,72 @@ func TestEvalSummarize(t *testing.T) {
 		th.TestSummarizeEvalExpr(t, &tt)
 	}
 }
+
+func TestEvalSummarizeAlignToFrom(t *testing.T) {
+	// 2010-01-01 05:00:00 UTC, 5 hours past the day boundary
+	midnight := int64(1262304000)
+	fiveAM := midnight + 5*3600
+
+	values := make([]float64, 0, 48)
+	for i := 0; i < 48; i++ {
+		switch {
+		case i < 19:
+			values = append(values, 1)
+		case i < 43:
+			values = append(values, 2)
+		default:
+			values = append(values, 3)
+		}
+	}
+
+	tests := []th.SummarizeEvalTestItem{
+		{
+			"summarize(metric1,'1d')",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", values, 3600, fiveAM)},
+			},
+			[]float64{19, 48, 15},
+			"summarize(metric1,'1d')",
+			86400,
+			midnight,
+			midnight + 3*86400,
+		},
+		{
+			"summarize(metric1,'1d','sum',false)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", values, 3600, fiveAM)},
+			},
+			[]float64{19, 48, 15},
+			"summarize(metric1,'1d','sum',false)",
+			86400,
+			midnight,
+			midnight + 3*86400,
+		},
+		{
+			"summarize(metric1,'1d','sum',true)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", values, 3600, fiveAM)},
+			},
+			[]float64{29, 53},
+			"summarize(metric1,'1d','sum',true)",
+			86400,
+			fiveAM,
+			fiveAM + 2*86400,
+		},
+		{
+			"summarize(metric1,'1d',alignToFrom=true)",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", values, 3600, fiveAM)},
+			},
+			[]float64{29, 53},
+			"summarize(metric1,'1d','sum',true)",
+			86400,
+			fiveAM,
+			fiveAM + 2*86400,
+		},
+	}
+
+	for _, tt := range tests {
+		th.TestSummarizeEvalExpr(t, &tt)
+	}
+}
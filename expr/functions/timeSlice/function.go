@@ -0,0 +1,114 @@
+package timeSlice
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/go-graphite/carbonapi/date"
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/interfaces"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+)
+
+type timeSlice struct {
+	interfaces.FunctionBase
+}
+
+func GetOrder() interfaces.Order {
+	return interfaces.Any
+}
+
+func New(configFile string) []interfaces.FunctionMetadata {
+	res := make([]interfaces.FunctionMetadata, 0)
+	f := &timeSlice{}
+	functions := []string{"timeSlice"}
+	for _, n := range functions {
+		res = append(res, interfaces.FunctionMetadata{Name: n, F: f})
+	}
+	return res
+}
+
+// invalidTime is returned by date.DateParamToEpoch if it fails to parse the argument
+const invalidTime = math.MinInt64
+
+// parseTime parses time argument in any of the formats of from/until, e.x. "09:00_20230101", "now" or "-1h"
+func parseTime(s, name string) (int64, error) {
+	t := date.DateParamToEpoch(s, "", invalidTime, helper.DefaultTimeZone)
+	if t == invalidTime {
+		return 0, fmt.Errorf("failed to parse %s '%s'", name, s)
+	}
+	return t, nil
+}
+
+// timeSlice(seriesList, startSliceAt, endSliceAt="now")
+func (f *timeSlice) Do(ctx context.Context, e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, error) {
+	arg, err := helper.GetSeriesArg(e.Args()[0], from, until, values)
+	if err != nil {
+		return nil, err
+	}
+	startSliceAt, err := e.GetStringArg(1)
+	if err != nil {
+		return nil, err
+	}
+	endSliceAt, err := e.GetStringArgDefault(2, "now")
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseTime(startSliceAt, "startSliceAt")
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseTime(endSliceAt, "endSliceAt")
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*types.MetricData, 0, len(arg))
+	for _, a := range arg {
+		// name and step are kept, points outside of [start, end) are absent
+		r := *a
+		r.Values = make([]float64, len(a.Values))
+		t := a.StartTime
+		for i, v := range a.Values {
+			if t < start || t >= end {
+				v = math.NaN()
+			}
+			r.Values[i] = v
+			t += a.StepTime
+		}
+		results = append(results, &r)
+	}
+	return results, nil
+}
+
+// Description is auto-generated description, based on output of https://github.com/graphite-project/graphite-web
+func (f *timeSlice) Description() map[string]types.FunctionDescription {
+	return map[string]types.FunctionDescription{
+		"timeSlice": {
+			Description: "Takes one metric or a wildcard metric, followed by a quoted string with the\ntime to start the line and another quoted string with the time to end the line.\nThe start time is inclusive and the end time is exclusive. See ``from / until`` in the render\\_api_\nfor examples of time formats.\n\nUseful for filtering out a part of a series of data from a wider range of\ndata.\n\nExample:\n\n.. code-block:: none\n\n  &target=timeSlice(network.core.port1,\"00:00 20140101\",\"11:59 20140630\")\n  &target=timeSlice(network.core.port1,\"12:00 20140630\",\"now\")",
+			Function:    "timeSlice(seriesList, startSliceAt, endSliceAt='now')",
+			Group:       "Transform",
+			Module:      "graphite.render.functions",
+			Name:        "timeSlice",
+			Params: []types.FunctionParam{
+				{
+					Name:     "seriesList",
+					Required: true,
+					Type:     types.SeriesList,
+				},
+				{
+					Name:     "startSliceAt",
+					Required: true,
+					Type:     types.Date,
+				},
+				{
+					Name:    "endSliceAt",
+					Type:    types.Date,
+					Default: types.NewSuggestion("now"),
+				},
+			},
+		},
+	}
+}
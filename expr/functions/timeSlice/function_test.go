@@ -0,0 +1,105 @@
+package timeSlice
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/expr/helper"
+	"github.com/go-graphite/carbonapi/expr/metadata"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	th "github.com/go-graphite/carbonapi/tests"
+)
+
+func init() {
+	md := New("")
+	evaluator := th.EvaluatorFromFunc(md[0].F)
+	metadata.SetEvaluator(evaluator)
+	helper.SetEvaluator(evaluator)
+	for _, m := range md {
+		metadata.RegisterFunction(m.Name, m.F)
+	}
+	helper.DefaultTimeZone = time.UTC
+}
+
+func TestFunction(t *testing.T) {
+	// 2023-01-01 08:58:00 UTC
+	start := time.Date(2023, 1, 1, 8, 58, 0, 0, time.UTC).Unix()
+	values := []float64{1, 2, 3, math.NaN(), 5, 6}
+
+	tests := []th.EvalTestItem{
+		{
+			// bounds fall on 09:00 and 09:03 points, start is included and end is not
+			"timeSlice(metric1,\"09:00_20230101\",\"09:03_20230101\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", values, 60, start)},
+			},
+			[]*types.MetricData{types.MakeMetricData("metric1", []float64{math.NaN(), math.NaN(), 3, math.NaN(), 5, math.NaN()}, 60, start)},
+		},
+		{
+			// bounds are between points
+			"timeSlice(metric1,\"08:59_20230101\",\"09:01_20230101\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", values, 60, start-30)},
+			},
+			[]*types.MetricData{types.MakeMetricData("metric1", []float64{math.NaN(), math.NaN(), 3, math.NaN(), math.NaN(), math.NaN()}, 60, start-30)},
+		},
+		{
+			"timeSlice(metric*,\"09:01_20230101\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric*", 0, 1}: {
+					types.MakeMetricData("metric1", values, 60, start),
+					types.MakeMetricData("metric2", []float64{1, 2, 3}, 120, start),
+				},
+			},
+			[]*types.MetricData{
+				types.MakeMetricData("metric1", []float64{math.NaN(), math.NaN(), math.NaN(), math.NaN(), 5, 6}, 60, start),
+				types.MakeMetricData("metric2", []float64{math.NaN(), math.NaN(), 3}, 120, start),
+			},
+		},
+		{
+			// unix timestamps of 08:59 and 09:01
+			"timeSlice(metric1,\"1672563540\",\"1672563660\")",
+			map[parser.MetricRequest][]*types.MetricData{
+				{"metric1", 0, 1}: {types.MakeMetricData("metric1", values, 60, start)},
+			},
+			[]*types.MetricData{types.MakeMetricData("metric1", []float64{math.NaN(), 2, 3, math.NaN(), math.NaN(), math.NaN()}, 60, start)},
+		},
+	}
+
+	for _, tt := range tests {
+		testName := tt.Target
+		t.Run(testName, func(t *testing.T) {
+			th.TestEvalExpr(t, &tt)
+		})
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	series := map[parser.MetricRequest][]*types.MetricData{
+		{"metric1", 0, 1}: {types.MakeMetricData("metric1", []float64{1, 2}, 60, 0)},
+	}
+
+	tests := []struct {
+		target string
+		err    string
+	}{
+		{"timeSlice(metric1,\"yesterday-ish\")", "failed to parse startSliceAt 'yesterday-ish'"},
+		{"timeSlice(metric1,\"09:00_20230101\",\"20231301\")", "failed to parse endSliceAt '20231301'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = metadata.GetEvaluator().Eval(context.Background(), exp, 0, 1, series)
+			if err == nil || err.Error() != tt.err {
+				t.Fatalf("unexpected error, got %v, expected %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -149,6 +149,29 @@ func GetBuckets(start, stop, bucketSize int64) int64 {
 	return int64(math.Ceil(float64(stop-start) / float64(bucketSize)))
 }
 
+// DefaultTimeZone is the configured timezone, calendar intervals (months and years) are aligned and dates in
+// arguments of functions are parsed in it
+var DefaultTimeZone = time.Local
+
+// CalendarBuckets returns boundaries of buckets, that are calendar months long in DefaultTimeZone, bucket i is
+// [res[i], res[i+1]). The first bucket starts at the beginning of the month start belongs to (or of the year
+// if months is multiple of 12), the last one ends at or after stop
+func CalendarBuckets(start, stop int64, months int) []int64 {
+	t := time.Unix(start, 0).In(DefaultTimeZone)
+	month := t.Month()
+	if months%12 == 0 {
+		month = time.January
+	}
+	t = time.Date(t.Year(), month, 1, 0, 0, 0, 0, DefaultTimeZone)
+
+	res := []int64{t.Unix()}
+	for t.Unix() < stop {
+		t = time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, DefaultTimeZone)
+		res = append(res, t.Unix())
+	}
+	return res
+}
+
 // AlignStartToInterval aligns start of serie to interval
 func AlignStartToInterval(start, stop, bucketSize int64) int64 {
 	for _, v := range []int64{86400, 3600, 60} {
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"regexp"
+	"sort"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -119,6 +120,17 @@ func AggKey(arg *types.MetricData, nodesOrTags []parser.NodeOrTag) string {
 
 type seriesFunc func(*types.MetricData, *types.MetricData) *types.MetricData
 
+// SortedGroupNames returns names of the groups sorted. Grouping functions return groups in this order, so their
+// output doesn't depend on order the series were fetched in
+func SortedGroupNames(groups map[string][]*types.MetricData) []string {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ForEachSeriesDo do action for each serie in list.
 func ForEachSeriesDo(e parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData, function seriesFunc) ([]*types.MetricData, error) {
 	arg, err := GetSeriesArg(e.Args()[0], from, until, values)
@@ -139,8 +151,13 @@ func ForEachSeriesDo(e parser.Expr, from, until int64, values map[parser.MetricR
 // AggregateFunc type that defined aggregate function
 type AggregateFunc func([]float64) float64
 
-// AggregateSeries aggregates series
+// AggregateSeries aggregates series. Series with different steps are resampled to their common step first,
+// using consolidation function of each series
 func AggregateSeries(e parser.Expr, args []*types.MetricData, function AggregateFunc) ([]*types.MetricData, error) {
+	if !ExtrapolatePoints {
+		// resampled series are copies, slice is copied as well so series in caller's slice are kept intact
+		args = ScaleToCommonStep(append([]*types.MetricData{}, args...), 0)
+	}
 	args = AlignSeries(args)
 	length := len(args[0].Values)
 	r := *args[0]
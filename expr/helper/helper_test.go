@@ -3,6 +3,7 @@ package helper
 import (
 	"fmt"
 	"math"
+	"reflect"
 	"testing"
 
 	"github.com/go-graphite/carbonapi/expr/tags"
@@ -259,3 +260,14 @@ func TestScaleToCommonStep(t *testing.T) {
 		})
 	}
 }
+
+func TestSortedGroupNames(t *testing.T) {
+	groups := map[string][]*types.MetricData{
+		"b.c": nil,
+		"a.c": nil,
+		"b.a": nil,
+	}
+	if got := SortedGroupNames(groups); !reflect.DeepEqual(got, []string{"a.c", "b.a", "b.c"}) {
+		t.Errorf("unexpected order %v", got)
+	}
+}
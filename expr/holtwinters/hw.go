@@ -26,16 +26,25 @@ func holtWintersDeviation(gamma, actual, prediction, lastSeasonalDev float64) fl
 	return gamma*math.Abs(actual-prediction) + (1-gamma)*lastSeasonalDev
 }
 
-// HoltWintersAnalysis do Holt-Winters Analysis
-func HoltWintersAnalysis(series []float64, step int64) ([]float64, []float64) {
+const (
+	// DefaultSeasonality is length of the season (in seconds), one day
+	DefaultSeasonality = 86400
+	// DefaultBootstrapInterval is amount of data (in seconds) previous to the series that is used to bootstrap the forecast, one week
+	DefaultBootstrapInterval = 7 * 86400
+)
+
+// HoltWintersAnalysis do Holt-Winters Analysis. seasonality is length of the season in seconds
+func HoltWintersAnalysis(series []float64, step, seasonality int64) ([]float64, []float64) {
 	const (
 		alpha = 0.1
 		beta  = 0.0035
 		gamma = 0.1
 	)
 
-	// season is currently one day
-	seasonLength := 24 * 60 * 60 / int(step)
+	seasonLength := int(seasonality / step)
+	if seasonLength < 1 {
+		seasonLength = 1
+	}
 
 	var (
 		intercepts  []float64
@@ -119,9 +128,9 @@ func HoltWintersAnalysis(series []float64, step int64) ([]float64, []float64) {
 func HoltWintersConfidenceBands(series []float64, step int64, delta float64) ([]float64, []float64) {
 	var lowerBand, upperBand []float64
 
-	predictions, deviations := HoltWintersAnalysis(series, step)
+	predictions, deviations := HoltWintersAnalysis(series, step, DefaultSeasonality)
 
-	windowPoints := 7 * 86400 / step
+	windowPoints := DefaultBootstrapInterval / step
 
 	predictionsOfInterest := predictions[windowPoints:]
 	deviationsOfInterest := deviations[windowPoints:]
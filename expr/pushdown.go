@@ -0,0 +1,146 @@
+package expr
+
+import (
+	"context"
+	"sort"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// pushdownFilterFunction returns filtering function that asks backend to evaluate the expression by itself. Only calls
+// of configured pushdown functions over a single series name with literal arguments can be pushed down.
+func pushdownFilterFunction(e parser.Expr) (*pb.FilteringFunction, bool) {
+	if !e.IsFunc() || len(e.Args()) == 0 || !e.Args()[0].IsName() {
+		return nil, false
+	}
+
+	supported := false
+	for _, f := range config.Config.Pushdown.Functions {
+		if f == e.Target() {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return nil, false
+	}
+
+	f := &pb.FilteringFunction{Name: e.Target()}
+	for _, arg := range e.Args()[1:] {
+		if arg.IsFunc() || arg.IsName() {
+			return nil, false
+		}
+		f.Arguments = append(f.Arguments, pushdownArgument(arg))
+	}
+
+	namedArgs := e.NamedArgs()
+	names := make([]string, 0, len(namedArgs))
+	for name := range namedArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f.Arguments = append(f.Arguments, name+"="+pushdownArgument(namedArgs[name]))
+	}
+
+	return f, true
+}
+
+func pushdownArgument(e parser.Expr) string {
+	switch e.Type() {
+	case parser.EtString:
+		return e.StringValue()
+	case parser.EtConst:
+		return e.ToString()
+	default:
+		return e.Target()
+	}
+}
+
+// singleBackend checks that all the data lives on a single backend: there is only one backend group and either it has
+// a single server or its servers are replicas (round-robin)
+func singleBackend() bool {
+	upstreams := config.Config.Upstreams
+	if len(upstreams.Backends) > 0 {
+		return len(upstreams.Backends) == 1 && len(upstreams.BackendsV2.Backends) == 0
+	}
+	if len(upstreams.BackendsV2.Backends) != 1 {
+		return false
+	}
+
+	backend := upstreams.BackendsV2.Backends[0]
+	if len(backend.Servers) == 1 {
+		return true
+	}
+	var lbMethod zipperTypes.LBMethod
+	if err := lbMethod.FromString(backend.LBMethod); err != nil {
+		return false
+	}
+	return lbMethod == zipperTypes.RoundRobinLB
+}
+
+// pushdown asks backend to evaluate the whole expression. If the backend evaluated it, results are returned with
+// ok = true. If backend returned raw data instead (it doesn't support the function), data is stored in values, so it
+// can be evaluated locally without fetching it again. Errors are not returned, as expression can always be evaluated
+// locally.
+func pushdown(ctx context.Context, exp parser.Expr, from, until int64, values map[parser.MetricRequest][]*types.MetricData) ([]*types.MetricData, bool) {
+	filterFunction, ok := pushdownFilterFunction(exp)
+	if !ok {
+		return nil, false
+	}
+
+	metrics := exp.Metrics()
+	if len(metrics) != 1 || metrics[0].From != 0 || metrics[0].Until != 0 {
+		// functions that change time range can't be pushed down
+		return nil, false
+	}
+	metricRequest := parser.MetricRequest{Metric: metrics[0].Metric, From: from, Until: until}
+	if _, ok := values[metricRequest]; ok {
+		return nil, false
+	}
+
+	if !singleBackend() {
+		return nil, false
+	}
+	ctx = utilctx.SetPushdown(ctx)
+
+	fetchRequest := pb.FetchRequest{
+		Name:           metricRequest.Metric,
+		PathExpression: metricRequest.Metric,
+		StartTime:      from,
+		StopTime:       until,
+		MaxDataPoints:  utilctx.GetMaxDatapoints(ctx),
+	}
+	if config.Config.RollupSelection {
+		applyRollup(ctx, &fetchRequest)
+	}
+	fetchRequest.FilterFunctions = append(fetchRequest.FilterFunctions, filterFunction)
+
+	results, _, err := config.Config.ZipperInstance.Render(ctx, pb.MultiFetchRequest{Metrics: []pb.FetchRequest{fetchRequest}})
+	if err != nil || len(results) == 0 {
+		return nil, false
+	}
+
+	applied := 0
+	for _, r := range results {
+		for _, f := range r.AppliedFunctions {
+			if f == filterFunction.Name {
+				applied++
+				break
+			}
+		}
+	}
+
+	switch applied {
+	case len(results):
+		return results, true
+	case 0:
+		values[metricRequest] = results
+	}
+	return nil, false
+}
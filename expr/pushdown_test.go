@@ -0,0 +1,199 @@
+package expr
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ansel1/merry"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	zipperCfg "github.com/go-graphite/carbonapi/zipper/config"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+func TestPushdownFilterFunction(t *testing.T) {
+	oldConfig := config.Config
+	defer func() {
+		config.Config = oldConfig
+	}()
+	config.Config.Pushdown.Functions = []string{"sumSeries", "summarize", "scale"}
+
+	tests := []struct {
+		target   string
+		expected *pb.FilteringFunction
+	}{
+		{"sumSeries(foo.*)", &pb.FilteringFunction{Name: "sumSeries"}},
+		{`summarize(foo.*,"1h",func="max",alignToFrom=true)`, &pb.FilteringFunction{Name: "summarize", Arguments: []string{"1h", "alignToFrom=true", "func=max"}}},
+		{"scale(foo.*,0.5)", &pb.FilteringFunction{Name: "scale", Arguments: []string{"0.5"}}},
+		{"maxSeries(foo.*)", nil},
+		{"sumSeries(foo.*,bar.*)", nil},
+		{"sumSeries(scale(foo.*,2))", nil},
+		{"foo.*", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := pushdownFilterFunction(exp)
+			if ok != (tt.expected != nil) || !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("unexpected filter function: got %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func singleGroup(lbMethod string, servers ...string) zipperCfg.Config {
+	return zipperCfg.Config{BackendsV2: zipperTypes.BackendsV2{Backends: []zipperTypes.BackendV2{
+		{GroupName: "group", LBMethod: lbMethod, Servers: servers},
+	}}}
+}
+
+func TestFetchAndEvalExpPushdown(t *testing.T) {
+	oldConfig := config.Config
+	defer func() {
+		config.Config = oldConfig
+	}()
+	config.Config.Limiter = limiter.NewSimpleLimiter(1)
+	config.Config.Pushdown.Functions = []string{"sumSeries"}
+
+	raw := func() []*types.MetricData {
+		a := types.MakeMetricData("foo.a", []float64{1, 2}, 60, 0)
+		b := types.MakeMetricData("foo.b", []float64{3, 4}, 60, 0)
+		a.PathExpression, b.PathExpression = "foo.*", "foo.*"
+		return []*types.MetricData{a, b}
+	}
+	pushedDown := func() []*types.MetricData {
+		r := types.MakeMetricData("sumSeries(foo.*)", []float64{40, 60}, 60, 0)
+		r.PathExpression = "foo.*"
+		r.AppliedFunctions = []string{"sumSeries"}
+		return []*types.MetricData{r}
+	}
+	hasPushdown := func(request pb.MultiFetchRequest) bool {
+		for _, f := range request.Metrics[0].FilterFunctions {
+			if f.Name == "sumSeries" {
+				return true
+			}
+		}
+		return false
+	}
+
+	tests := []struct {
+		name      string
+		target    string
+		upstreams zipperCfg.Config
+		// backend's behavior when function is pushed down: "apply", "ignore" or "reject"
+		backend          string
+		expectedValues   []float64
+		expectedRequests []bool
+	}{
+		{
+			name:             "single backend",
+			target:           "sumSeries(foo.*)",
+			upstreams:        singleGroup("broadcast", "backend1"),
+			backend:          "apply",
+			expectedValues:   []float64{40, 60},
+			expectedRequests: []bool{true},
+		},
+		{
+			name:             "several backends",
+			target:           "sumSeries(foo.*)",
+			upstreams:        singleGroup("broadcast", "backend1", "backend2"),
+			backend:          "apply",
+			expectedValues:   []float64{4, 6},
+			expectedRequests: []bool{false},
+		},
+		{
+			name:             "replicas",
+			target:           "sumSeries(foo.*)",
+			upstreams:        singleGroup("roundrobin", "backend1", "backend2"),
+			backend:          "apply",
+			expectedValues:   []float64{40, 60},
+			expectedRequests: []bool{true},
+		},
+		{
+			name:   "several groups",
+			target: "sumSeries(foo.*)",
+			upstreams: zipperCfg.Config{BackendsV2: zipperTypes.BackendsV2{Backends: []zipperTypes.BackendV2{
+				{GroupName: "group1", LBMethod: "roundrobin", Servers: []string{"backend1"}},
+				{GroupName: "group2", LBMethod: "roundrobin", Servers: []string{"backend2"}},
+			}}},
+			backend:          "apply",
+			expectedValues:   []float64{4, 6},
+			expectedRequests: []bool{false},
+		},
+		{
+			name:             "backend doesn't support function",
+			target:           "sumSeries(foo.*)",
+			upstreams:        singleGroup("broadcast", "backend1"),
+			backend:          "ignore",
+			expectedValues:   []float64{4, 6},
+			expectedRequests: []bool{true},
+		},
+		{
+			name:             "backend rejects function",
+			target:           "sumSeries(foo.*)",
+			upstreams:        singleGroup("broadcast", "backend1"),
+			backend:          "reject",
+			expectedValues:   []float64{4, 6},
+			expectedRequests: []bool{true, false},
+		},
+		{
+			name:             "function is not pushed down",
+			target:           "sumSeries(scale(foo.*,1))",
+			upstreams:        singleGroup("broadcast", "backend1"),
+			backend:          "apply",
+			expectedValues:   []float64{4, 6},
+			expectedRequests: []bool{false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Config.Upstreams = tt.upstreams
+			z := &mockZipper{
+				render: func(request pb.MultiFetchRequest) ([]*types.MetricData, merry.Error) {
+					if !hasPushdown(request) {
+						return raw(), nil
+					}
+					switch tt.backend {
+					case "apply":
+						return pushedDown(), nil
+					case "reject":
+						return nil, merry.New("unknown filtering function").WithHTTPCode(400)
+					}
+					return raw(), nil
+				},
+			}
+			config.Config.ZipperInstance = z
+
+			exp, _, err := parser.ParseExpr(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			results, err := FetchAndEvalExp(context.Background(), exp, 0, 120, make(map[parser.MetricRequest][]*types.MetricData))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(results) != 1 || !reflect.DeepEqual(results[0].Values, tt.expectedValues) {
+				t.Errorf("unexpected results: %v", results)
+			}
+
+			requests := make([]bool, 0, len(z.requests))
+			for _, r := range z.requests {
+				requests = append(requests, hasPushdown(r))
+			}
+			if !reflect.DeepEqual(requests, tt.expectedRequests) {
+				t.Errorf("unexpected requests (true if function was pushed down): got %v, expected %v", requests, tt.expectedRequests)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package expr
+
+import (
+	"context"
+	"time"
+
+	"github.com/dgryski/go-expirecache"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+var timeNow = time.Now
+
+// selectArchive returns seconds per point of the finest archive that covers from and is coarse enough to have
+// no more points than requested, i.e. its resolution is step or coarser.
+// 0 is returned if there's no such archive or backend would pick it by itself.
+func selectArchive(retentions []pb.Retention, from, now, step int64) int64 {
+	var finest, selected int64
+	for _, r := range retentions {
+		if r.SecondsPerPoint <= 0 || r.SecondsPerPoint*r.NumberOfPoints < now-from {
+			continue
+		}
+		if finest == 0 || r.SecondsPerPoint < finest {
+			finest = r.SecondsPerPoint
+		}
+		if r.SecondsPerPoint >= step && (selected == 0 || r.SecondsPerPoint < selected) {
+			selected = r.SecondsPerPoint
+		}
+	}
+	if selected == finest {
+		return 0
+	}
+	return selected
+}
+
+// archiveStep returns seconds per point of the archive that backend would use to serve data since from: the finest one
+// that covers from, or the coarsest one if none of them does
+func archiveStep(retentions []pb.Retention, from, now int64) int64 {
+	var finest, coarsest int64
+	for _, r := range retentions {
+		if r.SecondsPerPoint <= 0 {
+			continue
+		}
+		if r.SecondsPerPoint > coarsest {
+			coarsest = r.SecondsPerPoint
+		}
+		if r.SecondsPerPoint*r.NumberOfPoints >= now-from && (finest == 0 || r.SecondsPerPoint < finest) {
+			finest = r.SecondsPerPoint
+		}
+	}
+	if finest == 0 {
+		return coarsest
+	}
+	return finest
+}
+
+// retentions caches retentions of metrics matched by path expression, as returned by backends
+var retentions = expirecache.New(rollupCacheSize)
+
+// rollupCacheSize is the max amount of path expressions with cached retentions, rollupCacheTTL is how long they are kept, seconds
+const (
+	rollupCacheSize = 100000
+	rollupCacheTTL  = 600
+)
+
+func init() {
+	go retentions.ApproximateCleaner(10 * time.Second)
+}
+
+// metricsRetentions returns retentions of every metric matched by pathExpression. Backends are only asked if they
+// aren't cached yet, errors are not cached.
+func metricsRetentions(ctx context.Context, pathExpression string) ([][]pb.Retention, bool) {
+	if v, ok := retentions.Get(pathExpression); ok {
+		return v.([][]pb.Retention), true
+	}
+
+	info, _, err := config.Config.ZipperInstance.Info(ctx, []string{pathExpression})
+	if err != nil || info == nil {
+		return nil, false
+	}
+	var res [][]pb.Retention
+	for _, resp := range info.Info {
+		for _, m := range resp.Metrics {
+			res = append(res, m.Retentions)
+		}
+	}
+	retentions.Set(pathExpression, res, uint64(len(res)+1), rollupCacheTTL)
+	return res, true
+}
+
+// selectRollup returns seconds per point of the archive that satisfies fetchRequest for all the metrics it matches.
+// 0 means that no selection should be passed to backend.
+func selectRollup(ctx context.Context, fetchRequest *pb.FetchRequest) int64 {
+	if fetchRequest.MaxDataPoints <= 0 || fetchRequest.StopTime <= fetchRequest.StartTime {
+		return 0
+	}
+	// the finest step that still fits into maxDataPoints
+	step := (fetchRequest.StopTime - fetchRequest.StartTime + fetchRequest.MaxDataPoints - 1) / fetchRequest.MaxDataPoints
+
+	metrics, ok := metricsRetentions(ctx, fetchRequest.PathExpression)
+	if !ok {
+		return 0
+	}
+
+	now := timeNow().Unix()
+	var rollup int64
+	for _, m := range metrics {
+		s := selectArchive(m, fetchRequest.StartTime, now, step)
+		if s == 0 {
+			// one of the metrics has no better archive, so data should be fetched as usual
+			return 0
+		}
+		if rollup == 0 || s < rollup {
+			rollup = s
+		}
+	}
+	return rollup
+}
+
+// applyRollup passes selected archive to backend as maxDataPoints that matches its resolution. As archive is at
+// least as coarse as requested, maxDataPoints never grows.
+func applyRollup(ctx context.Context, fetchRequest *pb.FetchRequest) {
+	if rollup := selectRollup(ctx, fetchRequest); rollup > 0 {
+		if mdp := (fetchRequest.StopTime - fetchRequest.StartTime) / rollup; mdp > 0 && mdp < fetchRequest.MaxDataPoints {
+			fetchRequest.MaxDataPoints = mdp
+		}
+	}
+}
@@ -0,0 +1,203 @@
+package expr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+	"github.com/dgryski/go-expirecache"
+
+	"github.com/go-graphite/carbonapi/cmd/carbonapi/config"
+	"github.com/go-graphite/carbonapi/expr/types"
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/pkg/parser"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	zipperTypes "github.com/go-graphite/carbonapi/zipper/types"
+	pb "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+// 10s:7d,1min:30d,10min:1y
+var testRetentions = []pb.Retention{
+	{SecondsPerPoint: 10, NumberOfPoints: 60480},
+	{SecondsPerPoint: 60, NumberOfPoints: 43200},
+	{SecondsPerPoint: 600, NumberOfPoints: 52560},
+}
+
+type mockZipper struct {
+	retentions []pb.Retention
+	// overrides retentions for particular metrics
+	metricRetentions map[string][]pb.Retention
+	requests         []pb.MultiFetchRequest
+	// leaf metrics matched by glob
+	globs map[string][]string
+	// amount of Info calls
+	infoRequests int
+	// answers render requests, no data by default
+	render func(request pb.MultiFetchRequest) ([]*types.MetricData, merry.Error)
+}
+
+func (z *mockZipper) Find(_ context.Context, request pb.MultiGlobRequest) (*pb.MultiGlobResponse, *zipperTypes.Stats, merry.Error) {
+	resp := &pb.MultiGlobResponse{}
+	for _, m := range request.Metrics {
+		g := pb.GlobResponse{Name: m}
+		for _, path := range z.globs[m] {
+			g.Matches = append(g.Matches, pb.GlobMatch{Path: path, IsLeaf: true})
+		}
+		resp.Metrics = append(resp.Metrics, g)
+	}
+	return resp, nil, nil
+}
+
+func (z *mockZipper) Info(_ context.Context, metrics []string) (*pb.ZipperInfoResponse, *zipperTypes.Stats, merry.Error) {
+	z.infoRequests++
+	resp := pb.MultiMetricsInfoResponse{}
+	for _, m := range metrics {
+		retentions, ok := z.metricRetentions[m]
+		if !ok {
+			retentions = z.retentions
+		}
+		resp.Metrics = append(resp.Metrics, pb.MetricsInfoResponse{Name: m, Retentions: retentions})
+	}
+	return &pb.ZipperInfoResponse{Info: map[string]pb.MultiMetricsInfoResponse{"backend": resp}}, nil, nil
+}
+
+func (z *mockZipper) RenderCompat(context.Context, []string, int64, int64) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	return nil, nil, nil
+}
+
+func (z *mockZipper) Render(_ context.Context, request pb.MultiFetchRequest) ([]*types.MetricData, *zipperTypes.Stats, merry.Error) {
+	z.requests = append(z.requests, request)
+	if z.render != nil {
+		res, err := z.render(request)
+		return res, nil, err
+	}
+	return nil, nil, nil
+}
+
+func (z *mockZipper) TagNames(context.Context, string, int64) ([]string, merry.Error) {
+	return nil, nil
+}
+
+func (z *mockZipper) TagValues(context.Context, string, int64) ([]string, merry.Error) {
+	return nil, nil
+}
+
+func (z *mockZipper) ScaleToCommonStep() bool {
+	return false
+}
+
+func (z *mockZipper) ProbeBackends(context.Context) map[string]merry.Error {
+	return nil
+}
+
+func TestSelectArchive(t *testing.T) {
+	now := int64(100000000)
+	tests := []struct {
+		name     string
+		from     int64
+		step     int64
+		expected int64
+	}{
+		{"narrow window", now - 3600, 10, 0},
+		{"step finer than any archive", now - 3600, 1, 0},
+		{"wide window, coarse step", now - 3*24*3600, 600, 600},
+		{"wide window, medium step", now - 3*24*3600, 300, 600},
+		{"wide window, step between archives", now - 3*24*3600, 50, 60},
+		{"finest archive doesn't cover from", now - 14*24*3600, 60, 0},
+		{"only coarsest archive covers from", now - 60*24*3600, 3600, 0},
+		{"finest covering archive is coarser than step", now - 14*24*3600, 30, 0},
+		{"step coarser than any archive", now - 14*24*3600, 3600, 0},
+		{"medium archive covers from", now - 14*24*3600, 500, 600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectArchive(testRetentions, tt.from, now, tt.step)
+			if got != tt.expected {
+				t.Errorf("unexpected archive: got %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFetchAndEvalExpRollupSelection(t *testing.T) {
+	now := time.Unix(100000000, 0)
+	timeNow = func() time.Time { return now }
+	oldConfig := config.Config
+	oldRetentions := retentions
+	defer func() {
+		timeNow = time.Now
+		config.Config = oldConfig
+		retentions = oldRetentions
+	}()
+	retentions = expirecache.New(rollupCacheSize)
+
+	z := &mockZipper{retentions: testRetentions}
+	config.Config.ZipperInstance = z
+	config.Config.Limiter = limiter.NewSimpleLimiter(1)
+	config.Config.RollupSelection = true
+
+	tests := []struct {
+		name          string
+		from          int64
+		maxDataPoints int64
+		expected      int64
+	}{
+		{
+			name:          "narrow window",
+			from:          now.Unix() - 3600,
+			maxDataPoints: 360,
+			expected:      360,
+		},
+		{
+			name:          "no maxDataPoints",
+			from:          now.Unix() - 30*24*3600,
+			maxDataPoints: 0,
+			expected:      0,
+		},
+		{
+			// 518s per point are requested, backend would read 10s archive, 10min one is selected instead
+			name:          "wide window",
+			from:          now.Unix() - 6*24*3600,
+			maxDataPoints: 1000,
+			expected:      6 * 24 * 3600 / 600,
+		},
+		{
+			name:          "no archive is coarse enough",
+			from:          now.Unix() - 6*24*3600,
+			maxDataPoints: 100,
+			expected:      100,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z.requests = nil
+			exp, _, err := parser.ParseExpr("foo.bar")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := utilctx.SetMaxDatapoints(context.Background(), tt.maxDataPoints)
+			_, _ = FetchAndEvalExp(ctx, exp, tt.from, now.Unix(), make(map[parser.MetricRequest][]*types.MetricData))
+
+			if len(z.requests) != 1 || len(z.requests[0].Metrics) != 1 {
+				t.Fatalf("unexpected requests: %+v", z.requests)
+			}
+			got := z.requests[0].Metrics[0]
+			if len(got.FilterFunctions) != 0 {
+				t.Errorf("unexpected filter functions: %+v", got.FilterFunctions)
+			}
+			if got.MaxDataPoints != tt.expected {
+				t.Errorf("unexpected maxDataPoints: got %v, expected %v", got.MaxDataPoints, tt.expected)
+			}
+			if got.MaxDataPoints > tt.maxDataPoints {
+				t.Errorf("maxDataPoints %v is larger than requested %v", got.MaxDataPoints, tt.maxDataPoints)
+			}
+		})
+	}
+
+	if z.infoRequests != 1 {
+		t.Errorf("retentions should be asked once and cached, got %v requests", z.infoRequests)
+	}
+}
@@ -30,6 +30,55 @@ func TestJSONResponse(t *testing.T) {
 	}
 }
 
+func TestJSONResponseWithErrors(t *testing.T) {
+	tests := []struct {
+		results []*MetricData
+		errs    []ResponseError
+		out     []byte
+	}{
+		{
+			[]*MetricData{
+				MakeMetricData("metric1", []float64{1, math.NaN()}, 100, 100),
+			},
+			nil,
+			[]byte(`{"series":[{"target":"metric1","datapoints":[[1,100],[null,200]],"tags":{"name":"metric1"}}],"errors":[]}`),
+		},
+		{
+			[]*MetricData{
+				MakeMetricData("metric1", []float64{1, math.NaN()}, 100, 100),
+			},
+			[]ResponseError{
+				{Target: "sum(metric2)", Error: "metric not found"},
+				{Error: "backend failed"},
+			},
+			[]byte(`{"series":[{"target":"metric1","datapoints":[[1,100],[null,200]],"tags":{"name":"metric1"}}],"errors":[{"target":"sum(metric2)","error":"metric not found"},{"error":"backend failed"}]}`),
+		},
+	}
+
+	for _, tt := range tests {
+		b := MarshalJSONWithErrors(tt.results, 1.0, false, tt.errs, nil)
+		if !bytes.Equal(b, tt.out) {
+			t.Errorf("marshalJSONWithErrors(%+v):\n    got %+v\n    want %+v", tt.results, string(b), string(tt.out))
+		}
+	}
+}
+
+func TestJSONResponseWithMeta(t *testing.T) {
+	metric1 := MakeMetricData("metric1", []float64{1, 2}, 100, 100)
+	metric2 := MakeMetricData("metric2", []float64{3, 4}, 100, 100)
+	results := []*MetricData{metric1, metric2}
+	meta := map[*MetricData]SeriesMeta{
+		metric1: {Backends: []string{"backend1", "backend2"}, Archive: 100, ConsolidationFunc: "average", ValuesPerPoint: 1},
+	}
+
+	want := `[{"target":"metric1","datapoints":[[1,100],[2,200]],"tags":{"name":"metric1"},"meta":{"backends":["backend1","backend2"],"archive":100,"consolidationFunc":"average","valuesPerPoint":1}},` +
+		`{"target":"metric2","datapoints":[[3,100],[4,200]],"tags":{"name":"metric2"}}]`
+	b := MarshalJSONWithMeta(results, 1.0, false, meta)
+	if string(b) != want {
+		t.Errorf("marshalJSONWithMeta(%+v):\n    got %+v\n    want %+v", results, string(b), want)
+	}
+}
+
 func TestJSONResponseNoNullPoints(t *testing.T) {
 
 	tests := []struct {
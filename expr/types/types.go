@@ -2,6 +2,7 @@ package types
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"math"
 	"sort"
@@ -89,8 +90,22 @@ func ConsolidateJSON(maxDataPoints int64, results []*MetricData) {
 	}
 }
 
+// SeriesMeta describes how series was fetched and consolidated
+type SeriesMeta struct {
+	Backends []string `json:"backends"`
+	// Archive is seconds per point of the data returned by backends
+	Archive           int64  `json:"archive"`
+	ConsolidationFunc string `json:"consolidationFunc"`
+	ValuesPerPoint    int    `json:"valuesPerPoint"`
+}
+
 // MarshalJSON marshals metric data to JSON
 func MarshalJSON(results []*MetricData, timestampMultiplier int64, noNullPoints bool) []byte {
+	return MarshalJSONWithMeta(results, timestampMultiplier, noNullPoints, nil)
+}
+
+// MarshalJSONWithMeta marshals metric data to JSON, adding "meta" object to the series that have it in meta
+func MarshalJSONWithMeta(results []*MetricData, timestampMultiplier int64, noNullPoints bool, meta map[*MetricData]SeriesMeta) []byte {
 	var b []byte
 	b = append(b, '[')
 
@@ -105,61 +120,109 @@ func MarshalJSON(results []*MetricData, timestampMultiplier int64, noNullPoints
 		}
 		topComma = true
 
-		b = append(b, `{"target":`...)
-		b = strconv.AppendQuoteToASCII(b, r.Name)
-		b = append(b, `,"datapoints":[`...)
+		b = appendJSONSeries(b, r, timestampMultiplier, noNullPoints, meta)
+	}
 
-		var innerComma bool
-		t := r.StartTime * timestampMultiplier
-		for _, v := range r.AggregatedValues() {
-			if noNullPoints && math.IsNaN(v) {
-				t += r.AggregatedTimeStep() * timestampMultiplier
-			} else {
-				if innerComma {
-					b = append(b, ',')
-				}
-				innerComma = true
+	b = append(b, ']')
 
-				b = append(b, '[')
+	return b
+}
 
-				if math.IsNaN(v) || math.IsInf(v, 1) || math.IsInf(v, -1) {
-					b = append(b, "null"...)
-				} else {
-					b = strconv.AppendFloat(b, v, 'f', -1, 64)
-				}
+// MarshalNDJSON marshals metric data to newline-delimited JSON, one series object per line
+func MarshalNDJSON(results []*MetricData, timestampMultiplier int64, noNullPoints bool) []byte {
+	var b []byte
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		b = appendJSONSeries(b, r, timestampMultiplier, noNullPoints, nil)
+		b = append(b, '\n')
+	}
+	return b
+}
 
+func appendJSONSeries(b []byte, r *MetricData, timestampMultiplier int64, noNullPoints bool, meta map[*MetricData]SeriesMeta) []byte {
+	b = append(b, `{"target":`...)
+	b = strconv.AppendQuoteToASCII(b, r.Name)
+	b = append(b, `,"datapoints":[`...)
+
+	var innerComma bool
+	t := r.StartTime * timestampMultiplier
+	for _, v := range r.AggregatedValues() {
+		if noNullPoints && math.IsNaN(v) {
+			t += r.AggregatedTimeStep() * timestampMultiplier
+		} else {
+			if innerComma {
 				b = append(b, ',')
+			}
+			innerComma = true
 
-				b = strconv.AppendInt(b, t, 10)
-
-				b = append(b, ']')
+			b = append(b, '[')
 
-				t += r.AggregatedTimeStep() * timestampMultiplier
+			if math.IsNaN(v) || math.IsInf(v, 1) || math.IsInf(v, -1) {
+				b = append(b, "null"...)
+			} else {
+				b = strconv.AppendFloat(b, v, 'f', -1, 64)
 			}
-		}
 
-		b = append(b, `],"tags":{`...)
-		notFirstTag := false
-		responseTags := make([]string, 0, len(r.Tags))
-		for tag := range r.Tags {
-			responseTags = append(responseTags, tag)
+			b = append(b, ',')
+
+			b = strconv.AppendInt(b, t, 10)
+
+			b = append(b, ']')
+
+			t += r.AggregatedTimeStep() * timestampMultiplier
 		}
-		sort.Strings(responseTags)
-		for _, tag := range responseTags {
-			v := r.Tags[tag]
-			if notFirstTag {
-				b = append(b, ',')
-			}
-			b = strconv.AppendQuoteToASCII(b, tag)
-			b = append(b, ':')
-			b = strconv.AppendQuoteToASCII(b, v)
-			notFirstTag = true
+	}
+
+	b = append(b, `],"tags":{`...)
+	notFirstTag := false
+	responseTags := make([]string, 0, len(r.Tags))
+	for tag := range r.Tags {
+		responseTags = append(responseTags, tag)
+	}
+	sort.Strings(responseTags)
+	for _, tag := range responseTags {
+		v := r.Tags[tag]
+		if notFirstTag {
+			b = append(b, ',')
 		}
+		b = strconv.AppendQuoteToASCII(b, tag)
+		b = append(b, ':')
+		b = strconv.AppendQuoteToASCII(b, v)
+		notFirstTag = true
+	}
 
-		b = append(b, `}}`...)
+	b = append(b, '}')
+	if m, ok := meta[r]; ok {
+		b = append(b, `,"meta":`...)
+		mb, _ := json.Marshal(m)
+		b = append(b, mb...)
 	}
+	b = append(b, '}')
 
-	b = append(b, ']')
+	return b
+}
+
+// ResponseError describes non-fatal error that happened while processing the request
+type ResponseError struct {
+	Target string `json:"target,omitempty"`
+	Error  string `json:"error"`
+}
+
+// MarshalJSONWithErrors marshals metric data to JSON and wraps it together with list of errors:
+// {"series":[...],"errors":[...]}
+func MarshalJSONWithErrors(results []*MetricData, timestampMultiplier int64, noNullPoints bool, errs []ResponseError, meta map[*MetricData]SeriesMeta) []byte {
+	var b []byte
+	b = append(b, `{"series":`...)
+	b = append(b, MarshalJSONWithMeta(results, timestampMultiplier, noNullPoints, meta)...)
+	b = append(b, `,"errors":`...)
+	if errs == nil {
+		errs = []ResponseError{}
+	}
+	e, _ := json.Marshal(errs)
+	b = append(b, e...)
+	b = append(b, '}')
 
 	return b
 }
@@ -26,6 +26,7 @@ require (
 	github.com/go-graphite/protocol v0.4.3
 	github.com/golang/protobuf v1.4.0
 	github.com/gorilla/handlers v1.4.2
+	github.com/klauspost/compress v1.11.4
 	github.com/lib/pq v1.4.0
 	github.com/lomik/og-rek v0.0.0-20170411191824-628eefeb8d80
 	github.com/lomik/zapwriter v0.0.0-20180906104450-2ec2b9a61680
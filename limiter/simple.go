@@ -1,10 +1,22 @@
 package limiter
 
+import "context"
+
 type SimpleLimiter chan struct{}
 
 func (l SimpleLimiter) Enter() { l <- struct{}{} }
 func (l SimpleLimiter) Leave() { <-l }
 
+// EnterWithContext waits for a free slot, but gives up if ctx is done
+func (l SimpleLimiter) EnterWithContext(ctx context.Context) error {
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func NewSimpleLimiter(l int) SimpleLimiter {
 	return make(chan struct{}, l)
 }
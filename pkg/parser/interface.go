@@ -48,6 +48,8 @@ var (
 	ErrSeriesDoesNotExist = errors.New("no timeseries with that name")
 	// ErrUnknownTimeUnits is an eval error returned when a time unit is unknown to system
 	ErrUnknownTimeUnits = errors.New("unknown time units")
+	// ErrTooDeep is a parse error returned when function calls in an expression are nested deeper than MaxDepth.
+	ErrTooDeep = errors.New("function calls are nested too deep")
 )
 
 // NodeOrTag structure contains either Node (=integer) or Tag (=string)
@@ -106,6 +108,8 @@ type Expr interface {
 
 	// GetIntervalArg returns interval typed argument.
 	GetIntervalArg(n int, defaultSign int) (int32, error)
+	// GetIntervalNamedOrPosArgDefault returns specific positioned interval-typed argument (in seconds) or replace it with default if none found.
+	GetIntervalNamedOrPosArgDefault(k string, n int, defaultSign int, v int64) (int64, error)
 
 	// GetStringArg returns n-th argument as string.
 	GetStringArg(n int) (string, error)
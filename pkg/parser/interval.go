@@ -64,6 +64,27 @@ func IntervalString(s string, defaultSign int) (int32, error) {
 	return totalInterval, nil
 }
 
+// CalendarMonths returns amount of months in interval string that consists of months or years only,
+// e.x. "1month" or "2y". Such intervals don't have fixed length, ok is false for any other interval
+func CalendarMonths(s string) (months int, ok bool) {
+	j := 0
+	for j < len(s) && '0' <= s[j] && s[j] <= '9' {
+		j++
+	}
+	n, err := strconv.Atoi(s[:j])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+
+	switch s[j:] {
+	case "mon", "month", "months":
+		return n, true
+	case "y", "year", "years":
+		return 12 * n, true
+	}
+	return 0, false
+}
+
 func TruthyBool(s string) bool {
 	switch s {
 	case "", "0", "false", "False", "no", "No":
@@ -51,3 +51,28 @@ func TestInterval(t *testing.T) {
 		}
 	}
 }
+
+func TestCalendarMonths(t *testing.T) {
+	var tests = []struct {
+		t      string
+		months int
+		ok     bool
+	}{
+		{"1month", 1, true},
+		{"1mon", 1, true},
+		{"3months", 3, true},
+		{"1y", 12, true},
+		{"2years", 24, true},
+		{"30d", 0, false},
+		{"1month2d", 0, false},
+		{"-1month", 0, false},
+		{"0months", 0, false},
+		{"month", 0, false},
+	}
+
+	for _, tt := range tests {
+		if months, ok := CalendarMonths(tt.t); months != tt.months || ok != tt.ok {
+			t.Errorf("CalendarMonths(%q)=%d, %v, want %d, %v\n", tt.t, months, ok, tt.months, tt.ok)
+		}
+	}
+}
@@ -179,10 +179,35 @@ func (e *expr) Metrics() []MetricRequest {
 			}
 
 			return r2
-		case "holtWintersForecast", "holtWintersConfidenceBands", "holtWintersAberration":
+		case "holtWintersForecast":
+			bootstrapInterval, err := e.GetIntervalNamedOrPosArgDefault("bootstrapInterval", 1, 1, 7*86400)
+			if err != nil {
+				return nil
+			}
+			for i := range r {
+				r[i].From -= bootstrapInterval
+			}
+		case "holtWintersConfidenceBands", "holtWintersAberration":
 			for i := range r {
 				r[i].From -= 7 * 86400 // starts -7 days from where the original starts
 			}
+		case "exponentialMovingAverage":
+			if len(e.args) < 2 {
+				return nil
+			}
+			if e.args[1].etype == EtString {
+				offs, err := e.GetIntervalArg(1, 1)
+				if err != nil {
+					return nil
+				}
+				// sign of the interval doesn't matter, window is always in the past
+				if offs < 0 {
+					offs = -offs
+				}
+				for i := range r {
+					r[i].From -= int64(offs)
+				}
+			}
 		case "movingAverage", "movingMedian", "movingMin", "movingMax", "movingSum":
 			if len(e.args) < 2 {
 				return nil
@@ -221,6 +246,31 @@ func (e *expr) GetIntervalArg(n, defaultSign int) (int32, error) {
 	return seconds, nil
 }
 
+func (e *expr) GetIntervalNamedOrPosArgDefault(k string, n, defaultSign int, v int64) (int64, error) {
+	var val string
+	if a := e.getNamedArg(k); a != nil {
+		if a.etype != EtString {
+			return 0, ErrBadType
+		}
+		val = a.valStr
+	} else {
+		if len(e.args) <= n {
+			return v, nil
+		}
+		if e.args[n].etype != EtString {
+			return 0, ErrBadType
+		}
+		val = e.args[n].valStr
+	}
+
+	seconds, err := IntervalString(val, defaultSign)
+	if err != nil {
+		return 0, ErrBadType
+	}
+
+	return int64(seconds), nil
+}
+
 func (e *expr) GetStringArg(n int) (string, error) {
 	if len(e.args) <= n {
 		return "", ErrMissingArgument
@@ -395,7 +445,25 @@ func (e *expr) insertFirstArg(exp *expr) error {
 	return nil
 }
 
-func parseExprWithoutPipe(e string) (Expr, string, error) {
+// MaxDepth limits nesting of function calls in expressions. 0 - unlimited
+var MaxDepth int
+
+// depth returns amount of nested function calls in the expression
+func (e *expr) depth() int {
+	if e.etype != EtFunc {
+		return 0
+	}
+	var d int
+	for _, arg := range e.args {
+		if ad := arg.depth(); ad > d {
+			d = ad
+		}
+	}
+	return d + 1
+}
+
+// parseExprWithoutPipe parses single expression, depth is amount of function calls it's nested in
+func parseExprWithoutPipe(e string, depth int) (Expr, string, error) {
 	// skip whitespace
 	for len(e) > 1 && e[0] == ' ' {
 		e = e[1:]
@@ -432,12 +500,15 @@ func parseExprWithoutPipe(e string) (Expr, string, error) {
 	if e != "" && e[0] == '(' {
 		// TODO(civil): Tags: make it a proper Expression
 		if name == "seriesByTag" {
-			argString, _, _, e, err := parseArgList(e)
+			argString, _, _, e, err := parseArgList(e, depth)
 			return &expr{target: name + "(" + argString + ")", etype: EtName}, e, err
 		}
+		if MaxDepth > 0 && depth >= MaxDepth {
+			return nil, e, fmt.Errorf("%w: limit is %d", ErrTooDeep, MaxDepth)
+		}
 		exp := &expr{target: name, etype: EtFunc}
 
-		argString, posArgs, namedArgs, e, err := parseArgList(e)
+		argString, posArgs, namedArgs, e, err := parseArgList(e, depth+1)
 		exp.argString = argString
 		exp.args = posArgs
 		exp.namedArgs = namedArgs
@@ -448,17 +519,17 @@ func parseExprWithoutPipe(e string) (Expr, string, error) {
 	return &expr{target: name}, e, nil
 }
 
-func parseExprInner(e string) (Expr, string, error) {
-	exp, e, err := parseExprWithoutPipe(e)
+func parseExprInner(e string, depth int) (Expr, string, error) {
+	exp, e, err := parseExprWithoutPipe(e, depth)
 	if err != nil {
 		return exp, e, err
 	}
-	return pipe(exp.(*expr), e)
+	return pipe(exp.(*expr), e, depth)
 }
 
 // ParseExpr actually do all the parsing. It returns expression, original string and error (if any)
 func ParseExpr(e string) (Expr, string, error) {
-	exp, e, err := parseExprInner(e)
+	exp, e, err := parseExprInner(e, 0)
 	if err != nil {
 		return exp, e, err
 	}
@@ -466,7 +537,7 @@ func ParseExpr(e string) (Expr, string, error) {
 	return exp, e, err
 }
 
-func pipe(exp *expr, e string) (*expr, string, error) {
+func pipe(exp *expr, e string, depth int) (*expr, string, error) {
 	for len(e) > 1 && e[0] == ' ' {
 		e = e[1:]
 	}
@@ -475,7 +546,7 @@ func pipe(exp *expr, e string) (*expr, string, error) {
 		return exp, e, nil
 	}
 
-	wr, e, err := parseExprWithoutPipe(e[1:])
+	wr, e, err := parseExprWithoutPipe(e[1:], depth)
 	if err != nil {
 		return exp, e, err
 	}
@@ -488,8 +559,12 @@ func pipe(exp *expr, e string) (*expr, string, error) {
 		return exp, e, err
 	}
 	exp = wr.(*expr)
+	// piped expression becomes first argument of the function, so it's nested one level deeper
+	if MaxDepth > 0 && depth+exp.depth() > MaxDepth {
+		return exp, e, fmt.Errorf("%w: limit is %d", ErrTooDeep, MaxDepth)
+	}
 
-	return pipe(exp, e)
+	return pipe(exp, e, depth)
 }
 
 // IsNameChar checks if specified char is actually a valid (from graphite's protocol point of view)
@@ -512,7 +587,7 @@ func isDigit(r byte) bool {
 	return '0' <= r && r <= '9'
 }
 
-func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
+func parseArgList(e string, depth int) (string, []*expr, map[string]*expr, string, error) {
 
 	var (
 		posArgs   []*expr
@@ -538,7 +613,7 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 		var err error
 
 		argString := e
-		arg, e, err = parseExprInner(e)
+		arg, e, err = parseExprInner(e, depth)
 		if err != nil {
 			return "", nil, nil, e, err
 		}
@@ -550,7 +625,7 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 		// we now know we're parsing a key-value pair
 		if arg.IsName() && e[0] == '=' {
 			e = e[1:]
-			argCont, eCont, errCont := parseExprInner(e)
+			argCont, eCont, errCont := parseExprInner(e, depth)
 			if errCont != nil {
 				return "", nil, nil, eCont, errCont
 			}
@@ -604,7 +679,7 @@ func parseArgList(e string) (string, []*expr, map[string]*expr, string, error) {
 		}
 
 		if e[0] != ',' && e[0] != ' ' {
-			return "", nil, nil, "", ErrUnexpectedCharacter
+			return "", nil, nil, e, ErrUnexpectedCharacter
 		}
 
 		e = e[1:]
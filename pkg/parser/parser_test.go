@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -372,6 +374,41 @@ func TestParseExpr(t *testing.T) {
 	}
 }
 
+func TestParseExprMaxDepth(t *testing.T) {
+	defer func() { MaxDepth = 0 }()
+	MaxDepth = 3
+
+	nested := func(depth int) string {
+		return strings.Repeat("absolute(", depth) + "metric" + strings.Repeat(")", depth)
+	}
+
+	tests := []struct {
+		s       string
+		tooDeep bool
+	}{
+		{nested(3), false},
+		{nested(4), true},
+		{nested(200), true},
+		{"sumSeries(absolute(metric),scale(absolute(metric),2))", false},
+		{"sumSeries(absolute(metric),scale(absolute(absolute(metric)),2))", true},
+		{"metric|absolute()|absolute()|absolute()", false},
+		{"metric|absolute()|absolute()|absolute()|absolute()", true},
+		{"sumSeries(absolute(metric)|absolute())", false},
+		{"sumSeries(absolute(metric)|absolute()|absolute())", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			_, _, err := ParseExpr(tt.s)
+			if tt.tooDeep {
+				assert.True(t, errors.Is(err, ErrTooDeep), "expected ErrTooDeep, got %v", err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestDoGetBoolVar(t *testing.T) {
 	tests := []struct {
 		s string
@@ -76,11 +76,13 @@ func DeepClone(original map[parser.MetricRequest][]*types.MetricData) map[parser
 		for _, originalMetric := range originalMetrics {
 			copiedMetric := types.MetricData{
 				FetchResponse: pb.FetchResponse{
-					Name:      originalMetric.Name,
-					StartTime: originalMetric.StartTime,
-					StopTime:  originalMetric.StopTime,
-					StepTime:  originalMetric.StepTime,
-					Values:    make([]float64, len(originalMetric.Values)),
+					Name:              originalMetric.Name,
+					ConsolidationFunc: originalMetric.ConsolidationFunc,
+					StartTime:         originalMetric.StartTime,
+					StopTime:          originalMetric.StopTime,
+					StepTime:          originalMetric.StepTime,
+					XFilesFactor:      originalMetric.XFilesFactor,
+					Values:            make([]float64, len(originalMetric.Values)),
 				},
 				Tags: make(map[string]string),
 			}
@@ -3,6 +3,8 @@ package ctx
 import (
 	"context"
 	"net/http"
+	"sort"
+	"sync"
 )
 
 type key int
@@ -15,6 +17,9 @@ const (
 	headersToPassKey
 	headersToLogKey
 	maxDataPoints
+	errorCollectorKey
+	fetchMetaCollectorKey
+	pushdownKey
 )
 
 func ifaceToString(v interface{}) string {
@@ -80,6 +85,148 @@ func GetMaxDatapoints(ctx context.Context) int64 {
 	return getCtxInt64(ctx, maxDataPoints)
 }
 
+// SetPushdown marks requests that ask backend to evaluate the whole expression by itself
+func SetPushdown(ctx context.Context) context.Context {
+	return context.WithValue(ctx, pushdownKey, true)
+}
+
+func IsPushdown(ctx context.Context) bool {
+	v, _ := ctx.Value(pushdownKey).(bool)
+	return v
+}
+
+// ErrorCollector gathers non-fatal errors (e.x. failed backends, when some data was still fetched) during request processing
+type ErrorCollector struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+func (c *ErrorCollector) Add(err string) {
+	c.mu.Lock()
+	c.errors = append(c.errors, err)
+	c.mu.Unlock()
+}
+
+func (c *ErrorCollector) Errors() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := make([]string, len(c.errors))
+	copy(res, c.errors)
+	return res
+}
+
+func SetErrorCollector(ctx context.Context, c *ErrorCollector) context.Context {
+	return context.WithValue(ctx, errorCollectorKey, c)
+}
+
+// GetErrorCollector returns ErrorCollector attached to the context or nil if there is none
+func GetErrorCollector(ctx context.Context) *ErrorCollector {
+	v := ctx.Value(errorCollectorKey)
+	if v != nil {
+		return v.(*ErrorCollector)
+	}
+	return nil
+}
+
+// FetchMeta describes where fetched series came from
+type FetchMeta struct {
+	Backends []string
+	// StepTime of the data returned by backends, e.x. seconds per point of archive that was used
+	StepTime int64
+}
+
+func (m *FetchMeta) add(backend string, stepTime int64) {
+	for _, b := range m.Backends {
+		if b == backend {
+			return
+		}
+	}
+	m.Backends = append(m.Backends, backend)
+	sort.Strings(m.Backends)
+	if m.StepTime == 0 || stepTime < m.StepTime {
+		m.StepTime = stepTime
+	}
+}
+
+// FetchMetaCollector gathers backends and archives that served each fetched series, used for debugging
+type FetchMetaCollector struct {
+	mu       sync.Mutex
+	byName   map[string]*FetchMeta
+	byPathEx map[string]*FetchMeta
+}
+
+// Add records that series name (fetched for pathExpression) was returned by backend with given step
+func (c *FetchMetaCollector) Add(pathExpression, name, backend string, stepTime int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.byName == nil {
+		c.byName = make(map[string]*FetchMeta)
+		c.byPathEx = make(map[string]*FetchMeta)
+	}
+	addFetchMeta(c.byName, name, backend, stepTime)
+	addFetchMeta(c.byPathEx, pathExpression, backend, stepTime)
+}
+
+func addFetchMeta(m map[string]*FetchMeta, key, backend string, stepTime int64) {
+	meta, ok := m[key]
+	if !ok {
+		meta = &FetchMeta{}
+		m[key] = meta
+	}
+	meta.add(backend, stepTime)
+}
+
+// Get returns meta for series name. If series wasn't fetched as is (e.x. it's a result of aggregation),
+// meta for all the series fetched for pathExpression is returned
+func (c *FetchMetaCollector) Get(pathExpression, name string) (FetchMeta, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	meta, ok := c.byName[name]
+	if !ok {
+		meta, ok = c.byPathEx[pathExpression]
+	}
+	if !ok {
+		return FetchMeta{}, false
+	}
+	res := FetchMeta{
+		Backends: make([]string, len(meta.Backends)),
+		StepTime: meta.StepTime,
+	}
+	copy(res.Backends, meta.Backends)
+	return res, true
+}
+
+// Backends returns sorted names of all the backends that served any of the series
+func (c *FetchMetaCollector) Backends() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seen := make(map[string]bool)
+	res := make([]string, 0)
+	for _, meta := range c.byName {
+		for _, b := range meta.Backends {
+			if !seen[b] {
+				seen[b] = true
+				res = append(res, b)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func SetFetchMetaCollector(ctx context.Context, c *FetchMetaCollector) context.Context {
+	return context.WithValue(ctx, fetchMetaCollectorKey, c)
+}
+
+// GetFetchMetaCollector returns FetchMetaCollector attached to the context or nil if there is none
+func GetFetchMetaCollector(ctx context.Context) *FetchMetaCollector {
+	v := ctx.Value(fetchMetaCollectorKey)
+	if v != nil {
+		return v.(*FetchMetaCollector)
+	}
+	return nil
+}
+
 func ParseCtx(h http.HandlerFunc, uuidKey string) http.HandlerFunc {
 	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		uuid := req.Header.Get(uuidKey)
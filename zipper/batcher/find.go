@@ -0,0 +1,192 @@
+package batcher
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"go.uber.org/zap"
+)
+
+// findBatchKey identifies requests that can be sent to the backend together. Requests with different headers to pass
+// are never batched, as the backend can answer them differently
+type findBatchKey struct {
+	startTime int64
+	stopTime  int64
+	headers   string
+}
+
+type findBatch struct {
+	patterns map[string]struct{}
+	done     chan struct{}
+
+	// ctx carries headers and UUID of the request that opened the batch, it's cancelled when all the requests in
+	// the batch are cancelled
+	ctx     context.Context
+	cancel  context.CancelFunc
+	waiting int
+
+	response *protov3.MultiGlobResponse
+	stats    *types.Stats
+	err      merry.Error
+}
+
+// FindBatcher collects find requests that arrive within a short window and sends them to the backend as a single
+// multi-pattern find request. All other requests are passed to the backend as-is.
+//
+// Backend must support multiple patterns in one find request.
+type FindBatcher struct {
+	types.BackendServer
+
+	window  time.Duration
+	timeout time.Duration
+	logger  *zap.Logger
+
+	mu      sync.Mutex
+	pending map[findBatchKey]*findBatch
+}
+
+func NewFindBatcher(logger *zap.Logger, backend types.BackendServer, window, timeout time.Duration) *FindBatcher {
+	return &FindBatcher{
+		BackendServer: backend,
+		window:        window,
+		timeout:       timeout,
+		logger:        logger.With(zap.String("type", "findBatcher"), zap.String("name", backend.Name())),
+		pending:       make(map[findBatchKey]*findBatch),
+	}
+}
+
+// headersKey returns headers in canonical form
+func headersKey(headers map[string]string) string {
+	res := make([]string, 0, len(headers))
+	for k, v := range headers {
+		res = append(res, k+": "+v)
+	}
+	sort.Strings(res)
+	return strings.Join(res, "\n")
+}
+
+// batchContext returns context for backend request of the batch, with headers and UUID of ctx, but without its
+// deadline and cancellation, as the batch is shared between several requests
+func batchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	res := utilctx.SetUUID(context.Background(), utilctx.GetUUID(ctx))
+	res = utilctx.SetPassHeaders(res, utilctx.GetPassHeaders(ctx))
+	res = utilctx.SetLogHeaders(res, utilctx.GetLogHeaders(ctx))
+	return context.WithCancel(res)
+}
+
+func (b *FindBatcher) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	key := findBatchKey{
+		startTime: request.StartTime,
+		stopTime:  request.StopTime,
+		headers:   headersKey(utilctx.GetPassHeaders(ctx)),
+	}
+
+	b.mu.Lock()
+	batch, ok := b.pending[key]
+	if !ok {
+		batch = &findBatch{
+			patterns: make(map[string]struct{}),
+			done:     make(chan struct{}),
+		}
+		batch.ctx, batch.cancel = batchContext(ctx)
+		b.pending[key] = batch
+		time.AfterFunc(b.window, func() { b.flush(key) })
+	}
+	for _, p := range request.Metrics {
+		batch.patterns[p] = struct{}{}
+	}
+	batch.waiting++
+	b.mu.Unlock()
+
+	select {
+	case <-batch.done:
+	case <-ctx.Done():
+		// backend request is cancelled only when nobody waits for it anymore
+		b.mu.Lock()
+		batch.waiting--
+		if batch.waiting == 0 {
+			batch.cancel()
+		}
+		b.mu.Unlock()
+
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, &types.Stats{FindErrors: 1, Timeouts: 1, FindTimeouts: 1}, types.ErrTimeoutExceeded
+		}
+		return nil, &types.Stats{FindErrors: 1}, types.ErrRequestCancelled
+	}
+
+	// only the request that opened the batch reports backend stats, otherwise the same backend request would be
+	// accounted several times
+	stats := &types.Stats{}
+	if !ok && batch.stats != nil {
+		stats = batch.stats
+	}
+
+	if batch.response == nil {
+		if batch.err != nil {
+			return nil, stats, batch.err
+		}
+		return nil, stats, types.ErrNotFound
+	}
+
+	requested := make(map[string]struct{}, len(request.Metrics))
+	for _, p := range request.Metrics {
+		requested[p] = struct{}{}
+	}
+	response := &protov3.MultiGlobResponse{}
+	for _, m := range batch.response.Metrics {
+		if _, ok := requested[m.Name]; ok {
+			response.Metrics = append(response.Metrics, m)
+		}
+	}
+	if len(response.Metrics) == 0 {
+		if batch.err != nil {
+			return nil, stats, batch.err
+		}
+		return nil, stats, types.ErrNotFound
+	}
+
+	return response, stats, batch.err
+}
+
+func (b *FindBatcher) flush(key findBatchKey) {
+	b.mu.Lock()
+	batch := b.pending[key]
+	delete(b.pending, key)
+	b.mu.Unlock()
+
+	request := &protov3.MultiGlobRequest{
+		Metrics:   make([]string, 0, len(batch.patterns)),
+		StartTime: key.startTime,
+		StopTime:  key.stopTime,
+	}
+	for p := range batch.patterns {
+		request.Metrics = append(request.Metrics, p)
+	}
+	sort.Strings(request.Metrics)
+
+	b.logger.Debug("sending batched find request",
+		zap.Strings("request", request.Metrics),
+	)
+
+	ctx, cancel := context.WithTimeout(batch.ctx, b.timeout)
+	defer cancel()
+	defer batch.cancel()
+
+	if batch.ctx.Err() != nil {
+		// all the requests in the batch are cancelled already
+		batch.err = types.ErrRequestCancelled
+	} else {
+		batch.response, batch.stats, batch.err = b.BackendServer.Find(ctx, request)
+	}
+	close(batch.done)
+}
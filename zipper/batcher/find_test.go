@@ -0,0 +1,203 @@
+package batcher
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ansel1/merry"
+
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
+	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"go.uber.org/zap"
+)
+
+type countingClient struct {
+	*dummy.DummyClient
+	findRequests int64
+}
+
+func (c *countingClient) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	atomic.AddInt64(&c.findRequests, 1)
+	return c.DummyClient.Find(ctx, request)
+}
+
+func globResponse(name string) protov3.GlobResponse {
+	return protov3.GlobResponse{
+		Name:    name,
+		Matches: []protov3.GlobMatch{{Path: name, IsLeaf: true}},
+	}
+}
+
+func TestFindBatcherMergesRequests(t *testing.T) {
+	client := &countingClient{DummyClient: dummy.NewDummyClient("client", []string{"backend"}, 1)}
+	client.AddFindResponse(
+		&protov3.MultiGlobRequest{Metrics: []string{"a.*", "b.*", "c.*"}},
+		&protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{globResponse("a.*"), globResponse("b.*")}},
+		&types.Stats{FindRequests: 1},
+		nil,
+	)
+
+	b := NewFindBatcher(zap.NewNop(), client, 50*time.Millisecond, time.Second)
+
+	patterns := []string{"a.*", "b.*", "c.*"}
+	responses := make([]*protov3.MultiGlobResponse, len(patterns))
+	errs := make([]merry.Error, len(patterns))
+	stats := make([]*types.Stats, len(patterns))
+	var wg sync.WaitGroup
+	for i, p := range patterns {
+		wg.Add(1)
+		go func(i int, p string) {
+			defer wg.Done()
+			responses[i], stats[i], errs[i] = b.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{p}})
+		}(i, p)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&client.findRequests); n != 1 {
+		t.Fatalf("expected 1 backend request, got %v", n)
+	}
+
+	for i, p := range patterns[:2] {
+		if errs[i] != nil {
+			t.Errorf("unexpected error for %v: %v", p, errs[i])
+		}
+		expected := &protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{globResponse(p)}}
+		if !reflect.DeepEqual(responses[i], expected) {
+			t.Errorf("unexpected response for %v: got %+v, expected %+v", p, responses[i], expected)
+		}
+	}
+	if !merry.Is(errs[2], types.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for %v, got %v", patterns[2], errs[2])
+	}
+
+	var findRequests int64
+	for _, s := range stats {
+		findRequests += s.FindRequests
+	}
+	if findRequests != 1 {
+		t.Errorf("backend request should be accounted once, got %v", findRequests)
+	}
+}
+
+func TestFindBatcherSeparatesTimeRanges(t *testing.T) {
+	client := &countingClient{DummyClient: dummy.NewDummyClient("client", []string{"backend"}, 1)}
+	client.AddFindResponse(
+		&protov3.MultiGlobRequest{Metrics: []string{"a.*"}},
+		&protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{globResponse("a.*")}},
+		nil,
+		nil,
+	)
+
+	b := NewFindBatcher(zap.NewNop(), client, 10*time.Millisecond, time.Second)
+
+	var wg sync.WaitGroup
+	for i := int64(0); i < 2; i++ {
+		wg.Add(1)
+		go func(startTime int64) {
+			defer wg.Done()
+			_, _, err := b.Find(context.Background(), &protov3.MultiGlobRequest{Metrics: []string{"a.*"}, StartTime: startTime})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := atomic.LoadInt64(&client.findRequests); n != 2 {
+		t.Fatalf("expected 2 backend requests, got %v", n)
+	}
+}
+
+// ctxClient records contexts of find requests and waits till they are done
+type ctxClient struct {
+	*dummy.DummyClient
+	mu   sync.Mutex
+	ctxs []context.Context
+}
+
+func (c *ctxClient) Find(ctx context.Context, request *protov3.MultiGlobRequest) (*protov3.MultiGlobResponse, *types.Stats, merry.Error) {
+	c.mu.Lock()
+	c.ctxs = append(c.ctxs, ctx)
+	c.mu.Unlock()
+	<-ctx.Done()
+	return nil, nil, types.ErrTimeoutExceeded
+}
+
+func TestFindBatcherPassesHeaders(t *testing.T) {
+	recorder := &ctxClient{DummyClient: dummy.NewDummyClient("client", []string{"backend"}, 1)}
+	b := NewFindBatcher(zap.NewNop(), recorder, 10*time.Millisecond, 50*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for _, org := range []string{"1", "2"} {
+		wg.Add(1)
+		go func(org string) {
+			defer wg.Done()
+			ctx := utilctx.SetUUID(context.Background(), "uuid-"+org)
+			ctx = utilctx.SetPassHeaders(ctx, map[string]string{"X-Grafana-Org-Id": org})
+			_, _, _ = b.Find(ctx, &protov3.MultiGlobRequest{Metrics: []string{"a.*"}})
+		}(org)
+	}
+	wg.Wait()
+
+	// requests with different headers are not batched
+	if len(recorder.ctxs) != 2 {
+		t.Fatalf("expected 2 backend requests, got %v", len(recorder.ctxs))
+	}
+	for _, ctx := range recorder.ctxs {
+		org := utilctx.GetPassHeaders(ctx)["X-Grafana-Org-Id"]
+		if org == "" || utilctx.GetUUID(ctx) != "uuid-"+org {
+			t.Errorf("headers and uuid should be passed to backend, got headers %v, uuid '%v'", utilctx.GetPassHeaders(ctx), utilctx.GetUUID(ctx))
+		}
+	}
+}
+
+func TestFindBatcherCancel(t *testing.T) {
+	recorder := &ctxClient{DummyClient: dummy.NewDummyClient("client", []string{"backend"}, 1)}
+	b := NewFindBatcher(zap.NewNop(), recorder, 10*time.Millisecond, time.Minute)
+
+	deadlineCtx, cancelDeadline := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelDeadline()
+	cancelCtx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+	errs := make([]merry.Error, 2)
+	stats := make([]*types.Stats, 2)
+	for i, ctx := range []context.Context{deadlineCtx, cancelCtx} {
+		wg.Add(1)
+		go func(i int, ctx context.Context) {
+			defer wg.Done()
+			_, stats[i], errs[i] = b.Find(ctx, &protov3.MultiGlobRequest{Metrics: []string{"a.*"}})
+		}(i, ctx)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// the request is still awaited by one of the callers
+	recorder.mu.Lock()
+	backendCtx := recorder.ctxs[0]
+	recorder.mu.Unlock()
+	if backendCtx.Err() != nil {
+		t.Fatalf("backend request shouldn't be cancelled while someone waits for it: %v", backendCtx.Err())
+	}
+
+	cancel()
+	wg.Wait()
+
+	if !merry.Is(errs[0], types.ErrTimeoutExceeded) || stats[0].Timeouts != 1 {
+		t.Errorf("expected timeout, got %v, stats %+v", errs[0], stats[0])
+	}
+	if !merry.Is(errs[1], types.ErrRequestCancelled) || stats[1].Timeouts != 0 {
+		t.Errorf("expected cancel, got %v, stats %+v", errs[1], stats[1])
+	}
+	select {
+	case <-backendCtx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("backend request should be cancelled when all callers are gone")
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/go-graphite/carbonapi/limiter"
 	"github.com/go-graphite/carbonapi/pathcache"
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
 
@@ -25,6 +26,7 @@ type BroadcastGroup struct {
 	maxMetricsPerRequest      int
 	doMultipleRequestsIfSplit bool
 	tldCacheDisabled          bool
+	invalidSeries             types.InvalidSeriesAction
 
 	fetcher   types.Fetcher
 	pathCache pathcache.PathCache
@@ -44,6 +46,12 @@ func (bg *BroadcastGroup) SetDoMultipleRequestIfSplit(v bool) {
 	}
 }
 
+// SetInvalidSeriesAction controls what happens with series in responses of backends which amount of points doesn't
+// match their time range
+func (bg *BroadcastGroup) SetInvalidSeriesAction(action types.InvalidSeriesAction) {
+	bg.invalidSeries = action
+}
+
 func NewBroadcastGroup(logger *zap.Logger, groupName string, doMultipleRequestsIfSplit bool, servers []types.BackendServer, expireDelaySec int32, concurrencyLimit, maxBatchSize int, timeout types.Timeouts, tldCacheDisabled bool) (*BroadcastGroup, merry.Error) {
 	if len(servers) == 0 {
 		return nil, types.ErrNoServersSpecified
@@ -152,9 +160,11 @@ func (bg *BroadcastGroup) doMultiFetch(ctx context.Context, logger *zap.Logger,
 		return
 	}
 
+	logger = logger.With(zap.String("backend_name", backend.Name()))
+	// requests are sent concurrently, but group expects single response from every backend, so they are merged
+	responses := make(chan *types.ServerFetchResponse, len(requests))
 	for _, req := range requests {
 		go func(req *protov3.MultiFetchRequest) {
-			logger = logger.With(zap.String("backend_name", backend.Name()))
 			logger.Debug("waiting for slot",
 				zap.Int("max_connections", bg.limiter.Capacity()),
 			)
@@ -164,7 +174,7 @@ func (bg *BroadcastGroup) doMultiFetch(ctx context.Context, logger *zap.Logger,
 
 			if err := bg.limiter.Enter(ctx, backend.Name()); err != nil {
 				logger.Debug("timeout waiting for a slot")
-				resCh <- response.NonFatalError(merry.Prepend(err, "timeout waiting for slot"))
+				responses <- response.NonFatalError(merry.Prepend(err, "timeout waiting for slot"))
 				return
 			}
 
@@ -177,11 +187,93 @@ func (bg *BroadcastGroup) doMultiFetch(ctx context.Context, logger *zap.Logger,
 			response.Response, response.Stats, err = backend.Fetch(ctx, req)
 			response.AddError(err)
 			logger.Debug("got response")
+			bg.validateFetchResponse(logger, backend, response)
+			recordFetchMeta(ctx, backend, response.Response, response.Stats)
 
-			resCh <- response
+			responses <- response
 		}(req)
 	}
 
+	response := types.NewServerFetchResponse()
+	response.Server = backend.Name()
+	for range requests {
+		_ = response.Merge(<-responses)
+	}
+	resCh <- response
+}
+
+// recordFetchMeta remembers which servers served each of the metrics, if it was requested. Servers are reported in
+// stats by the backend, name of the backend is recorded if it doesn't report them. Nested groups are skipped, so only
+// actual backends are recorded.
+func recordFetchMeta(ctx context.Context, backend types.BackendServer, response *protov3.MultiFetchResponse, stats *types.Stats) {
+	collector := utilctx.GetFetchMetaCollector(ctx)
+	if collector == nil || response == nil {
+		return
+	}
+	if _, ok := backend.(*BroadcastGroup); ok {
+		return
+	}
+	servers := []string{backend.Name()}
+	if stats != nil && len(stats.Servers) > 0 {
+		servers = stats.Servers
+	}
+	for i := range response.Metrics {
+		m := &response.Metrics[i]
+		for _, server := range servers {
+			collector.Add(m.PathExpression, m.Name, server, m.StepTime)
+		}
+	}
+}
+
+// validateFetchResponse checks that amount of points of each series in the response matches its time range. Invalid
+// series are logged, dropped or fail the whole response, depending on invalidSeries action. Nested groups are skipped, as they
+// validate responses of their own backends.
+func (bg *BroadcastGroup) validateFetchResponse(logger *zap.Logger, backend types.BackendServer, r *types.ServerFetchResponse) {
+	if bg.invalidSeries == types.IgnoreInvalidSeries || r.Response == nil {
+		return
+	}
+	if _, ok := backend.(*BroadcastGroup); ok {
+		return
+	}
+
+	var metrics []protov3.FetchResponse
+	for i := range r.Response.Metrics {
+		err := types.ValidateFetchResponse(&r.Response.Metrics[i])
+		if err == nil {
+			if metrics != nil {
+				metrics = append(metrics, r.Response.Metrics[i])
+			}
+			continue
+		}
+
+		if bg.invalidSeries == types.LogInvalidSeries {
+			logger.Warn("invalid series in backend response, passing as is",
+				zap.Error(err),
+			)
+			continue
+		}
+
+		if bg.invalidSeries == types.FailInvalidSeries {
+			logger.Error("invalid series in backend response",
+				zap.Error(err),
+			)
+			r.Response = nil
+			r.AddError(err)
+			return
+		}
+
+		logger.Warn("skipping invalid series from backend response",
+			zap.Error(err),
+		)
+		if metrics == nil {
+			metrics = make([]protov3.FetchResponse, i, len(r.Response.Metrics))
+			copy(metrics, r.Response.Metrics[:i])
+		}
+	}
+
+	if metrics != nil {
+		r.Response = &protov3.MultiFetchResponse{Metrics: metrics}
+	}
 }
 
 func (bg *BroadcastGroup) doSingleFetch(ctx context.Context, logger *zap.Logger, backend types.BackendServer, reqs interface{}, resCh chan types.ServerFetcherResponse) {
@@ -229,6 +321,8 @@ func (bg *BroadcastGroup) doSingleFetch(ctx context.Context, logger *zap.Logger,
 		r.Response, r.Stats, err = backend.Fetch(ctx, req)
 		r.AddError(err)
 		logger.Debug("got response")
+		bg.validateFetchResponse(logger, backend, r)
+		recordFetchMeta(ctx, backend, r.Response, r.Stats)
 		_ = response.Merge(r)
 	}
 
@@ -257,8 +351,9 @@ func (bg *BroadcastGroup) splitRequest(ctx context.Context, request *protov3.Mul
 			continue
 		}
 
-		// Do not send Find requests if we have neither globs in the request nor metric expansions
-		if !strings.ContainsAny(metric.Name, "*{") {
+		// Do not send Find requests if we have neither globs in the request nor metric expansions. Pushed down requests
+		// are not expanded either, as backend needs all the metrics of the pattern to evaluate the expression
+		if !strings.ContainsAny(metric.Name, "*{") || utilctx.IsPushdown(ctx) {
 			newRequest.Metrics = append(newRequest.Metrics, protov3.FetchRequest{
 				Name:            metric.PathExpression,
 				StartTime:       metric.StartTime,
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"sort"
 	"testing"
@@ -11,7 +13,10 @@ import (
 
 	"github.com/ansel1/merry"
 
+	utilctx "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/dummy"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
+	"github.com/go-graphite/carbonapi/zipper/protocols/v3"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -1160,3 +1165,346 @@ func TestFetchRequests(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchMeta(t *testing.T) {
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{
+			{
+				Name:           "foo*",
+				StartTime:      0,
+				StopTime:       120,
+				PathExpression: "foo*",
+			},
+		},
+	}
+	metric := func(name string, step int64) protov3.FetchResponse {
+		return protov3.FetchResponse{
+			Name:           name,
+			PathExpression: "foo*",
+			StartTime:      0,
+			StopTime:       120,
+			StepTime:       step,
+			Values:         []float64{0, 1, 2},
+		}
+	}
+
+	client1 := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	client1.AddFetchResponse(request, &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{metric("foo", 60), metric("foo2", 60)}}, &types.Stats{}, nil)
+	client2 := dummy.NewDummyClient("client2", []string{"backend2"}, 1)
+	client2.AddFetchResponse(request, &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{metric("foo", 10)}}, &types.Stats{}, nil)
+
+	nested, err := NewBroadcastGroup(logger, "nested", false, []types.BackendServer{client2}, 60, 500, 100, timeouts, false)
+	if err != nil {
+		t.Fatalf("error while initializing group, when it shouldn't be: %v", merry.Details(err))
+	}
+	b, err := NewBroadcastGroup(logger, "root", false, []types.BackendServer{client1, nested}, 60, 500, 100, timeouts, false)
+	if err != nil {
+		t.Fatalf("error while initializing group, when it shouldn't be: %v", merry.Details(err))
+	}
+
+	collector := &utilctx.FetchMetaCollector{}
+	ctx := utilctx.SetFetchMetaCollector(context.Background(), collector)
+	_, _, err = b.Fetch(ctx, request)
+	if err != nil {
+		t.Fatalf("unexpected error '%+v'", merry.Details(err))
+	}
+
+	tests := []struct {
+		name     string
+		expected utilctx.FetchMeta
+	}{
+		{"foo", utilctx.FetchMeta{Backends: []string{"client1", "client2"}, StepTime: 10}},
+		{"foo2", utilctx.FetchMeta{Backends: []string{"client1"}, StepTime: 60}},
+		{"sumSeries(foo*)", utilctx.FetchMeta{Backends: []string{"client1", "client2"}, StepTime: 10}},
+	}
+	for _, tt := range tests {
+		got, ok := collector.Get("foo*", tt.name)
+		if !ok {
+			t.Errorf("no meta for %v", tt.name)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("unexpected meta for %v: got %+v, expected %+v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestFetchMetaSplitRequests(t *testing.T) {
+	metric := func(name string) *protov3.MultiFetchResponse {
+		return &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{{
+			Name:           name,
+			PathExpression: "foo*",
+			StartTime:      0,
+			StopTime:       120,
+			StepTime:       60,
+			Values:         []float64{0, 1},
+		}}}
+	}
+	request := func(name string) *protov3.MultiFetchRequest {
+		return &protov3.MultiFetchRequest{
+			Metrics: []protov3.FetchRequest{{Name: name, StartTime: 0, StopTime: 120, PathExpression: "foo*"}},
+		}
+	}
+
+	// every metric is fetched by a request of its own
+	client := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+	client.AddFetchResponse(request("foo1"), metric("foo1"), &types.Stats{Servers: []string{"server1"}}, nil)
+	client.AddFetchResponse(request("foo2"), metric("foo2"), &types.Stats{}, nil)
+	client.AddFindResponse(
+		&protov3.MultiGlobRequest{Metrics: []string{"foo*"}},
+		&protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{
+			Name:    "foo*",
+			Matches: []protov3.GlobMatch{{Path: "foo1", IsLeaf: true}, {Path: "foo2", IsLeaf: true}},
+		}}},
+		&types.Stats{},
+		nil,
+	)
+
+	b, err := NewBroadcastGroup(logger, "root", true, []types.BackendServer{client}, 60, 500, 100, timeouts, false)
+	if err != nil {
+		t.Fatalf("error while initializing group, when it shouldn't be: %v", merry.Details(err))
+	}
+
+	collector := &utilctx.FetchMetaCollector{}
+	ctx := utilctx.SetFetchMetaCollector(context.Background(), collector)
+	res, _, err := b.Fetch(ctx, request("foo*"))
+	if err != nil {
+		t.Fatalf("unexpected error '%+v'", merry.Details(err))
+	}
+	// responses to all the split requests are merged
+	if len(res.Metrics) != 2 {
+		t.Errorf("unexpected amount of metrics: got %+v, expected 2", res.Metrics)
+	}
+
+	tests := []struct {
+		name     string
+		expected utilctx.FetchMeta
+	}{
+		{"foo1", utilctx.FetchMeta{Backends: []string{"server1"}, StepTime: 60}},
+		{"foo2", utilctx.FetchMeta{Backends: []string{"client1"}, StepTime: 60}},
+	}
+	for _, tt := range tests {
+		got, ok := collector.Get("foo*", tt.name)
+		if !ok {
+			t.Errorf("no meta for %v", tt.name)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("unexpected meta for %v: got %+v, expected %+v", tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestFetchInvalidSeries(t *testing.T) {
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{
+			{
+				Name:           "foo*",
+				StartTime:      0,
+				StopTime:       240,
+				PathExpression: "foo*",
+			},
+		},
+	}
+	valid := protov3.FetchResponse{
+		Name:           "foo",
+		PathExpression: "foo*",
+		StartTime:      0,
+		StopTime:       240,
+		StepTime:       60,
+		Values:         []float64{0, 1, 2, 3},
+	}
+	// 4 points are expected for such time range and step
+	corrupt := protov3.FetchResponse{
+		Name:           "foo2",
+		PathExpression: "foo*",
+		StartTime:      0,
+		StopTime:       240,
+		StepTime:       60,
+		Values:         []float64{0, 1, 2, 3, 4, 5, 6, 7},
+	}
+
+	tests := []struct {
+		name            string
+		action          types.InvalidSeriesAction
+		expectedErr     merry.Error
+		expectedMetrics []string
+	}{
+		{
+			name:            "skip",
+			action:          types.SkipInvalidSeries,
+			expectedMetrics: []string{"foo"},
+		},
+		{
+			name:        "error",
+			action:      types.FailInvalidSeries,
+			expectedErr: types.ErrFailedToFetch,
+		},
+		{
+			name:            "ignore",
+			action:          types.IgnoreInvalidSeries,
+			expectedMetrics: []string{"foo", "foo2"},
+		},
+		{
+			name:            "log",
+			action:          types.LogInvalidSeries,
+			expectedMetrics: []string{"foo", "foo2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := dummy.NewDummyClient("client1", []string{"backend1"}, 1)
+			client.AddFetchResponse(request, &protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{valid, corrupt}}, &types.Stats{}, nil)
+
+			b, err := NewBroadcastGroup(logger, tt.name, false, []types.BackendServer{client}, 60, 500, 100, timeouts, false)
+			if err != nil {
+				t.Fatalf("error while initializing group, when it shouldn't be: %v", merry.Details(err))
+			}
+			b.SetInvalidSeriesAction(tt.action)
+
+			res, _, err := b.Fetch(context.Background(), request)
+			if tt.expectedErr != nil {
+				if !errorsAreEqual(err, tt.expectedErr) {
+					t.Fatalf("unexpected error %v, expected %v", merry.Details(err), tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error '%+v'", merry.Details(err))
+			}
+
+			names := make([]string, 0, len(res.Metrics))
+			for _, m := range res.Metrics {
+				names = append(names, m.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.expectedMetrics) {
+				t.Errorf("got metrics %v, expected %v", names, tt.expectedMetrics)
+			}
+		})
+	}
+}
+
+func TestFetchMetaRecordsServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var b []byte
+		if r.URL.Path == "/metrics/find/" {
+			response := protov3.MultiGlobResponse{
+				Metrics: []protov3.GlobResponse{{
+					Name:    "foo*",
+					Matches: []protov3.GlobMatch{{Path: "foo", IsLeaf: true}},
+				}},
+			}
+			b, _ = response.Marshal()
+		} else {
+			response := protov3.MultiFetchResponse{
+				Metrics: []protov3.FetchResponse{{
+					Name:           "foo",
+					PathExpression: "foo*",
+					StartTime:      0,
+					StopTime:       120,
+					StepTime:       60,
+					Values:         []float64{0, 1},
+				}},
+			}
+			b, _ = response.Marshal()
+		}
+		w.Header().Set("Content-Type", httpHeaders.ContentTypeCarbonAPIv3PB)
+		_, _ = w.Write(b)
+	}))
+	defer srv.Close()
+
+	concurrencyLimit, maxIdleConns, maxTries, maxBatchSize := 10, 10, 1, 100
+	keepAlive := 30 * time.Second
+	cfg := types.BackendV2{
+		GroupName:           "group",
+		Protocol:            "carbonapi_v3_pb",
+		LBMethod:            "rr",
+		Servers:             []string{srv.URL},
+		ConcurrencyLimit:    &concurrencyLimit,
+		MaxIdleConnsPerHost: &maxIdleConns,
+		MaxTries:            &maxTries,
+		KeepAliveInterval:   &keepAlive,
+		MaxBatchSize:        &maxBatchSize,
+	}
+	cfg.FillDefaults()
+	client, err := v3.New(logger, cfg, true)
+	if err != nil {
+		t.Fatalf("error while initializing client: %v", merry.Details(err))
+	}
+	b, err := NewBroadcastGroup(logger, "root", false, []types.BackendServer{client}, 60, 500, 100, timeouts, false)
+	if err != nil {
+		t.Fatalf("error while initializing group, when it shouldn't be: %v", merry.Details(err))
+	}
+
+	collector := &utilctx.FetchMetaCollector{}
+	ctx := utilctx.SetFetchMetaCollector(context.Background(), collector)
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo*", StartTime: 0, StopTime: 120, PathExpression: "foo*"}},
+	}
+	if _, _, err = b.Fetch(ctx, request); err != nil {
+		t.Fatalf("unexpected error '%+v'", merry.Details(err))
+	}
+
+	// server that actually answered is recorded, not the name of the group
+	got, ok := collector.Get("foo*", "foo")
+	expected := utilctx.FetchMeta{Backends: []string{srv.URL}, StepTime: 60}
+	if !ok || !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected meta: got %+v, expected %+v", got, expected)
+	}
+}
+
+func TestSplitRequestPushdown(t *testing.T) {
+	client := dummy.NewDummyClient("client1", []string{"backend1"}, 10)
+	client.AddFindResponse(
+		&protov3.MultiGlobRequest{Metrics: []string{"foo*"}},
+		&protov3.MultiGlobResponse{Metrics: []protov3.GlobResponse{{
+			Name:    "foo*",
+			Matches: []protov3.GlobMatch{{Path: "foo1", IsLeaf: true}, {Path: "foo2", IsLeaf: true}},
+		}}},
+		nil,
+		nil,
+	)
+	b, err := NewBroadcastGroup(logger, "root", false, []types.BackendServer{client}, 60, 500, 100, timeouts, false)
+	if err != nil {
+		t.Fatalf("error while initializing group, when it shouldn't be: %v", merry.Details(err))
+	}
+
+	request := &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{
+			Name:            "foo*",
+			StartTime:       0,
+			StopTime:        120,
+			PathExpression:  "foo*",
+			FilterFunctions: []*protov3.FilteringFunction{{Name: "sumSeries"}},
+		}},
+	}
+	names := func(requests []*protov3.MultiFetchRequest) []string {
+		var res []string
+		for _, r := range requests {
+			for _, m := range r.Metrics {
+				res = append(res, m.Name)
+			}
+		}
+		return res
+	}
+
+	// filtering functions alone don't prevent glob expansion
+	requests, err := b.splitRequest(context.Background(), request, client)
+	if err != nil {
+		t.Fatalf("unexpected error '%+v'", merry.Details(err))
+	}
+	if got := names(requests); !reflect.DeepEqual(got, []string{"foo1", "foo2"}) {
+		t.Errorf("glob should be expanded, got %v", got)
+	}
+
+	// pushed down expression needs all the metrics of the pattern in one request
+	requests, err = b.splitRequest(utilctx.SetPushdown(context.Background()), request, client)
+	if err != nil {
+		t.Fatalf("unexpected error '%+v'", merry.Details(err))
+	}
+	if got := names(requests); !reflect.DeepEqual(got, []string{"foo*"}) {
+		t.Errorf("glob shouldn't be expanded for pushed down request, got %v", got)
+	}
+}
@@ -31,6 +31,11 @@ type Config struct {
 	// ScaleToCommonStep controls if metrics in one target should be aggregated to common step
 	ScaleToCommonStep bool `mapstructure:"scaleToCommonStep"`
 
+	// InvalidSeries controls what happens with series in backend responses which amount of points doesn't match
+	// their time range: "log" (default) logs and passes them as is, "ignore" passes them silently, "skip" drops them,
+	// "error" fails response of the backend
+	InvalidSeries string `mapstructure:"invalidSeries"`
+
 	isSanitized bool
 }
 
@@ -80,6 +85,7 @@ func SanitizeConfig(logger *zap.Logger, oldConfig Config) *Config {
 		Timeouts:             oldConfig.Timeouts,
 		KeepAliveInterval:    oldConfig.KeepAliveInterval,
 		ScaleToCommonStep:    oldConfig.ScaleToCommonStep,
+		InvalidSeries:        oldConfig.InvalidSeries,
 	}
 
 	if newConfig.MaxBatchSize == nil {
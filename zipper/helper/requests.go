@@ -2,56 +2,155 @@ package helper
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync/atomic"
 
 	"github.com/ansel1/merry"
 	"github.com/go-graphite/carbonapi/limiter"
 	util "github.com/go-graphite/carbonapi/util/ctx"
 	"github.com/go-graphite/carbonapi/zipper/types"
+	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
 )
 
+// Content encodings of backend responses that carbonapi can decode
+const (
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+	EncodingIdentity = "identity"
+)
+
+// zstdDecoder is shared between all requests, DecodeAll is safe for concurrent use
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+// IsSupportedEncoding returns true if backend responses in the encoding can be decoded
+func IsSupportedEncoding(encoding string) bool {
+	switch encoding {
+	case EncodingGzip, EncodingZstd, EncodingIdentity:
+		return true
+	}
+	return false
+}
+
+// decodeBody decompresses response body according to it's Content-Encoding
+func decodeBody(contentEncoding string, body []byte) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(contentEncoding)) {
+	case "", EncodingIdentity:
+		return body, nil
+	case EncodingGzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case EncodingZstd:
+		return zstdDecoder.DecodeAll(body, nil)
+	}
+	return nil, types.ErrUnsupportedEncoding.WithValue("encoding", contentEncoding)
+}
+
+// TruncatedHeader is set by backends on render responses that were cut at their limit of series per query
+// (e.x. maxSeriesPerQuery), its value isn't checked
+const TruncatedHeader = "X-Carbonapi-Truncated"
+
 type ServerResponse struct {
 	Server   string
 	Response []byte
+	// Truncated is true if backend returned only part of the matched series, see TruncatedHeader
+	Truncated bool
 }
 
 type HttpQuery struct {
 	groupName string
 	servers   []string
+	schedule  []string
 	maxTries  int
 	limiter   limiter.ServerLimiter
 	client    *http.Client
 	encoding  string
+	// value of Accept-Encoding header, empty means that http.Transport negotiates gzip by itself
+	acceptEncoding string
 
 	counter uint64
 }
 
-func NewHttpQuery(groupName string, servers []string, maxTries int, limiter limiter.ServerLimiter, client *http.Client, encoding string) *HttpQuery {
+// NewHttpQuery creates HttpQuery for the group. If weights are specified, servers will be picked by smooth weighted
+// round-robin, otherwise all servers are treated as equals. acceptEncodings are compressions that backends are allowed to use for responses.
+func NewHttpQuery(groupName string, servers []string, weights []int, maxTries int, limiter limiter.ServerLimiter, client *http.Client, encoding string, acceptEncodings []string) *HttpQuery {
 	return &HttpQuery{
-		groupName: groupName,
-		servers:   servers,
-		maxTries:  maxTries,
-		limiter:   limiter,
-		client:    client,
-		encoding:  encoding,
+		groupName:      groupName,
+		servers:        servers,
+		schedule:       weightedSchedule(servers, weights),
+		maxTries:       maxTries,
+		limiter:        limiter,
+		client:         client,
+		encoding:       encoding,
+		acceptEncoding: strings.Join(acceptEncodings, ", "),
+	}
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// weightedSchedule precomputes order of servers for one full round of smooth weighted round-robin (same algorithm as nginx uses),
+// so picking a server later on is just an atomic increment.
+func weightedSchedule(servers []string, weights []int) []string {
+	if len(weights) != len(servers) {
+		return servers
 	}
+
+	div := 0
+	for _, w := range weights {
+		if w <= 0 {
+			return servers
+		}
+		div = gcd(div, w)
+	}
+
+	total := 0
+	normalized := make([]int, len(weights))
+	for i, w := range weights {
+		normalized[i] = w / div
+		total += normalized[i]
+	}
+
+	current := make([]int, len(servers))
+	schedule := make([]string, 0, total)
+	for n := 0; n < total; n++ {
+		best := 0
+		for i := range current {
+			current[i] += normalized[i]
+			if current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		schedule = append(schedule, servers[best])
+	}
+
+	return schedule
 }
 
 func (c *HttpQuery) pickServer(logger *zap.Logger) string {
-	if len(c.servers) == 1 {
+	if len(c.schedule) == 1 {
 		// No need to do heavy operations here
-		return c.servers[0]
+		return c.schedule[0]
 	}
 	logger = logger.With(zap.String("function", "picker"))
 	counter := atomic.AddUint64(&(c.counter), 1)
-	idx := counter % uint64(len(c.servers))
-	srv := c.servers[int(idx)]
+	idx := counter % uint64(len(c.schedule))
+	srv := c.schedule[int(idx)]
 	logger.Debug("picked",
 		zap.Uint64("counter", counter),
 		zap.Uint64("idx", idx),
@@ -95,6 +194,9 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server, u
 	}
 
 	req.Header.Set("Accept", c.encoding)
+	if c.acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", c.acceptEncoding)
+	}
 	req = util.MarshalPassHeaders(ctx, util.MarshalCtx(ctx, util.MarshalCtx(ctx, req, util.HeaderUUIDZipper), util.HeaderUUIDAPI))
 
 	logger.Debug("trying to get slot",
@@ -137,11 +239,20 @@ func (c *HttpQuery) doRequest(ctx context.Context, logger *zap.Logger, server, u
 		return nil, merry.Here(err).WithValue("server", server)
 	}
 
+	body, err = decodeBody(resp.Header.Get("Content-Encoding"), body)
+	if err != nil {
+		logger.Debug("error decoding body",
+			zap.String("content_encoding", resp.Header.Get("Content-Encoding")),
+			zap.Error(err),
+		)
+		return nil, merry.Here(err).WithValue("server", server)
+	}
+
 	if resp.StatusCode >= http.StatusInternalServerError {
 		return nil, types.ErrFailedToFetch.Here().WithValue("group", c.groupName).WithValue("status_code", resp.StatusCode).WithValue("body", string(body))
 	}
 
-	return &ServerResponse{Server: server, Response: body}, nil
+	return &ServerResponse{Server: server, Response: body, Truncated: resp.Header.Get(TruncatedHeader) != ""}, nil
 }
 
 func (c *HttpQuery) DoQuery(ctx context.Context, logger *zap.Logger, uri string, r types.Request) (*ServerResponse, merry.Error) {
@@ -160,6 +271,10 @@ func (c *HttpQuery) DoQuery(ctx context.Context, logger *zap.Logger, uri string,
 			)
 
 			e = e.WithCause(err)
+			if ctx.Err() != nil {
+				// request was cancelled, there is no point to try other servers
+				break
+			}
 			continue
 		}
 
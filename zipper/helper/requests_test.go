@@ -0,0 +1,193 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ansel1/merry"
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	"github.com/klauspost/compress/zstd"
+	"go.uber.org/zap"
+)
+
+func TestPickServerWeighted(t *testing.T) {
+	tests := []struct {
+		name     string
+		servers  []string
+		weights  []int
+		expected map[string]int
+	}{
+		{
+			name:     "no weights",
+			servers:  []string{"s1", "s2"},
+			expected: map[string]int{"s1": 5000, "s2": 5000},
+		},
+		{
+			name:     "1:3",
+			servers:  []string{"s1", "s2"},
+			weights:  []int{1, 3},
+			expected: map[string]int{"s1": 2500, "s2": 7500},
+		},
+		{
+			name:     "20:30:50",
+			servers:  []string{"s1", "s2", "s3"},
+			weights:  []int{20, 30, 50},
+			expected: map[string]int{"s1": 2000, "s2": 3000, "s3": 5000},
+		},
+		{
+			name:     "mismatched weights are ignored",
+			servers:  []string{"s1", "s2"},
+			weights:  []int{1},
+			expected: map[string]int{"s1": 5000, "s2": 5000},
+		},
+	}
+
+	logger := zap.NewNop()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewHttpQuery(tt.name, tt.servers, tt.weights, 1, nil, nil, "", nil)
+			got := make(map[string]int)
+			for i := 0; i < 10000; i++ {
+				got[q.pickServer(logger)]++
+			}
+
+			for srv, cnt := range tt.expected {
+				if got[srv] != cnt {
+					t.Errorf("unexpected amount of requests for %v: got %v, expected %v (all: %v)", srv, got[srv], cnt, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedScheduleIsSmooth(t *testing.T) {
+	schedule := weightedSchedule([]string{"a", "b", "c"}, []int{5, 1, 1})
+	expected := []string{"a", "a", "b", "a", "c", "a", "a"}
+	if len(schedule) != len(expected) {
+		t.Fatalf("unexpected schedule length: got %v, expected %v", schedule, expected)
+	}
+	for i := range expected {
+		if schedule[i] != expected[i] {
+			t.Fatalf("unexpected schedule: got %v, expected %v", schedule, expected)
+		}
+	}
+}
+
+const encodingTestPayload = "carbonapi_v3_pb response body"
+
+func compress(t *testing.T, encoding string, data []byte) []byte {
+	var buf bytes.Buffer
+	switch encoding {
+	case EncodingGzip:
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(data)
+		_ = w.Close()
+	case EncodingZstd:
+		w, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write(data)
+		_ = w.Close()
+	default:
+		buf.Write(data)
+	}
+	return buf.Bytes()
+}
+
+func TestDoQueryContentEncoding(t *testing.T) {
+	tests := []struct {
+		name            string
+		acceptEncodings []string
+		contentEncoding string
+		expectedAccept  string
+		expectedErr     merry.Error
+	}{
+		{
+			name:            "zstd",
+			acceptEncodings: []string{"zstd", "gzip"},
+			contentEncoding: EncodingZstd,
+			expectedAccept:  "zstd, gzip",
+		},
+		{
+			name:            "gzip",
+			acceptEncodings: []string{"zstd", "gzip"},
+			contentEncoding: EncodingGzip,
+			expectedAccept:  "zstd, gzip",
+		},
+		{
+			name:            "identity",
+			acceptEncodings: []string{"identity"},
+			expectedAccept:  "identity",
+		},
+		{
+			name:            "unsupported",
+			acceptEncodings: []string{"zstd"},
+			contentEncoding: "br",
+			expectedAccept:  "zstd",
+			expectedErr:     types.ErrUnsupportedEncoding,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var accept string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				accept = r.Header.Get("Accept-Encoding")
+				if tt.contentEncoding != "" {
+					w.Header().Set("Content-Encoding", tt.contentEncoding)
+				}
+				_, _ = w.Write(compress(t, tt.contentEncoding, []byte(encodingTestPayload)))
+			}))
+			defer srv.Close()
+
+			servers := []string{srv.URL}
+			q := NewHttpQuery(tt.name, servers, nil, 1, limiter.NewServerLimiter(servers, 1), srv.Client(), "", tt.acceptEncodings)
+			res, err := q.DoQuery(context.Background(), zap.NewNop(), "/render/", nil)
+
+			if accept != tt.expectedAccept {
+				t.Errorf("unexpected Accept-Encoding: got %q, expected %q", accept, tt.expectedAccept)
+			}
+			if tt.expectedErr != nil {
+				if !merry.Is(err, tt.expectedErr) {
+					t.Fatalf("unexpected error: got %v, expected %v", err, tt.expectedErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(res.Response) != encodingTestPayload {
+				t.Errorf("unexpected response: got %q, expected %q", res.Response, encodingTestPayload)
+			}
+		})
+	}
+}
+
+func TestDoQueryTruncated(t *testing.T) {
+	for _, truncated := range []bool{true, false} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if truncated {
+				w.Header().Set(TruncatedHeader, "1000")
+			}
+			_, _ = w.Write([]byte(encodingTestPayload))
+		}))
+
+		servers := []string{srv.URL}
+		q := NewHttpQuery("truncated", servers, nil, 1, limiter.NewServerLimiter(servers, 1), srv.Client(), "", nil)
+		res, err := q.DoQuery(context.Background(), zap.NewNop(), "/render/", nil)
+		srv.Close()
+
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if res.Truncated != truncated {
+			t.Errorf("unexpected Truncated: got %v, expected %v", res.Truncated, truncated)
+		}
+	}
+}
@@ -6,4 +6,5 @@ const (
 	ContentTypePickle        = "application/pickle"
 	ContentTypeCarbonAPIv3PB = "application/x-carbonapi-v3-pb"
 	ContentTypeCarbonAPIv2PB = "application/x-protobuf"
+	ContentTypeMsgPack       = "application/x-msgpack"
 )
@@ -13,12 +13,14 @@ import (
 type md struct {
 	sync.RWMutex
 	SupportedProtocols       map[string]struct{}
+	MultiPatternFind         map[string]struct{}
 	ProtocolInits            map[string]func(*zap.Logger, types.BackendV2, bool) (types.BackendServer, merry.Error)
 	ProtocolInitsWithLimiter map[string]func(*zap.Logger, types.BackendV2, bool, limiter.ServerLimiter) (types.BackendServer, merry.Error)
 }
 
 var Metadata = md{
 	SupportedProtocols:       make(map[string]struct{}),
+	MultiPatternFind:         make(map[string]struct{}),
 	ProtocolInits:            make(map[string]func(*zap.Logger, types.BackendV2, bool) (types.BackendServer, merry.Error)),
 	ProtocolInitsWithLimiter: make(map[string]func(*zap.Logger, types.BackendV2, bool, limiter.ServerLimiter) (types.BackendServer, merry.Error)),
 }
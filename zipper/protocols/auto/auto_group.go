@@ -36,7 +36,7 @@ type capabilityResponse struct {
 
 //_internal/capabilities/
 func doQuery(ctx context.Context, logger *zap.Logger, groupName string, httpClient *http.Client, limiter limiter.ServerLimiter, server string, request types.Request, resChan chan<- capabilityResponse) {
-	httpQuery := helper.NewHttpQuery(groupName, []string{server}, 1, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB)
+	httpQuery := helper.NewHttpQuery(groupName, []string{server}, nil, 1, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB, nil)
 	rewrite, _ := url.Parse("http://127.0.0.1/_internal/capabilities/")
 
 	res, e := httpQuery.DoQuery(ctx, logger, rewrite.RequestURI(), request)
@@ -70,7 +70,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 		},
 	}
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, config.Weights, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeMsgPack, config.AcceptEncodings)
 
 	c := &GraphiteGroup{
 		groupName:            config.GroupName,
@@ -113,6 +113,25 @@ func (c GraphiteGroup) Backends() []string {
 	return c.servers
 }
 
+// msgpackValue converts decoded msgpack value to float64. Encoders are free to pack whole numbers as integers,
+// nil (and anything unexpected) is treated as absent value
+func msgpackValue(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case int:
+		return float64(v)
+	default:
+		return math.NaN()
+	}
+}
+
 func (c *GraphiteGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRequest) (*protov3.MultiFetchResponse, *types.Stats, merry.Error) {
 	logger := c.logger.With(zap.String("type", "fetch"), zap.String("request", request.String()))
 	stats := &types.Stats{}
@@ -161,15 +180,12 @@ func (c *GraphiteGroup) Fetch(ctx context.Context, request *protov3.MultiFetchRe
 			}
 			continue
 		}
+		stats.Servers = append(stats.Servers, res.Server)
 
 		for _, m := range metrics {
 			vals := make([]float64, len(m.Values))
 			for i, vIface := range m.Values {
-				if v, ok := vIface.(float64); ok {
-					vals[i] = v
-				} else {
-					vals[i] = math.NaN()
-				}
+				vals[i] = msgpackValue(vIface)
 			}
 			r.Metrics = append(r.Metrics, protov3.FetchResponse{
 				Name:              m.Name,
@@ -0,0 +1,95 @@
+package graphite
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
+	"github.com/go-graphite/carbonapi/zipper/protocols/graphite/msgpack"
+	"github.com/go-graphite/carbonapi/zipper/types"
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+
+	"go.uber.org/zap"
+)
+
+func TestFetchMsgPack(t *testing.T) {
+	response := msgpack.MultiGraphiteFetchResponse{
+		{
+			Start:          1510913280,
+			End:            1510913460,
+			Step:           60,
+			Name:           "foo.bar",
+			PathExpression: "foo.*",
+			Values:         []interface{}{1.5, int64(2), nil, uint64(3)},
+		},
+	}
+	body, err := response.MarshalMsg(nil)
+	if err != nil {
+		t.Fatalf("failed to marshal response: %v", err)
+	}
+
+	var accept, format string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		format = r.FormValue("format")
+		w.Header().Set("Content-Type", httpHeaders.ContentTypeMsgPack)
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	concurrencyLimit := 0
+	maxTries := 1
+	maxBatchSize := 0
+	maxIdleConnsPerHost := 1
+	keepAliveInterval := time.Second
+	backend, merr := New(zap.NewNop(), types.BackendV2{
+		GroupName:           "msgpack",
+		Protocol:            "msgpack",
+		Servers:             []string{srv.URL},
+		Timeouts:            &types.Timeouts{Find: time.Second, Render: time.Second, Connect: time.Second},
+		ConcurrencyLimit:    &concurrencyLimit,
+		MaxTries:            &maxTries,
+		MaxBatchSize:        &maxBatchSize,
+		MaxIdleConnsPerHost: &maxIdleConnsPerHost,
+		KeepAliveInterval:   &keepAliveInterval,
+	}, false)
+	if merr != nil {
+		t.Fatalf("failed to create backend: %v", merr)
+	}
+
+	res, _, merr := backend.Fetch(context.Background(), &protov3.MultiFetchRequest{
+		Metrics: []protov3.FetchRequest{{Name: "foo.*", PathExpression: "foo.*", StartTime: 1510913280, StopTime: 1510913460}},
+	})
+	if merr != nil {
+		t.Fatalf("unexpected error: %v", merr)
+	}
+
+	if accept != httpHeaders.ContentTypeMsgPack {
+		t.Errorf("unexpected Accept header: got %q, expected %q", accept, httpHeaders.ContentTypeMsgPack)
+	}
+	if format != "msgpack" {
+		t.Errorf("unexpected format: got %q, expected %q", format, "msgpack")
+	}
+
+	if len(res.Metrics) != 1 {
+		t.Fatalf("unexpected amount of metrics: got %v, expected 1", len(res.Metrics))
+	}
+	m := res.Metrics[0]
+	if m.Name != "foo.bar" || m.PathExpression != "foo.*" || m.StartTime != 1510913280 || m.StopTime != 1510913460 || m.StepTime != 60 {
+		t.Errorf("unexpected metric: %+v", m)
+	}
+	expected := []float64{1.5, 2, math.NaN(), 3}
+	if len(m.Values) != len(expected) {
+		t.Fatalf("unexpected values: got %v, expected %v", m.Values, expected)
+	}
+	for i := range expected {
+		if m.Values[i] != expected[i] && !(math.IsNaN(m.Values[i]) && math.IsNaN(expected[i])) {
+			t.Errorf("unexpected values: got %v, expected %v", m.Values, expected)
+			break
+		}
+	}
+}
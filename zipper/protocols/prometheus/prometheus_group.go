@@ -158,7 +158,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 	}
 
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, config.Weights, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB, config.AcceptEncodings)
 
 	return NewWithEverythingInitialized(logger, config, tldCacheDisabled, limiter, step, maxPointsPerQuery, delay, httpQuery, httpClient)
 }
@@ -323,6 +323,7 @@ func (c *PrometheusGroup) Fetch(ctx context.Context, request *protov3.MultiFetch
 				}
 				continue
 			}
+			stats.Servers = append(stats.Servers, res.Server)
 
 			for _, m := range response.Data.Result {
 				// We always should trust backend's response (to mimic behavior of graphite for grahpite native protoocols)
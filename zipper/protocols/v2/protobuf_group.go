@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/ansel1/merry"
 
@@ -73,7 +74,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 	}
 
 	httpLimiter := limiter.NewServerLimiter(config.Servers, *config.ConcurrencyLimit)
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, httpLimiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, config.Weights, *config.MaxTries, httpLimiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB, config.AcceptEncodings)
 
 	c := &ClientProtoV2Group{
 		groupName:            config.GroupName,
@@ -175,6 +176,11 @@ func (c *ClientProtoV2Group) Fetch(ctx context.Context, request *protov3.MultiFe
 			continue
 		}
 
+		stats.Servers = append(stats.Servers, res.Server)
+		if res.Truncated && strings.HasPrefix(batch.pathExpression, "seriesByTag") {
+			stats.TruncatedTargets = append(stats.TruncatedTargets, batch.pathExpression)
+		}
+
 		for _, m := range metrics.Metrics {
 			for i, v := range m.IsAbsent {
 				if v {
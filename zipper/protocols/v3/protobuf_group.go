@@ -6,6 +6,7 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/ansel1/merry"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
@@ -27,6 +28,7 @@ func init() {
 	metadata.Metadata.Lock()
 	for _, name := range aliases {
 		metadata.Metadata.SupportedProtocols[name] = struct{}{}
+		metadata.Metadata.MultiPatternFind[name] = struct{}{}
 		metadata.Metadata.ProtocolInits[name] = New
 		metadata.Metadata.ProtocolInitsWithLimiter[name] = NewWithLimiter
 	}
@@ -80,7 +82,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 
 	logger = logger.With(zap.String("type", "protoV3Group"), zap.String("name", config.GroupName))
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, config.Weights, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv3PB, config.AcceptEncodings)
 
 	c := &ClientProtoV3Group{
 		groupName:            config.GroupName,
@@ -143,6 +145,15 @@ func (c *ClientProtoV3Group) Fetch(ctx context.Context, request *protov3.MultiFe
 		stats.RenderErrors += 1
 		return nil, stats, merry.Wrap(err)
 	}
+	stats.Servers = append(stats.Servers, res.Server)
+
+	if res.Truncated {
+		for _, m := range request.Metrics {
+			if strings.HasPrefix(m.PathExpression, "seriesByTag") {
+				stats.TruncatedTargets = append(stats.TruncatedTargets, m.PathExpression)
+			}
+		}
+	}
 
 	return &r, stats, nil
 }
@@ -0,0 +1,75 @@
+package v3
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+	"go.uber.org/zap"
+
+	"github.com/go-graphite/carbonapi/limiter"
+	"github.com/go-graphite/carbonapi/zipper/helper"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
+)
+
+func TestFetchTruncated(t *testing.T) {
+	tests := []struct {
+		name      string
+		truncated bool
+		expected  []string
+	}{
+		{
+			name:      "truncated",
+			truncated: true,
+			expected:  []string{"seriesByTag('name=a')"},
+		},
+		{
+			name: "complete",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := protov3.MultiFetchResponse{Metrics: []protov3.FetchResponse{
+				{Name: "a;env=prod", PathExpression: "seriesByTag('name=a')", StepTime: 1, Values: []float64{1}},
+			}}
+			body, err := response.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.truncated {
+					w.Header().Set(helper.TruncatedHeader, "1")
+				}
+				_, _ = w.Write(body)
+			}))
+			defer srv.Close()
+
+			servers := []string{srv.URL}
+			c := &ClientProtoV3Group{
+				groupName: tt.name,
+				servers:   servers,
+				logger:    zap.NewNop(),
+				httpQuery: helper.NewHttpQuery(tt.name, servers, nil, 1, limiter.NewServerLimiter(servers, 1), srv.Client(), httpHeaders.ContentTypeCarbonAPIv3PB, nil),
+			}
+
+			res, stats, err := c.Fetch(context.Background(), &protov3.MultiFetchRequest{Metrics: []protov3.FetchRequest{
+				{Name: "seriesByTag('name=a')", PathExpression: "seriesByTag('name=a')", StartTime: 1, StopTime: 2},
+				{Name: "b.c", PathExpression: "b.c", StartTime: 1, StopTime: 2},
+			}})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(res.Metrics) != 1 {
+				t.Errorf("unexpected amount of metrics: %v", len(res.Metrics))
+			}
+			if !reflect.DeepEqual(stats.TruncatedTargets, tt.expected) {
+				t.Errorf("unexpected truncated targets: got %v, expected %v", stats.TruncatedTargets, tt.expected)
+			}
+		})
+	}
+}
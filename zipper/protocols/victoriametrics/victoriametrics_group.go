@@ -182,7 +182,7 @@ func NewWithLimiter(logger *zap.Logger, config types.BackendV2, tldCacheDisabled
 		}
 	}
 
-	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB)
+	httpQuery := helper.NewHttpQuery(config.GroupName, config.Servers, config.Weights, *config.MaxTries, limiter, httpClient, httpHeaders.ContentTypeCarbonAPIv2PB, config.AcceptEncodings)
 
 	c := &VictoriaMetricsGroup{
 		groupName:            config.GroupName,
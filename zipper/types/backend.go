@@ -19,6 +19,7 @@ type BackendV2 struct {
 	Protocol                  string                 `mapstructure:"protocol"`
 	LBMethod                  string                 `mapstructure:"lbMethod"` // Valid: rr/roundrobin, broadcast/all
 	Servers                   []string               `mapstructure:"servers"`
+	Weights                   []int                  `mapstructure:"weights"` // Optional, only for rr/roundrobin. Same order as Servers
 	Timeouts                  *Timeouts              `mapstructure:"timeouts"`
 	ConcurrencyLimit          *int                   `mapstructure:"concurrencyLimit"`
 	KeepAliveInterval         *time.Duration         `mapstructure:"keepAliveInterval"`
@@ -28,6 +29,8 @@ type BackendV2 struct {
 	BackendOptions            map[string]interface{} `mapstructure:"backendOptions"`
 	ForceAttemptHTTP2         bool                   `mapstructure:"forceAttemptHTTP2"`
 	DoMultipleRequestsIfSplit bool                   `mapstructure:"doMultipleRequestsIfSplit"`
+	FindBatchWindow           time.Duration          `mapstructure:"findBatchWindow"` // Optional, 0 - disabled. Only for protocols that support multiple patterns in find request
+	AcceptEncodings           []string               `mapstructure:"acceptEncodings"` // Optional, compressions backend is allowed to use for responses: gzip, zstd, identity. Empty - gzip, negotiated by http client
 }
 
 func (b *BackendV2) FillDefaults() {
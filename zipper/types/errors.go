@@ -14,6 +14,7 @@ var ErrResponseStepTimeMismatch = merry.New("response step time mismatch")
 var ErrNotImplementedYet = merry.New("this feature is not implemented yet")
 var ErrNotSupportedByBackend = merry.New("this feature is not supported by backend")
 var ErrTimeoutExceeded = merry.New("timeout while fetching Response")
+var ErrRequestCancelled = merry.New("request was cancelled")
 var ErrNonFatalErrors = merry.New("response contains non-fatal errors")
 var ErrNotFound = merry.New("metric not found")
 var ErrNoResponseFetched = merry.New("no responses fetched from upstream")
@@ -23,8 +24,13 @@ var ErrFailedToFetch = merry.New("failed to fetch data from server/group")
 var ErrNoRequests = merry.New("no requests to fetch")
 var ErrNoTagSpecified = merry.New("no tag specified")
 var ErrNoServersSpecified = merry.New("no servers specified")
+var ErrWeightsMismatch = merry.New("amount of weights doesn't match amount of servers")
+var ErrInvalidWeight = merry.New("weight must be positive")
 var ErrConcurrencyLimitNotSet = merry.New("concurrency limit is not set")
 var ErrUnmarshalFailed = merry.New("unmarshal failed")
+var ErrUnsupportedEncoding = merry.New("unsupported content encoding")
+var ErrInvalidSeries = merry.New("amount of points doesn't match time range of series")
+var ErrSeriesTruncated = merry.New("series were truncated by backend limit")
 
 func ReturnNonNotFoundError(errors []merry.Error) []merry.Error {
 	var errList []merry.Error
@@ -25,6 +25,8 @@ type Stats struct {
 
 	Servers       []string
 	FailedServers []string
+	// TruncatedTargets are seriesByTag expressions that matched more series than backends are allowed to return
+	TruncatedTargets []string
 }
 
 func (s *Stats) Merge(stats *Stats) {
@@ -47,4 +49,5 @@ func (s *Stats) Merge(stats *Stats) {
 
 	s.Servers = append(s.Servers, stats.Servers...)
 	s.FailedServers = append(s.FailedServers, stats.FailedServers...)
+	s.TruncatedTargets = append(s.TruncatedTargets, stats.TruncatedTargets...)
 }
@@ -0,0 +1,68 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ansel1/merry"
+
+	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
+)
+
+var ErrUnknownInvalidSeriesActionFmt = "unknown invalid series action: '%v', supported: %v"
+
+// InvalidSeriesAction controls what happens with series in backend response which amount of points doesn't match
+// their time range
+type InvalidSeriesAction int
+
+const (
+	// LogInvalidSeries logs invalid series and passes them as is
+	LogInvalidSeries InvalidSeriesAction = iota
+	// IgnoreInvalidSeries passes invalid series as is silently
+	IgnoreInvalidSeries
+	// SkipInvalidSeries drops invalid series from the response and logs them
+	SkipInvalidSeries
+	// FailInvalidSeries treats whole backend response as failed if it contains invalid series
+	FailInvalidSeries
+)
+
+var supportedInvalidSeriesActions = map[string]InvalidSeriesAction{
+	"":       LogInvalidSeries,
+	"log":    LogInvalidSeries,
+	"skip":   SkipInvalidSeries,
+	"error":  FailInvalidSeries,
+	"ignore": IgnoreInvalidSeries,
+}
+
+func (a *InvalidSeriesAction) FromString(action string) error {
+	var ok bool
+	if *a, ok = supportedInvalidSeriesActions[strings.ToLower(action)]; !ok {
+		res := make([]string, 0, len(supportedInvalidSeriesActions))
+		for k := range supportedInvalidSeriesActions {
+			if k != "" {
+				res = append(res, k)
+			}
+		}
+		sort.Strings(res)
+		return fmt.Errorf(ErrUnknownInvalidSeriesActionFmt, action, res)
+	}
+	return nil
+}
+
+// ValidateFetchResponse checks that amount of points in the series matches (StopTime - StartTime) / StepTime.
+// One extra point is allowed, as some backends (e.x. prometheus) report time of the last point as StopTime.
+func ValidateFetchResponse(m *protov3.FetchResponse) merry.Error {
+	if m.StepTime <= 0 || m.StopTime < m.StartTime {
+		return ErrInvalidSeries.WithValue("name", m.Name).Appendf("%v: invalid time range: start %v, stop %v, step %v",
+			m.Name, m.StartTime, m.StopTime, m.StepTime)
+	}
+
+	expected := (m.StopTime - m.StartTime) / m.StepTime
+	if n := int64(len(m.Values)); n != expected && n != expected+1 {
+		return ErrInvalidSeries.WithValue("name", m.Name).Appendf("%v: got %v points, expected %v for start %v, stop %v, step %v",
+			m.Name, n, expected, m.StartTime, m.StopTime, m.StepTime)
+	}
+
+	return nil
+}
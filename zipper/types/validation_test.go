@@ -0,0 +1,34 @@
+package types
+
+import (
+	"testing"
+)
+
+func TestInvalidSeriesActionFromString(t *testing.T) {
+	tests := []struct {
+		action   string
+		expected InvalidSeriesAction
+	}{
+		{"", LogInvalidSeries},
+		{"log", LogInvalidSeries},
+		{"ignore", IgnoreInvalidSeries},
+		{"Skip", SkipInvalidSeries},
+		{"error", FailInvalidSeries},
+	}
+
+	for _, tt := range tests {
+		var a InvalidSeriesAction
+		if err := a.FromString(tt.action); err != nil {
+			t.Errorf("unexpected error for %q: %v", tt.action, err)
+		} else if a != tt.expected {
+			t.Errorf("unexpected action for %q: got %v, expected %v", tt.action, a, tt.expected)
+		}
+	}
+
+	var a InvalidSeriesAction
+	err := a.FromString("drop")
+	expected := "unknown invalid series action: 'drop', supported: [error ignore log skip]"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: got %v, expected %v", err, expected)
+	}
+}
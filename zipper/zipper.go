@@ -10,8 +10,10 @@ import (
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
 	"go.uber.org/zap"
 
+	"github.com/go-graphite/carbonapi/zipper/batcher"
 	"github.com/go-graphite/carbonapi/zipper/broadcast"
 	"github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/helper"
 	"github.com/go-graphite/carbonapi/zipper/metadata"
 	"github.com/go-graphite/carbonapi/zipper/types"
 
@@ -48,7 +50,7 @@ type Zipper struct {
 	logger *zap.Logger
 }
 
-func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelaySec int32, tldCacheDisabled bool) ([]types.BackendServer, merry.Error) {
+func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelaySec int32, tldCacheDisabled bool, invalidSeries types.InvalidSeriesAction) ([]types.BackendServer, merry.Error) {
 	storeClients := make([]types.BackendServer, 0)
 	var e merry.Error
 	timeouts := backends.Timeouts
@@ -111,6 +113,29 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 				zap.Error(err),
 			)
 		}
+		if len(backend.Weights) > 0 {
+			if lbMethod != types.RoundRobinLB {
+				logger.Warn("weights are only used by roundrobin lbMethod and will be ignored",
+					zap.String("name", backend.GroupName),
+					zap.String("lbMethod", backend.LBMethod),
+				)
+				backend.Weights = nil
+			} else if len(backend.Weights) != len(backend.Servers) {
+				return nil, types.ErrWeightsMismatch.WithValue("group", backend.GroupName)
+			}
+			for _, w := range backend.Weights {
+				if w <= 0 {
+					return nil, types.ErrInvalidWeight.WithValue("group", backend.GroupName).WithValue("weight", w)
+				}
+			}
+		}
+
+		for _, encoding := range backend.AcceptEncodings {
+			if !helper.IsSupportedEncoding(encoding) {
+				return nil, types.ErrUnsupportedEncoding.WithValue("group", backend.GroupName).WithValue("encoding", encoding)
+			}
+		}
+
 		if lbMethod == types.RoundRobinLB {
 			client, e = backendInit(logger, backend, tldCacheDisabled)
 			if e != nil {
@@ -130,10 +155,26 @@ func createBackendsV2(logger *zap.Logger, backends types.BackendsV2, expireDelay
 				backends = append(backends, client)
 			}
 
-			client, e = broadcast.NewBroadcastGroup(logger, backend.GroupName, backend.DoMultipleRequestsIfSplit, backends, expireDelaySec, *backend.ConcurrencyLimit, *backend.MaxBatchSize, timeouts, tldCacheDisabled)
+			group, e := broadcast.NewBroadcastGroup(logger, backend.GroupName, backend.DoMultipleRequestsIfSplit, backends, expireDelaySec, *backend.ConcurrencyLimit, *backend.MaxBatchSize, timeouts, tldCacheDisabled)
 			if e != nil {
 				return nil, e
 			}
+			group.SetInvalidSeriesAction(invalidSeries)
+			client = group
+		}
+
+		if backend.FindBatchWindow > 0 {
+			metadata.Metadata.RLock()
+			_, multiPatternFind := metadata.Metadata.MultiPatternFind[backend.Protocol]
+			metadata.Metadata.RUnlock()
+			if multiPatternFind {
+				client = batcher.NewFindBatcher(logger, client, backend.FindBatchWindow, backend.Timeouts.Find)
+			} else {
+				logger.Warn("protocol doesn't support multiple patterns in find request, findBatchWindow will be ignored",
+					zap.String("name", backend.GroupName),
+					zap.String("protocol", backend.Protocol),
+				)
+			}
 		}
 		storeClients = append(storeClients, client)
 	}
@@ -149,38 +190,46 @@ func NewZipper(sender func(*types.Stats), cfg *config.Config, logger *zap.Logger
 	var searchBackends types.BackendServer
 	var prefix string
 
+	var invalidSeries types.InvalidSeriesAction
+	if err := invalidSeries.FromString(cfg.InvalidSeries); err != nil {
+		return nil, merry.Wrap(err)
+	}
+
 	if len(cfg.CarbonSearchV2.BackendsV2.Backends) > 0 {
 		logger.Warn("Carbonsearch support is considered to be deprecated in November 2020, please comment on https://github.com/go-graphite/carbonapi/issues/449 if you still need it")
 		prefix = cfg.CarbonSearchV2.Prefix
-		searchClients, err := createBackendsV2(logger, cfg.CarbonSearchV2.BackendsV2, int32(cfg.InternalRoutingCache.Seconds()), cfg.TLDCacheDisabled)
+		searchClients, err := createBackendsV2(logger, cfg.CarbonSearchV2.BackendsV2, int32(cfg.InternalRoutingCache.Seconds()), cfg.TLDCacheDisabled, invalidSeries)
 		if err != nil {
 			logger.Fatal("merry.Errors while initialing zipper search backends",
 				zap.Any("merry.Errors", err),
 			)
 		}
 
-		searchBackends, err = broadcast.NewBroadcastGroup(logger, "search", true, searchClients, int32(cfg.InternalRoutingCache.Seconds()), cfg.ConcurrencyLimitPerServer, *cfg.MaxBatchSize, cfg.Timeouts, cfg.TLDCacheDisabled)
+		searchGroup, err := broadcast.NewBroadcastGroup(logger, "search", true, searchClients, int32(cfg.InternalRoutingCache.Seconds()), cfg.ConcurrencyLimitPerServer, *cfg.MaxBatchSize, cfg.Timeouts, cfg.TLDCacheDisabled)
 		if err != nil {
 			logger.Fatal("merry.Errors while initialing zipper search backends",
 				zap.Any("merry.Errors", err),
 			)
 		}
+		searchGroup.SetInvalidSeriesAction(invalidSeries)
+		searchBackends = searchGroup
 	}
 
-	storeClients, err := createBackendsV2(logger, cfg.BackendsV2, int32(cfg.InternalRoutingCache.Seconds()), cfg.TLDCacheDisabled)
+	storeClients, err := createBackendsV2(logger, cfg.BackendsV2, int32(cfg.InternalRoutingCache.Seconds()), cfg.TLDCacheDisabled, invalidSeries)
 	if err != nil {
 		logger.Fatal("merry.Errors while initialing zipper store backends",
 			zap.Any("merry.Errors", err),
 		)
 	}
 
-	var storeBackends types.BackendServer
-	storeBackends, err = broadcast.NewBroadcastGroup(logger, "root", cfg.DoMultipleRequestsIfSplit, storeClients, int32(cfg.InternalRoutingCache.Seconds()), cfg.ConcurrencyLimitPerServer, *cfg.MaxBatchSize, cfg.Timeouts, cfg.TLDCacheDisabled)
+	storeGroup, err := broadcast.NewBroadcastGroup(logger, "root", cfg.DoMultipleRequestsIfSplit, storeClients, int32(cfg.InternalRoutingCache.Seconds()), cfg.ConcurrencyLimitPerServer, *cfg.MaxBatchSize, cfg.Timeouts, cfg.TLDCacheDisabled)
 	if err != nil {
 		logger.Fatal("merry.Errors while initialing zipper store backends",
 			zap.Any("merry.Errors", err),
 		)
 	}
+	storeGroup.SetInvalidSeriesAction(invalidSeries)
+	var storeBackends types.BackendServer = storeGroup
 
 	z := &Zipper{
 		ProbeQuit:  make(chan struct{}),
@@ -230,6 +279,31 @@ func (z *Zipper) doProbe(logger *zap.Logger) {
 	}
 }
 
+// ProbeBackends probes each of the backend groups and returns probe error (nil if group is reachable) per group name
+func (z *Zipper) ProbeBackends(ctx context.Context) map[string]merry.Error {
+	type probeResult struct {
+		name string
+		err  merry.Error
+	}
+
+	backends := z.storeBackends.Children()
+	resCh := make(chan probeResult, len(backends))
+	for _, backend := range backends {
+		go func(backend types.BackendServer) {
+			_, err := backend.ProbeTLDs(ctx)
+			resCh <- probeResult{name: backend.Name(), err: err}
+		}(backend)
+	}
+
+	res := make(map[string]merry.Error, len(backends))
+	for range backends {
+		r := <-resCh
+		res[r.name] = r.err
+	}
+
+	return res
+}
+
 func (z *Zipper) probeTlds() {
 	logger := z.logger.With(zap.String("type", "probe"))
 	for {
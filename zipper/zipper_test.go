@@ -1,12 +1,19 @@
 package zipper
 
 import (
+	"context"
 	"fmt"
 	"math"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ansel1/merry"
+	"go.uber.org/zap"
 
+	"github.com/go-graphite/carbonapi/zipper/config"
+	"github.com/go-graphite/carbonapi/zipper/httpHeaders"
 	"github.com/go-graphite/carbonapi/zipper/types"
 	protov3 "github.com/go-graphite/protocol/carbonapi_v3_pb"
 )
@@ -209,3 +216,49 @@ func TestMergeValues(t *testing.T) {
 		})
 	}
 }
+
+func TestProbeBackends(t *testing.T) {
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response := protov3.MultiGlobResponse{
+			Metrics: []protov3.GlobResponse{{
+				Name:    "*",
+				Matches: []protov3.GlobMatch{{Path: "a", IsLeaf: false}},
+			}},
+		}
+		b, _ := response.Marshal()
+		w.Header().Set("Content-Type", httpHeaders.ContentTypeCarbonAPIv3PB)
+		_, _ = w.Write(b)
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	maxBatchSize := 100
+	cfg := &config.Config{
+		MaxBatchSize:     &maxBatchSize,
+		TLDCacheDisabled: true,
+		BackendsV2: types.BackendsV2{
+			Backends: []types.BackendV2{
+				{GroupName: "up", Protocol: "carbonapi_v3_pb", LBMethod: "broadcast", Servers: []string{up.URL}},
+				{GroupName: "down", Protocol: "carbonapi_v3_pb", LBMethod: "broadcast", Servers: []string{down.URL}},
+			},
+		},
+	}
+	z, err := NewZipper(func(*types.Stats) {}, cfg, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res := z.ProbeBackends(ctx)
+	if len(res) != 2 {
+		t.Fatalf("expected probes of 2 groups, got %v", res)
+	}
+	if err, ok := res["up"]; !ok || err != nil {
+		t.Errorf("group 'up' should be reachable, got %v", err)
+	}
+	if err, ok := res["down"]; !ok || err == nil {
+		t.Errorf("group 'down' should be unreachable")
+	}
+}